@@ -32,6 +32,8 @@ func NewHandler() http.Handler {
 	router.GET("/v1/status", HandleGetStatus)
 	router.PATCH("/v1/status", HandlePatchStatus)
 
+	router.GET("/v1/snapshot", HandleGetSnapshot)
+
 	router.GET("/v1/metrics", HandleGetMetrics)
 	router.GET("/v1/metrics/:id", HandleGetMetric)
 
@@ -0,0 +1,66 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+type Snapshot struct {
+	AtTime     float64 `json:"at-time"`
+	VUs        int64   `json:"vus"`
+	VUsMax     int64   `json:"vus-max"`
+	Iterations int64   `json:"iterations"`
+	Errors     int64   `json:"errors"`
+	ErrorRate  float64 `json:"error-rate"`
+
+	Requests           float64 `json:"requests"`
+	RequestsPerSecond  float64 `json:"requests-per-second"`
+	RequestDurationP95 float64 `json:"request-duration-p95"`
+}
+
+func NewSnapshot(engine *lib.Engine) Snapshot {
+	s := engine.Snapshot()
+	return Snapshot{
+		AtTime:             stats.D(s.AtTime),
+		VUs:                s.VUs,
+		VUsMax:             s.VUsMax,
+		Iterations:         s.Iterations,
+		Errors:             s.Errors,
+		ErrorRate:          s.ErrorRate,
+		Requests:           s.Requests,
+		RequestsPerSecond:  s.RequestsPerSecond,
+		RequestDurationP95: s.RequestDurationP95,
+	}
+}
+
+func (s Snapshot) GetName() string {
+	return "snapshot"
+}
+
+func (s Snapshot) GetID() string {
+	return "default"
+}
+
+func (s Snapshot) SetID(id string) error {
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestGetSnapshot(t *testing.T) {
+	engine, err := lib.NewEngine(nil, lib.Options{VUsMax: null.IntFrom(10), VUs: null.IntFrom(5)})
+	assert.NoError(t, err)
+
+	rw := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "GET", "/v1/snapshot", nil))
+	res := rw.Result()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	t.Run("document", func(t *testing.T) {
+		var doc jsonapi.Document
+		assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &doc))
+		if !assert.NotNil(t, doc.Data.DataObject) {
+			return
+		}
+		assert.Equal(t, "snapshot", doc.Data.DataObject.Type)
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		var snapshot Snapshot
+		assert.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &snapshot))
+		assert.Equal(t, int64(5), snapshot.VUs)
+		assert.Equal(t, int64(10), snapshot.VUsMax)
+		assert.Equal(t, 0.0, snapshot.RequestsPerSecond)
+	})
+}
@@ -20,7 +20,7 @@ func BenchmarkJSRunners(b *testing.B) {
 					r, err := makeRunner(t, &lib.SourceData{
 						Filename: "/script.js",
 						Data:     []byte(script),
-					}, afero.NewMemMapFs())
+					}, afero.NewMemMapFs(), "")
 					if err != nil {
 						b.Error(err)
 						return
@@ -0,0 +1,162 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package embed runs tests from Go programs, eg. an orchestration service, without going through
+// the CLI. A test is made from a Runner, usually a script's:
+//
+//	runner, err := embed.NewRunner("script.js", []byte(src), afero.NewMemMapFs())
+//	test := embed.NewTest(runner, lib.Options{VUs: null.IntFrom(10), Duration: null.StringFrom("30s")})
+//	test.Logger = logger
+//	go func() {
+//		for p := range test.Progress() {
+//			fmt.Println(p.AtTime, p.VUs, p.RequestsPerSecond)
+//		}
+//	}()
+//	result, err := test.Run(ctx)
+//
+// Options are layered the same way as on the CLI: the script's own options come first, and the
+// ones given here override them. Nothing is printed, and log output goes to Test.Logger.
+package embed
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/js"
+	"github.com/loadimpact/k6/lib"
+	"github.com/spf13/afero"
+)
+
+// How often progress updates are sent, unless Test.ProgressInterval says otherwise.
+const DefaultProgressInterval = 1 * time.Second
+
+// Makes a runner for a script; filename is used to resolve its imports and in error messages.
+func NewRunner(filename string, data []byte, fs afero.Fs) (*js.Runner, error) {
+	return js.New(&lib.SourceData{Filename: filename, Data: data}, fs)
+}
+
+// Makes a runner for a script read from a file.
+func NewRunnerFromFile(filename string, fs afero.Fs) (*js.Runner, error) {
+	data, err := afero.ReadFile(fs, filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewRunner(filename, data, fs)
+}
+
+// The outcome of a test. Summary holds every metric's aggregated values and thresholds, as well as
+// the checks, grouped the same way as in the script; see lib.Summary.
+type Result struct {
+	Summary *lib.Summary
+
+	// Set if any threshold failed.
+	ThresholdsFailed bool
+}
+
+// A Test is a single run of a Runner. It can only be run once.
+type Test struct {
+	Runner  lib.Runner
+	Options lib.Options
+
+	// Samples are passed on to these, on top of being aggregated for the Result; see lib.Output.
+	// Use lib.CollectorOutput() to pass a lib.Collector.
+	Outputs []lib.Output
+
+	// Where the engine's and (for JS runners) the script's log output goes; defaults to a logger
+	// that discards everything, so nothing is written to stderr unless asked for.
+	Logger *log.Logger
+
+	// How often to send progress updates; DefaultProgressInterval if zero.
+	ProgressInterval time.Duration
+
+	// Called as VUs are created and iterations run; see lib.Hooks.
+	Hooks lib.Hooks
+
+	progress chan lib.Snapshot
+}
+
+func NewTest(runner lib.Runner, opts lib.Options) *Test {
+	return &Test{
+		Runner:   runner,
+		Options:  opts,
+		progress: make(chan lib.Snapshot, 1),
+	}
+}
+
+// Returns a channel of progress updates, which is closed when the test is over. Updates are
+// dropped rather than holding up the test if they're not received in time.
+func (t *Test) Progress() <-chan lib.Snapshot {
+	return t.progress
+}
+
+// Runs the test until it's done, or ctx is cancelled, in which case the partial results are
+// returned, with Summary.State.Interrupted set. An error is returned if the test couldn't be
+// started, eg. because of invalid options, or if the engine failed.
+func (t *Test) Run(ctx context.Context) (*Result, error) {
+	defer close(t.progress)
+
+	logger := t.Logger
+	if logger == nil {
+		logger = log.New()
+		logger.Out = ioutil.Discard
+	}
+	if r, ok := t.Runner.(*js.Runner); ok {
+		r.Logger = logger
+	}
+
+	opts := t.Runner.GetOptions().Apply(t.Options).WithDefaults()
+	t.Runner.ApplyOptions(opts)
+
+	engine, err := lib.NewEngine(t.Runner, opts)
+	if err != nil {
+		return nil, err
+	}
+	engine.SetLogger(logger)
+	engine.Hooks = t.Hooks
+	engine.Outputs = t.Outputs
+
+	interval := t.ProgressInterval
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	errC := make(chan error, 1)
+	go func() { errC <- engine.Run(ctx) }()
+	for {
+		select {
+		case <-ticker.C:
+			select {
+			case t.progress <- engine.Snapshot():
+			default:
+			}
+		case err := <-errC:
+			if err != nil {
+				return nil, err
+			}
+			summary := engine.Summary()
+			summary.State.Interrupted = ctx.Err() != nil
+			return &Result{Summary: summary, ThresholdsFailed: engine.IsTainted()}, nil
+		}
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package embed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	logtest "github.com/Sirupsen/logrus/hooks/test"
+	"github.com/loadimpact/k6/lib"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestTest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	script := fmt.Sprintf(`
+	import http from "k6/http";
+	import { check } from "k6";
+	export let options = {
+		thresholds: {
+			"http_req_duration": ["p(95)<10000"],
+			"checks": ["rate>0.9"],
+		},
+	};
+	export default function() {
+		console.log("hello");
+		check(http.get("%s"), { "is 200": (r) => r.status === 200 });
+		check(http.get("%s/missing"), { "is 404": (r) => r.status === 404 });
+	}
+	`, srv.URL, srv.URL)
+
+	t.Run("Iterations", func(t *testing.T) {
+		runner, err := NewRunner("/script.js", []byte(script), afero.NewMemMapFs())
+		if !assert.NoError(t, err) {
+			return
+		}
+		logger, hook := logtest.NewNullLogger()
+		test := NewTest(runner, lib.Options{VUs: null.IntFrom(2), Iterations: null.IntFrom(3)})
+		test.Logger = logger
+
+		result, err := test.Run(context.Background())
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.False(t, result.ThresholdsFailed)
+		assert.False(t, result.Summary.State.Interrupted)
+		assert.Equal(t, float64(12), result.Summary.Metrics["http_reqs"].Values["count"])
+		assert.Equal(t, lib.SummaryThreshold{OK: true}, result.Summary.Metrics["checks"].Thresholds["rate>0.9"])
+		assert.True(t, result.Summary.Metrics["http_req_duration"].Values["p95"] > 0, "no p95")
+
+		checks := map[string]lib.SummaryCheck{}
+		for _, c := range result.Summary.RootGroup.Checks {
+			checks[c.Name] = c
+		}
+		assert.Equal(t, int64(6), checks["is 200"].Passes)
+		assert.Equal(t, int64(6), checks["is 404"].Passes)
+
+		var logged int
+		for _, e := range hook.AllEntries() {
+			if e.Level == log.InfoLevel && e.Message == "hello" {
+				logged++
+			}
+		}
+		assert.Equal(t, 6, logged)
+
+		// The channel is closed once the test is over, or this would hang.
+		for range test.Progress() {
+		}
+	})
+	t.Run("Progress", func(t *testing.T) {
+		runner, err := NewRunner("/script.js", []byte(script), afero.NewMemMapFs())
+		if !assert.NoError(t, err) {
+			return
+		}
+		test := NewTest(runner, lib.Options{VUs: null.IntFrom(1), Duration: null.StringFrom("200ms")})
+		test.ProgressInterval = 10 * time.Millisecond
+
+		var updates []lib.Snapshot
+		done := make(chan struct{})
+		go func() {
+			for p := range test.Progress() {
+				updates = append(updates, p)
+			}
+			close(done)
+		}()
+		_, err = test.Run(context.Background())
+		assert.NoError(t, err)
+		<-done
+
+		if assert.NotEmpty(t, updates) {
+			last := updates[len(updates)-1]
+			assert.True(t, last.AtTime > 0)
+			assert.Equal(t, int64(1), last.VUs)
+			assert.True(t, last.Requests > 0)
+		}
+	})
+	t.Run("Interrupted", func(t *testing.T) {
+		runner, err := NewRunner("/script.js", []byte(script), afero.NewMemMapFs())
+		if !assert.NoError(t, err) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		result, err := NewTest(runner, lib.Options{VUs: null.IntFrom(1), Duration: null.StringFrom("1h")}).Run(ctx)
+		if assert.NoError(t, err) {
+			assert.True(t, result.Summary.State.Interrupted)
+			assert.True(t, result.Summary.Metrics["http_reqs"].Values["count"] > 0)
+		}
+	})
+	t.Run("InvalidOptions", func(t *testing.T) {
+		runner, err := NewRunner("/script.js", []byte(script), afero.NewMemMapFs())
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = NewTest(runner, lib.Options{RPS: null.IntFrom(-1)}).Run(context.Background())
+		assert.EqualError(t, err, "options.rps: can't be negative")
+	})
+	t.Run("File", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_, err := NewRunnerFromFile("/script.js", fs)
+		assert.Error(t, err)
+
+		assert.NoError(t, afero.WriteFile(fs, "/script.js", []byte(script), 0644))
+		runner, err := NewRunnerFromFile("/script.js", fs)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "/script.js", runner.Bundle.Filename)
+		}
+	})
+}
@@ -23,6 +23,7 @@ package js
 import (
 	"context"
 	"encoding/json"
+	"math/rand"
 	"path/filepath"
 	"reflect"
 
@@ -30,6 +31,7 @@ import (
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/js/compiler"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 )
@@ -41,6 +43,9 @@ type Bundle struct {
 	Program  *goja.Program
 	Options  lib.Options
 
+	// Custom metrics declared by the script's init code.
+	Metrics []*stats.Metric
+
 	BaseInitContext *InitContext
 }
 
@@ -49,18 +54,35 @@ type BundleInstance struct {
 	Runtime *goja.Runtime
 	Context *context.Context
 	Default goja.Callable
+
+	// The instance's own seeded RNG, also backing Math.random(); reseeded through RNG.
+	Rand goja.RandSource
+	RNG  *rand.Rand
+
+	// Hooks into the runtime's Promise polyfill, for the VU's event loop.
+	promises *promiseHooks
 }
 
 // Creates a new bundle from a source file and a filesystem.
 func NewBundle(src *lib.SourceData, fs afero.Fs) (*Bundle, error) {
+	return NewBundleWithCompatibilityMode(src, fs, compiler.CompatibilityModeES6)
+}
+
+// Creates a new bundle from a source file written in the given compatibility mode; see
+// compiler.CompatibilityModeES6 and compiler.CompatibilityModeES5.
+func NewBundleWithCompatibilityMode(src *lib.SourceData, fs afero.Fs, mode string) (*Bundle, error) {
 	// Compile the main program.
-	code, _, err := compiler.Transform(string(src.Data), src.Filename)
-	if err != nil {
-		return nil, errors.Wrap(err, "Transform")
-	}
-	pgm, err := goja.Compile(src.Filename, code, true)
+	// Babel retains line numbers, so any errors can be pointed out in the transformed code.
+	pgm, code, srcmap, err := compiler.CompileWithSourceMap(string(src.Data), src.Filename, mode)
 	if err != nil {
-		return nil, errors.Wrap(err, "Compile")
+		if code == "" {
+			return nil, err
+		}
+		if srcmap.Mappings != "" {
+			maps := map[string]compiler.SourceMap{src.Filename: srcmap}
+			return nil, common.WithSourceFrame(common.WithSourceMaps(err, maps), src.Filename, string(src.Data))
+		}
+		return nil, common.WithSourceFrame(err, src.Filename, code)
 	}
 
 	// We want to eliminate disk access at runtime, so we set up a memory mapped cache that's
@@ -77,9 +99,13 @@ func NewBundle(src *lib.SourceData, fs afero.Fs) (*Bundle, error) {
 		Program:         pgm,
 		BaseInitContext: NewInitContext(rt, new(context.Context), fs, filepath.Dir(src.Filename)),
 	}
-	if err := bundle.instantiate(rt, bundle.BaseInitContext); err != nil {
-		return nil, err
+	bundle.BaseInitContext.compatibilityMode = mode
+	bundle.BaseInitContext.addSource(src.Filename, string(src.Data), code, srcmap)
+	bundle.BaseInitContext.metrics = &common.MetricRegistry{}
+	if _, err := bundle.instantiate(rt, bundle.BaseInitContext); err != nil {
+		return nil, bundle.withSourceFrame(err)
 	}
+	bundle.Metrics = bundle.BaseInitContext.metrics.Metrics
 
 	// Validate exports.
 	exportsV := rt.Get("exports")
@@ -115,6 +141,13 @@ func NewBundle(src *lib.SourceData, fs afero.Fs) (*Bundle, error) {
 	return &bundle, nil
 }
 
+// Annotates an error with a frame of the source it occurred in, if that's the script or one of
+// the files it required.
+func (b *Bundle) withSourceFrame(err error) error {
+	err = common.WithSourceMaps(err, b.BaseInitContext.sourceMaps)
+	return common.WithSourceFrames(err, b.BaseInitContext.sources)
+}
+
 // Instantiates a new runtime from this bundle.
 func (b *Bundle) Instantiate() (*BundleInstance, error) {
 	// Placeholder for a real context.
@@ -124,9 +157,13 @@ func (b *Bundle) Instantiate() (*BundleInstance, error) {
 	// runtime, but no state, to allow module-provided types to function within the init context.
 	rt := goja.New()
 	init := newBoundInitContext(b.BaseInitContext, ctxPtr, rt)
-	if err := b.instantiate(rt, init); err != nil {
+	promises, err := b.instantiate(rt, init)
+	if err != nil {
 		return nil, err
 	}
+	// Locked, since requests in a batch and the dialer draw from it outside the VU's goroutine.
+	rng := rand.New(common.NewLockedSource(common.NewSeed()))
+	rt.SetRandSource(rng.Float64)
 
 	// Grab the default function; type is already checked in NewBundle().
 	exports := rt.Get("exports").ToObject(rt)
@@ -136,15 +173,24 @@ func (b *Bundle) Instantiate() (*BundleInstance, error) {
 		Runtime: rt,
 		Context: ctxPtr,
 		Default: def,
+		Rand:    rng.Float64,
+		RNG:     rng,
+
+		promises: promises,
 	}, nil
 }
 
 // Instantiates the bundle into an existing runtime. Not public because it also messes with a bunch
 // of other things, will potentially thrash data and makes a mess in it if the operation fails.
-func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext) error {
+func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext) (*promiseHooks, error) {
 	rt.SetFieldNameMapper(common.FieldNameMapper{})
 	rt.SetRandSource(common.DefaultRandSource)
 
+	promises, err := installPromises(rt)
+	if err != nil {
+		return nil, err
+	}
+
 	exports := rt.NewObject()
 	rt.Set("exports", exports)
 	module := rt.NewObject()
@@ -152,14 +198,19 @@ func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext) error {
 	rt.Set("module", module)
 
 	*init.ctxPtr = common.WithRuntime(context.Background(), rt)
+	if init.metrics != nil {
+		*init.ctxPtr = common.WithMetricRegistry(*init.ctxPtr, init.metrics)
+	}
 	unbindInit := common.BindToGlobal(rt, common.Bind(rt, init, init.ctxPtr))
 	if _, err := rt.RunProgram(b.Program); err != nil {
-		return err
+		return nil, err
+	}
+	// There's no event loop during init, so run callbacks of promises settled in it right away.
+	if err := promises.RunJobs(); err != nil {
+		return nil, err
 	}
 	unbindInit()
 	*init.ctxPtr = nil
 
-	rt.SetRandSource(common.NewRandSource())
-
-	return nil
+	return promises, nil
 }
@@ -26,7 +26,9 @@ import (
 	"time"
 
 	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/compiler"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/guregu/null.v3"
@@ -45,14 +47,50 @@ func TestNewBundle(t *testing.T) {
 			Filename: "/script.js",
 			Data:     []byte{0x00},
 		}, afero.NewMemMapFs())
-		assert.EqualError(t, err, "Transform: SyntaxError: /script.js: Unexpected character '\x00' (1:0)\n> 1 | \x00\n    | ^ at <eval>:2:26853(114)")
+		assert.EqualError(t, err, "SyntaxError: /script.js: Unexpected character '\x00' (1:0)\n> 1 | \x00\n    | ^")
+	})
+	t.Run("CompatibilityMode", func(t *testing.T) {
+		t.Run("ES5", func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			assert.NoError(t, afero.WriteFile(fs, "/lib.js", []byte(`exports.value = 1;`), 0644))
+			b, err := NewBundleWithCompatibilityMode(&lib.SourceData{
+				Filename: "/script.js",
+				Data: []byte(`
+					var http = require("k6/http");
+					var lib = require("./lib.js");
+					exports.options = { vus: lib.value };
+					exports.default = function() {};
+				`),
+			}, fs, compiler.CompatibilityModeES5)
+			if assert.NoError(t, err) {
+				assert.Equal(t, null.IntFrom(1), b.Options.VUs)
+				_, err := b.Instantiate()
+				assert.NoError(t, err)
+			}
+		})
+		t.Run("ES5 with ES6", func(t *testing.T) {
+			_, err := NewBundleWithCompatibilityMode(&lib.SourceData{
+				Filename: "/script.js",
+				Data:     []byte(`export default function() {};`),
+			}, afero.NewMemMapFs(), compiler.CompatibilityModeES5)
+			assert.Error(t, err)
+		})
+		t.Run("Invalid", func(t *testing.T) {
+			_, err := NewBundleWithCompatibilityMode(&lib.SourceData{
+				Filename: "/script.js",
+				Data:     []byte(`exports.default = function() {};`),
+			}, afero.NewMemMapFs(), "es2049")
+			assert.EqualError(t, err, "invalid compatibility mode: es2049")
+		})
 	})
 	t.Run("Error", func(t *testing.T) {
 		_, err := NewBundle(&lib.SourceData{
 			Filename: "/script.js",
 			Data:     []byte(`throw new Error("aaaa");`),
 		}, afero.NewMemMapFs())
-		assert.EqualError(t, err, "Error: aaaa at /script.js:1:20(3)")
+		assert.EqualError(t, err, "Error: aaaa at /script.js:1:20(3)\n"+
+			"> 1 | \"use strict\";throw new Error(\"aaaa\");\n"+
+			"    |                    ^")
 	})
 	t.Run("InvalidExports", func(t *testing.T) {
 		_, err := NewBundle(&lib.SourceData{
@@ -97,6 +135,29 @@ func TestNewBundle(t *testing.T) {
 		}, afero.NewMemMapFs())
 		assert.NoError(t, err)
 	})
+	t.Run("Metrics", func(t *testing.T) {
+		b, err := NewBundle(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+				import { Counter, Trend } from "k6/metrics";
+				let errors = new Counter("errors");
+				let latency = new Trend("latency", true);
+				export default function() {}
+			`),
+		}, afero.NewMemMapFs())
+		if assert.NoError(t, err) && assert.Len(t, b.Metrics, 2) {
+			assert.Equal(t, "errors", b.Metrics[0].Name)
+			assert.Equal(t, stats.Counter, b.Metrics[0].Type)
+			assert.Equal(t, "latency", b.Metrics[1].Name)
+			assert.Equal(t, stats.Trend, b.Metrics[1].Type)
+			assert.Equal(t, stats.Time, b.Metrics[1].Contains)
+
+			// VUs declare the same metrics again, which mustn't be recorded twice.
+			_, err := b.Instantiate()
+			assert.NoError(t, err)
+			assert.Len(t, b.Metrics, 2)
+		}
+	})
 	t.Run("Options", func(t *testing.T) {
 		t.Run("Empty", func(t *testing.T) {
 			_, err := NewBundle(&lib.SourceData{
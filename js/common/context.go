@@ -24,6 +24,7 @@ import (
 	"context"
 
 	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/stats"
 )
 
 type ctxKey int
@@ -31,6 +32,7 @@ type ctxKey int
 const (
 	ctxKeyState ctxKey = iota
 	ctxKeyRuntime
+	ctxKeyMetricRegistry
 )
 
 func WithState(ctx context.Context, state *State) context.Context {
@@ -56,3 +58,20 @@ func GetRuntime(ctx context.Context) *goja.Runtime {
 	}
 	return v.(*goja.Runtime)
 }
+
+// A MetricRegistry records the custom metrics a script declares in its init code.
+type MetricRegistry struct {
+	Metrics []*stats.Metric
+}
+
+func WithMetricRegistry(ctx context.Context, reg *MetricRegistry) context.Context {
+	return context.WithValue(ctx, ctxKeyMetricRegistry, reg)
+}
+
+func GetMetricRegistry(ctx context.Context) *MetricRegistry {
+	v := ctx.Value(ctxKeyMetricRegistry)
+	if v == nil {
+		return nil
+	}
+	return v.(*MetricRegistry)
+}
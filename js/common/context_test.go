@@ -45,3 +45,9 @@ func TestContextRuntime(t *testing.T) {
 func TestContextRuntimeNil(t *testing.T) {
 	assert.Nil(t, GetRuntime(context.Background()))
 }
+
+func TestContextMetricRegistry(t *testing.T) {
+	reg := &MetricRegistry{}
+	assert.Equal(t, reg, GetMetricRegistry(WithMetricRegistry(context.Background(), reg)))
+	assert.Nil(t, GetMetricRegistry(context.Background()))
+}
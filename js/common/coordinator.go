@@ -0,0 +1,114 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// A Coordinator holds counters and latches shared by all of a Runner's VUs, for coordinating
+// them; eg. handing out unique user indexes, or having every VU log in before any goes on. Note
+// that they're shared by the VUs of one instance, not across instances running a distributed test.
+type Coordinator struct {
+	counters map[string]int64
+	latches  map[string]*Latch
+	lock     sync.Mutex
+}
+
+func NewCoordinator() *Coordinator {
+	return &Coordinator{
+		counters: make(map[string]int64),
+		latches:  make(map[string]*Latch),
+	}
+}
+
+// Adds delta to a counter, which starts at 0, and returns its new value.
+func (c *Coordinator) Add(name string, delta int64) int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.counters[name] += delta
+	return c.counters[name]
+}
+
+// Returns a counter's value.
+func (c *Coordinator) Counter(name string) int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.counters[name]
+}
+
+// Returns a latch, which is made with the given count the first time it's asked for; asking for
+// it with another count is an error, as VUs would disagree on when it's released.
+func (c *Coordinator) Latch(name string, count int64) (*Latch, error) {
+	if count <= 0 {
+		return nil, errors.Errorf("latch %s: count must be positive", name)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	l, ok := c.latches[name]
+	if !ok {
+		l = &Latch{Count: count, remaining: count, done: make(chan struct{})}
+		c.latches[name] = l
+	} else if l.Count != count {
+		return nil, errors.Errorf("latch %s was made with a count of %d, not %d", name, l.Count, count)
+	}
+	return l, nil
+}
+
+// A Latch is released once it's been counted down Count times; it can't be reset.
+type Latch struct {
+	Count int64
+
+	remaining int64
+	done      chan struct{}
+	lock      sync.Mutex
+}
+
+// Counts the latch down, releasing it if this was the last count; counts past that do nothing.
+func (l *Latch) CountDown() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.remaining == 0 {
+		return
+	}
+	l.remaining--
+	if l.remaining == 0 {
+		close(l.done)
+	}
+}
+
+// Waits for the latch to be released; returns the context's error if it's done first.
+func (l *Latch) Wait(ctx context.Context) error {
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
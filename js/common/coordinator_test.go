@@ -0,0 +1,101 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoordinator(t *testing.T) {
+	t.Run("Counter", func(t *testing.T) {
+		c := NewCoordinator()
+		var wg sync.WaitGroup
+		seen := make([]bool, 100)
+		var lock sync.Mutex
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n := c.Add("users", 1)
+				lock.Lock()
+				seen[n-1] = true
+				lock.Unlock()
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(100), c.Counter("users"))
+		for i, ok := range seen {
+			assert.True(t, ok, "index %d not handed out", i)
+		}
+		assert.Equal(t, int64(0), c.Counter("other"))
+	})
+	t.Run("Latch", func(t *testing.T) {
+		c := NewCoordinator()
+		l, err := c.Latch("login", 2)
+		if !assert.NoError(t, err) {
+			return
+		}
+		l2, err := c.Latch("login", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, l, l2)
+
+		released := make(chan error)
+		go func() { released <- l.Wait(context.Background()) }()
+
+		l.CountDown()
+		select {
+		case <-released:
+			t.Fatal("released early")
+		case <-time.After(10 * time.Millisecond):
+		}
+		l.CountDown()
+		select {
+		case err := <-released:
+			assert.NoError(t, err)
+		case <-time.After(1 * time.Second):
+			t.Fatal("not released")
+		}
+
+		l.CountDown()
+		assert.NoError(t, l.Wait(context.Background()), "released latches stay released")
+
+		t.Run("Cancelled", func(t *testing.T) {
+			l, err := c.Latch("never", 1)
+			assert.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			assert.Equal(t, context.Canceled, l.Wait(ctx))
+		})
+		t.Run("Wrong Count", func(t *testing.T) {
+			_, err := c.Latch("login", 3)
+			assert.EqualError(t, err, "latch login was made with a count of 2, not 3")
+		})
+		t.Run("Invalid Count", func(t *testing.T) {
+			_, err := c.Latch("zero", 0)
+			assert.EqualError(t, err, "latch zero: count must be positive")
+		})
+	})
+}
@@ -0,0 +1,145 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The version of the script API. It's bumped whenever scripts gain something they may want to
+// check for, so that they can fail fast on older versions; see CheckRequires().
+const APIVersion = 2
+
+var (
+	features     = make(map[string]bool)
+	featuresLock sync.RWMutex
+)
+
+// Registers features scripts can check for with hasFeature(), eg. "http.batch.dag". Modules
+// register what they provide when they're loaded.
+func RegisterFeature(names ...string) {
+	featuresLock.Lock()
+	defer featuresLock.Unlock()
+	for _, name := range names {
+		features[name] = true
+	}
+}
+
+// Returns whether a feature has been registered.
+func HasFeature(name string) bool {
+	featuresLock.RLock()
+	defer featuresLock.RUnlock()
+	return features[name]
+}
+
+// Returns all registered features, sorted.
+func Features() []string {
+	featuresLock.RLock()
+	defer featuresLock.RUnlock()
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	requiresRegexp   = regexp.MustCompile(`^//\s*@requires\s+(.*)$`)
+	apiVersionRegexp = regexp.MustCompile(`^api\s*(>=|<=|==|=|>|<)\s*(\d+)$`)
+)
+
+// Checks "// @requires" lines in a script's leading comments against the API version and the
+// registered features, eg. "// @requires api>=2, http.batch.dag". Requirements may be separated by
+// commas or spaces; API versions can be compared with >=, >, <=, < or =.
+func CheckRequires(src string) error {
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#!") {
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		m := requiresRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for _, req := range splitRequires(m[1]) {
+			if err := checkRequirement(req); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Splits a list of requirements on commas and whitespace, keeping "api >= 2" together.
+func splitRequires(s string) []string {
+	for _, op := range []string{">=", "<=", "==", "=", ">", "<"} {
+		s = strings.Replace(s, " "+op, op, -1)
+		s = strings.Replace(s, op+" ", op, -1)
+	}
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+}
+
+func checkRequirement(req string) error {
+	if !strings.HasPrefix(req, "api") || strings.HasPrefix(req, "api.") {
+		if !HasFeature(req) {
+			return errors.Errorf("script requires the feature %q, which this version of k6 doesn't have; "+
+				"try upgrading k6", req)
+		}
+		return nil
+	}
+
+	m := apiVersionRegexp.FindStringSubmatch(req)
+	if m == nil {
+		return errors.Errorf("invalid @requires: %s", req)
+	}
+	v, _ := strconv.Atoi(m[2])
+	var ok bool
+	switch m[1] {
+	case ">=":
+		ok = APIVersion >= v
+	case ">":
+		ok = APIVersion > v
+	case "<=":
+		ok = APIVersion <= v
+	case "<":
+		ok = APIVersion < v
+	default:
+		ok = APIVersion == v
+	}
+	if !ok {
+		hint := "try upgrading k6"
+		if m[1] == "<" || m[1] == "<=" || APIVersion > v {
+			hint = "it was written for an older version of k6"
+		}
+		return errors.Errorf("script requires %s, but this version of k6 has api=%d; %s", req, APIVersion, hint)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatures(t *testing.T) {
+	assert.False(t, HasFeature("test.feature"))
+	RegisterFeature("test.feature")
+	assert.True(t, HasFeature("test.feature"))
+	assert.Contains(t, Features(), "test.feature")
+}
+
+func TestCheckRequires(t *testing.T) {
+	RegisterFeature("test.required")
+
+	older := fmt.Sprintf("api=%d", APIVersion-1)
+	testdata := map[string]string{
+		"export default function() {}":                            "",
+		"// @requires api>=1\nexport default function() {}":       "",
+		"#!/usr/bin/env k6\n// @requires api >= 1, test.required": "",
+		"// a script\n//@requires api>0 test.required":            "",
+		"// @requires api>=999":                                   fmt.Sprintf("script requires api>=999, but this version of k6 has api=%d; try upgrading k6", APIVersion),
+		"// @requires " + older:                                   fmt.Sprintf("script requires %s, but this version of k6 has api=%d; it was written for an older version of k6", older, APIVersion),
+		"// @requires test.nope":                                  `script requires the feature "test.nope", which this version of k6 doesn't have; try upgrading k6`,
+		"// @requires api~2":                                      "invalid @requires: api~2",
+		"export default function() {}\n// @requires api>=999":     "",
+		"/* @requires api>=999 */":                                "",
+	}
+	for src, expected := range testdata {
+		t.Run(src, func(t *testing.T) {
+			err := CheckRequires(src)
+			if expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"io"
+
+	"github.com/spf13/afero"
+)
+
+// A FileStream is a handle to a local file that's read lazily, eg. when used as a request body,
+// rather than being loaded into memory up front. Each Open() returns an independent reader, so
+// any number of VUs can stream the same file at once.
+type FileStream struct {
+	Filename string
+	Size     int64
+
+	fs afero.Fs
+}
+
+func NewFileStream(fs afero.Fs, filename string) (*FileStream, error) {
+	info, err := fs.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStream{Filename: filename, Size: info.Size(), fs: fs}, nil
+}
+
+// Opens a new reader over the file, starting from the beginning.
+func (f *FileStream) Open() (io.ReadCloser, error) {
+	return f.fs.Open(f.Filename)
+}
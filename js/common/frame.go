@@ -0,0 +1,171 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/loadimpact/k6/js/compiler"
+)
+
+// Number of lines of context shown around the offending line in a source frame.
+const sourceFrameContext = 2
+
+// A SourceError is an error in a script, annotated with a frame of the offending source.
+type SourceError struct {
+	Err   error
+	Frame string
+}
+
+func (e *SourceError) Error() string {
+	return e.Err.Error() + "\n" + e.Frame
+}
+
+// Passes through the wrapped error's String(), which may include eg. a stack trace.
+func (e *SourceError) String() string {
+	if s, ok := e.Err.(fmt.Stringer); ok {
+		return s.String() + "\n" + e.Frame
+	}
+	return e.Error()
+}
+
+// Annotates an error with a frame of the source it occurred in, if it refers to a location in the
+// given file; either as part of a stack trace ("/script.js:3:9") or a parser error ("/script.js:
+// Line 3:9"). Other errors are returned as they are.
+func WithSourceFrame(err error, filename, src string) error {
+	if err == nil {
+		return nil
+	}
+	re := regexp.MustCompile(regexp.QuoteMeta(filename) + `:(?: Line )?(\d+):(\d+)`)
+	m := re.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+	frame := SourceFrame(src, line, col)
+	if frame == "" {
+		return err
+	}
+	return &SourceError{Err: err, Frame: frame}
+}
+
+// Like WithSourceFrame, but for errors that may have occurred in any of several files, eg. a script
+// and the modules it requires, given as filename -> source. The first location in any of them
+// is pointed out, which for a stack trace is where the error was thrown.
+func WithSourceFrames(err error, sources map[string]string) error {
+	if err == nil {
+		return nil
+	}
+	for _, m := range locationRE.FindAllStringSubmatch(err.Error(), -1) {
+		if src, ok := sources[m[1]]; ok {
+			return WithSourceFrame(err, m[1], src)
+		}
+	}
+	return err
+}
+
+// Matches locations in stack traces or parser errors, capturing the filename.
+var locationRE = regexp.MustCompile(`([^\s:()]+):(?: Line )?\d+:\d+`)
+
+// A MappedError is an error whose locations were mapped from transformed code back to the source it
+// was transformed from; see WithSourceMaps.
+type MappedError struct {
+	Err  error
+	maps map[string]compiler.SourceMap
+}
+
+func (e *MappedError) Error() string {
+	return mapLocations(e.Err.Error(), e.maps)
+}
+
+// Passes through the wrapped error's String(), with its locations mapped too.
+func (e *MappedError) String() string {
+	if s, ok := e.Err.(fmt.Stringer); ok {
+		return mapLocations(s.String(), e.maps)
+	}
+	return e.Error()
+}
+
+// Maps the locations in an error that refer to any of several transformed files, given as
+// filename -> source map, back to their sources; eg. from the code Babel made of a TypeScript file
+// to the file itself. Errors with no such locations are returned as they are.
+func WithSourceMaps(err error, maps map[string]compiler.SourceMap) error {
+	if err == nil || len(maps) == 0 {
+		return err
+	}
+	if msg := err.Error(); mapLocations(msg, maps) == msg {
+		return err
+	}
+	return &MappedError{Err: err, maps: maps}
+}
+
+// Like locationRE, but capturing the parts of a location, so it can be rewritten.
+var locationPartsRE = regexp.MustCompile(`([^\s:()]+):( Line )?(\d+):(\d+)`)
+
+func mapLocations(s string, maps map[string]compiler.SourceMap) string {
+	return locationPartsRE.ReplaceAllStringFunc(s, func(loc string) string {
+		m := locationPartsRE.FindStringSubmatch(loc)
+		srcmap, ok := maps[m[1]]
+		if !ok {
+			return loc
+		}
+		line, _ := strconv.Atoi(m[3])
+		col, _ := strconv.Atoi(m[4])
+		line, col, _ = srcmap.OriginalPosition(line, col)
+		return fmt.Sprintf("%s:%s%d:%d", m[1], m[2], line, col)
+	})
+}
+
+// Renders a few lines of source around a location, with the line marked and the column pointed
+// out with a caret. Lines and columns are 1-indexed. Returns an empty string for out-of-range lines.
+func SourceFrame(src string, line, col int) string {
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	start := line - sourceFrameContext
+	if start < 1 {
+		start = 1
+	}
+	end := line + sourceFrameContext
+	if end > len(lines) {
+		end = len(lines)
+	}
+	width := len(strconv.Itoa(end))
+
+	var buf []string
+	for i := start; i <= end; i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		buf = append(buf, fmt.Sprintf("%s %*d | %s", marker, width, i, lines[i-1]))
+		if i == line && col > 0 {
+			buf = append(buf, fmt.Sprintf("  %s | %s^", strings.Repeat(" ", width), strings.Repeat(" ", col-1)))
+		}
+	}
+	return strings.Join(buf, "\n")
+}
@@ -0,0 +1,108 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/loadimpact/k6/js/compiler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceFrame(t *testing.T) {
+	src := "a\nb\nc\nd\ne\nf"
+	t.Run("Middle", func(t *testing.T) {
+		assert.Equal(t, "  1 | a\n  2 | b\n> 3 | c\n    | ^\n  4 | d\n  5 | e", SourceFrame(src, 3, 1))
+	})
+	t.Run("Start", func(t *testing.T) {
+		assert.Equal(t, "> 1 | a\n    |   ^\n  2 | b\n  3 | c", SourceFrame(src, 1, 3))
+	})
+	t.Run("End", func(t *testing.T) {
+		assert.Equal(t, "  4 | d\n  5 | e\n> 6 | f", SourceFrame(src, 6, 0))
+	})
+	t.Run("OutOfRange", func(t *testing.T) {
+		assert.Equal(t, "", SourceFrame(src, 7, 1))
+		assert.Equal(t, "", SourceFrame(src, 0, 1))
+	})
+}
+
+func TestWithSourceFrame(t *testing.T) {
+	src := "let a = 1;\nlet b = c;"
+	testdata := map[string]string{
+		"Error: c is not defined at /script.js:2:9(4)": "  1 | let a = 1;\n> 2 | let b = c;\n    |         ^",
+		"/script.js: Line 2:9 Unexpected identifier":   "  1 | let a = 1;\n> 2 | let b = c;\n    |         ^",
+	}
+	for msg, frame := range testdata {
+		t.Run(msg, func(t *testing.T) {
+			err := WithSourceFrame(errors.New(msg), "/script.js", src)
+			assert.EqualError(t, err, msg+"\n"+frame)
+		})
+	}
+
+	t.Run("OtherFile", func(t *testing.T) {
+		err := errors.New("Error: oops at /lib.js:2:9(4)")
+		assert.Equal(t, err, WithSourceFrame(err, "/script.js", src))
+	})
+	t.Run("Nil", func(t *testing.T) {
+		assert.NoError(t, WithSourceFrame(nil, "/script.js", src))
+	})
+}
+
+func TestWithSourceFrames(t *testing.T) {
+	sources := map[string]string{
+		"/script.js": "import { f } from \"/lib.js\";\nf();",
+		"/lib.js":    "export function f() {\n  return c;\n}",
+	}
+
+	t.Run("Module", func(t *testing.T) {
+		msg := "ReferenceError: c is not defined at /lib.js:2:10(3)"
+		err := WithSourceFrames(errors.New(msg), sources)
+		assert.EqualError(t, err, msg+"\n  1 | export function f() {\n> 2 |   return c;\n    |          ^\n  3 | }")
+	})
+	t.Run("Unknown", func(t *testing.T) {
+		err := errors.New("Error: oops at http.js:12:3(8)")
+		assert.Equal(t, err, WithSourceFrames(err, sources))
+	})
+	t.Run("Nil", func(t *testing.T) {
+		assert.NoError(t, WithSourceFrames(nil, sources))
+	})
+}
+
+func TestWithSourceMaps(t *testing.T) {
+	// Column 5 of line 1 of the code was column 7 of the source, and line 2 is as it was.
+	maps := map[string]compiler.SourceMap{"/script.ts": {Mappings: "AAAA,IAAM;AACN"}}
+
+	t.Run("Mapped", func(t *testing.T) {
+		err := WithSourceMaps(errors.New("Error: nope at /script.ts:1:6(3) at /script.js:1:6(1)"), maps)
+		assert.EqualError(t, err, "Error: nope at /script.ts:1:8(3) at /script.js:1:6(1)")
+		assert.IsType(t, &MappedError{}, err)
+
+		src := "let a: number = 1;\nlet b = c;"
+		err = WithSourceFrame(WithSourceMaps(errors.New("/script.ts: Line 1:5 Unexpected identifier"), maps), "/script.ts", src)
+		assert.EqualError(t, err, "/script.ts: Line 1:7 Unexpected identifier\n> 1 | let a: number = 1;\n    |       ^\n  2 | let b = c;")
+	})
+	t.Run("Unmapped", func(t *testing.T) {
+		orig := errors.New("Error: nope at /script.js:1:6(1)")
+		assert.Equal(t, orig, WithSourceMaps(orig, maps))
+		assert.Nil(t, WithSourceMaps(nil, maps))
+	})
+}
@@ -23,7 +23,9 @@ package common
 import (
 	crand "crypto/rand"
 	"encoding/binary"
+	"hash/fnv"
 	"math/rand"
+	"sync"
 
 	"github.com/dop251/goja"
 	"github.com/pkg/errors"
@@ -32,9 +34,44 @@ import (
 var DefaultRandSource = NewRandSource()
 
 func NewRandSource() goja.RandSource {
+	return rand.New(rand.NewSource(NewSeed())).Float64
+}
+
+// A rand.Source that's safe for concurrent use, unlike rand.NewSource()'s.
+type lockedSource struct {
+	mutex sync.Mutex
+	src   rand.Source
+}
+
+func NewLockedSource(seed int64) rand.Source {
+	return &lockedSource{src: rand.NewSource(seed)}
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.src.Seed(seed)
+}
+
+// Returns a random seed, read from the system's secure random source.
+func NewSeed() int64 {
 	var seed int64
 	if err := binary.Read(crand.Reader, binary.LittleEndian, &seed); err != nil {
 		panic(errors.New("Couldn't read bytes for random seed"))
 	}
-	return rand.New(rand.NewSource(seed)).Float64
+	return seed
+}
+
+// Derives the seed for an iteration from the test's seed, so that any iteration can be replayed
+// from its VU ID and iteration number alone.
+func IterationSeed(seed, id, iteration int64) int64 {
+	h := fnv.New64a()
+	_ = binary.Write(h, binary.LittleEndian, [3]int64{seed, id, iteration})
+	return int64(h.Sum64())
 }
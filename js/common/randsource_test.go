@@ -0,0 +1,53 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockedSource(t *testing.T) {
+	expected := rand.New(rand.NewSource(1))
+	rng := rand.New(NewLockedSource(1))
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, expected.Float64(), rng.Float64())
+	}
+
+	rng.Seed(1)
+	assert.Equal(t, rand.New(rand.NewSource(1)).Float64(), rng.Float64())
+
+	// Safe to draw from concurrently; run with -race.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				rng.Float64()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -21,10 +21,16 @@
 package common
 
 import (
+	"crypto/tls"
 	"net/http"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
+	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/netext"
 	"github.com/loadimpact/k6/stats"
+	"gopkg.in/guregu/null.v3"
 )
 
 // Provides volatile state for a VU.
@@ -34,6 +40,72 @@ type State struct {
 
 	// Networking equipment.
 	HTTPTransport http.RoundTripper
+	CookieJar     http.CookieJar
+
+	// Dialer for raw connections, eg. from k6/net; nil to use a plain net.Dialer.
+	Dialer *netext.Dialer
+
+	// TLS config for connections made outside of HTTPTransport, eg. from k6/grpc, with the TLS
+	// options and client certificates applied; nil to use the defaults. It must be cloned before
+	// it's modified.
+	TLSConfig *tls.Config
+
+	// Set if HTTPTransport doesn't reuse connections; see lib.Options.NoConnectionReuse. It may be
+	// wrapped any number of times, so this is the only reliable way to tell.
+	NoConnectionReuse bool
+
+	// Headers sent with every request, unless overridden; see lib.Options.Headers. Keys are
+	// canonicalized, eg. "User-Agent".
+	DefaultHeaders http.Header
+
+	// Dumping of requests and responses to the log; see lib.Options.HTTPDebug. Empty if disabled.
+	HTTPDebug       string
+	HTTPDebugRedact bool
+
+	// Tags requests' samples with the IP they connected to, and whether its lookup was cached; see
+	// lib.DNSOptions.Tags.
+	DNSTags bool
+
+	// Leaves out the http_* samples for requests, unless they ask for them; see lib.Options.NoHTTPMetrics.
+	NoHTTPMetrics bool
+
+	// Response bodies are truncated past this size; 0 means no limit.
+	MaxResponseBodySize int64
+
+	// Redirects followed before a request fails; lib.DefaultMaxRedirects if unset.
+	MaxRedirects null.Int
+
+	// Requests taking longer than this are aborted, unless they say otherwise; 0 means no timeout.
+	HTTPTimeout time.Duration
+
+	// Rate limits to wait for before every request; see lib.Options.RPS.
+	RateLimiters []*netext.RateLimiter
+
+	// Trace context propagation; see lib.Options.Tracing. Empty if disabled.
+	TracePropagator string
+	TraceSampling   float64
+
+	// Emulated browser cache; nil if disabled.
+	HTTPCache *netext.Cache
+
+	// The VU's seeded RNG, shared with Math.random().
+	Rand goja.RandSource
+
+	// The VU's key/value store, which persists across iterations.
+	Store *Store
+
+	// Counters and latches shared by all VUs.
+	Coordinator *Coordinator
+
+	// The VU's identity, for tagging log output.
+	VUID      int64
+	Iteration int64
+
+	// Where log output, such as dumped requests, goes; nil for logrus' standard logger.
+	Logger *log.Logger
+
+	// Time spent in sleep() so far this iteration.
+	Slept time.Duration
 
 	// Sample buffer, emitted at the end of the iteration.
 	Samples []stats.Sample
@@ -0,0 +1,112 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Default maximum size of a Store, in bytes.
+const DefaultStoreSize = 1024 * 1024
+
+// A Store is a VU's private key/value store, which persists across iterations. Values are held
+// JSON-encoded, and the sum of all keys' and values' lengths may not exceed MaxSize (0 = no limit).
+type Store struct {
+	MaxSize int64
+
+	size int64
+	data map[string]string
+	lock sync.Mutex
+}
+
+func NewStore(maxSize int64) *Store {
+	return &Store{MaxSize: maxSize, data: make(map[string]string)}
+}
+
+// Returns the JSON-encoded value for a key, and whether there was one.
+func (s *Store) Get(key string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	v, ok := s.data[key]
+	return v, ok
+}
+
+// Stores a JSON-encoded value under a key, replacing any previous one. Fails, leaving the store
+// untouched, if this would push it over its size limit.
+func (s *Store) Set(key, value string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	size := s.size + int64(len(key)+len(value))
+	if old, ok := s.data[key]; ok {
+		size -= int64(len(key) + len(old))
+	}
+	if s.MaxSize > 0 && size > s.MaxSize {
+		return errors.Errorf("store: size limit of %d bytes exceeded", s.MaxSize)
+	}
+
+	s.data[key] = value
+	s.size = size
+	return nil
+}
+
+// Removes a key from the store.
+func (s *Store) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if old, ok := s.data[key]; ok {
+		s.size -= int64(len(key) + len(old))
+		delete(s.data, key)
+	}
+}
+
+// Removes everything from the store.
+func (s *Store) Clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data = make(map[string]string)
+	s.size = 0
+}
+
+// Returns the current size of the store, in bytes.
+func (s *Store) Size() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.size
+}
+
+// Returns a copy of the store's contents, for debugging.
+func (s *Store) Snapshot() map[string]json.RawMessage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	snapshot := make(map[string]json.RawMessage, len(s.data))
+	for k, v := range s.data {
+		snapshot[k] = json.RawMessage(v)
+	}
+	return snapshot
+}
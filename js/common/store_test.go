@@ -0,0 +1,73 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(20)
+	_, ok := s.Get("a")
+	assert.False(t, ok)
+
+	assert.NoError(t, s.Set("a", `"abc"`))
+	v, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, `"abc"`, v)
+	assert.Equal(t, int64(6), s.Size())
+
+	t.Run("Replace", func(t *testing.T) {
+		assert.NoError(t, s.Set("a", `123`))
+		assert.Equal(t, int64(4), s.Size())
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		assert.EqualError(t, s.Set("b", `"way too long for this"`), "store: size limit of 20 bytes exceeded")
+		_, ok := s.Get("b")
+		assert.False(t, ok)
+		assert.Equal(t, int64(4), s.Size())
+	})
+
+	t.Run("Snapshot", func(t *testing.T) {
+		assert.NoError(t, s.Set("b", `[1]`))
+		assert.Equal(t, map[string]json.RawMessage{
+			"a": json.RawMessage(`123`),
+			"b": json.RawMessage(`[1]`),
+		}, s.Snapshot())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		s.Delete("a")
+		_, ok := s.Get("a")
+		assert.False(t, ok)
+		assert.Equal(t, int64(4), s.Size())
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		s.Clear()
+		assert.Empty(t, s.Snapshot())
+		assert.Equal(t, int64(0), s.Size())
+	})
+}
@@ -21,8 +21,12 @@
 package common
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/compiler"
+	"github.com/pkg/errors"
 )
 
 // Panic if the provided source can't be compiled.
@@ -48,5 +52,66 @@ func Throw(rt *goja.Runtime, err error) {
 	if e, ok := err.(*goja.Exception); ok {
 		panic(e)
 	}
-	panic(rt.NewGoError(err))
+	obj := rt.NewGoError(err)
+	if p, ok := err.(ErrorProperties); ok {
+		for k, v := range p.Properties() {
+			_ = obj.Set(k, v)
+		}
+	}
+	panic(obj)
+}
+
+// An error that carries context for scripts to inspect, eg. which request failed. Throw() sets
+// its properties on the thrown object.
+type ErrorProperties interface {
+	error
+	Properties() map[string]interface{}
+}
+
+// Converts a string or byte array to bytes, for functions that take either; strings are encoded as
+// UTF-8.
+func ToBytes(v goja.Value) ([]byte, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, errors.New("input must be a string or a byte array")
+	}
+	b, ok, err := ToByteArray(v)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return b, nil
+	}
+	return []byte(v.String()), nil
+}
+
+// Converts a JS value into a duration; numbers are taken to be milliseconds, strings are parsed,
+// eg. "1.5s".
+func ToDuration(v goja.Value) (time.Duration, error) {
+	switch v.Export().(type) {
+	case string:
+		return time.ParseDuration(v.String())
+	default:
+		return time.Duration(v.ToFloat() * float64(time.Millisecond)), nil
+	}
+}
+
+// Converts a byte array, either a Go []byte or a JS array of values 0-255, to a []byte. Returns
+// false if the value isn't an array at all.
+func ToByteArray(v goja.Value) ([]byte, bool, error) {
+	switch data := v.Export().(type) {
+	case []byte:
+		return data, true, nil
+	case []interface{}:
+		b := make([]byte, len(data))
+		for i, e := range data {
+			n, ok := e.(int64)
+			if !ok || n < 0 || n > 255 {
+				return nil, true, fmt.Errorf("invalid byte at index %d: %v", i, e)
+			}
+			b[i] = byte(n)
+		}
+		return b, true, nil
+	default:
+		return nil, false, nil
+	}
 }
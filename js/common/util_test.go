@@ -23,6 +23,7 @@ package common
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/dop251/goja"
 	"github.com/stretchr/testify/assert"
@@ -62,3 +63,116 @@ func TestThrow(t *testing.T) {
 		}
 	}
 }
+
+type propsError struct{}
+
+func (propsError) Error() string { return "bbbb" }
+func (propsError) Properties() map[string]interface{} {
+	return map[string]interface{}{"code": 42}
+}
+
+func TestThrowProperties(t *testing.T) {
+	rt := goja.New()
+	rt.Set("fn", func() { Throw(rt, propsError{}) })
+	v, err := RunString(rt, `(function() { try { fn(); } catch (e) { return e.message + " " + e.code; } })()`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "bbbb 42", v.String())
+	}
+}
+
+func TestToByteArray(t *testing.T) {
+	rt := goja.New()
+	testdata := map[string]struct {
+		b   []byte
+		ok  bool
+		err string
+	}{
+		`[0, 1, 255]`: {[]byte{0, 1, 255}, true, ""},
+		`[]`:          {[]byte{}, true, ""},
+		`[256]`:       {nil, true, "invalid byte at index 0: 256"},
+		`[1, "a"]`:    {nil, true, "invalid byte at index 1: a"},
+		`"abc"`:       {nil, false, ""},
+		`({a: 1})`:    {nil, false, ""},
+	}
+	for src, data := range testdata {
+		t.Run(src, func(t *testing.T) {
+			v, err := rt.RunString(src)
+			if !assert.NoError(t, err) {
+				return
+			}
+			b, ok, err := ToByteArray(v)
+			assert.Equal(t, data.ok, ok)
+			if data.err != "" {
+				assert.EqualError(t, err, data.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, data.b, b)
+		})
+	}
+	t.Run("Go", func(t *testing.T) {
+		b, ok, err := ToByteArray(rt.ToValue([]byte("abc")))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []byte("abc"), b)
+	})
+}
+
+func TestToBytes(t *testing.T) {
+	rt := goja.New()
+	testdata := map[string]struct {
+		b   []byte
+		err string
+	}{
+		`"abc"`:     {[]byte("abc"), ""},
+		`"é"`:       {[]byte("é"), ""},
+		`[0, 255]`:  {[]byte{0, 255}, ""},
+		`[256]`:     {nil, "invalid byte at index 0: 256"},
+		`undefined`: {nil, "input must be a string or a byte array"},
+		`null`:      {nil, "input must be a string or a byte array"},
+	}
+	for src, data := range testdata {
+		t.Run(src, func(t *testing.T) {
+			v, err := rt.RunString(src)
+			if !assert.NoError(t, err) {
+				return
+			}
+			b, err := ToBytes(v)
+			if data.err != "" {
+				assert.EqualError(t, err, data.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, data.b, b)
+		})
+	}
+}
+
+func TestToDuration(t *testing.T) {
+	rt := goja.New()
+	testdata := map[string]struct {
+		d   time.Duration
+		err bool
+	}{
+		`1500`:   {1500 * time.Millisecond, false},
+		`0.5`:    {500 * time.Microsecond, false},
+		`"1.5s"`: {1500 * time.Millisecond, false},
+		`"1m"`:   {time.Minute, false},
+		`"1x"`:   {0, true},
+	}
+	for src, data := range testdata {
+		t.Run(src, func(t *testing.T) {
+			v, err := rt.RunString(src)
+			if !assert.NoError(t, err) {
+				return
+			}
+			d, err := ToDuration(v)
+			if data.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, data.d, d)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package compiler
 
 import (
+	"errors"
 	"time"
 
 	"github.com/GeertJohan/go.rice"
@@ -55,10 +56,22 @@ func (c *Compiler) Transform(src, filename string) (code string, srcmap SourceMa
 		opts[k] = v
 	}
 	opts["filename"] = filename
+	if IsTypeScript(filename) {
+		if err := checkTypeScript(src, filename); err != nil {
+			return code, srcmap, err
+		}
+		// Stripping types moves code around within lines, so errors need mapping back.
+		opts["presets"] = []string{"latest", "flow"}
+		opts["sourceMaps"] = true
+	}
 
 	startTime := time.Now()
 	v, err := c.transform(c.this, c.vm.ToValue(src), c.vm.ToValue(opts))
 	if err != nil {
+		// Babel's errors already come with a code frame; where in Babel they were thrown is noise.
+		if e, ok := err.(*goja.Exception); ok {
+			err = errors.New(e.Value().String())
+		}
 		return code, srcmap, err
 	}
 	log.WithField("t", time.Since(startTime)).Debug("Babel: Transformed")
@@ -56,3 +56,118 @@ func TestTransform(t *testing.T) {
 		// assert.Equal(t, "aAAA,SAASA,GAAT,CAAaC,CAAb,EAAgBC,CAAhB,EAAmB;AACf,WAAOD,IAAIC,CAAX;AACH;;AAED,IAAIC,MAAMH,IAAI,CAAJ,EAAO,CAAP,CAAV", srcmap.Mappings)
 	})
 }
+
+func TestCompile(t *testing.T) {
+	t.Run("ES6", func(t *testing.T) {
+		pgm, code, err := Compile("let a = () => 1;", "test.js", CompatibilityModeES6)
+		assert.NoError(t, err)
+		assert.NotNil(t, pgm)
+		assert.NotContains(t, code, "=>")
+	})
+	t.Run("ES5", func(t *testing.T) {
+		pgm, code, err := Compile("var a = function() { return 1; };", "test.js", CompatibilityModeES5)
+		assert.NoError(t, err)
+		assert.NotNil(t, pgm)
+		assert.Equal(t, "var a = function() { return 1; };", code)
+	})
+	t.Run("TypeScript", func(t *testing.T) {
+		pgm, code, err := Compile(strings.Join([]string{
+			`interface Point { x: number; y: number }`,
+			`type Points = Array<Point>;`,
+			`function sum(points: Points): number {`,
+			`    return points.reduce((acc: number, p: Point) => acc + p.x + p.y, 0);`,
+			`}`,
+			`let total: number = sum([{ x: 1, y: 2 }]);`,
+		}, "\n"), "test.ts", CompatibilityModeES6)
+		if assert.NoError(t, err) {
+			assert.NotNil(t, pgm)
+			assert.NotContains(t, code, "interface")
+			assert.NotContains(t, code, ": number")
+			assert.Equal(t, 6, len(strings.Split(code, "\n")), "lines weren't retained")
+		}
+
+		t.Run("ES5", func(t *testing.T) {
+			_, _, err := Compile("let a: number = 1;", "test.ts", CompatibilityModeES5)
+			assert.EqualError(t, err, "test.ts: TypeScript needs the es6 compatibility mode")
+		})
+		t.Run("Not TypeScript", func(t *testing.T) {
+			_, _, err := Compile("let a: number = 1;", "test.js", CompatibilityModeES6)
+			assert.Error(t, err)
+		})
+		t.Run("Unsupported", func(t *testing.T) {
+			_, _, err := Compile("let a = 1;\nenum Color { Red }", "test.ts", CompatibilityModeES6)
+			assert.EqualError(t, err, "test.ts: Line 2:1 enums aren't supported in TypeScript files; "+
+				"only type annotations, interfaces and type aliases are stripped")
+		})
+		t.Run("SourceMap", func(t *testing.T) {
+			src := "let a = 1;\nfunction f(x: number, y: number): number { return x + y; }"
+			_, code, srcmap, err := CompileWithSourceMap(src, "test.ts", CompatibilityModeES6)
+			if !assert.NoError(t, err) {
+				return
+			}
+			// The return statement moves left when the types are stripped; it's mapped back.
+			line, col, ok := srcmap.OriginalPosition(2, strings.Index(strings.Split(code, "\n")[1], "return")+1)
+			assert.True(t, ok)
+			assert.Equal(t, 2, line)
+			assert.Equal(t, strings.Index(strings.Split(src, "\n")[1], "return")+1, col)
+
+			_, _, srcmap, err = CompileWithSourceMap("let a = 1;", "test.js", CompatibilityModeES6)
+			assert.NoError(t, err)
+			assert.Equal(t, "", srcmap.Mappings)
+		})
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, _, err := Compile("", "test.js", "es2049")
+		assert.EqualError(t, err, "invalid compatibility mode: es2049")
+	})
+}
+
+func TestCheckTypeScript(t *testing.T) {
+	unsupported := map[string]string{
+		"enum Color { Red, Green }":                    "1:1 enums",
+		"const enum Color { Red }":                     "1:7 enums",
+		"namespace Shapes { export let a = 1; }":       "1:1 namespaces",
+		"namespace A.B { }":                            "1:1 namespaces",
+		`declare module "foo" { }`:                     "1:9 namespaces",
+		"let a = b as string;":                         "1:11 type assertions with as",
+		"let a = (b) as any;":                          "1:13 type assertions with as",
+		"let a = {} as Foo;":                           "1:12 type assertions with as",
+		"let a = b!.c;":                                "1:10 non-null assertions",
+		"f(a!);":                                       "1:4 non-null assertions",
+		"class A { private x: number = 1; }":           "1:11 access modifiers",
+		"class A { constructor(public x: number) {} }": "1:23 access modifiers",
+		"interface A { readonly x: number }":           "1:15 readonly modifiers",
+		"let s = 'a';\n/* enum */\nlet b = c as any;":  "3:11 type assertions with as",
+	}
+	for src, expected := range unsupported {
+		t.Run(src, func(t *testing.T) {
+			err := checkTypeScript(src, "test.ts")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "test.ts: Line "+expected+" aren't supported")
+			}
+		})
+	}
+
+	supported := []string{
+		`import { a as b } from "./a.ts";`,
+		`import def, { a as b, c } from "./a.ts";`,
+		`import * as all from "./a.ts";`,
+		`export { a as b };`,
+		`export * as all from "./a.ts";`,
+		`let a = b !== c && !d && e != f;`,
+		`function f() { return!a; }`,
+		`let s = "x as any, enum E { }, a!.b"; let t = 'private x';`,
+		"let t = `namespace N { ${a} }`;",
+		`// let a = b as any;`,
+		`/* a!.b */`,
+		`let r = /a!b as c/g.test(s);`,
+		`let o = { private: 1, readonly: 2, as: 3 }; let as = o.as;`,
+		`let module = {}; module.exports = 1;`,
+		`let n = x / y / z;`,
+	}
+	for _, src := range supported {
+		t.Run(src, func(t *testing.T) {
+			assert.NoError(t, checkTypeScript(src, "test.ts"))
+		})
+	}
+}
@@ -1,15 +1,71 @@
 package compiler
 
-func init() {
-	c, err := New()
-	if err != nil {
-		panic(err)
-	}
-	DefaultCompiler = c
-}
+import (
+	"sync"
+
+	"github.com/dop251/goja"
+	"github.com/pkg/errors"
+)
+
+// Compatibility modes, which decide what dialect of JS scripts are written in.
+const (
+	// Modern JS (ES6+), transformed into ES5 with Babel before being run. The default.
+	CompatibilityModeES6 = "es6"
 
-var DefaultCompiler *Compiler
+	// Plain ES5, run as-is, which skips loading Babel and transforming scripts. Modules must be
+	// written CommonJS-style: `var http = require("k6/http"); exports.default = function() {};`
+	CompatibilityModeES5 = "es5"
+)
+
+// The default compiler is only loaded when it's first used, as loading Babel takes a while.
+var (
+	defaultCompiler     *Compiler
+	defaultCompilerOnce sync.Once
+)
+
+func DefaultCompiler() *Compiler {
+	defaultCompilerOnce.Do(func() {
+		c, err := New()
+		if err != nil {
+			panic(err)
+		}
+		defaultCompiler = c
+	})
+	return defaultCompiler
+}
 
 func Transform(src, filename string) (code string, srcmap SourceMap, err error) {
-	return DefaultCompiler.Transform(src, filename)
+	return DefaultCompiler().Transform(src, filename)
+}
+
+// Compiles a script written in the given compatibility mode, returning both the program and the
+// code it was compiled from. An empty mode means CompatibilityModeES6.
+func Compile(src, filename, mode string) (*goja.Program, string, error) {
+	pgm, code, _, err := CompileWithSourceMap(src, filename, mode)
+	return pgm, code, err
+}
+
+// Like Compile, but also returns the source map of the transform, to map positions in the code
+// back to the source. Only TypeScript sources have one, as Babel retains lines, but not columns,
+// when it strips types; for anything else, its mappings are empty.
+func CompileWithSourceMap(src, filename, mode string) (*goja.Program, string, SourceMap, error) {
+	code := src
+	var srcmap SourceMap
+	switch mode {
+	case "", CompatibilityModeES6:
+		var err error
+		if code, srcmap, err = Transform(src, filename); err != nil {
+			return nil, "", srcmap, err
+		}
+	case CompatibilityModeES5:
+		// Type annotations have to be stripped before anything can run it.
+		if IsTypeScript(filename) {
+			return nil, "", srcmap, errors.Errorf("%s: TypeScript needs the %s compatibility mode", filename, CompatibilityModeES6)
+		}
+	default:
+		return nil, "", srcmap, errors.Errorf("invalid compatibility mode: %s", mode)
+	}
+
+	pgm, err := goja.Compile(filename, code, true)
+	return pgm, code, srcmap, err
 }
@@ -1,5 +1,9 @@
 package compiler
 
+import (
+	"strings"
+)
+
 type SourceMap struct {
 	Version    int
 	File       string
@@ -8,3 +12,67 @@ type SourceMap struct {
 	Names      []string
 	Mappings   string
 }
+
+// Maps a position in the transformed code back to the source it was transformed from; lines and
+// columns are 1-indexed, as in goja's error messages. Positions on a line without mappings, or
+// before the first one on it, are returned as they are, with false.
+func (m SourceMap) OriginalPosition(line, col int) (int, int, bool) {
+	// Every line's mappings are separated by a ";", and every mapping on a line by a ",". Each is
+	// a list of base64 VLQ values: the generated column, the source index, the source line and
+	// column, and optionally a name index. Only the generated column restarts every line; the
+	// rest are relative to the previous mapping's, wherever it is.
+	var srcLine, srcCol int
+	for i, lineMappings := range strings.Split(m.Mappings, ";") {
+		genCol := 0
+		found := false
+		var foundLine, foundCol int
+		for _, mapping := range strings.Split(lineMappings, ",") {
+			values, ok := decodeVLQ(mapping)
+			if !ok || len(values) == 0 {
+				continue
+			}
+			genCol += values[0]
+			if len(values) < 4 {
+				continue
+			}
+			srcLine += values[2]
+			srcCol += values[3]
+			if i == line-1 && genCol <= col-1 {
+				found, foundLine, foundCol = true, srcLine, srcCol+(col-1-genCol)
+			}
+		}
+		if i == line-1 {
+			if !found {
+				return line, col, false
+			}
+			return foundLine + 1, foundCol + 1, true
+		}
+	}
+	return line, col, false
+}
+
+const vlqChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// Decodes a source map segment's base64 VLQ values.
+func decodeVLQ(s string) ([]int, bool) {
+	var values []int
+	value, shift := 0, uint(0)
+	for _, c := range s {
+		digit := strings.IndexRune(vlqChars, c)
+		if digit == -1 {
+			return nil, false
+		}
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			continue
+		}
+		if value&1 != 0 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	return values, shift == 0
+}
@@ -0,0 +1,173 @@
+package compiler
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Extensions of TypeScript sources. These are transformed with Babel's Flow preset, which strips
+// type annotations, aliases, interfaces and generics, as the two share the syntax for them.
+// TypeScript-only constructs the Flow preset can't parse are rejected up front by
+// checkTypeScript(), rather than failing with a generic syntax error.
+var TypeScriptExts = []string{".ts"}
+
+// Returns whether a file is a TypeScript source, by its extension.
+func IsTypeScript(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, tsExt := range TypeScriptExts {
+		if ext == tsExt {
+			return true
+		}
+	}
+	return false
+}
+
+// Words that can't be the operand before a type assertion or a non-null assertion.
+var tsKeywords = map[string]bool{
+	"break": true, "case": true, "const": true, "continue": true, "default": true, "delete": true,
+	"do": true, "else": true, "export": true, "extends": true, "from": true, "function": true,
+	"if": true, "import": true, "in": true, "instanceof": true, "let": true, "new": true,
+	"of": true, "return": true, "throw": true, "typeof": true, "var": true, "void": true,
+	"while": true, "yield": true, "await": true,
+}
+
+// A token of a TypeScript source, as far as checkTypeScript() cares: a word (an identifier, keyword
+// or number), a string, template literal or regexp, or else a single punctuation character.
+type tsToken struct {
+	text       string
+	word, str  bool
+	line, col  int
+	start, end int
+}
+
+// Returns whether a token can end an operand, eg. x in "x as T" or "x!".
+func (t tsToken) isOperand() bool {
+	return (t.word && !tsKeywords[t.text]) || t.str || t.text == ")" || t.text == "]"
+}
+
+// Rejects the TypeScript-only constructs Babel's Flow preset can't strip, with an error pointing
+// out the first one found; positions are given as "filename: Line 1:2", like the parser's.
+func checkTypeScript(src, filename string) error {
+	tokens := tokenizeTypeScript(src)
+	token := func(i int) tsToken {
+		if i < 0 || i >= len(tokens) {
+			return tsToken{}
+		}
+		return tokens[i]
+	}
+	unsupported := func(t tsToken, what string) error {
+		return errors.Errorf(
+			"%s: Line %d:%d %s aren't supported in TypeScript files; only type annotations, "+
+				"interfaces and type aliases are stripped",
+			filename, t.line, t.col, what)
+	}
+
+	// Braces of import and export lists, where "a as b" renames rather than asserts a type.
+	var specifiers []bool
+	for i, t := range tokens {
+		prev, next := token(i-1), token(i+1)
+		switch {
+		case t.text == "{":
+			specifiers = append(specifiers, prev.text == "import" || prev.text == "export" ||
+				(prev.text == "," && token(i-3).text == "import"))
+		case t.text == "}":
+			if len(specifiers) > 0 {
+				specifiers = specifiers[:len(specifiers)-1]
+			}
+		case t.text == "enum" && next.word && token(i+2).text == "{":
+			return unsupported(t, "enums")
+		case (t.text == "namespace" || t.text == "module") && (next.word || next.str) &&
+			!tsKeywords[next.text] && (token(i+2).text == "{" || token(i+2).text == "."):
+			return unsupported(t, "namespaces")
+		case t.text == "as" && (prev.isOperand() || prev.text == "}") && prev.line == t.line && next.line == t.line &&
+			(next.word || next.text == "{" || next.text == "[" || next.text == "("):
+			if len(specifiers) > 0 && specifiers[len(specifiers)-1] {
+				continue
+			}
+			return unsupported(t, "type assertions with as")
+		case t.text == "!" && prev.isOperand() && prev.end == t.start && !strings.HasPrefix(src[t.end:], "="):
+			return unsupported(t, "non-null assertions")
+		case (t.text == "public" || t.text == "private" || t.text == "protected") &&
+			(next.word || next.text == "[") && next.line == t.line:
+			return unsupported(t, "access modifiers")
+		case t.text == "readonly" && (next.word || next.text == "[") && next.line == t.line:
+			return unsupported(t, "readonly modifiers")
+		}
+	}
+	return nil
+}
+
+// Splits a source into tokens, skipping whitespace, comments, and the contents of strings, template
+// literals and regular expressions. It's no parser, but good enough to tell code apart from text.
+func tokenizeTypeScript(src string) []tsToken {
+	var tokens []tsToken
+	line, lineStart := 1, 0
+	for i := 0; i < len(src); {
+		c := src[i]
+		start, startLine := i, line
+		col := i - lineStart + 1
+		switch {
+		case c == '\n':
+			line, lineStart = line+1, i+1
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			continue
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(src[i:], "/*"):
+			end := len(src)
+			if j := strings.Index(src[i+2:], "*/"); j != -1 {
+				end = i + 2 + j + 2
+			}
+			for ; i < end; i++ {
+				if src[i] == '\n' {
+					line, lineStart = line+1, i+1
+				}
+			}
+			continue
+		case c == '"' || c == '\'' || c == '`' ||
+			(c == '/' && (len(tokens) == 0 || !tokens[len(tokens)-1].isOperand())):
+			// Strings, template literals and regexps all end with an unescaped copy of the
+			// character they start with.
+			for i++; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' {
+					i++
+				} else if src[i] == '\n' {
+					line, lineStart = line+1, i+1
+				}
+			}
+			i++
+			if i > len(src) {
+				i = len(src)
+			}
+			tokens = append(tokens, tsToken{text: src[start:i], str: true, line: startLine, col: col, start: start, end: i})
+			if c == '/' {
+				for i < len(src) && isWordByte(src[i]) {
+					i++
+				}
+			}
+			continue
+		case isWordByte(c):
+			for i < len(src) && isWordByte(src[i]) {
+				i++
+			}
+			tokens = append(tokens, tsToken{text: src[start:i], word: true, line: line, col: col, start: start, end: i})
+			continue
+		}
+		i++
+		tokens = append(tokens, tsToken{text: string(c), line: line, col: col, start: start, end: i})
+	}
+	return tokens
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
@@ -21,12 +21,25 @@
 package js
 
 import (
+	"context"
+	"math"
 	"strconv"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
 )
 
+// How deep objects are inspected before they're abbreviated, eg. as "[Object]".
+const inspectDepth = 2
+
+// How many elements of an array are shown, like Node's maxArrayLength; the rest are summarised as
+// eg. "... 5 more items".
+const inspectArrayLength = 100
+
+// A Console logs messages with printf-style formatting, like console.log() in browsers or Node;
+// messages logged from a VU are tagged with its ID and iteration.
 type Console struct {
 	Logger *log.Logger
 }
@@ -35,12 +48,15 @@ func NewConsole() *Console {
 	return &Console{log.StandardLogger()}
 }
 
-func (c Console) log(level log.Level, msgobj goja.Value, args ...goja.Value) {
+func (c Console) log(ctxPtr *context.Context, level log.Level, msgobj goja.Value, args ...goja.Value) {
 	fields := make(log.Fields)
-	for i, arg := range args {
-		fields[strconv.Itoa(i)] = arg.String()
+	if ctxPtr != nil && *ctxPtr != nil {
+		if state := common.GetState(*ctxPtr); state != nil {
+			fields["vu_id"] = state.VUID
+			fields["iteration"] = state.Iteration
+		}
 	}
-	msg := msgobj.ToString()
+	msg := formatLog(msgobj, args)
 	e := c.Logger.WithFields(fields)
 	switch level {
 	case log.DebugLevel:
@@ -54,22 +70,153 @@ func (c Console) log(level log.Level, msgobj goja.Value, args ...goja.Value) {
 	}
 }
 
-func (c Console) Log(msg goja.Value, args ...goja.Value) {
-	c.Info(msg, args...)
+func (c Console) Log(ctxPtr *context.Context, msg goja.Value, args ...goja.Value) {
+	c.Info(ctxPtr, msg, args...)
+}
+
+func (c Console) Debug(ctxPtr *context.Context, msg goja.Value, args ...goja.Value) {
+	c.log(ctxPtr, log.DebugLevel, msg, args...)
+}
+
+func (c Console) Info(ctxPtr *context.Context, msg goja.Value, args ...goja.Value) {
+	c.log(ctxPtr, log.InfoLevel, msg, args...)
+}
+
+func (c Console) Warn(ctxPtr *context.Context, msg goja.Value, args ...goja.Value) {
+	c.log(ctxPtr, log.WarnLevel, msg, args...)
 }
 
-func (c Console) Debug(msg goja.Value, args ...goja.Value) {
-	c.log(log.DebugLevel, msg, args...)
+func (c Console) Error(ctxPtr *context.Context, msg goja.Value, args ...goja.Value) {
+	c.log(ctxPtr, log.ErrorLevel, msg, args...)
 }
 
-func (c Console) Info(msg goja.Value, args ...goja.Value) {
-	c.log(log.InfoLevel, msg, args...)
+// Formats a log message like Node's util.format(): if the first argument is a string, %s, %d,
+// %i, %f, %o and %O in it are replaced by the following arguments, and %% by a "%". Any leftover
+// arguments are appended, separated by spaces; strings as they are, anything else inspected.
+func formatLog(msg goja.Value, args []goja.Value) string {
+	if msg == nil {
+		return ""
+	}
+	var parts []string
+	if s, ok := msg.Export().(string); ok {
+		var buf []byte
+		for i := 0; i < len(s); i++ {
+			if s[i] != '%' || i+1 == len(s) {
+				buf = append(buf, s[i])
+				continue
+			}
+			verb := s[i+1]
+			if verb == '%' {
+				buf = append(buf, '%')
+				i++
+				continue
+			}
+			if !strings.ContainsRune("sdifoO", rune(verb)) || len(args) == 0 {
+				buf = append(buf, s[i])
+				continue
+			}
+			arg := args[0]
+			args = args[1:]
+			i++
+			switch verb {
+			case 's':
+				if str, ok := arg.Export().(string); ok {
+					buf = append(buf, str...)
+				} else {
+					buf = append(buf, inspect(arg, 0)...)
+				}
+			case 'd', 'f':
+				buf = append(buf, formatNumber(arg.ToFloat())...)
+			case 'i':
+				buf = append(buf, formatNumber(float64(arg.ToInteger()))...)
+			case 'o', 'O':
+				buf = append(buf, inspect(arg, 0)...)
+			}
+		}
+		parts = append(parts, string(buf))
+	} else {
+		parts = append(parts, inspect(msg, 0))
+	}
+	for _, arg := range args {
+		if str, ok := arg.Export().(string); ok {
+			parts = append(parts, str)
+		} else {
+			parts = append(parts, inspect(arg, 0))
+		}
+	}
+	return strings.Join(parts, " ")
 }
 
-func (c Console) Warn(msg goja.Value, args ...goja.Value) {
-	c.log(log.WarnLevel, msg, args...)
+// Renders a value for a log message, eg. { a: 1, b: [ 'x', 'y' ] }; objects nested deeper than
+// inspectDepth are abbreviated, which also keeps cyclic ones from recursing forever.
+func inspect(v goja.Value, depth int) string {
+	switch {
+	case v == nil || goja.IsUndefined(v):
+		return "undefined"
+	case goja.IsNull(v):
+		return "null"
+	}
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		if s, ok := v.Export().(string); ok && depth > 0 {
+			return "'" + s + "'"
+		}
+		return v.String()
+	}
+
+	switch obj.ClassName() {
+	case "Function":
+		if name := obj.Get("name"); name != nil && name.String() != "" {
+			return "[Function: " + name.String() + "]"
+		}
+		return "[Function]"
+	case "Error", "Date", "RegExp":
+		return v.String()
+	case "Array":
+		if depth >= inspectDepth {
+			return "[Array]"
+		}
+		length := int(obj.Get("length").ToInteger())
+		if length == 0 {
+			return "[]"
+		}
+		n := length
+		if n > inspectArrayLength {
+			n = inspectArrayLength
+		}
+		items := make([]string, n, n+1)
+		for i := range items {
+			items[i] = inspect(obj.Get(strconv.Itoa(i)), depth+1)
+		}
+		switch rest := length - n; {
+		case rest == 1:
+			items = append(items, "... 1 more item")
+		case rest > 1:
+			items = append(items, "... "+strconv.Itoa(rest)+" more items")
+		}
+		return "[ " + strings.Join(items, ", ") + " ]"
+	}
+
+	keys := obj.Keys()
+	if len(keys) == 0 {
+		return "{}"
+	}
+	if depth >= inspectDepth {
+		return "[Object]"
+	}
+	items := make([]string, len(keys))
+	for i, k := range keys {
+		items[i] = k + ": " + inspect(obj.Get(k), depth+1)
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
 }
 
-func (c Console) Error(msg goja.Value, args ...goja.Value) {
-	c.log(log.ErrorLevel, msg, args...)
+func formatNumber(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
@@ -23,6 +23,7 @@ package js
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	log "github.com/Sirupsen/logrus"
@@ -40,14 +41,22 @@ func TestConsole(t *testing.T) {
 		"warn":  log.WarnLevel,
 		"error": log.ErrorLevel,
 	}
-	argsets := map[string]struct {
-		Message string
-		Data    log.Fields
-	}{
-		`"string"`:         {Message: "string"},
-		`"string","a","b"`: {Message: "string", Data: log.Fields{"0": "a", "1": "b"}},
-		`"string",1,2`:     {Message: "string", Data: log.Fields{"0": "1", "1": "2"}},
-		`{}`:               {Message: "[object Object]"},
+	argsets := map[string]string{
+		`"string"`:                   "string",
+		`"string","a","b"`:           "string a b",
+		`"string",1,2`:               "string 1 2",
+		`{}`:                         "{}",
+		`"%s: %d%%", "progress", 50`: "progress: 50%",
+		`"%i items", 4.7`:            "4 items",
+		`"%f", 1.5, "left", "over"`:  "1.5 left over",
+		`"%s %s", "one"`:             "one %s",
+		`"obj: %o", {a: 1, b: "x"}`:  "obj: { a: 1, b: 'x' }",
+		`{a: [1, {b: {c: 1}}]}`:      "{ a: [ 1, [Object] ] }",
+		`[1, "a", null, undefined]`:  "[ 1, 'a', null, undefined ]",
+		`"fn", function named() {}`:  "fn [Function: named]",
+		`"err", new Error("oops")`:   "err Error: oops",
+		`new Array(101)`:             "[ " + strings.Repeat("undefined, ", 100) + "... 1 more item ]",
+		`new Array(1e8)`:             "[ " + strings.Repeat("undefined, ", 100) + "... 99999900 more items ]",
 	}
 	for name, level := range levels {
 		t.Run(name, func(t *testing.T) {
@@ -75,13 +84,8 @@ func TestConsole(t *testing.T) {
 					entry := hook.LastEntry()
 					if assert.NotNil(t, entry, "nothing logged") {
 						assert.Equal(t, level, entry.Level)
-						assert.Equal(t, result.Message, entry.Message)
-
-						data := result.Data
-						if data == nil {
-							data = make(log.Fields)
-						}
-						assert.Equal(t, data, entry.Data)
+						assert.Equal(t, result, entry.Message)
+						assert.Equal(t, log.Fields{"vu_id": int64(0), "iteration": int64(0)}, entry.Data)
 					}
 				})
 			}
@@ -0,0 +1,144 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// A callback scheduled with setTimeout() or setInterval().
+type timer struct {
+	id     int64
+	at     time.Time
+	repeat time.Duration
+	fn     goja.Callable
+	args   []goja.Value
+}
+
+// A VU's event loop. Timers and promise callbacks aren't run while the default function is; once
+// it returns, they're run in the order they're due, and the iteration only ends when none are
+// left. Like the runtime itself, it's not safe for concurrent use.
+type EventLoop struct {
+	timers map[int64]*timer
+	lastID int64
+
+	// Runs promise callbacks; nil if the runtime has no Promise polyfill.
+	promises *promiseHooks
+}
+
+func NewEventLoop() *EventLoop {
+	return &EventLoop{timers: make(map[int64]*timer)}
+}
+
+// Schedules fn to be called after delay, every delay if repeat is set, and returns its ID.
+func (l *EventLoop) Add(fn goja.Callable, delay time.Duration, repeat bool, args []goja.Value) int64 {
+	l.lastID++
+	t := &timer{id: l.lastID, at: time.Now().Add(delay), fn: fn, args: args}
+	if repeat {
+		// Like browsers, don't let intervals spin without yielding.
+		t.repeat = delay
+		if t.repeat < time.Millisecond {
+			t.repeat = time.Millisecond
+		}
+	}
+	l.timers[t.id] = t
+	return t.id
+}
+
+// Cancels a timer; unknown IDs are ignored.
+func (l *EventLoop) Clear(id int64) {
+	delete(l.timers, id)
+}
+
+// Drops all pending timers and promise callbacks.
+func (l *EventLoop) Reset() {
+	l.timers = make(map[int64]*timer)
+	if l.promises != nil {
+		l.promises.Reset()
+	}
+}
+
+// Returns the number of pending timers.
+func (l *EventLoop) Len() int {
+	return len(l.timers)
+}
+
+// Runs promise callbacks and timers until there are none left; promise callbacks go first, as
+// they do in browsers. An error thrown by a timer stops the loop and is returned; if ctx is done
+// first, the loop stops without an error, much like sleep(). Either way, anything left is dropped.
+func (l *EventLoop) Run(ctx context.Context) error {
+	defer l.Reset()
+	for {
+		if l.promises != nil {
+			if err := l.promises.RunJobs(); err != nil {
+				return err
+			}
+		}
+		if len(l.timers) == 0 {
+			return nil
+		}
+
+		t := l.next()
+		if d := t.at.Sub(time.Now()); d > 0 {
+			wait := time.NewTimer(d)
+			select {
+			case <-wait.C:
+			case <-ctx.Done():
+				wait.Stop()
+				return nil
+			}
+		}
+
+		// The callback may clear its own timer, so reschedule or remove it first.
+		if t.repeat > 0 {
+			t.at = time.Now().Add(t.repeat)
+		} else {
+			delete(l.timers, t.id)
+		}
+		if _, err := t.fn(goja.Undefined(), t.args...); err != nil {
+			return err
+		}
+	}
+}
+
+// Returns the timer that's due first; those due at the same time run in the order they were set.
+func (l *EventLoop) next() *timer {
+	var next *timer
+	for _, t := range l.timers {
+		if next == nil || t.at.Before(next.at) || (t.at.Equal(next.at) && t.id < next.id) {
+			next = t
+		}
+	}
+	return next
+}
+
+// Converts a delay in milliseconds, as passed to setTimeout() and setInterval(), to a duration;
+// like in browsers, negative and non-numeric delays mean 0.
+func timerDelay(ms float64) time.Duration {
+	if math.IsNaN(ms) || ms < 0 {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,180 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventLoop(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		export default function() {
+			let calls = __VU_STATE__.calls = [];
+			setTimeout((a, b) => calls.push("timeout " + a + b), 50, "x", "y");
+			setTimeout(() => calls.push("first"), 0);
+			clearTimeout(setTimeout(() => calls.push("cleared"), 10));
+			let n = 0;
+			let id = setInterval(() => {
+				calls.push("interval " + (++n));
+				if (n == 3) { clearInterval(id); }
+			}, 5);
+			calls.push("sync");
+		}
+		export function forever() { setInterval(() => {}, 1); }
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("order", func(t *testing.T) {
+		start := time.Now()
+		_, err := vu.RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, time.Since(start) >= 50*time.Millisecond, "iteration didn't wait for timers")
+
+		calls, err := vu.Runtime.RunString(`__VU_STATE__.calls`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []interface{}{
+				"sync", "first", "interval 1", "interval 2", "interval 3", "timeout xy",
+			}, calls.Export())
+		}
+		assert.Equal(t, 0, vu.VUContext.loop.Len())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		if !assert.NoError(t, vu.SetScenario("forever", "forever")) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = vu.RunOnce(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, vu.VUContext.loop.Len())
+	})
+}
+
+func TestEventLoopError(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		export default function() {
+			setTimeout(() => { throw new Error("oops"); }, 1);
+			setTimeout(() => { __VU_STATE__.ran = true; }, 10);
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = vu.RunOnce(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Error: oops")
+	}
+	assert.Equal(t, 0, vu.VUContext.loop.Len())
+
+	ran, err := vu.Runtime.RunString(`__VU_STATE__.ran`)
+	if assert.NoError(t, err) {
+		assert.Nil(t, ran.Export())
+	}
+}
+
+func TestEventLoopPromises(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		let initValue;
+		Promise.resolve("init").then(v => { initValue = v; });
+
+		export default async function() {
+			let v = await new Promise(resolve => setTimeout(() => resolve(41), 5));
+			__VU_STATE__.v = v + 1;
+			__VU_STATE__.init = initValue;
+		}
+		export async function fails() {
+			await null;
+			throw new Error("bad");
+		}
+		export async function caught() {
+			try {
+				await Promise.reject(new Error("bad"));
+			} catch (e) {
+				__VU_STATE__.caught = e.message;
+			}
+		}
+		export function never() { return new Promise(() => {}); }
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("await", func(t *testing.T) {
+		_, err := vu.RunOnce(context.Background())
+		assert.NoError(t, err)
+		v, err := vu.Runtime.RunString(`__VU_STATE__.v + " " + __VU_STATE__.init`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "42 init", v.Export())
+		}
+	})
+	t.Run("rejected", func(t *testing.T) {
+		assert.NoError(t, vu.SetScenario("fails", "fails"))
+		_, err := vu.RunOnce(context.Background())
+		assert.EqualError(t, err, "Error: bad")
+	})
+	t.Run("caught", func(t *testing.T) {
+		assert.NoError(t, vu.SetScenario("caught", "caught"))
+		_, err := vu.RunOnce(context.Background())
+		assert.NoError(t, err)
+		v, err := vu.Runtime.RunString(`__VU_STATE__.caught`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "bad", v.Export())
+		}
+	})
+	t.Run("never", func(t *testing.T) {
+		assert.NoError(t, vu.SetScenario("never", "never"))
+		_, err := vu.RunOnce(context.Background())
+		assert.EqualError(t, err, "promise never settled")
+	})
+}
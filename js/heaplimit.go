@@ -0,0 +1,81 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// How often iterations check the heap size against Options.MaxHeapSize; reading it stops the
+// world, so it's also cached for this long, and shared by all VUs.
+const heapCheckInterval = 100 * time.Millisecond
+
+// A HeapLimitError is returned by VUs whose iteration was aborted because the heap outgrew
+// Options.MaxHeapSize; possibly wrapped in an IterationError.
+type HeapLimitError struct {
+	Heap, Limit uint64
+}
+
+func (e HeapLimitError) Error() string {
+	return fmt.Sprintf(
+		"heap size of %.1f MB exceeds maxHeapSize of %.1f MB; the iteration was aborted",
+		float64(e.Heap)/(1<<20), float64(e.Limit)/(1<<20))
+}
+
+// The process' heap size, as last read. goja doesn't account for allocations per runtime, so the
+// limit is enforced on the process as a whole: whichever iterations are running once it's
+// exceeded are aborted, whether or not they're the ones to blame.
+var heapSize struct {
+	sync.Mutex
+	bytes  uint64
+	readAt time.Time
+	gcAt   time.Time
+}
+
+// Returns a HeapLimitError if the heap is larger than limit. Garbage is collected before giving
+// up, so that only memory that's actually still in use counts against it; at most once every
+// heapCheckInterval, however many VUs are asking, as it stops the world.
+func checkHeapSize(limit uint64) error {
+	heapSize.Lock()
+	defer heapSize.Unlock()
+
+	if time.Since(heapSize.readAt) >= heapCheckInterval {
+		heapSize.bytes, heapSize.readAt = readHeapSize(), time.Now()
+	}
+	if heapSize.bytes > limit && time.Since(heapSize.gcAt) >= heapCheckInterval {
+		runtime.GC()
+		heapSize.bytes, heapSize.readAt = readHeapSize(), time.Now()
+		heapSize.gcAt = heapSize.readAt
+	}
+	if heapSize.bytes <= limit {
+		return nil
+	}
+	return HeapLimitError{Heap: heapSize.bytes, Limit: limit}
+}
+
+func readHeapSize() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
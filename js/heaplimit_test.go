@@ -0,0 +1,46 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckHeapSize(t *testing.T) {
+	assert.NoError(t, checkHeapSize(1<<62))
+
+	t.Run("Exceeded", func(t *testing.T) {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		for i := 0; i < 10; i++ {
+			err := checkHeapSize(1)
+			if assert.IsType(t, HeapLimitError{}, err) {
+				assert.Equal(t, uint64(1), err.(HeapLimitError).Limit)
+			}
+		}
+		runtime.ReadMemStats(&after)
+		// Only the first check collects garbage; the rest reuse its result.
+		assert.True(t, after.NumGC-before.NumGC <= 2, "%d GCs", after.NumGC-before.NumGC)
+	})
+}
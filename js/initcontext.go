@@ -22,8 +22,6 @@ package js
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"strings"
 
 	"github.com/dop251/goja"
@@ -31,6 +29,7 @@ import (
 	"github.com/loadimpact/k6/js/compiler"
 	"github.com/loadimpact/k6/js/modules"
 	"github.com/loadimpact/k6/loader"
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 )
 
@@ -46,10 +45,34 @@ type InitContext struct {
 	fs  afero.Fs
 	pwd string
 
+	// Filesystem to stream files from; unlike fs, this is kept around for bound contexts, as the
+	// files it serves are only read when they're used.
+	streamFs afero.Fs
+
+	// Dialect of JS imported files are written in; see compiler.CompatibilityModeES6.
+	compatibilityMode string
+
 	// Cache of loaded programs and files.
 	programs map[string]*goja.Program
 	files    map[string][]byte
 
+	// Compiled code of loaded scripts, by filename, for pointing out where errors occurred. For
+	// TypeScript files, it's the source instead, and locations are mapped back to it with the
+	// source maps of their transforms.
+	sources    map[string]string
+	sourceMaps map[string]compiler.SourceMap
+
+	// Data of SharedArrays, which is only built by the first context that makes each one.
+	sharedArrays *sharedArrays
+
+	// Records custom metrics declared by the script; only set for the bundle's base context, as
+	// VUs declare the same ones again.
+	metrics *common.MetricRegistry
+
+	// Module objects of files required into this runtime, so each one is only run once, and
+	// circular requires get the partially filled exports rather than recursing forever.
+	modules map[string]*goja.Object
+
 	// Console object.
 	Console *Console
 }
@@ -61,8 +84,16 @@ func NewInitContext(rt *goja.Runtime, ctxPtr *context.Context, fs afero.Fs, pwd
 		fs:      fs,
 		pwd:     pwd,
 
+		streamFs: fs,
+
 		programs: make(map[string]*goja.Program),
 		files:    make(map[string][]byte),
+		sources:  make(map[string]string),
+		modules:  make(map[string]*goja.Object),
+
+		sourceMaps: make(map[string]compiler.SourceMap),
+
+		sharedArrays: newSharedArrays(),
 
 		Console: NewConsole(),
 	}
@@ -76,13 +107,33 @@ func newBoundInitContext(base *InitContext, ctxPtr *context.Context, rt *goja.Ru
 		fs:  nil,
 		pwd: base.pwd,
 
+		streamFs: base.streamFs,
+
+		compatibilityMode: base.compatibilityMode,
+
 		programs: base.programs,
 		files:    base.files,
+		sources:  base.sources,
+		modules:  make(map[string]*goja.Object),
+
+		sourceMaps: base.sourceMaps,
+
+		sharedArrays: base.sharedArrays,
 
 		Console: base.Console,
 	}
 }
 
+// Records a loaded script's source, for pointing out where errors occurred in it; see sources.
+func (i *InitContext) addSource(filename, src, code string, srcmap compiler.SourceMap) {
+	if srcmap.Mappings == "" {
+		i.sources[filename] = code
+		return
+	}
+	i.sources[filename] = src
+	i.sourceMaps[filename] = srcmap
+}
+
 func (i *InitContext) Require(arg string) goja.Value {
 	switch {
 	case arg == "k6", strings.HasPrefix(arg, "k6/"):
@@ -106,7 +157,7 @@ func (i *InitContext) Require(arg string) goja.Value {
 func (i *InitContext) requireModule(name string) (goja.Value, error) {
 	mod, ok := modules.Index[name]
 	if !ok {
-		return nil, errors.New(fmt.Sprintf("unknown builtin module: %s", name))
+		return nil, errors.Errorf("unknown builtin module: %s", name)
 	}
 	return i.runtime.ToValue(common.Bind(i.runtime, mod, i.ctxPtr)), nil
 }
@@ -115,6 +166,9 @@ func (i *InitContext) requireFile(name string) (goja.Value, error) {
 	// Resolve the file path, push the target directory as pwd to make relative imports work.
 	pwd := i.pwd
 	filename := loader.Resolve(pwd, name)
+	if module, ok := i.modules[filename]; ok {
+		return module.Get("exports"), nil
+	}
 	i.pwd = loader.Dir(filename)
 	defer func() { i.pwd = pwd }()
 
@@ -129,23 +183,23 @@ func (i *InitContext) requireFile(name string) (goja.Value, error) {
 	module := i.runtime.NewObject()
 	_ = module.Set("exports", exports)
 	i.runtime.Set("module", module)
+	i.modules[filename] = module
 
-	// Read sources, transform into ES6 and cache the compiled program.
+	// Read sources, transform into ES5 if needed and cache the compiled program.
 	pgm, ok := i.programs[filename]
 	if !ok {
 		data, err := loader.Load(i.fs, pwd, name)
 		if err != nil {
+			delete(i.modules, filename)
 			return goja.Undefined(), err
 		}
-		src, _, err := compiler.Transform(string(data.Data), data.Filename)
-		if err != nil {
-			return goja.Undefined(), err
-		}
-		pgm_, err := goja.Compile(data.Filename, src, true)
+		pgm_, code, srcmap, err := compiler.CompileWithSourceMap(string(data.Data), data.Filename, i.compatibilityMode)
 		if err != nil {
+			delete(i.modules, filename)
 			return goja.Undefined(), err
 		}
 		i.programs[filename] = pgm_
+		i.addSource(data.Filename, string(data.Data), code, srcmap)
 		pgm = pgm_
 	}
 
@@ -153,22 +207,72 @@ func (i *InitContext) requireFile(name string) (goja.Value, error) {
 	// imported file to access or overwrite globals defined outside of it. Please don't do anything
 	// stupid with this, consider *any* use of it undefined behavior >_>;;
 	if _, err := i.runtime.RunProgram(pgm); err != nil {
+		delete(i.modules, filename)
 		return goja.Undefined(), err
 	}
 
 	return module.Get("exports"), nil
 }
 
-func (i *InitContext) Open(name string) (string, error) {
+// Opens a file and returns its contents. With the "b" mode, a *common.FileStream is returned
+// instead, which can be passed as a request body to upload the file without loading it. Files are
+// read once, when the script is first loaded, and shared by all VUs.
+func (i *InitContext) Open(name string, mode ...string) (goja.Value, error) {
+	if len(mode) > 0 {
+		switch mode[0] {
+		case "":
+		case "b":
+			return i.openStream(name)
+		default:
+			return goja.Undefined(), errors.Errorf("invalid mode: %s", mode[0])
+		}
+	}
+
 	filename := loader.Resolve(i.pwd, name)
 	data, ok := i.files[filename]
 	if !ok {
 		data_, err := loader.Load(i.fs, i.pwd, name)
 		if err != nil {
-			return "", err
+			return goja.Undefined(), err
 		}
 		i.files[filename] = data_.Data
 		data = data_.Data
 	}
-	return string(data), nil
+	return i.runtime.ToValue(string(data)), nil
+}
+
+func (i *InitContext) openStream(name string) (goja.Value, error) {
+	filename := loader.Resolve(i.pwd, name)
+	if !strings.HasPrefix(filename, "/") || !strings.HasPrefix(i.pwd, "/") {
+		return goja.Undefined(), errors.Errorf("only local files can be streamed: %s", name)
+	}
+	stream, err := common.NewFileStream(i.streamFs, filename)
+	if err != nil {
+		return goja.Undefined(), err
+	}
+	return i.runtime.ToValue(stream), nil
+}
+
+// Makes a SharedArray, eg. new SharedArray("users", function() { return JSON.parse(open("users.json")); }).
+// The function is only called the first time an array with the name is made, which is when the
+// script is first loaded; VUs get the data it returned, rather than calling it again. Items are
+// read with get(i) and slice(), not by indexing; see SharedArray.
+func (i *InitContext) XSharedArray(name string, fn goja.Callable) (*SharedArray, error) {
+	if name == "" {
+		return nil, errors.New("SharedArray needs a name")
+	}
+	data, ok := i.sharedArrays.get(name)
+	if !ok {
+		// The lock isn't held while fn runs, so it may make SharedArrays of its own.
+		v, err := fn(goja.Undefined())
+		if err != nil {
+			return nil, err
+		}
+		built, err := newSharedArrayData(name, v)
+		if err != nil {
+			return nil, err
+		}
+		data = i.sharedArrays.set(name, built)
+	}
+	return &SharedArray{Length: len(data.items), data: data, rt: i.runtime}, nil
 }
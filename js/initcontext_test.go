@@ -21,16 +21,24 @@
 package js
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
 	"testing"
 
 	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/modules"
 	"github.com/loadimpact/k6/lib"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 )
 
+type testExtension struct{}
+
+func (*testExtension) Echo(s string) string { return s }
+
 func TestInitContextRequire(t *testing.T) {
 	t.Run("Modules", func(t *testing.T) {
 		t.Run("Nonexistent", func(t *testing.T) {
@@ -41,6 +49,28 @@ func TestInitContextRequire(t *testing.T) {
 			assert.EqualError(t, err, "GoError: unknown builtin module: k6/NONEXISTENT")
 		})
 
+		t.Run("Extension", func(t *testing.T) {
+			modules.Register("k6/x/test-initcontext", &testExtension{})
+			b, err := NewBundle(&lib.SourceData{
+				Filename: "/script.js",
+				Data: []byte(`
+					import { hasFeature } from "k6";
+					import { echo } from "k6/x/test-initcontext";
+					if (!hasFeature("k6/x/test-initcontext")) { throw new Error("feature not registered"); }
+					export let v = echo("abc123");
+					export default function() {}
+				`),
+			}, afero.NewMemMapFs())
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			bi, err := b.Instantiate()
+			if assert.NoError(t, err) {
+				assert.Equal(t, "abc123", bi.Runtime.Get("exports").ToObject(bi.Runtime).Get("v").String())
+			}
+		})
+
 		t.Run("k6", func(t *testing.T) {
 			b, err := NewBundle(&lib.SourceData{
 				Filename: "/script.js",
@@ -129,7 +159,72 @@ func TestInitContextRequire(t *testing.T) {
 				Filename: "/script.js",
 				Data:     []byte(`import "/file.js"; export default function() {}`),
 			}, fs)
-			assert.EqualError(t, err, "Error: aaaa at /file.js:1:20(3)")
+			assert.EqualError(t, err, "Error: aaaa at /file.js:1:20(3)\n"+
+				"> 1 | \"use strict\";throw new Error(\"aaaa\");\n"+
+				"    |                    ^")
+		})
+
+		t.Run("TypeScript", func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			assert.NoError(t, afero.WriteFile(fs, "/lib.ts", []byte(`
+				interface Greeting { name: string }
+				export function greet(g: Greeting): string { return "hi " + g.name; }
+			`), 0644))
+			b, err := NewBundle(&lib.SourceData{
+				Filename: "/script.js",
+				Data: []byte(`
+					import { greet } from "./lib.ts";
+					export let greeting = greet({ name: "k6" });
+					export default function() {}
+				`),
+			}, fs)
+			if assert.NoError(t, err) {
+				bi, err := b.Instantiate()
+				if assert.NoError(t, err) {
+					exports := bi.Runtime.Get("exports").ToObject(bi.Runtime)
+					assert.Equal(t, "hi k6", exports.Get("greeting").String())
+				}
+			}
+		})
+
+		t.Run("Once", func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			assert.NoError(t, afero.WriteFile(fs, "/counter.js", []byte(`
+				let global = Function("return this")();
+				global.count = (global.count || 0) + 1;
+				export let count = global.count;
+			`), 0644))
+			assert.NoError(t, afero.WriteFile(fs, "/lib/a.js", []byte(`
+				import { b } from "./b.js";
+				export let a = "a";
+				export function ab() { return a + b(); }
+			`), 0644))
+			assert.NoError(t, afero.WriteFile(fs, "/lib/b.js", []byte(`
+				import * as a from "./a.js";
+				export function b() { return "b" + a.a; }
+			`), 0644))
+			b, err := NewBundle(&lib.SourceData{
+				Filename: "/script.js",
+				Data: []byte(`
+					import { count } from "./counter.js";
+					import { count as count2 } from "/counter.js";
+					import { ab } from "./lib/a.js";
+					export let counts = [count, count2, Function("return this")().count];
+					export let abs = ab();
+					export default function() {}
+				`),
+			}, fs)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			bi, err := b.Instantiate()
+			if !assert.NoError(t, err) {
+				return
+			}
+			exports := bi.Runtime.Get("exports").ToObject(bi.Runtime)
+			assert.Equal(t, []interface{}{int64(1), int64(1), int64(1)}, exports.Get("counts").Export())
+			assert.Equal(t, "aba", exports.Get("abs").String())
 		})
 
 		imports := map[string]struct {
@@ -252,4 +347,81 @@ func TestInitContextOpen(t *testing.T) {
 		}, fs)
 		assert.EqualError(t, err, "GoError: open /nonexistent.txt: file does not exist")
 	})
+	t.Run("InvalidMode", func(t *testing.T) {
+		_, err := NewBundle(&lib.SourceData{
+			Filename: "/path/to/script.js",
+			Data:     []byte(`open("./file.txt", "x"); export default function() {}`),
+		}, fs)
+		assert.EqualError(t, err, "GoError: invalid mode: x")
+	})
+	t.Run("Cached", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		assert.NoError(t, afero.WriteFile(fs, "/data.csv", []byte("a,b\n1,2"), 0644))
+		b, err := NewBundle(&lib.SourceData{
+			Filename: "/script.js",
+			Data:     []byte(`export let data = open("/data.csv"); export default function() {}`),
+		}, fs)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		// VUs never touch the filesystem, so removing the file doesn't affect them.
+		assert.NoError(t, fs.Remove("/data.csv"))
+		for i := 0; i < 2; i++ {
+			bi, err := b.Instantiate()
+			if assert.NoError(t, err) {
+				assert.Equal(t, "a,b\n1,2", bi.Runtime.Get("data").Export())
+			}
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		b, err := NewBundle(&lib.SourceData{
+			Filename: "/path/to/script.js",
+			Data: []byte(`
+			export let stream = open("./file.txt", "b");
+			export default function() {}
+			`),
+		}, fs)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		bi, err := b.Instantiate()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		stream, ok := bi.Runtime.Get("stream").Export().(*common.FileStream)
+		if assert.True(t, ok, "not a stream") {
+			assert.Equal(t, "/path/to/file.txt", stream.Filename)
+			assert.Equal(t, int64(3), stream.Size)
+
+			r, err := stream.Open()
+			if assert.NoError(t, err) {
+				data, err := ioutil.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, "hi!", string(data))
+				assert.NoError(t, r.Close())
+			}
+		}
+
+		t.Run("Remote", func(t *testing.T) {
+			_, err := NewBundle(&lib.SourceData{
+				Filename: "example.com/script.js",
+				Data:     []byte(`open("/path/to/file.txt", "b"); export default function() {}`),
+			}, fs)
+			assert.EqualError(t, err, "GoError: only local files can be streamed: /path/to/file.txt")
+		})
+	})
+
+	t.Run("No Pwd", func(t *testing.T) {
+		init := NewInitContext(goja.New(), new(context.Context), fs, "")
+		_, err := init.Open("/path/to/file.txt", "b")
+		assert.EqualError(t, err, "only local files can be streamed: /path/to/file.txt")
+		_, err = init.Open("/path/to/file.txt")
+		assert.EqualError(t, err, "origin () not allowed to load local file: /path/to/file.txt")
+		_, err = init.Open("")
+		assert.EqualError(t, err, "local or remote path required")
+	})
 }
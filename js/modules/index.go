@@ -21,16 +21,65 @@
 package modules
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/js/modules/k6"
+	"github.com/loadimpact/k6/js/modules/k6/crypto"
+	"github.com/loadimpact/k6/js/modules/k6/encoding"
+	"github.com/loadimpact/k6/js/modules/k6/grpc"
 	"github.com/loadimpact/k6/js/modules/k6/html"
 	"github.com/loadimpact/k6/js/modules/k6/http"
 	"github.com/loadimpact/k6/js/modules/k6/metrics"
+	"github.com/loadimpact/k6/js/modules/k6/net"
+	"github.com/loadimpact/k6/js/modules/k6/sse"
+	"github.com/loadimpact/k6/js/modules/k6/store"
+	"github.com/loadimpact/k6/js/modules/k6/sync"
+	"github.com/loadimpact/k6/js/modules/k6/time"
+	"github.com/loadimpact/k6/js/modules/k6/utils"
+	"github.com/loadimpact/k6/js/modules/k6/xml"
 )
 
 // Index of module implementations.
 var Index = map[string]interface{}{
-	"k6":         &k6.K6{},
-	"k6/http":    &http.HTTP{},
-	"k6/metrics": &metrics.Metrics{},
-	"k6/html":    &html.HTML{},
+	"k6":          &k6.K6{APIVersion: common.APIVersion},
+	"k6/crypto":   &crypto.Crypto{},
+	"k6/encoding": &encoding.Encoding{},
+	"k6/http":     &http.HTTP{},
+	"k6/metrics":  &metrics.Metrics{},
+	"k6/html":     &html.HTML{},
+	"k6/grpc":     &grpc.GRPC{},
+	"k6/net":      &net.Net{},
+	"k6/sse":      &sse.SSE{},
+	"k6/store":    &store.Store{},
+	"k6/sync":     &sync.Sync{},
+	"k6/time":     &time.Time{},
+	"k6/utils":    &utils.Utils{},
+	"k6/xml":      &xml.XML{},
+}
+
+// Prefix of the names of modules registered with Register().
+const ExtensionPrefix = "k6/x/"
+
+// Registers a module implemented outside of k6, so scripts can import it like a built-in one; eg.
+// a custom build can link in a package that calls modules.Register("k6/x/mqtt", &MQTT{}) from its
+// init(). The module is bound like built-in ones, see common.Bind(), and its name is registered
+// as a feature, so scripts can check for it with hasFeature().
+//
+// Names must start with ExtensionPrefix, so they can't collide with current or future built-in
+// modules. This isn't thread-safe, and is meant to be called from init(); it panics if the name
+// is invalid or already taken, as that's a programming error in the build.
+func Register(name string, mod interface{}) {
+	if !strings.HasPrefix(name, ExtensionPrefix) || len(name) == len(ExtensionPrefix) {
+		panic(fmt.Sprintf("modules: invalid module name %q, must start with %q", name, ExtensionPrefix))
+	}
+	if mod == nil {
+		panic(fmt.Sprintf("modules: module %s is nil", name))
+	}
+	if _, ok := Index[name]; ok {
+		panic(fmt.Sprintf("modules: module %s is already registered", name))
+	}
+	Index[name] = mod
+	common.RegisterFeature(name)
 }
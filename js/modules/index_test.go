@@ -0,0 +1,48 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package modules
+
+import (
+	"testing"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type testModule struct{}
+
+func (*testModule) Echo(s string) string { return s }
+
+func TestRegister(t *testing.T) {
+	mod := &testModule{}
+	Register("k6/x/test-register", mod)
+	assert.Equal(t, mod, Index["k6/x/test-register"])
+	assert.True(t, common.HasFeature("k6/x/test-register"))
+
+	for _, name := range []string{"k6/x/test-register", "k6/http", "k6/x/", "mqtt"} {
+		t.Run(name, func(t *testing.T) {
+			assert.Panics(t, func() { Register(name, &testModule{}) })
+		})
+	}
+	t.Run("nil", func(t *testing.T) {
+		assert.Panics(t, func() { Register("k6/x/nil", nil) })
+	})
+}
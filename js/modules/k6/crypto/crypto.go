@@ -0,0 +1,121 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// Hashing and HMAC signing, backed by Go's crypto packages. Inputs are strings (hashed as UTF-8)
+// or byte arrays; digests are returned as "hex" (the default), "base64" or "base64url" strings,
+// or "binary" byte arrays.
+type Crypto struct{}
+
+func init() {
+	common.RegisterFeature("crypto")
+}
+
+// Hash functions, by the names scripts use for them.
+var algorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+func (*Crypto) Md5(input goja.Value, encoding ...string) (interface{}, error) {
+	return digest("md5", nil, input, encoding)
+}
+
+func (*Crypto) Sha1(input goja.Value, encoding ...string) (interface{}, error) {
+	return digest("sha1", nil, input, encoding)
+}
+
+func (*Crypto) Sha256(input goja.Value, encoding ...string) (interface{}, error) {
+	return digest("sha256", nil, input, encoding)
+}
+
+func (*Crypto) Sha384(input goja.Value, encoding ...string) (interface{}, error) {
+	return digest("sha384", nil, input, encoding)
+}
+
+func (*Crypto) Sha512(input goja.Value, encoding ...string) (interface{}, error) {
+	return digest("sha512", nil, input, encoding)
+}
+
+// Signs data with a secret, eg. crypto.hmac("sha256", secret, "GET\n/orders", "base64").
+func (*Crypto) Hmac(algorithm string, secret, input goja.Value, encoding ...string) (interface{}, error) {
+	key, err := common.ToBytes(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "secret")
+	}
+	return digest(algorithm, key, input, encoding)
+}
+
+// Hashes the input with an algorithm, or signs it if a key is given.
+func digest(algorithm string, key []byte, input goja.Value, encoding []string) (interface{}, error) {
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return nil, errors.Errorf("unsupported hash algorithm: %s", algorithm)
+	}
+	data, err := common.ToBytes(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var h hash.Hash
+	if key != nil {
+		h = hmac.New(newHash, key)
+	} else {
+		h = newHash()
+	}
+	_, _ = h.Write(data)
+	sum := h.Sum(nil)
+
+	enc := "hex"
+	if len(encoding) > 0 && encoding[0] != "" {
+		enc = encoding[0]
+	}
+	switch enc {
+	case "hex":
+		return hex.EncodeToString(sum), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(sum), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(sum), nil
+	case "binary":
+		return sum, nil
+	default:
+		return nil, errors.Errorf("unsupported output encoding: %s", enc)
+	}
+}
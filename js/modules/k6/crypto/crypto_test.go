@@ -0,0 +1,98 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package crypto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrypto(t *testing.T) {
+	rt := goja.New()
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("crypto", common.Bind(rt, &Crypto{}, &ctx))
+
+	t.Run("Hash", func(t *testing.T) {
+		testdata := map[string]string{
+			`crypto.md5("hello world")`:    "5eb63bbbe01eeed093cb22bb8f5acdc3",
+			`crypto.sha1("hello world")`:   "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed",
+			`crypto.sha256("hello world")`: "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+			`crypto.sha384("hello world")`: "fdbd8e75a67f29f701a4e040385e2e23986303ea10239211af907fcbb83578b3e417cb71ce646efd0819dd8c088de1bd",
+			`crypto.sha512("hello world")`: "309ecc489c12d6eb4cc40f50c902f2b4d0ed77ee511a7c7a9bcd3ca86d4cd86f989dd35bc5ff499670da34255b45b0cfd830e81f605dcf7dc5542e93ae9cd76f",
+
+			`crypto.sha256("hello world", "base64")`:    "uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=",
+			`crypto.sha256("hello world", "base64url")`: "uU0nuZNNPgilLlLX2n2r-sSE7-N6U4DukIj3rOLvzek",
+			`crypto.md5([1, 2, 3])`:                     "5289df737df57326fcdd22597afb1fac",
+			`crypto.sha1("åäö")`:                        "d127d3833921b504f8d78de20a6063256a29c92f",
+		}
+		for src, expected := range testdata {
+			t.Run(src, func(t *testing.T) {
+				v, err := common.RunString(rt, src)
+				if assert.NoError(t, err) {
+					assert.Equal(t, expected, v.String())
+				}
+			})
+		}
+
+		t.Run("binary", func(t *testing.T) {
+			v, err := common.RunString(rt, `crypto.md5("hello world", "binary")`)
+			if assert.NoError(t, err) {
+				assert.Equal(t, []byte{
+					0x5e, 0xb6, 0x3b, 0xbb, 0xe0, 0x1e, 0xee, 0xd0,
+					0x93, 0xcb, 0x22, 0xbb, 0x8f, 0x5a, 0xcd, 0xc3,
+				}, v.Export())
+			}
+		})
+		t.Run("invalid encoding", func(t *testing.T) {
+			_, err := common.RunString(rt, `crypto.md5("hello world", "rot13")`)
+			assert.EqualError(t, err, "GoError: unsupported output encoding: rot13")
+		})
+		t.Run("invalid input", func(t *testing.T) {
+			_, err := common.RunString(rt, `crypto.md5(null)`)
+			assert.EqualError(t, err, "GoError: input must be a string or a byte array")
+		})
+	})
+	t.Run("Hmac", func(t *testing.T) {
+		v, err := common.RunString(rt, `crypto.hmac("sha256", "secret", "hello world")`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "734cc62f32841568f45715aeb9f4d7891324e6d948e4c6c60c0621cdac48623a", v.String())
+		}
+
+		t.Run("base64", func(t *testing.T) {
+			v, err := common.RunString(rt, `crypto.hmac("sha1", "secret", "hello world", "base64")`)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "Azdu5617v87umGYEOaTYsSUSKlo=", v.String())
+			}
+		})
+		t.Run("invalid algorithm", func(t *testing.T) {
+			_, err := common.RunString(rt, `crypto.hmac("sha3", "secret", "hello world")`)
+			assert.EqualError(t, err, "GoError: unsupported hash algorithm: sha3")
+		})
+		t.Run("invalid secret", func(t *testing.T) {
+			_, err := common.RunString(rt, `crypto.hmac("sha256", undefined, "hello world")`)
+			assert.EqualError(t, err, "GoError: secret: input must be a string or a byte array")
+		})
+	})
+}
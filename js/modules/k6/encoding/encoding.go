@@ -0,0 +1,132 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package encoding
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// Base64, hex and percent-encoding. Inputs to encode are strings (encoded as UTF-8) or byte
+// arrays; decoded data is returned as a string, or as a byte array with the "binary" format.
+type Encoding struct{}
+
+func init() {
+	common.RegisterFeature("encoding")
+}
+
+// Base64 variants, by the names scripts use for them.
+var base64Encodings = map[string]*base64.Encoding{
+	"std":    base64.StdEncoding,
+	"rawstd": base64.RawStdEncoding,
+	"url":    base64.URLEncoding,
+	"rawurl": base64.RawURLEncoding,
+}
+
+// Encodes the input as base64; "std" (the default), "rawstd" (unpadded), "url" (URL-safe) or
+// "rawurl" (URL-safe and unpadded).
+func (*Encoding) B64encode(input goja.Value, encoding ...string) (string, error) {
+	enc, err := base64Encoding(encoding)
+	if err != nil {
+		return "", err
+	}
+	data, err := common.ToBytes(input)
+	if err != nil {
+		return "", err
+	}
+	return enc.EncodeToString(data), nil
+}
+
+// Decodes base64 in one of the encodings b64encode() takes.
+func (*Encoding) B64decode(input string, args ...string) (interface{}, error) {
+	enc, err := base64Encoding(args)
+	if err != nil {
+		return nil, err
+	}
+	data, err := enc.DecodeString(input)
+	if err != nil {
+		return nil, err
+	}
+	return output(data, args, 1)
+}
+
+// Encodes the input as lowercase hex.
+func (*Encoding) HexEncode(input goja.Value) (string, error) {
+	data, err := common.ToBytes(input)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// Decodes hex, in either case.
+func (*Encoding) HexDecode(input string, format ...string) (interface{}, error) {
+	data, err := hex.DecodeString(input)
+	if err != nil {
+		return nil, err
+	}
+	return output(data, format, 0)
+}
+
+// Percent-encodes everything but unreserved characters (letters, digits, "-", "_", "." and "~"),
+// like encodeURIComponent(); spaces become "%20", never "+".
+func (*Encoding) UrlEncode(input string) string {
+	return strings.Replace(url.QueryEscape(input), "+", "%20", -1)
+}
+
+// Decodes percent-encoding; unlike for form bodies, "+" is left as it is.
+func (*Encoding) UrlDecode(input string) (string, error) {
+	return url.QueryUnescape(strings.Replace(input, "+", "%2B", -1))
+}
+
+func base64Encoding(args []string) (*base64.Encoding, error) {
+	name := "std"
+	if len(args) > 0 && args[0] != "" {
+		name = args[0]
+	}
+	enc, ok := base64Encodings[name]
+	if !ok {
+		return nil, errors.Errorf("unsupported base64 encoding: %s", name)
+	}
+	return enc, nil
+}
+
+// Returns decoded data in the format given at args[i]: "string" (the default) or "binary".
+func output(data []byte, args []string, i int) (interface{}, error) {
+	format := "string"
+	if len(args) > i && args[i] != "" {
+		format = args[i]
+	}
+	switch format {
+	case "string":
+		return string(data), nil
+	case "binary":
+		return data, nil
+	default:
+		return nil, errors.Errorf("unsupported output format: %s", format)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package encoding
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoding(t *testing.T) {
+	rt := goja.New()
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("encoding", common.Bind(rt, &Encoding{}, &ctx))
+
+	testdata := map[string]string{
+		`encoding.b64encode("hello?>")`:              "aGVsbG8/Pg==",
+		`encoding.b64encode("hello?>", "rawstd")`:    "aGVsbG8/Pg",
+		`encoding.b64encode("hello?>", "url")`:       "aGVsbG8_Pg==",
+		`encoding.b64encode("hello?>", "rawurl")`:    "aGVsbG8_Pg",
+		`encoding.b64encode([0, 255])`:               "AP8=",
+		`encoding.b64encode("åäö")`:                  "w6XDpMO2",
+		`encoding.b64decode("aGVsbG8/Pg==")`:         "hello?>",
+		`encoding.b64decode("aGVsbG8_Pg", "rawurl")`: "hello?>",
+		`encoding.b64decode("w6XDpMO2")`:             "åäö",
+		`encoding.hexEncode("hi!")`:                  "686921",
+		`encoding.hexDecode("686921")`:               "hi!",
+		`encoding.hexDecode("6869FF", "binary")[2]`:  "255",
+		`encoding.urlEncode("a b+c/d?e=&f~")`:        "a%20b%2Bc%2Fd%3Fe%3D%26f~",
+		`encoding.urlDecode("a%20b+c%2Fd")`:          "a b+c/d",
+	}
+	for src, expected := range testdata {
+		t.Run(src, func(t *testing.T) {
+			v, err := common.RunString(rt, src)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, v.String())
+			}
+		})
+	}
+
+	t.Run("Binary", func(t *testing.T) {
+		v, err := common.RunString(rt, `encoding.b64decode("AP8=", "std", "binary")`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []byte{0, 255}, v.Export())
+		}
+	})
+
+	errdata := map[string]string{
+		`encoding.b64encode("hi", "base32")`:         "GoError: unsupported base64 encoding: base32",
+		`encoding.b64decode("!!!")`:                  "GoError: illegal base64 data at input byte 0",
+		`encoding.b64decode("aGk=", "std", "utf16")`: "GoError: unsupported output format: utf16",
+		`encoding.hexDecode("zz")`:                   "GoError: encoding/hex: invalid byte: U+007A 'z'",
+		`encoding.urlDecode("%zz")`:                  `GoError: invalid URL escape "%zz"`,
+		`encoding.hexEncode(null)`:                   "GoError: input must be a string or a byte array",
+		`encoding.b64encode([256])`:                  "GoError: invalid byte at index 0: 256",
+	}
+	for src, msg := range errdata {
+		t.Run(src, func(t *testing.T) {
+			_, err := common.RunString(rt, src)
+			assert.EqualError(t, err, msg)
+		})
+	}
+}
@@ -0,0 +1,360 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// How long connect() waits for a connection, unless overridden with the timeout param.
+const DefaultConnectTimeout = 10 * time.Second
+
+type GRPC struct{}
+
+func init() {
+	common.RegisterFeature("grpc")
+}
+
+// Creates a client; like anything else made in the init context, every VU gets its own.
+func (*GRPC) XClient(ctxPtr *context.Context) interface{} {
+	rt := common.GetRuntime(*ctxPtr)
+	return common.Bind(rt, &Client{methods: make(map[string]protoreflect.MethodDescriptor)}, ctxPtr)
+}
+
+// A Client makes unary calls to methods described by the descriptors loaded into it.
+type Client struct {
+	methods map[string]protoreflect.MethodDescriptor
+	conn    *grpc.ClientConn
+}
+
+// The outcome of a call. Status is the gRPC status code, 0 (OK) on success, in which case Message
+// holds the response; otherwise, Error holds the status message.
+type Response struct {
+	Status   int
+	Message  interface{}
+	Error    string
+	Headers  map[string]string
+	Trailers map[string]string
+}
+
+// Loads service descriptors, either from a .proto file's source or a compiled descriptor set
+// (protoc --include_imports -o), opened with open(filename, "b"). Imports in .proto sources can
+// only refer to Google's well-known types. Returns the names of all methods loaded, eg.
+// "package.Service/Method".
+func (c *Client) Load(ctx context.Context, src goja.Value) ([]string, error) {
+	if common.GetState(ctx) != nil {
+		return nil, errors.New("grpc: descriptors must be loaded in the init context")
+	}
+
+	var set *descriptorpb.FileDescriptorSet
+	var err error
+	if stream, ok := src.Export().(*common.FileStream); ok {
+		set, err = readStream(stream)
+	} else {
+		set, err = parseProto("main.proto", src.String())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "grpc")
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, errors.Wrap(err, "grpc")
+	}
+	var names []string
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				md := methods.Get(j)
+				name := fmt.Sprintf("%s/%s", md.Parent().FullName(), md.Name())
+				c.methods[name] = md
+				names = append(names, name)
+			}
+		}
+		return true
+	})
+	sort.Strings(names)
+	return names, nil
+}
+
+func readStream(stream *common.FileStream) (*descriptorpb.FileDescriptorSet, error) {
+	r, err := stream.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(stream.Filename, ".proto") {
+		return parseProto(stream.Filename, string(data))
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Parses a .proto file into a descriptor set, which includes everything it imports.
+func parseProto(filename, src string) (*descriptorpb.FileDescriptorSet, error) {
+	parser := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{filename: src}),
+	}
+	fds, err := parser.ParseFiles(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(fd *desc.FileDescriptor)
+	add = func(fd *desc.FileDescriptor) {
+		if seen[fd.GetName()] {
+			return
+		}
+		seen[fd.GetName()] = true
+		for _, dep := range fd.GetDependencies() {
+			add(dep)
+		}
+		set.File = append(set.File, fd.AsFileDescriptorProto())
+	}
+	for _, fd := range fds {
+		add(fd)
+	}
+	return set, nil
+}
+
+// Connects to a server, over TLS unless the plaintext param is set. A previous connection, if
+// any, is closed. Like HTTP requests, it goes through the VU's dialer and TLS config, so options
+// such as hosts, localIPs and insecureSkipTLSVerify apply, and the connection is counted.
+func (c *Client) Connect(ctx context.Context, addr string, params ...goja.Value) error {
+	rt := common.GetRuntime(ctx)
+	state := common.GetState(ctx)
+	if state == nil {
+		return errors.New("grpc: connections can't be made in the init context")
+	}
+
+	plaintext := false
+	timeout := DefaultConnectTimeout
+	if len(params) > 0 && !goja.IsUndefined(params[0]) && !goja.IsNull(params[0]) {
+		obj := params[0].ToObject(rt)
+		for _, k := range obj.Keys() {
+			switch k {
+			case "plaintext":
+				plaintext = obj.Get(k).ToBoolean()
+			case "timeout":
+				d, err := common.ToDuration(obj.Get(k))
+				if err != nil {
+					return errors.Wrap(err, "timeout")
+				}
+				timeout = d
+			}
+		}
+	}
+
+	opts := []grpc.DialOption{grpc.WithBlock(), grpc.FailOnNonTempDialError(true)}
+	if state.Dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return state.Dialer.DialContext(ctx, "tcp", addr)
+		}))
+	}
+	if plaintext {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		tlsConfig := &tls.Config{}
+		if state.TLSConfig != nil {
+			tlsConfig = state.TLSConfig.Clone()
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(dialCtx, addr, opts...)
+	if err != nil {
+		return errors.Wrap(err, "grpc")
+	}
+	c.Close()
+	c.conn = conn
+	return nil
+}
+
+// Calls a unary method, eg. "package.Service/Method", with a request message given as an object.
+// Errors from the server are reported through the response's status; only calls that couldn't be
+// made at all throw.
+func (c *Client) Invoke(ctx context.Context, method string, req goja.Value, params ...goja.Value) (*Response, error) {
+	rt := common.GetRuntime(ctx)
+	state := common.GetState(ctx)
+	if state == nil {
+		return nil, errors.New("grpc: calls can't be made in the init context")
+	}
+	if c.conn == nil {
+		return nil, errors.New("grpc: not connected")
+	}
+
+	method = strings.TrimPrefix(method, "/")
+	md, ok := c.methods[method]
+	if !ok {
+		return nil, errors.Errorf("grpc: unknown method: %s", method)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, errors.Errorf("grpc: streaming methods aren't supported: %s", method)
+	}
+
+	tags := map[string]string{
+		"method": "/" + method,
+		"group":  state.Group.Path,
+	}
+	reqMD := metadata.MD{}
+	var timeout time.Duration
+	if len(params) > 0 && !goja.IsUndefined(params[0]) && !goja.IsNull(params[0]) {
+		obj := params[0].ToObject(rt)
+		for _, k := range obj.Keys() {
+			switch k {
+			case "headers":
+				headersV := obj.Get(k)
+				if goja.IsUndefined(headersV) || goja.IsNull(headersV) {
+					continue
+				}
+				headers := headersV.ToObject(rt)
+				for _, key := range headers.Keys() {
+					reqMD.Append(key, headers.Get(key).String())
+				}
+			case "tags":
+				tagsV := obj.Get(k)
+				if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
+					continue
+				}
+				tagObj := tagsV.ToObject(rt)
+				for _, key := range tagObj.Keys() {
+					tags[key] = tagObj.Get(key).String()
+				}
+			case "timeout":
+				d, err := common.ToDuration(obj.Get(k))
+				if err != nil {
+					return nil, errors.Wrap(err, "timeout")
+				}
+				timeout = d
+			}
+		}
+	}
+
+	// Messages go through JSON, which is how protobuf maps to JS objects anyway.
+	in := dynamicpb.NewMessage(md.Input())
+	if req != nil && !goja.IsUndefined(req) && !goja.IsNull(req) {
+		b, err := json.Marshal(req.Export())
+		if err != nil {
+			return nil, err
+		}
+		if err := protojson.Unmarshal(b, in); err != nil {
+			return nil, errors.Wrap(err, "grpc: invalid request message")
+		}
+	}
+	out := dynamicpb.NewMessage(md.Output())
+
+	callCtx := metadata.NewOutgoingContext(ctx, reqMD)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(callCtx, timeout)
+		defer cancel()
+	}
+
+	var header, trailer metadata.MD
+	startTime := time.Now()
+	err := c.conn.Invoke(callCtx, "/"+method, in, out, grpc.Header(&header), grpc.Trailer(&trailer))
+	endTime := time.Now()
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil, err
+	}
+
+	tags["status"] = strconv.Itoa(int(st.Code()))
+	state.Samples = append(state.Samples,
+		stats.Sample{Metric: metrics.GRPCReqs, Time: endTime, Tags: tags, Value: 1},
+		stats.Sample{Metric: metrics.GRPCReqDuration, Time: endTime, Tags: tags, Value: stats.D(endTime.Sub(startTime))},
+	)
+
+	res := &Response{
+		Status:   int(st.Code()),
+		Headers:  flattenMD(header),
+		Trailers: flattenMD(trailer),
+	}
+	if err != nil {
+		res.Error = st.Message()
+		return res, nil
+	}
+	b, err := protojson.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &res.Message); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Closes the connection, if any.
+func (c *Client) Close() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func flattenMD(md metadata.MD) map[string]string {
+	m := make(map[string]string, len(md))
+	for k, vs := range md {
+		m[k] = strings.Join(vs, ", ")
+	}
+	return m
+}
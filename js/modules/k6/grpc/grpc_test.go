@@ -0,0 +1,204 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const healthProto = `
+syntax = "proto3";
+package grpc.health.v1;
+
+message HealthCheckRequest {
+	string service = 1;
+}
+
+message HealthCheckResponse {
+	enum ServingStatus {
+		UNKNOWN = 0;
+		SERVING = 1;
+		NOT_SERVING = 2;
+		SERVICE_UNKNOWN = 3;
+	}
+	ServingStatus status = 1;
+}
+
+service Health {
+	rpc Check(HealthCheckRequest) returns (HealthCheckResponse);
+	rpc Watch(HealthCheckRequest) returns (stream HealthCheckResponse);
+}
+`
+
+func TestClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("up", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Stop()
+
+	// A compiled descriptor set, as protoc -o would produce.
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}}
+	data, err := proto.Marshal(set)
+	if !assert.NoError(t, err) {
+		return
+	}
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/health.protoset", data, 0644))
+	stream, err := common.NewFileStream(fs, "/health.protoset")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	root, err := lib.NewGroup("", nil)
+	assert.NoError(t, err)
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("grpc", common.Bind(rt, &GRPC{}, &ctx))
+	rt.Set("protoset", stream)
+	rt.Set("healthProto", healthProto)
+	rt.Set("addr", l.Addr().String())
+
+	_, err = common.RunString(rt, `
+	let client = new grpc.Client();
+	let methods = client.load(protoset);
+	if (methods.join(",") != "grpc.health.v1.Health/Check,grpc.health.v1.Health/Watch") {
+		throw new Error("wrong methods: " + methods.join(","));
+	}
+	let sourceClient = new grpc.Client();
+	sourceClient.load(healthProto);
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("InitContext", func(t *testing.T) {
+		_, err := common.RunString(rt, `client.connect(addr, { plaintext: true });`)
+		assert.EqualError(t, err, "GoError: grpc: connections can't be made in the init context")
+	})
+
+	state := &common.State{Group: root}
+	ctx = common.WithState(ctx, state)
+
+	t.Run("Load", func(t *testing.T) {
+		_, err := common.RunString(rt, `client.load(protoset);`)
+		assert.EqualError(t, err, "GoError: grpc: descriptors must be loaded in the init context")
+	})
+	t.Run("NotConnected", func(t *testing.T) {
+		_, err := common.RunString(rt, `client.invoke("grpc.health.v1.Health/Check", {});`)
+		assert.EqualError(t, err, "GoError: grpc: not connected")
+	})
+
+	for name, client := range map[string]string{"Descriptor": "client", "Source": "sourceClient"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := common.RunString(rt, client+`.connect(addr, { plaintext: true, timeout: "5s" });`)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _, _ = common.RunString(rt, client+`.close();`) }()
+
+			t.Run("OK", func(t *testing.T) {
+				state.Samples = nil
+				_, err := common.RunString(rt, `
+				let res = `+client+`.invoke("/grpc.health.v1.Health/Check", { service: "up" }, { tags: { tag: "value" } });
+				if (res.status != 0) { throw new Error("wrong status: " + res.status); }
+				if (res.message.status != "SERVING") { throw new Error("wrong message: " + JSON.stringify(res.message)); }
+				if (res.error != "") { throw new Error("unexpected error: " + res.error); }
+				`)
+				assert.NoError(t, err)
+
+				seen := map[string]bool{}
+				for _, s := range state.Samples {
+					seen[s.Metric.Name] = true
+					assert.Equal(t, "/grpc.health.v1.Health/Check", s.Tags["method"])
+					assert.Equal(t, "0", s.Tags["status"])
+					assert.Equal(t, "value", s.Tags["tag"])
+				}
+				assert.True(t, seen[metrics.GRPCReqs.Name])
+				assert.True(t, seen[metrics.GRPCReqDuration.Name])
+			})
+			t.Run("Status", func(t *testing.T) {
+				state.Samples = nil
+				_, err := common.RunString(rt, `
+				let res = `+client+`.invoke("grpc.health.v1.Health/Check", { service: "nope" });
+				if (res.status != 5) { throw new Error("wrong status: " + res.status); }
+				if (res.error != "unknown service") { throw new Error("wrong error: " + res.error); }
+				if (res.message !== null) { throw new Error("unexpected message: " + JSON.stringify(res.message)); }
+				`)
+				assert.NoError(t, err)
+				for _, s := range state.Samples {
+					assert.Equal(t, "5", s.Tags["status"])
+				}
+			})
+			t.Run("InvalidMessage", func(t *testing.T) {
+				_, err := common.RunString(rt, client+`.invoke("grpc.health.v1.Health/Check", { nope: 1 });`)
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "GoError: grpc: invalid request message")
+				}
+			})
+			t.Run("UnknownMethod", func(t *testing.T) {
+				_, err := common.RunString(rt, client+`.invoke("grpc.health.v1.Health/Nope", {});`)
+				assert.EqualError(t, err, "GoError: grpc: unknown method: grpc.health.v1.Health/Nope")
+			})
+			t.Run("Streaming", func(t *testing.T) {
+				_, err := common.RunString(rt, client+`.invoke("grpc.health.v1.Health/Watch", {});`)
+				assert.EqualError(t, err, "GoError: grpc: streaming methods aren't supported: grpc.health.v1.Health/Watch")
+			})
+		})
+	}
+
+	t.Run("Dialer", func(t *testing.T) {
+		state.Dialer = netext.NewDialer(net.Dialer{})
+		defer func() { state.Dialer = nil }()
+
+		_, err := common.RunString(rt, `client.connect(addr, { plaintext: true, timeout: "5s" });`)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, int64(1), state.Dialer.Stats.Open()["127.0.0.1"])
+		_, err = common.RunString(rt, `client.close();`)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,173 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	neturl "net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// A FormFile is a file field's contents, for uploading data that isn't on disk; see HTTP.File().
+type FormFile struct {
+	Data        []byte
+	Filename    string
+	ContentType string
+}
+
+// Makes a file to append to a FormData, from a string or an array of byte values.
+func (*HTTP) File(data goja.Value, args ...string) (*FormFile, error) {
+	f := &FormFile{Filename: "file", ContentType: "application/octet-stream"}
+	if b, ok, err := common.ToByteArray(data); ok {
+		if err != nil {
+			return nil, err
+		}
+		f.Data = b
+	} else {
+		f.Data = []byte(data.String())
+	}
+	if len(args) > 0 && args[0] != "" {
+		f.Filename = args[0]
+	}
+	if len(args) > 1 && args[1] != "" {
+		f.ContentType = args[1]
+	}
+	return f, nil
+}
+
+// Builds a form body, like a browser's FormData: fields may be repeated, and may hold files, either
+// from http.file() or open(filename, "b"). Passed as a request body, it's sent as
+// multipart/form-data if it holds any files, and urlencoded otherwise.
+func (*HTTP) XFormData(ctxPtr *context.Context) interface{} {
+	return &FormData{}
+}
+
+type FormData struct {
+	fields []formField
+}
+
+type formField struct {
+	name  string
+	value string
+
+	// Set for file fields.
+	file   *FormFile
+	stream *common.FileStream
+}
+
+// Appends a field; appending the same name again adds another value rather than replacing it. The
+// filename of a file field may be overridden.
+func (fd *FormData) Append(name string, value goja.Value, filename ...string) {
+	field := formField{name: name}
+	switch v := value.Export().(type) {
+	case *FormFile:
+		f := *v
+		if len(filename) > 0 && filename[0] != "" {
+			f.Filename = filename[0]
+		}
+		field.file = &f
+	case *common.FileStream:
+		f := FormFile{Filename: filepath.Base(v.Filename), ContentType: "application/octet-stream"}
+		if len(filename) > 0 && filename[0] != "" {
+			f.Filename = filename[0]
+		}
+		field.file = &f
+		field.stream = v
+	default:
+		field.value = value.String()
+	}
+	fd.fields = append(fd.fields, field)
+}
+
+// Encodes the form, returning the body and its content type.
+func (fd *FormData) encode() ([]byte, string, error) {
+	hasFiles := false
+	for _, field := range fd.fields {
+		if field.file != nil {
+			hasFiles = true
+			break
+		}
+	}
+
+	if !hasFiles {
+		values := make(neturl.Values, len(fd.fields))
+		for _, field := range fd.fields {
+			values.Add(field.name, field.value)
+		}
+		return []byte(values.Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, field := range fd.fields {
+		if field.file == nil {
+			if err := w.WriteField(field.name, field.value); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="`+escapeQuotes(field.name)+`"; filename="`+escapeQuotes(field.file.Filename)+`"`)
+		h.Set("Content-Type", field.file.ContentType)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		if field.stream != nil {
+			err = copyStream(part, field.stream)
+		} else {
+			_, err = part.Write(field.file.Data)
+		}
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "form field %s", field.name)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+func copyStream(w io.Writer, stream *common.FileStream) error {
+	r, err := stream.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
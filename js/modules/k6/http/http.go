@@ -22,45 +22,100 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"net"
 	"net/http"
 	neturl "net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"reflect"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/js/modules/k6/html"
+	"github.com/loadimpact/k6/js/modules/k6/xml"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/netext"
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
 )
 
 type HTTPResponseTimings struct {
-	Duration, Blocked, LookingUp, Connecting, Sending, Waiting, Receiving float64
+	Duration, Blocked, LookingUp, Connecting, TLSHandshaking, Sending, Waiting, Receiving float64
+}
+
+// The request a response was for; after redirects, this is the last one made.
+type HTTPRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+}
+
+// A redirect followed by a request: the URL that was redirected, and the status it responded with.
+type HTTPRedirect struct {
+	URL    string
+	Status int
 }
 
 type HTTPResponse struct {
 	ctx context.Context
 
-	RemoteIP   string
-	RemotePort int
-	URL        string
-	Status     int
-	Headers    map[string]string
-	Body       string
-	Timings    HTTPResponseTimings
+	Request HTTPRequest
+
+	RemoteIP      string
+	RemotePort    int
+	URL           string
+	Proto         string
+	Status        int
+	StatusText    string
+	OK            bool `js:"ok"`
+	Headers       map[string]string
+	Body          string
+	BodyTruncated bool
+	Timings       HTTPResponseTimings
+	TLS           *HTTPResponseTLS
+	FromCache     bool
+	Attempts      int
+
+	// Redirects followed to get to this response, in order; URL is where the last one led.
+	Redirects []HTTPRedirect
+
+	// Set if the server answered, but the body couldn't be read in full, eg. because the connection
+	// dropped; Body holds what was received. ErrorCategory is then "read", or "timeout" if the
+	// request's timeout ran out while reading it.
+	Error         string
+	ErrorCategory string
 
 	cachedJSON goja.Value
 }
 
 func (res *HTTPResponse) Json() goja.Value {
+	if res.BodyTruncated {
+		common.Throw(common.GetRuntime(res.ctx), ErrBodyTruncated)
+	}
+	if res.Body == "" {
+		reason := "its body is empty"
+		if !bodyAllowed(res.Request.Method, res.Status) {
+			reason = noBodyReason(res.Request.Method, res.Status) + " responses have no body"
+		}
+		common.Throw(common.GetRuntime(res.ctx), errors.Errorf(
+			"can't parse the response to %s %s as JSON: %s", res.Request.Method, res.Request.URL, reason,
+		))
+	}
 	if res.cachedJSON == nil {
 		var v interface{}
 		if err := json.Unmarshal([]byte(res.Body), &v); err != nil {
@@ -72,6 +127,9 @@ func (res *HTTPResponse) Json() goja.Value {
 }
 
 func (res *HTTPResponse) Html(selector ...string) html.Selection {
+	if res.BodyTruncated {
+		common.Throw(common.GetRuntime(res.ctx), ErrBodyTruncated)
+	}
 	sel, err := html.HTML{}.ParseHTML(res.ctx, res.Body)
 	if err != nil {
 		common.Throw(common.GetRuntime(res.ctx), err)
@@ -82,17 +140,312 @@ func (res *HTTPResponse) Html(selector ...string) html.Selection {
 	return sel
 }
 
+// Parses the body as XML; malformed documents throw an error with the line and column.
+func (res *HTTPResponse) Xml() *xml.Node {
+	rt := common.GetRuntime(res.ctx)
+	if res.BodyTruncated {
+		common.Throw(rt, ErrBodyTruncated)
+	}
+	doc, err := xml.Parse(rt, res.Body)
+	if err != nil {
+		common.Throw(rt, err)
+	}
+	return doc
+}
+
+// Returns the part of the body between the first occurrence of left, and the first occurrence of
+// right after that; eg. a CSRF token in a hidden form field. Undefined if there's no such part.
+func (res *HTTPResponse) FindBetween(left, right string) goja.Value {
+	if s, ok := findBetween(res.Body, left, right); ok {
+		return common.GetRuntime(res.ctx).ToValue(s)
+	}
+	return goja.Undefined()
+}
+
+// Like FindBetween(), but returns every such part of the body, in order.
+func (res *HTTPResponse) FindBetweenAll(left, right string) []string {
+	matches := []string{}
+	if left == "" && right == "" {
+		return matches
+	}
+	for body := res.Body; ; {
+		i := strings.Index(body, left)
+		if i == -1 {
+			return matches
+		}
+		body = body[i+len(left):]
+		j := strings.Index(body, right)
+		if j == -1 {
+			return matches
+		}
+		matches = append(matches, body[:j])
+		body = body[j+len(right):]
+	}
+}
+
+func findBetween(s, left, right string) (string, bool) {
+	i := strings.Index(s, left)
+	if i == -1 {
+		return "", false
+	}
+	s = s[i+len(left):]
+	j := strings.Index(s, right)
+	if j == -1 {
+		return "", false
+	}
+	return s[:j], true
+}
+
+// A URLTag is a URL with a name attached to it, produced by the http.url template tag. The name is
+// the unexpanded template, and is used to group dynamic URLs together in metrics.
+type URLTag struct {
+	URL  string `js:"url"`
+	Name string `js:"name"`
+}
+
+func (u URLTag) String() string {
+	return u.URL
+}
+
+// Resolves a URL argument, which may be either a URLTag or anything that can be made a string.
+func toURLTag(v goja.Value) URLTag {
+	if v == nil {
+		return URLTag{}
+	}
+	if u, ok := v.Export().(URLTag); ok {
+		return u
+	}
+	s := v.String()
+	return URLTag{URL: s, Name: s}
+}
+
+// Methods defined by RFC 7231 and RFC 5789; these are always sent uppercased.
+var standardMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "CONNECT": true, "OPTIONS": true, "TRACE": true,
+}
+
+// Normalizes a method given by a script. Standard methods are uppercased, custom ones (eg. WebDAV's
+// PROPFIND) are passed through as they are, as long as they're valid tokens (RFC 7230, 3.2.6).
+func normalizeMethod(method string) (string, error) {
+	if upper := strings.ToUpper(method); standardMethods[upper] {
+		return upper, nil
+	}
+	if method == "" {
+		return "", errors.New("invalid HTTP method: empty")
+	}
+	for _, c := range method {
+		if !isTokenChar(c) {
+			return "", errors.Errorf("invalid HTTP method: %q", method)
+		}
+	}
+	return method, nil
+}
+
+// Declares a content length for a request, truncating the body if it's longer.
+func setContentLength(req *http.Request, n int64) {
+	if n == 0 {
+		req.Body = nil
+		req.GetBody = nil
+	} else if req.Body != nil && (req.ContentLength <= 0 || n < req.ContentLength) {
+		req.Body = limitBody(req.Body, n)
+		if getBody := req.GetBody; getBody != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				return limitBody(body, n), nil
+			}
+		}
+	}
+	req.ContentLength = n
+}
+
+// Compresses a request body with a content coding; "gzip" or "deflate" (which is zlib's format).
+func compressBody(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, errors.Errorf("unsupported encoding: %s", encoding)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func limitBody(body io.ReadCloser, n int64) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(body, n), body}
+}
+
+func isTokenChar(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	default:
+		return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+	}
+}
+
+// Initial delay between retries, unless overridden with the retryBackoff param.
+const DefaultRetryBackoff = 100 * time.Millisecond
+
+// Thrown when trying to parse a response body that was cut off by maxResponseBodySize.
+var ErrBodyTruncated = errors.New("response body truncated; raise maxResponseBodySize to parse it")
+
+// Thrown when a request fails without a response, eg. on a network error, or with a 4xx or 5xx one
+// or one whose body couldn't be read if the throwOnError param is set; other responses never throw,
+// whatever their status. The method, URL, attempts and redirects followed are set on the thrown
+// object, to tell requests in a batch apart, as well as the status and response, if there was one.
+type HTTPError struct {
+	Method    string
+	URL       string
+	Attempts  int
+	Redirects int
+	Err       error
+
+	// Set if the request took longer than its timeout.
+	Timeout bool
+
+	// Set if there was a response, but it had an error status.
+	Response *HTTPResponse
+}
+
+func (e *HTTPError) Error() string {
+	if e.Response != nil {
+		if e.Response.Error != "" {
+			return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.URL, e.Response.Status, e.Response.StatusText, e.Response.Error)
+		}
+		return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.Response.Status, e.Response.StatusText)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Err)
+}
+
+func (e *HTTPError) Properties() map[string]interface{} {
+	props := map[string]interface{}{
+		"method":    e.Method,
+		"url":       e.URL,
+		"attempts":  e.Attempts,
+		"redirects": e.Redirects,
+		"timeout":   e.Timeout,
+	}
+	if e.Response != nil {
+		props["status"] = e.Response.Status
+		props["response"] = e.Response
+	}
+	return props
+}
+
 type HTTP struct{}
 
-func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value) (*HTTPResponse, error) {
+func init() {
+	common.RegisterFeature(
+		"http.batch", "http.batch.dag",
+		"http.retries", "http.compressBody", "http.recordMetrics",
+		"http.response.html", "http.response.xml", "http.setMaxConnsPerHost",
+		"http.options", "http.timeout", "http.redirects", "http.auth.digest", "http2",
+	)
+}
+
+// Tags a request with the IP it connected to, and whether the lookup for it came from the cache.
+func addDNSTags(tags map[string]string, trail netext.Trail) {
+	if trail.ConnRemoteAddr != nil {
+		if ip, _, err := net.SplitHostPort(trail.ConnRemoteAddr.String()); err == nil {
+			tags["ip"] = ip
+		}
+	}
+	if trail.DNSLookups > 0 {
+		if trail.DNSCacheHits == trail.DNSLookups {
+			tags["dns_cache"] = "hit"
+		} else {
+			tags["dns_cache"] = "miss"
+		}
+	}
+}
+
+// Caps the connections the VU can have open to a host at once, for the rest of the test; requests
+// past it wait for one to free up. Overrides the maxConnsPerHost option; values past MaxInt32 are
+// clamped to it.
+func (*HTTP) SetMaxConnsPerHost(ctx context.Context, v goja.Value) error {
+	n := v.ToFloat()
+	if goja.IsUndefined(v) || goja.IsNull(v) || math.IsNaN(n) || n < 1 || n != math.Trunc(n) {
+		return errors.Errorf("setMaxConnsPerHost: must be a positive integer: %s", v.String())
+	}
+	if n > math.MaxInt32 {
+		n = math.MaxInt32
+	}
+
+	state := common.GetState(ctx)
+	if state == nil || state.Dialer == nil {
+		return errors.New("setMaxConnsPerHost: can't be used here")
+	}
+	state.Dialer.SetMaxConnsPerHost(int(n))
+	return nil
+}
+
+// Template tag for URLs; http.url`/orders/${id}` requests "/orders/1234", but tags it with the
+// name "/orders/${}", so that requests to the same endpoint can be grouped.
+func (*HTTP) Url(parts []string, pieces ...string) URLTag {
+	var name, url bytes.Buffer
+	for i, part := range parts {
+		name.WriteString(part)
+		url.WriteString(part)
+		if i < len(pieces) {
+			name.WriteString("${}")
+			url.WriteString(pieces[i])
+		}
+	}
+	return URLTag{URL: url.String(), Name: name.String()}
+}
+
+func (*HTTP) Request(ctx context.Context, method string, urlV goja.Value, args ...goja.Value) (*HTTPResponse, error) {
+	return request(ctx, nil, method, urlV, args...)
+}
+
+// Makes a request; extraTags are added to its samples' tags, but may be overridden by the script.
+func request(ctx context.Context, extraTags map[string]string, method string, urlV goja.Value, args ...goja.Value) (*HTTPResponse, error) {
 	rt := common.GetRuntime(ctx)
 	state := common.GetState(ctx)
+	method, err := normalizeMethod(method)
+	if err != nil {
+		panic(rt.NewTypeError("%s", err.Error()))
+	}
+	u := toURLTag(urlV)
+	url := u.URL
 
 	var bodyReader io.Reader
+	var bodyStream *common.FileStream
 	var contentType string
 	if len(args) > 0 && !goja.IsUndefined(args[0]) && !goja.IsNull(args[0]) {
 		var data map[string]goja.Value
-		if rt.ExportTo(args[0], &data) == nil {
+		if stream, ok := args[0].Export().(*common.FileStream); ok {
+			bodyStream = stream
+		} else if fd, ok := args[0].Export().(*FormData); ok {
+			b, ct, err := fd.encode()
+			if err != nil {
+				return nil, errors.Wrap(err, "body")
+			}
+			bodyReader = bytes.NewReader(b)
+			contentType = ct
+		} else if b, ok, err := common.ToByteArray(args[0]); ok {
+			// Byte arrays are sent verbatim, eg. to replay captured traffic.
+			if err != nil {
+				return nil, errors.Wrap(err, "body")
+			}
+			bodyReader = bytes.NewReader(b)
+		} else if rt.ExportTo(args[0], &data) == nil {
 			bodyQuery := make(neturl.Values, len(data))
 			for k, v := range data {
 				bodyQuery.Set(k, v.String())
@@ -108,17 +461,53 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 	if err != nil {
 		return nil, err
 	}
+	for k, vs := range state.DefaultHeaders {
+		req.Header[k] = append([]string(nil), vs...)
+	}
 	if contentType != "" {
 		req.Header.Set("Content-Type", contentType)
 	}
+	if bodyStream != nil {
+		// Streamed bodies are read straight off disk; GetBody lets redirects start over.
+		body, err := bodyStream.Open()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+		req.GetBody = bodyStream.Open
+		req.ContentLength = bodyStream.Size
+	}
 
 	tags := map[string]string{
 		"status": "0",
 		"method": method,
 		"url":    url,
+		"name":   u.Name,
 		"group":  state.Group.Path,
+		"host":   req.URL.Host,
+	}
+	for k, v := range extraTags {
+		tags[k] = v
 	}
 
+	auth := ""
+	debug := state.HTTPDebug
+	var username, password null.String
+	retries := 0
+	retryBackoff := DefaultRetryBackoff
+	retryAll := false
+	retryServerErrors := false
+	throwOnError := false
+	maxBodySize := state.MaxResponseBodySize
+	timeout := state.HTTPTimeout
+	maxRedirects := lib.DefaultMaxRedirects
+	if state.MaxRedirects.Valid {
+		maxRedirects = int(state.MaxRedirects.Int64)
+	}
+	followRedirects := true
+	httpCache := state.HTTPCache
+	recordMetrics := !state.NoHTTPMetrics
+	compression := ""
 	if len(args) > 1 {
 		paramsV := args[1]
 		if !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
@@ -134,8 +523,14 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 					if headers == nil {
 						continue
 					}
+					// Keys are case insensitive, and null removes a default header.
 					for _, key := range headers.Keys() {
-						req.Header.Set(key, headers.Get(key).String())
+						v := headers.Get(key)
+						if goja.IsUndefined(v) || goja.IsNull(v) {
+							req.Header.Del(key)
+							continue
+						}
+						req.Header.Set(key, v.String())
 					}
 				case "tags":
 					tagsV := params.Get(k)
@@ -149,127 +544,674 @@ func (*HTTP) Request(ctx context.Context, method, url string, args ...goja.Value
 					for _, key := range tagObj.Keys() {
 						tags[key] = tagObj.Get(key).String()
 					}
+				case "auth":
+					auth = params.Get(k).String()
+				case "username":
+					username = null.StringFrom(params.Get(k).String())
+				case "password":
+					password = null.StringFrom(params.Get(k).String())
+				case "retries":
+					retries = int(params.Get(k).ToInteger())
+				case "retryBackoff":
+					d, err := common.ToDuration(params.Get(k))
+					if err != nil {
+						return nil, errors.Wrap(err, "retryBackoff")
+					}
+					if d < 0 {
+						return nil, errors.New("retryBackoff: can't be negative")
+					}
+					retryBackoff = d
+				case "timeout":
+					// Numbers are milliseconds; 0 means no timeout.
+					d, err := common.ToDuration(params.Get(k))
+					if err != nil {
+						return nil, errors.Wrap(err, "timeout")
+					}
+					if d < 0 {
+						return nil, errors.New("timeout: can't be negative")
+					}
+					timeout = d
+				case "maxRedirects":
+					maxRedirects = int(params.Get(k).ToInteger())
+					if maxRedirects < 0 {
+						return nil, errors.New("maxRedirects: can't be negative")
+					}
+				case "followRedirects":
+					// false returns redirect responses as they are, rather than following them.
+					followRedirects = params.Get(k).ToBoolean()
+				case "retryAll":
+					retryAll = params.Get(k).ToBoolean()
+				case "retryServerErrors":
+					retryServerErrors = params.Get(k).ToBoolean()
+				case "throwOnError":
+					throwOnError = params.Get(k).ToBoolean()
+				case "compressBody":
+					compression = params.Get(k).String()
+					if compression != "gzip" && compression != "deflate" {
+						return nil, errors.Errorf("compressBody: unsupported encoding: %s", compression)
+					}
+				case "recordMetrics":
+					// false still makes the request, but emits none of the http_* samples for it.
+					recordMetrics = params.Get(k).ToBoolean()
+				case "cache":
+					// false bypasses the cache altogether; the response is neither looked up nor stored.
+					if !params.Get(k).ToBoolean() {
+						httpCache = nil
+					}
+				case "maxResponseBodySize":
+					maxBodySize = params.Get(k).ToInteger()
+					if maxBodySize < 0 {
+						return nil, errors.New("maxResponseBodySize: can't be negative")
+					}
+				case "debug":
+					// true dumps everything; a mode ("headers", "full") may also be given.
+					switch v := params.Get(k); v.Export().(type) {
+					case bool:
+						debug = ""
+						if v.ToBoolean() {
+							debug = lib.HTTPDebugFull
+						}
+					default:
+						debug = v.String()
+						if debug != lib.HTTPDebugHeaders && debug != lib.HTTPDebugFull {
+							return nil, errors.Errorf("invalid debug mode: %s", debug)
+						}
+					}
 				}
 			}
 		}
 	}
 
-	client := http.Client{Transport: state.HTTPTransport}
-	tracer := netext.Tracer{}
-	res, err := client.Do(req.WithContext(netext.WithTracer(ctx, &tracer)))
-	if err != nil {
-		state.Samples = append(state.Samples, tracer.Done().Samples(tags)...)
-		return nil, err
+	// Compressed bodies are read up front, so the compressed size can be sent as the Content-Length.
+	var bodySize, compressedSize int64
+	if compression != "" && req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "body")
+		}
+		compressed, err := compressBody(compression, data)
+		if err != nil {
+			return nil, errors.Wrap(err, "compressBody")
+		}
+		bodySize, compressedSize = int64(len(data)), int64(len(compressed))
+		req.Body = ioutil.NopCloser(bytes.NewReader(compressed))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(compressed)), nil
+		}
+		req.ContentLength = compressedSize
+		req.Header.Set("Content-Encoding", compression)
 	}
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		state.Samples = append(state.Samples, tracer.Done().Samples(tags)...)
-		return nil, err
+	// An explicit Content-Length is sent as given, even if it doesn't match the body, to see how
+	// servers cope. Go's client never writes past it, so a longer body is cut short; a shorter one
+	// is sent in full, after which the request fails while the server is still waiting for more.
+	if cl := req.Header.Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid Content-Length: %s", cl)
+		}
+		req.Header.Del("Content-Length")
+		setContentLength(req, n)
 	}
-	_ = res.Body.Close()
-	trail := tracer.Done()
 
+	// Emulate a browser cache, if enabled. Fresh entries are served without touching the network,
+	// and thus emit no metrics; stale ones are revalidated with a conditional request.
+	var cached *netext.CacheEntry
+	if httpCache != nil && method == "GET" {
+		if cached = httpCache.Get(url); cached != nil {
+			if cached.IsFresh(time.Now()) {
+				return &HTTPResponse{
+					ctx:        ctx,
+					Request:    HTTPRequest{Method: method, URL: url, Headers: joinHeaders(req.Header)},
+					URL:        cached.URL,
+					Status:     cached.Status,
+					StatusText: http.StatusText(cached.Status),
+					OK:         isOK(cached.Status),
+					Headers:    cached.Headers,
+					Body:       string(cached.Body),
+					FromCache:  true,
+					Redirects:  []HTTPRedirect{},
+				}, nil
+			}
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+	}
+
+	// Only idempotent requests are retried, unless the script insists.
+	if !retryAll && !isIdempotent(method) {
+		retries = 0
+	}
+
+	transport := state.HTTPTransport
+	if debug != "" {
+		logger := state.Logger
+		if logger == nil {
+			logger = log.StandardLogger()
+		}
+		transport = &netext.DumpTransport{
+			Transport: transport,
+			Logger:    logger.WithFields(log.Fields{"vu_id": state.VUID, "iteration": state.Iteration}),
+			Body:      debug == lib.HTTPDebugFull,
+			Redact:    state.HTTPDebugRedact,
+		}
+	}
+	// A username or password on its own implies basic auth. Credentials come from the URL, unless
+	// given explicitly; they must be removed from it, or they'll be sent as basic auth regardless.
+	if auth == "" && (username.Valid || password.Valid) {
+		auth = "basic"
+	}
+	if u := req.URL.User; u != nil && auth != "" {
+		if !username.Valid {
+			username = null.StringFrom(u.Username())
+		}
+		if p, ok := u.Password(); ok && !password.Valid {
+			password = null.StringFrom(p)
+		}
+		req.URL.User = nil
+	}
+	switch auth {
+	case "":
+	case "basic":
+		req.SetBasicAuth(username.String, password.String)
+	case "digest":
+		transport = &netext.DigestTransport{
+			Transport: transport,
+			Username:  username.String,
+			Password:  password.String,
+		}
+	case "ntlm":
+		// The transport is wrapped, so NTLMTransport can't see that keep-alive is disabled itself.
+		if state.NoConnectionReuse {
+			return nil, netext.ErrNTLMNoKeepAlive
+		}
+		// "DOMAIN\user" is supported.
+		domain, user := netext.SplitNTLMUsername(username.String)
+		transport = &netext.NTLMTransport{
+			Transport: transport,
+			Domain:    domain,
+			Username:  user,
+			Password:  password.String,
+		}
+	default:
+		return nil, errors.Errorf("unknown auth type: %s", auth)
+	}
+
+	// Every request starts a trace of its own; attempts and redirects are spans within it.
+	var trace *netext.TraceContext
+	if state.TracePropagator != "" {
+		sampled := random(state)() < state.TraceSampling
+		trace, err = netext.NewTraceContext(sampled, state.TracePropagator == lib.TracingPropagatorB3)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	redirects := 0
+	var chain []HTTPRedirect
+	client := http.Client{
+		Transport: transport,
+		Jar:       state.CookieJar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !followRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > maxRedirects {
+				return errors.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			redirects = len(via)
+			chain = append(chain, HTTPRedirect{URL: via[len(via)-1].URL.String(), Status: req.Response.StatusCode})
+			if trace != nil {
+				if _, err := trace.Inject(req.Header); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	var res *http.Response
+	var body []byte
+	var truncated bool
+	var readErr error
+	var trail netext.Trail
+	var timedOut bool
+	attempt := 0
+	for backoff := retryBackoff; ; backoff *= 2 {
+		attempt++
+
+		// Every attempt gets its own samples; tag them apart if there may be more than one.
+		attemptTags := tags
+		if retries > 0 {
+			attemptTags = make(map[string]string, len(tags)+1)
+			for k, v := range tags {
+				attemptTags[k] = v
+			}
+			attemptTags["attempt"] = strconv.Itoa(attempt)
+		}
+
+		if attempt > 1 && req.GetBody != nil {
+			b, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = b
+		}
+
+		// Waiting for a rate limit happens before the request is timed, so it's reported separately.
+		if len(state.RateLimiters) > 0 {
+			var waited time.Duration
+			for _, l := range state.RateLimiters {
+				d, err := l.Wait(ctx)
+				waited += d
+				if err != nil {
+					return nil, &HTTPError{Method: method, URL: url, Attempts: attempt, Err: err}
+				}
+			}
+			if recordMetrics {
+				state.Samples = append(state.Samples, stats.Sample{
+					Metric: metrics.HTTPReqRateLimited, Time: time.Now(), Tags: attemptTags, Value: stats.D(waited),
+				})
+			}
+		}
+
+		redirects, chain = 0, []HTTPRedirect{}
+		if trace != nil {
+			if _, err := trace.Inject(req.Header); err != nil {
+				return nil, err
+			}
+		}
+		// The timeout covers the whole attempt, redirects and reading the body included.
+		var reqCtx context.Context
+		var cancel context.CancelFunc
+		if timeout > 0 {
+			reqCtx, cancel = context.WithTimeout(ctx, timeout)
+		} else {
+			reqCtx, cancel = context.WithCancel(ctx)
+		}
+		tracer := netext.Tracer{}
+		res, err = client.Do(req.WithContext(netext.WithTracer(reqCtx, &tracer)))
+		readErr = nil
+		if err == nil {
+			// The server answered, so failing to read the body isn't the same as not getting a
+			// response; keep whatever was read, and report the error on the response.
+			body, truncated = nil, false
+			if bodyAllowed(method, res.StatusCode) {
+				body, truncated, readErr = readBody(res.Body, maxBodySize)
+			}
+			_ = res.Body.Close()
+		}
+		// An aborted iteration also cancels the request, but that's not a timeout.
+		timedOut = (err != nil || readErr != nil) && reqCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		trail = tracer.Done()
+		if err == nil {
+			attemptTags["status"] = strconv.Itoa(res.StatusCode)
+			attemptTags["proto"] = res.Proto
+		}
+		if timedOut {
+			attemptTags["error"] = "timeout"
+		} else if readErr != nil {
+			attemptTags["error"] = "read"
+		}
+		if state.DNSTags {
+			addDNSTags(attemptTags, trail)
+		}
+		if recordMetrics {
+			samples := trail.Samples(attemptTags)
+			if compression != "" {
+				samples = append(samples,
+					stats.Sample{Metric: metrics.HTTPReqBodySize, Time: trail.EndTime, Tags: attemptTags, Value: float64(bodySize)},
+					stats.Sample{Metric: metrics.HTTPReqBodyCompressed, Time: trail.EndTime, Tags: attemptTags, Value: float64(compressedSize)},
+				)
+			}
+			if trace != nil && trace.Sampled {
+				metadata := map[string]string{"trace_id": trace.TraceID}
+				for i := range samples {
+					samples[i].Metadata = metadata
+				}
+			}
+			if timedOut {
+				samples = append(samples, stats.Sample{
+					Metric: metrics.HTTPReqTimeouts, Time: trail.EndTime, Tags: attemptTags, Value: 1,
+				})
+			} else if readErr != nil {
+				samples = append(samples, stats.Sample{
+					Metric: metrics.HTTPReqReadErrors, Time: trail.EndTime, Tags: attemptTags, Value: 1,
+				})
+			}
+			state.Samples = append(state.Samples, samples...)
+		}
+
+		retryErr := err
+		if retryErr == nil {
+			retryErr = readErr
+		}
+		if attempt > retries || ctx.Err() != nil || !shouldRetry(retryErr, res, retryServerErrors) {
+			break
+		}
+
+		// Back off exponentially, with up to 50% jitter so VUs don't retry in lockstep.
+		jitter := time.Duration(random(state)() * float64(int64(backoff)/2+1))
+		timer := time.NewTimer(backoff + jitter)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, &HTTPError{Method: method, URL: url, Attempts: attempt, Redirects: redirects, Err: ctx.Err()}
+		}
+	}
+	if err != nil && timedOut {
+		return nil, &HTTPError{
+			Method: method, URL: url, Attempts: attempt, Redirects: redirects, Timeout: true,
+			Err: errors.Errorf("timed out after %s", timeout),
+		}
+	}
+	if err != nil {
+		// The client's own errors repeat the method and URL; don't say them twice.
+		if uerr, ok := err.(*neturl.Error); ok {
+			err = uerr.Err
+		}
+		return nil, &HTTPError{Method: method, URL: url, Attempts: attempt, Redirects: redirects, Err: err}
+	}
 	tags["status"] = strconv.Itoa(res.StatusCode)
-	state.Samples = append(state.Samples, trail.Samples(tags)...)
+	tags["proto"] = res.Proto
 
-	headers := make(map[string]string, len(res.Header))
-	for k, vs := range res.Header {
-		headers[k] = strings.Join(vs, ", ")
+	headers := joinHeaders(res.Header)
+	// Custom transports (eg. mocks) may not make any connections at all.
+	var remoteHost string
+	var remotePort int
+	if trail.ConnRemoteAddr != nil {
+		host, portStr, _ := net.SplitHostPort(trail.ConnRemoteAddr.String())
+		remoteHost = host
+		remotePort, _ = strconv.Atoi(portStr)
 	}
-	remoteHost, remotePortStr, _ := net.SplitHostPort(trail.ConnRemoteAddr.String())
-	remotePort, _ := strconv.Atoi(remotePortStr)
-	return &HTTPResponse{
+	resp := &HTTPResponse{
 		ctx: ctx,
+		Request: HTTPRequest{
+			Method:  res.Request.Method,
+			URL:     res.Request.URL.String(),
+			Headers: joinHeaders(res.Request.Header),
+		},
 
-		RemoteIP:   remoteHost,
-		RemotePort: remotePort,
-		URL:        res.Request.URL.String(),
-		Status:     res.StatusCode,
-		Headers:    headers,
-		Body:       string(body),
+		RemoteIP:      remoteHost,
+		RemotePort:    remotePort,
+		URL:           res.Request.URL.String(),
+		Proto:         res.Proto,
+		Status:        res.StatusCode,
+		StatusText:    statusText(res),
+		OK:            isOK(res.StatusCode),
+		Headers:       headers,
+		Body:          string(body),
+		BodyTruncated: truncated,
+		Attempts:      attempt,
+		Redirects:     chain,
+		TLS:           newHTTPResponseTLS(res.TLS),
 		Timings: HTTPResponseTimings{
-			Duration:   stats.D(trail.Duration),
-			Blocked:    stats.D(trail.Blocked),
-			Connecting: stats.D(trail.Connecting),
-			Sending:    stats.D(trail.Sending),
-			Waiting:    stats.D(trail.Waiting),
-			Receiving:  stats.D(trail.Receiving),
+			Duration:       stats.D(trail.Duration),
+			Blocked:        stats.D(trail.Blocked),
+			Connecting:     stats.D(trail.Connecting),
+			TLSHandshaking: stats.D(trail.TLSHandshaking),
+			Sending:        stats.D(trail.Sending),
+			Waiting:        stats.D(trail.Waiting),
+			Receiving:      stats.D(trail.Receiving),
 		},
-	}, nil
+	}
+	if readErr != nil {
+		if timedOut {
+			resp.Error = fmt.Sprintf("timeout: timed out after %s while reading the body", timeout)
+			resp.ErrorCategory = "timeout"
+		} else {
+			if uerr, ok := readErr.(*neturl.Error); ok {
+				readErr = uerr.Err
+			}
+			resp.Error = "read: " + readErr.Error()
+			resp.ErrorCategory = "read"
+		}
+	}
+
+	if httpCache != nil && method == "GET" {
+		switch {
+		case cached != nil && res.StatusCode == http.StatusNotModified:
+			httpCache.Set(url, cached.Revalidated(trail.EndTime, res.Header))
+			resp.Status = cached.Status
+			resp.StatusText = http.StatusText(cached.Status)
+			resp.OK = isOK(cached.Status)
+			resp.Headers = cached.Headers
+			resp.Body = string(cached.Body)
+			resp.FromCache = true
+		case res.StatusCode == http.StatusOK && !truncated && readErr == nil:
+			if entry := netext.NewCacheEntry(resp.URL, trail.EndTime, res.StatusCode, res.Header, body); entry != nil {
+				httpCache.Set(url, entry)
+			}
+		}
+	}
+
+	if throwOnError && (resp.Status >= 400 || resp.Error != "") {
+		return nil, &HTTPError{Method: method, URL: url, Attempts: attempt, Redirects: redirects, Timeout: timedOut, Response: resp}
+	}
+	return resp, nil
 }
 
-func (http *HTTP) Get(ctx context.Context, url string, args ...goja.Value) (*HTTPResponse, error) {
+// Returns whether a status is a success, ie. 2xx.
+func isOK(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// Returns a response's reason phrase, eg. "Not Found", as sent by the server.
+func statusText(res *http.Response) string {
+	text := strings.TrimSpace(strings.TrimPrefix(res.Status, strconv.Itoa(res.StatusCode)))
+	if text == "" {
+		return http.StatusText(res.StatusCode)
+	}
+	return text
+}
+
+// Flattens headers into a map, joining repeated ones with commas.
+func joinHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for k, vs := range h {
+		headers[k] = strings.Join(vs, ", ")
+	}
+	return headers
+}
+
+// Reads a response body, keeping at most limit bytes (0 means no limit). Anything past that is
+// still read, so it's accounted for and the connection can be reused, but thrown away.
+func readBody(r io.Reader, limit int64) ([]byte, bool, error) {
+	if limit <= 0 {
+		body, err := ioutil.ReadAll(r)
+		return body, false, err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r, limit))
+	if err != nil {
+		return body, false, err
+	}
+	n, err := io.Copy(ioutil.Discard, r)
+	return body, n > 0, err
+}
+
+// Returns whether a response to a request can have a body at all; HEAD responses and 1xx, 204 and
+// 304 ones never do, whatever their headers say.
+func bodyAllowed(method string, status int) bool {
+	switch {
+	case method == "HEAD":
+		return false
+	case status >= 100 && status < 200, status == 204, status == 304:
+		return false
+	}
+	return true
+}
+
+// Describes why bodyAllowed() says a response can't have a body, for error messages.
+func noBodyReason(method string, status int) string {
+	if method == "HEAD" {
+		return "HEAD"
+	}
+	return strconv.Itoa(status)
+}
+
+// Returns whether a method is safe to send more than once.
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns whether a failed attempt is worth retrying: network errors always are, gateway errors
+// only if requested, and anything else never is.
+func shouldRetry(err error, res *http.Response, retryServerErrors bool) bool {
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return retryServerErrors
+	default:
+		return false
+	}
+}
+
+// Returns the VU's seeded RNG, so that a replayed iteration makes the same random choices.
+func random(state *common.State) func() float64 {
+	if state.Rand != nil {
+		return state.Rand
+	}
+	return rand.Float64
+}
+
+func (http *HTTP) Get(ctx context.Context, url goja.Value, args ...goja.Value) (*HTTPResponse, error) {
 	// The body argument is always undefined for GETs and HEADs.
 	args = append([]goja.Value{goja.Undefined()}, args...)
 	return http.Request(ctx, "GET", url, args...)
 }
 
-func (http *HTTP) Head(ctx context.Context, url string, args ...goja.Value) (*HTTPResponse, error) {
+func (http *HTTP) Head(ctx context.Context, url goja.Value, args ...goja.Value) (*HTTPResponse, error) {
 	// The body argument is always undefined for GETs and HEADs.
 	args = append([]goja.Value{goja.Undefined()}, args...)
 	return http.Request(ctx, "HEAD", url, args...)
 }
 
-func (http *HTTP) Post(ctx context.Context, url string, args ...goja.Value) (*HTTPResponse, error) {
+func (http *HTTP) Post(ctx context.Context, url goja.Value, args ...goja.Value) (*HTTPResponse, error) {
 	return http.Request(ctx, "POST", url, args...)
 }
 
-func (http *HTTP) Put(ctx context.Context, url string, args ...goja.Value) (*HTTPResponse, error) {
+func (http *HTTP) Put(ctx context.Context, url goja.Value, args ...goja.Value) (*HTTPResponse, error) {
 	return http.Request(ctx, "PUT", url, args...)
 }
 
-func (http *HTTP) Patch(ctx context.Context, url string, args ...goja.Value) (*HTTPResponse, error) {
+func (http *HTTP) Patch(ctx context.Context, url goja.Value, args ...goja.Value) (*HTTPResponse, error) {
 	return http.Request(ctx, "PATCH", url, args...)
 }
 
-func (http *HTTP) Del(ctx context.Context, url string, args ...goja.Value) (*HTTPResponse, error) {
+func (http *HTTP) Del(ctx context.Context, url goja.Value, args ...goja.Value) (*HTTPResponse, error) {
 	return http.Request(ctx, "DELETE", url, args...)
 }
 
+func (http *HTTP) Options(ctx context.Context, url goja.Value, args ...goja.Value) (*HTTPResponse, error) {
+	return http.Request(ctx, "OPTIONS", url, args...)
+}
+
+// Makes requests in parallel. Requests may wait for others to finish first, by naming their keys
+// in a "waitFor" param; they're tagged with their depth in that graph as "batch_wave", starting at 0.
+// If a request fails, any that wait for it are skipped.
 func (http *HTTP) Batch(ctx context.Context, reqsV goja.Value) (goja.Value, error) {
 	rt := common.GetRuntime(ctx)
 
-	errs := make(chan error)
 	retval := rt.NewObject()
 	mutex := sync.Mutex{}
 
 	reqs := reqsV.ToObject(rt)
 	keys := reqs.Keys()
+	entries := make(map[string]*batchEntry, len(keys))
+	hasDeps := false
 	for _, k := range keys {
-		k := k
 		v := reqs.Get(k)
-
-		var method, url string
-		var args []goja.Value
+		entry := &batchEntry{done: make(chan struct{})}
+		entries[k] = entry
 
 		// Shorthand: "http://example.com/" -> ["GET", "http://example.com/"]
-		if v.ExportType().Kind() == reflect.String {
-			method = "GET"
-			url = v.String()
-		} else {
-			obj := v.ToObject(rt)
-			objkeys := obj.Keys()
-			for i, objk := range objkeys {
-				objv := obj.Get(objk)
-				switch i {
-				case 0:
-					method = strings.ToUpper(objv.String())
-					if method == "GET" || method == "HEAD" {
-						args = []goja.Value{goja.Undefined()}
-					}
-				case 1:
-					url = objv.String()
-				default:
-					args = append(args, objv)
+		_, isURLTag := v.Export().(URLTag)
+		if isURLTag || v.ExportType().Kind() == reflect.String {
+			entry.method = "GET"
+			entry.url = v
+			continue
+		}
+
+		obj := v.ToObject(rt)
+		objkeys := obj.Keys()
+		for i, objk := range objkeys {
+			objv := obj.Get(objk)
+			switch i {
+			case 0:
+				// Requests run in goroutines of their own, so invalid methods are caught here,
+				// where it's still safe to throw.
+				m, err := normalizeMethod(objv.String())
+				if err != nil {
+					panic(rt.NewTypeError("%s", err.Error()))
+				}
+				entry.method = m
+				if entry.method == "GET" || entry.method == "HEAD" {
+					entry.args = []goja.Value{goja.Undefined()}
 				}
+			case 1:
+				entry.url = objv
+			default:
+				entry.args = append(entry.args, objv)
 			}
 		}
+		if len(entry.args) > 1 {
+			if params := entry.args[1]; !goja.IsUndefined(params) && !goja.IsNull(params) {
+				if dep := params.ToObject(rt).Get("waitFor"); dep != nil && !goja.IsUndefined(dep) && !goja.IsNull(dep) {
+					entry.waitFor = dep.String()
+					hasDeps = true
+				}
+			}
+		}
+	}
+
+	// Only batches with dependencies are tagged, so that plain ones report the same as ever.
+	if hasDeps {
+		for _, k := range keys {
+			if _, err := batchWave(entries, k, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
 
+	errs := make(chan error)
+	for _, k := range keys {
+		k := k
+		entry := entries[k]
 		go func() {
-			res, err := http.Request(ctx, method, url, args...)
+			defer close(entry.done)
+
+			var tags map[string]string
+			if hasDeps {
+				tags = map[string]string{"batch_wave": strconv.Itoa(entry.wave)}
+			}
+			if entry.waitFor != "" {
+				dep := entries[entry.waitFor]
+				<-dep.done
+				if dep.failed {
+					entry.failed = true
+					errs <- nil
+					return
+				}
+			}
+
+			res, err := request(ctx, tags, entry.method, entry.url, entry.args...)
 			if err != nil {
+				entry.failed = true
 				errs <- err
+				return
 			}
 			mutex.Lock()
 			_ = retval.Set(k, res)
@@ -286,3 +1228,39 @@ func (http *HTTP) Batch(ctx context.Context, reqsV goja.Value) (goja.Value, erro
 	}
 	return retval, err
 }
+
+// A request in a batch.
+type batchEntry struct {
+	method  string
+	url     goja.Value
+	args    []goja.Value
+	waitFor string
+	wave    int
+
+	// Closed when the request is finished; failed is only safe to read after that.
+	done   chan struct{}
+	failed bool
+}
+
+// Works out how deep in a batch's dependency graph a request is, recording it in its entry's wave.
+// path holds the keys visited on the way there, to detect cycles.
+func batchWave(entries map[string]*batchEntry, key string, path []string) (int, error) {
+	entry := entries[key]
+	if entry.waitFor == "" {
+		return 0, nil
+	}
+	for i, k := range path {
+		if k == key {
+			return 0, errors.Errorf("batch: dependency cycle: %s", strings.Join(append(path[i:], key), " -> "))
+		}
+	}
+	if _, ok := entries[entry.waitFor]; !ok {
+		return 0, errors.Errorf("batch: %s waits for unknown request: %s", key, entry.waitFor)
+	}
+	wave, err := batchWave(entries, entry.waitFor, append(path, key))
+	if err != nil {
+		return 0, err
+	}
+	entry.wave = wave + 1
+	return entry.wave, nil
+}
@@ -21,31 +21,56 @@
 package http
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto"
+	"crypto/md5"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
+	logtest "github.com/Sirupsen/logrus/hooks/test"
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/netext"
 	"github.com/loadimpact/k6/stats"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+	"gopkg.in/guregu/null.v3"
 )
 
 func assertRequestMetricsEmitted(t *testing.T, samples []stats.Sample, method, url string, status int, group string) {
 	seenDuration := false
 	seenBlocked := false
 	seenConnecting := false
+	seenTLSHandshaking := false
 	seenSending := false
 	seenWaiting := false
 	seenReceiving := false
+	host := ""
+	if u, err := neturl.Parse(url); err == nil {
+		host = u.Host
+	}
 	for _, sample := range samples {
 		if sample.Tags["url"] == url {
 			switch sample.Metric {
@@ -55,6 +80,8 @@ func assertRequestMetricsEmitted(t *testing.T, samples []stats.Sample, method, u
 				seenBlocked = true
 			case metrics.HTTPReqConnecting:
 				seenConnecting = true
+			case metrics.HTTPReqTLSHandshaking:
+				seenTLSHandshaking = true
 			case metrics.HTTPReqSending:
 				seenSending = true
 			case metrics.HTTPReqWaiting:
@@ -66,11 +93,13 @@ func assertRequestMetricsEmitted(t *testing.T, samples []stats.Sample, method, u
 			assert.Equal(t, strconv.Itoa(status), sample.Tags["status"])
 			assert.Equal(t, method, sample.Tags["method"])
 			assert.Equal(t, group, sample.Tags["group"])
+			assert.Equal(t, host, sample.Tags["host"])
 		}
 	}
 	assert.True(t, seenDuration, "url %s didn't emit Duration", url)
 	assert.True(t, seenBlocked, "url %s didn't emit Blocked", url)
 	assert.True(t, seenConnecting, "url %s didn't emit Connecting", url)
+	assert.True(t, seenTLSHandshaking, "url %s didn't emit TLSHandshaking", url)
 	assert.True(t, seenSending, "url %s didn't emit Sending", url)
 	assert.True(t, seenWaiting, "url %s didn't emit Waiting", url)
 	assert.True(t, seenReceiving, "url %s didn't emit Receiving", url)
@@ -156,14 +185,1399 @@ func TestRequest(t *testing.T) {
 			assert.EqualError(t, err, "GoError: invalid character '<' looking for beginning of value")
 		})
 	})
+	t.Run("SetMaxConnsPerHost", func(t *testing.T) {
+		var active, maxActive int64
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, "ok")
+		}))
+		srv.Config.ConnState = func(conn net.Conn, cs http.ConnState) {
+			switch cs {
+			case http.StateNew:
+				n := atomic.AddInt64(&active, 1)
+				for {
+					max := atomic.LoadInt64(&maxActive)
+					if n <= max || atomic.CompareAndSwapInt64(&maxActive, max, n) {
+						break
+					}
+				}
+			case http.StateClosed, http.StateHijacked:
+				atomic.AddInt64(&active, -1)
+			}
+		}
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		oldDialer, oldTransport := state.Dialer, state.HTTPTransport
+		defer func() { state.Dialer, state.HTTPTransport = oldDialer, oldTransport }()
+		state.Dialer = netext.NewDialer(net.Dialer{}).ForVU()
+		state.HTTPTransport = &http.Transport{DialContext: state.Dialer.DialContext}
+
+		_, err := common.RunString(rt, `
+		http.setMaxConnsPerHost(1);
+		let res = http.batch([srvURL, srvURL, srvURL, srvURL]);
+		for (let i = 0; i < 4; i++) {
+			if (res[i].status != 200) { throw new Error("wrong status: " + res[i].status); }
+		}
+		`)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), atomic.LoadInt64(&maxActive))
+		assert.Equal(t, 1, state.Dialer.MaxConnsPerHost)
+
+		t.Run("Clamped", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.setMaxConnsPerHost(1e12)`)
+			assert.NoError(t, err)
+			assert.Equal(t, math.MaxInt32, state.Dialer.MaxConnsPerHost)
+		})
+		t.Run("Invalid", func(t *testing.T) {
+			for _, v := range []string{"0", "-1", "1.5", "'nope'", "undefined"} {
+				_, err := common.RunString(rt, "http.setMaxConnsPerHost("+v+")")
+				assert.Error(t, err, v)
+			}
+		})
+	})
+	t.Run("DNSTags", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, "ok")
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", strings.Replace(srv.URL, "127.0.0.1", "test.local", 1))
+
+		oldDialer, oldTransport := state.Dialer, state.HTTPTransport
+		defer func() {
+			state.Dialer, state.HTTPTransport, state.DNSTags = oldDialer, oldTransport, false
+		}()
+		state.Dialer = netext.NewDialer(net.Dialer{})
+		state.Dialer.Resolver.LookupIP = func(ctx context.Context, host string) ([]net.IP, error) {
+			return []net.IP{net.ParseIP("127.0.0.1")}, nil
+		}
+		state.HTTPTransport = &http.Transport{DialContext: state.Dialer.DialContext, DisableKeepAlives: true}
+		state.DNSTags = true
+
+		for _, expected := range []string{"miss", "hit"} {
+			state.Samples = nil
+			_, err := common.RunString(rt, `http.get(srvURL)`)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, sample := range state.Samples {
+				assert.Equal(t, "127.0.0.1", sample.Tags["ip"])
+				assert.Equal(t, expected, sample.Tags["dns_cache"])
+			}
+		}
+	})
+	t.Run("Bodyless", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method {
+			case "OPTIONS":
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+				w.WriteHeader(204)
+			default:
+				_, _ = fmt.Fprint(w, `{"a":1}`)
+			}
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		t.Run("HEAD", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.head(srvURL);
+			if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+			if (res.body !== "") { throw new Error("body not empty: " + res.body); }
+			if (res.headers["Content-Length"] != "7") { throw new Error("wrong Content-Length: " + res.headers["Content-Length"]); }
+			res.json();
+			`)
+			assert.EqualError(t, err, "GoError: can't parse the response to HEAD "+srv.URL+" as JSON: HEAD responses have no body")
+		})
+		t.Run("OPTIONS", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.options(srvURL);
+			if (res.status != 204) { throw new Error("wrong status: " + res.status); }
+			if (res.body !== "") { throw new Error("body not empty: " + res.body); }
+			if (res.headers["Access-Control-Allow-Methods"] != "GET, POST") { throw new Error("wrong Access-Control-Allow-Methods: " + res.headers["Access-Control-Allow-Methods"]); }
+			res.json();
+			`)
+			assert.EqualError(t, err, "GoError: can't parse the response to OPTIONS "+srv.URL+" as JSON: 204 responses have no body")
+		})
+	})
+	t.Run("ReadError", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+			_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 1000\r\n\r\npartial")
+			_ = buf.Flush()
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let res = http.get(srvURL);
+		if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+		if (res.body != "partial") { throw new Error("wrong body: " + res.body); }
+		if (res.error != "read: unexpected EOF") { throw new Error("wrong error: " + res.error); }
+		if (res.error_category != "read") { throw new Error("wrong errorCategory: " + res.error_category); }
+		`)
+		assert.NoError(t, err)
+
+		var readErrors int
+		for _, sample := range state.Samples {
+			if sample.Metric == metrics.HTTPReqReadErrors {
+				readErrors++
+			}
+			assert.Equal(t, "read", sample.Tags["error"])
+		}
+		assert.Equal(t, 1, readErrors)
+
+		t.Run("throwOnError", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.get(srvURL, { throwOnError: true })`)
+			assert.EqualError(t, err, "GoError: GET "+srv.URL+": 200 OK: read: unexpected EOF")
+		})
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		done := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/body" {
+				w.Header().Set("Content-Length", "10")
+				_, _ = fmt.Fprint(w, "part")
+				w.(http.Flusher).Flush()
+			}
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer srv.Close()
+		defer close(done)
+		rt.Set("srvURL", srv.URL)
+
+		state.Samples = nil
+		_, err := common.RunString(rt, `http.get(srvURL, { timeout: 100 })`)
+		assert.EqualError(t, err, "GoError: GET "+srv.URL+": timed out after 100ms")
+
+		var timeouts int
+		for _, sample := range state.Samples {
+			if sample.Metric == metrics.HTTPReqTimeouts {
+				timeouts++
+			}
+			assert.Equal(t, "timeout", sample.Tags["error"])
+		}
+		assert.Equal(t, 1, timeouts)
+
+		t.Run("Default", func(t *testing.T) {
+			state.HTTPTimeout = 100 * time.Millisecond
+			defer func() { state.HTTPTimeout = 0 }()
+
+			_, err := common.RunString(rt, `
+			try {
+				http.get(srvURL);
+				throw new Error("didn't time out");
+			} catch (e) {
+				if (!e.timeout) { throw e; }
+			}
+			`)
+			assert.NoError(t, err)
+
+			t.Run("Overridden", func(t *testing.T) {
+				_, err := common.RunString(rt, `http.get(srvURL, { timeout: "50ms" })`)
+				assert.EqualError(t, err, "GoError: GET "+srv.URL+": timed out after 50ms")
+			})
+		})
+		t.Run("Body", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.get(srvURL + "/body", { timeout: 100 });
+			if (res.body != "part") { throw new Error("wrong body: " + res.body); }
+			if (res.error_category != "timeout") { throw new Error("wrong errorCategory: " + res.error_category); }
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("Invalid", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.get(srvURL, { timeout: -1 })`)
+			assert.EqualError(t, err, "GoError: timeout: can't be negative")
+		})
+	})
+	t.Run("XML", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/broken" {
+				_, _ = fmt.Fprint(w, "<items>\n<item></items>")
+				return
+			}
+			_, _ = fmt.Fprint(w, `<items><item id="1">a</item><item id="2">b</item></items>`)
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		_, err := common.RunString(rt, `
+		let doc = http.get(srvURL).xml();
+		if (doc.get("/items/item[@id='2']/text()") != "b") { throw new Error("wrong item"); }
+		if (doc.find("//item/@id").join(",") != "1,2") { throw new Error("wrong ids"); }
+		`)
+		assert.NoError(t, err)
+
+		t.Run("Invalid", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			try {
+				http.get(srvURL + "/broken").xml();
+				throw new Error("no error");
+			} catch (e) {
+				if (e.line != 2) { throw new Error("wrong line: " + e.line); }
+			}
+			`)
+			assert.NoError(t, err)
+		})
+	})
+	t.Run("FindBetween", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, `<input name="csrf" value="abc"><input name="csrf" value="def"><input name="x" value="`)
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		_, err := common.RunString(rt, `let form = http.get(srvURL);`)
+		if !assert.NoError(t, err) {
+			return
+		}
+		testdata := map[string]string{
+			`form.findBetween('name="csrf" value="', '"')`:              "abc",
+			`form.findBetween('value="', '"')`:                          "abc",
+			`form.findBetween('name="x" value="', '"')`:                 "undefined",
+			`form.findBetween('nope', '"')`:                             "undefined",
+			`form.findBetween('<input', '')`:                            "",
+			`form.findBetweenAll('name="csrf" value="', '"').join(",")`: "abc,def",
+			`form.findBetweenAll('value="', '"').join(",")`:             "abc,def",
+			`form.findBetweenAll('nope', '"').length`:                   "0",
+			`form.findBetweenAll('', '').length`:                        "0",
+		}
+		for src, expected := range testdata {
+			t.Run(src, func(t *testing.T) {
+				v, err := common.RunString(rt, src)
+				if assert.NoError(t, err) {
+					assert.Equal(t, expected, v.String())
+				}
+			})
+		}
+	})
 	t.Run("Invalid", func(t *testing.T) {
-		_, err := common.RunString(rt, `http.request("", "");`)
-		assert.EqualError(t, err, "GoError: Get : unsupported protocol scheme \"\"")
+		_, err := common.RunString(rt, `http.request("GET", "");`)
+		assert.EqualError(t, err, "GoError: GET : unsupported protocol scheme \"\"")
 	})
 	t.Run("Unroutable", func(t *testing.T) {
 		_, err := common.RunString(rt, `http.request("GET", "http://sdafsgdhfjg/");`)
 		assert.Error(t, err)
 	})
+	t.Run("ErrorContext", func(t *testing.T) {
+		// Nothing listens on port 1, so following the redirect fails.
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://127.0.0.1:1/", http.StatusFound)
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		t.Run("Request", func(t *testing.T) {
+			v, err := common.RunString(rt, `
+			(function() {
+				try {
+					http.post(srvURL + "/a", "body");
+				} catch (e) {
+					return [e.method, e.url == srvURL + "/a", e.attempts, e.redirects].join(" ");
+				}
+			})()`)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "POST true 1 1", v.String())
+			}
+		})
+		t.Run("Batch", func(t *testing.T) {
+			v, err := common.RunString(rt, `
+			(function() {
+				try {
+					http.batch([["GET", srvURL + "/b"]]);
+				} catch (e) {
+					return e.message.indexOf("GET " + srvURL + "/b: ") == 0 && e.redirects == 1;
+				}
+			})()`)
+			if assert.NoError(t, err) {
+				assert.True(t, v.ToBoolean())
+			}
+		})
+	})
+
+	t.Run("URLTag", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let id = 1234;
+		let res = http.request("GET", http.url`+"`"+`https://httpbin.org/anything/${id}?a=${1+1}`+"`"+`);
+		if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+		if (res.json().url != "https://httpbin.org/anything/1234?a=2") { throw new Error("wrong url: " + res.json().url); }
+		`)
+		assert.NoError(t, err)
+		assertRequestMetricsEmitted(t, state.Samples, "GET", "https://httpbin.org/anything/1234?a=2", 200, "")
+		for _, sample := range state.Samples {
+			assert.Equal(t, "https://httpbin.org/anything/${}?a=${}", sample.Tags["name"])
+		}
+
+		t.Run("Batch", func(t *testing.T) {
+			state.Samples = nil
+			_, err := common.RunString(rt, `
+			let res = http.batch([
+				http.url`+"`"+`https://httpbin.org/anything/${1}`+"`"+`,
+				["GET", http.url`+"`"+`https://httpbin.org/anything/${2}`+"`"+`],
+			]);
+			for (var key in res) {
+				if (res[key].status != 200) { throw new Error("wrong status: " + res[key].status); }
+			}
+			`)
+			assert.NoError(t, err)
+			for _, sample := range state.Samples {
+				assert.Equal(t, "https://httpbin.org/anything/${}", sample.Tags["name"])
+			}
+		})
+
+		t.Run("String", func(t *testing.T) {
+			state.Samples = nil
+			_, err := common.RunString(rt, `http.request("GET", "https://httpbin.org/get");`)
+			assert.NoError(t, err)
+			for _, sample := range state.Samples {
+				assert.Equal(t, "https://httpbin.org/get", sample.Tags["name"])
+			}
+		})
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		var hits, revalidations int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				revalidations++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			if r.URL.Path == "/fresh" {
+				w.Header().Set("Cache-Control", "max-age=3600")
+			}
+			_, _ = fmt.Fprint(w, "cached body")
+		}))
+		defer srv.Close()
+
+		state.HTTPCache = netext.NewCache(netext.DefaultCacheSize)
+		defer func() { state.HTTPCache = nil }()
+		rt.Set("srvURL", srv.URL)
+
+		t.Run("Fresh", func(t *testing.T) {
+			hits = 0
+			state.Samples = nil
+			_, err := common.RunString(rt, `
+			let res1 = http.get(srvURL + "/fresh");
+			if (res1.from_cache) { throw new Error("first response was cached"); }
+			let res2 = http.get(srvURL + "/fresh");
+			if (!res2.from_cache) { throw new Error("second response wasn't cached"); }
+			if (res2.body != "cached body") { throw new Error("wrong body: " + res2.body); }
+			`)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, hits)
+
+			reqs := 0
+			for _, sample := range state.Samples {
+				if sample.Metric == metrics.HTTPReqs {
+					reqs++
+				}
+			}
+			assert.Equal(t, 1, reqs)
+		})
+		t.Run("Stale", func(t *testing.T) {
+			hits = 0
+			_, err := common.RunString(rt, `
+			let res1 = http.get(srvURL + "/stale");
+			if (res1.from_cache) { throw new Error("first response was cached"); }
+			let res2 = http.get(srvURL + "/stale");
+			if (!res2.from_cache) { throw new Error("second response wasn't cached"); }
+			if (res2.status != 200) { throw new Error("wrong status: " + res2.status); }
+			if (res2.body != "cached body") { throw new Error("wrong body: " + res2.body); }
+			`)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, hits)
+			assert.Equal(t, 1, revalidations)
+		})
+		t.Run("Bypass", func(t *testing.T) {
+			hits = 0
+			revalidations = 0
+			_, err := common.RunString(rt, `
+			let res1 = http.get(srvURL + "/fresh", { cache: false });
+			if (res1.from_cache) { throw new Error("response was cached"); }
+			if (res1.request.headers["If-None-Match"]) { throw new Error("request was conditional"); }
+			let res2 = http.get(srvURL + "/bypassed", { cache: false });
+			let res3 = http.get(srvURL + "/bypassed");
+			if (res3.from_cache) { throw new Error("bypassed response was stored"); }
+			`)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, hits)
+			assert.Equal(t, 0, revalidations)
+		})
+	})
+
+	t.Run("FileStream", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/redirect" {
+				http.Redirect(w, r, "/upload", http.StatusTemporaryRedirect)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			_, _ = fmt.Fprintf(w, "%d %d", r.ContentLength, len(body))
+		}))
+		defer srv.Close()
+
+		fs := afero.NewMemMapFs()
+		assert.NoError(t, afero.WriteFile(fs, "/upload.bin", bytes.Repeat([]byte("x"), 100000), 0644))
+		stream, err := common.NewFileStream(fs, "/upload.bin")
+		if !assert.NoError(t, err) {
+			return
+		}
+		rt.Set("stream", stream)
+		rt.Set("srvURL", srv.URL)
+
+		for _, path := range []string{"/upload", "/redirect"} {
+			t.Run(path, func(t *testing.T) {
+				state.Samples = nil
+				_, err := common.RunString(rt, fmt.Sprintf(`
+				let res = http.post(srvURL + "%s", stream);
+				if (res.body != "100000 100000") { throw new Error("wrong body: " + res.body); }
+				`, path))
+				assert.NoError(t, err)
+
+				sent := 0.0
+				for _, sample := range state.Samples {
+					if sample.Metric == metrics.DataSent {
+						sent += sample.Value
+					}
+				}
+				assert.True(t, sent > 100000, "streamed bytes not counted: %v", sent)
+			})
+		}
+	})
+
+	t.Run("RawBody", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			_, _ = fmt.Fprintf(w, "%d %x", r.ContentLength, body)
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		t.Run("Bytes", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.post(srvURL, [0, 1, 13, 10, 255]);
+			if (res.body != "5 00010d0aff") { throw new Error("wrong body: " + res.body); }
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("InvalidBytes", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.post(srvURL, [0, 256]);`)
+			assert.EqualError(t, err, "GoError: body: invalid byte at index 1: 256")
+		})
+		t.Run("ContentLength", func(t *testing.T) {
+			testdata := map[string]string{
+				`http.post(srvURL, "abcdef", { headers: { "Content-Length": "3" } })`:     "3 616263",
+				`http.post(srvURL, [97, 98, 99], { headers: { "Content-Length": "0" } })`: "0 ",
+				`http.post(srvURL, "abc", { headers: { "Content-Length": "3" } })`:        "3 616263",
+			}
+			for src, body := range testdata {
+				t.Run(src, func(t *testing.T) {
+					v, err := common.RunString(rt, src+`.body`)
+					if assert.NoError(t, err) {
+						assert.Equal(t, body, v.String())
+					}
+				})
+			}
+
+			t.Run("Longer", func(t *testing.T) {
+				_, err := common.RunString(rt, `http.post(srvURL, "abc", { headers: { "Content-Length": "10" } });`)
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "ContentLength=10 with Body length 3")
+				}
+			})
+			t.Run("Invalid", func(t *testing.T) {
+				_, err := common.RunString(rt, `http.post(srvURL, "abc", { headers: { "Content-Length": "-1" } });`)
+				assert.EqualError(t, err, "GoError: invalid Content-Length: -1")
+			})
+		})
+	})
+
+	t.Run("FormData", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var parts []string
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+				if err := r.ParseMultipartForm(1 << 20); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				for _, k := range []string{"a", "file"} {
+					parts = append(parts, r.MultipartForm.Value[k]...)
+					for _, fh := range r.MultipartForm.File[k] {
+						f, _ := fh.Open()
+						data, _ := ioutil.ReadAll(f)
+						_ = f.Close()
+						parts = append(parts, fmt.Sprintf("%s:%s:%d", fh.Filename, fh.Header.Get("Content-Type"), len(data)))
+					}
+				}
+			} else {
+				_ = r.ParseForm()
+				parts = append(parts, r.PostForm["a"]...)
+				parts = append(parts, r.PostForm["b"]...)
+			}
+			_, _ = fmt.Fprint(w, strings.Join(parts, ","))
+		}))
+		defer srv.Close()
+
+		fs := afero.NewMemMapFs()
+		assert.NoError(t, afero.WriteFile(fs, "/dir/upload.bin", []byte("0123456789"), 0644))
+		stream, err := common.NewFileStream(fs, "/dir/upload.bin")
+		if !assert.NoError(t, err) {
+			return
+		}
+		rt.Set("stream", stream)
+		rt.Set("srvURL", srv.URL)
+
+		testdata := map[string]struct{ src, body string }{
+			"Urlencoded": {`fd.append("a", 1); fd.append("a", "two"); fd.append("b", "x y");`, "1,two,x y"},
+			"File":       {`fd.append("a", "1"); fd.append("file", http.file("hello", "hello.txt", "text/plain"));`, "1,hello.txt:text/plain:5"},
+			"Bytes":      {`fd.append("file", http.file([1, 2, 3]));`, "file:application/octet-stream:3"},
+			"Stream":     {`fd.append("file", stream); fd.append("file", stream, "renamed.bin");`, "upload.bin:application/octet-stream:10,renamed.bin:application/octet-stream:10"},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				v, err := common.RunString(rt, `(function() {
+				let fd = new http.FormData();
+				`+data.src+`
+				return http.post(srvURL, fd).body;
+				})()`)
+				if assert.NoError(t, err) {
+					assert.Equal(t, data.body, v.String())
+				}
+			})
+		}
+	})
+
+	t.Run("Tracing", func(t *testing.T) {
+		var hops []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hops = append(hops, r.Header.Get("traceparent")+r.Header.Get("X-B3-TraceId"))
+			if r.URL.Path == "/redirect" {
+				http.Redirect(w, r, "/echo", http.StatusFound)
+				return
+			}
+			_, _ = fmt.Fprint(w, r.Header.Get("traceparent"))
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+		defer func() { state.TracePropagator = "" }()
+
+		t.Run("W3C", func(t *testing.T) {
+			hops = nil
+			state.Samples = nil
+			state.TracePropagator = lib.TracingPropagatorW3C
+			state.TraceSampling = 1
+			v, err := common.RunString(rt, `
+			let res = http.get(srvURL + "/redirect");
+			if (res.body != res.request.headers["Traceparent"]) { throw new Error("wrong header: " + res.body); }
+			res.body;
+			`)
+			if !assert.NoError(t, err) || !assert.Len(t, hops, 2) {
+				return
+			}
+			parts := strings.Split(v.String(), "-")
+			if assert.Len(t, parts, 4) {
+				assert.Equal(t, "01", parts[3])
+				assert.True(t, strings.HasPrefix(hops[0], "00-"+parts[1]+"-"), "trace not shared: %s", hops[0])
+				assert.NotEqual(t, hops[0], hops[1], "span not renewed")
+			}
+			for _, sample := range state.Samples {
+				assert.Equal(t, map[string]string{"trace_id": parts[1]}, sample.Metadata)
+			}
+		})
+		t.Run("Unsampled", func(t *testing.T) {
+			state.Samples = nil
+			state.TracePropagator = lib.TracingPropagatorW3C
+			state.TraceSampling = 0
+			v, err := common.RunString(rt, `http.get(srvURL + "/echo").body;`)
+			if assert.NoError(t, err) {
+				assert.True(t, strings.HasSuffix(v.String(), "-00"), "sampled: %s", v.String())
+			}
+			for _, sample := range state.Samples {
+				assert.Nil(t, sample.Metadata)
+			}
+		})
+		t.Run("B3", func(t *testing.T) {
+			hops = nil
+			state.TracePropagator = lib.TracingPropagatorB3
+			state.TraceSampling = 1
+			v, err := common.RunString(rt, `http.get(srvURL + "/echo").request.headers["X-B3-Traceid"];`)
+			if assert.NoError(t, err) && assert.Len(t, hops, 1) {
+				assert.Len(t, v.String(), 32)
+				assert.Equal(t, v.String(), hops[0])
+			}
+		})
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, "ok")
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		state.Samples = nil
+		state.RateLimiters = []*netext.RateLimiter{netext.NewRateLimiter(20)}
+		defer func() { state.RateLimiters = nil }()
+
+		start := time.Now()
+		_, err := common.RunString(rt, `
+		for (var i = 0; i < 3; i++) { http.get(srvURL); }
+		http.batch([srvURL, srvURL]);
+		`)
+		assert.NoError(t, err)
+		assert.True(t, time.Since(start) >= 200*time.Millisecond, "not rate limited: %s", time.Since(start))
+
+		var waits []float64
+		for _, sample := range state.Samples {
+			switch sample.Metric {
+			case metrics.HTTPReqRateLimited:
+				waits = append(waits, sample.Value)
+			case metrics.HTTPReqDuration:
+				assert.True(t, sample.Value < 40, "wait counted as latency: %v", sample.Value)
+			}
+		}
+		assert.Len(t, waits, 5)
+	})
+
+	t.Run("CompressBody", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body io.Reader = r.Body
+			switch r.Header.Get("Content-Encoding") {
+			case "gzip":
+				gr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				body = gr
+			case "deflate":
+				zr, err := zlib.NewReader(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				body = zr
+			}
+			data, err := ioutil.ReadAll(body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			_, _ = fmt.Fprintf(w, "%s|%d|%s", r.Header.Get("Content-Encoding"), r.ContentLength, data)
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		for _, encoding := range []string{"gzip", "deflate"} {
+			t.Run(encoding, func(t *testing.T) {
+				state.Samples = nil
+				rt.Set("encoding", encoding)
+				_, err := common.RunString(rt, `
+				let body = "";
+				for (let i = 0; i < 100; i++) { body += "compress me "; }
+				let res = http.post(srvURL, body, { compressBody: encoding });
+				let parts = res.body.split("|");
+				if (parts[0] != encoding) { throw new Error("wrong encoding: " + parts[0]); }
+				if (parts[2] != body) { throw new Error("wrong body: " + parts[2]); }
+				if (!(parts[1] > 0 && parts[1] < body.length)) { throw new Error("wrong length: " + parts[1]); }
+				`)
+				assert.NoError(t, err)
+
+				sizes := map[string]float64{}
+				for _, sample := range state.Samples {
+					switch sample.Metric {
+					case metrics.HTTPReqBodySize, metrics.HTTPReqBodyCompressed:
+						sizes[sample.Metric.Name] = sample.Value
+					}
+				}
+				assert.Equal(t, float64(1200), sizes[metrics.HTTPReqBodySize.Name])
+				assert.True(t, sizes[metrics.HTTPReqBodyCompressed.Name] > 0)
+				assert.True(t, sizes[metrics.HTTPReqBodyCompressed.Name] < 1200)
+			})
+		}
+
+		t.Run("Invalid", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.post(srvURL, "x", { compressBody: "br" })`)
+			assert.EqualError(t, err, "GoError: compressBody: unsupported encoding: br")
+		})
+	})
+
+	t.Run("RecordMetrics", func(t *testing.T) {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			_, _ = fmt.Fprint(w, "ok")
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		testdata := map[string]struct {
+			noHTTPMetrics bool
+			src           string
+			samples       bool
+		}{
+			"default":  {false, `http.get(srvURL)`, true},
+			"false":    {false, `http.get(srvURL, { recordMetrics: false })`, false},
+			"batch":    {false, `http.batch([["GET", srvURL, { recordMetrics: false }]])[0]`, false},
+			"disabled": {true, `http.get(srvURL)`, false},
+			"true":     {true, `http.get(srvURL, { recordMetrics: true })`, true},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				state.Samples = nil
+				state.NoHTTPMetrics = data.noHTTPMetrics
+				defer func() { state.NoHTTPMetrics = false }()
+				requests = 0
+
+				_, err := common.RunString(rt, `
+				let res = `+data.src+`;
+				if (res.body != "ok") { throw new Error("wrong body: " + res.body); }
+				if (res.timings.duration <= 0) { throw new Error("no timings"); }
+				`)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, requests)
+				if data.samples {
+					assert.NotEmpty(t, state.Samples)
+				} else {
+					assert.Empty(t, state.Samples)
+				}
+			})
+		}
+	})
+
+	t.Run("Redirects", func(t *testing.T) {
+		// /redirect/n redirects n times before landing on /done.
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/")); err == nil {
+				if n > 1 {
+					http.Redirect(w, r, "/redirect/"+strconv.Itoa(n-1), http.StatusFound)
+				} else {
+					http.Redirect(w, r, "/done", http.StatusMovedPermanently)
+				}
+				return
+			}
+			_, _ = fmt.Fprint(w, "done")
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		v, err := common.RunString(rt, `
+		let res = http.get(srvURL + "/redirect/2");
+		if (res.body != "done") { throw new Error("wrong body: " + res.body); }
+		if (res.url != srvURL + "/done") { throw new Error("wrong url: " + res.url); }
+		res.redirects.map(r => r.url.replace(srvURL, "") + " " + r.status).join(", ");
+		`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "/redirect/2 302, /redirect/1 301", v.String())
+		}
+
+		testdata := map[string]struct {
+			src string
+			err string
+		}{
+			"maxRedirects":          {`http.get(srvURL + "/redirect/2", { maxRedirects: 2 }).status`, ""},
+			"maxRedirects/exceeded": {`http.get(srvURL + "/redirect/3", { maxRedirects: 2 })`, "stopped after 2 redirects"},
+			"maxRedirects/zero":     {`http.get(srvURL + "/redirect/1", { maxRedirects: 0 })`, "stopped after 0 redirects"},
+			"maxRedirects/negative": {`http.get(srvURL + "/redirect/1", { maxRedirects: -1 })`, "maxRedirects: can't be negative"},
+			"followRedirects":       {`http.get(srvURL + "/redirect/2", { followRedirects: true }).status`, ""},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				_, err := common.RunString(rt, data.src)
+				if data.err == "" {
+					assert.NoError(t, err)
+				} else if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), data.err)
+				}
+			})
+		}
+
+		t.Run("followRedirects/false", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.get(srvURL + "/redirect/2", { followRedirects: false });
+			if (res.status != 302) { throw new Error("wrong status: " + res.status); }
+			if (res.headers["Location"] != "/redirect/1") { throw new Error("wrong location: " + res.headers["Location"]); }
+			if (res.redirects.length != 0) { throw new Error("redirects followed: " + res.redirects.length); }
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("Default", func(t *testing.T) {
+			state.MaxRedirects = null.IntFrom(1)
+			defer func() { state.MaxRedirects = null.Int{} }()
+
+			_, err := common.RunString(rt, `http.get(srvURL + "/redirect/1")`)
+			assert.NoError(t, err)
+			_, err = common.RunString(rt, `http.get(srvURL + "/redirect/2")`)
+			assert.EqualError(t, err, "GoError: GET "+srv.URL+"/redirect/2: stopped after 1 redirects")
+		})
+	})
+
+	t.Run("DefaultHeaders", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/redirect" {
+				http.Redirect(w, r, "/echo", http.StatusFound)
+				return
+			}
+			_, _ = fmt.Fprintf(w, "%s|%s", r.Header.Get("User-Agent"), r.Header.Get("X-Default"))
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		state.DefaultHeaders = http.Header{"User-Agent": {"k6-test"}, "X-Default": {"1"}}
+		defer func() { state.DefaultHeaders = nil }()
+
+		testdata := map[string]struct{ src, body, ua string }{
+			"Defaults":  {`http.get(srvURL + "/echo")`, "k6-test|1", "k6-test"},
+			"Redirect":  {`http.get(srvURL + "/redirect")`, "k6-test|1", "k6-test"},
+			"Batch":     {`http.batch([srvURL + "/echo"])[0]`, "k6-test|1", "k6-test"},
+			"Override":  {`http.get(srvURL + "/echo", { headers: { "user-agent": "custom", "x-default": "2" } })`, "custom|2", "custom"},
+			"Null":      {`http.get(srvURL + "/echo", { headers: { "X-Default": null } })`, "k6-test|", "k6-test"},
+			"Undefined": {`http.get(srvURL + "/echo", { headers: { "x-default": undefined } })`, "k6-test|", "k6-test"},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				v, err := common.RunString(rt, `
+				let res = `+data.src+`;
+				[res.body, res.request.headers["`+http.CanonicalHeaderKey("user-agent")+`"]].join("\n");
+				`)
+				if assert.NoError(t, err) {
+					assert.Equal(t, data.body+"\n"+data.ua, v.String())
+				}
+			})
+		}
+
+		t.Run("Unchanged", func(t *testing.T) {
+			assert.Equal(t, http.Header{"User-Agent": {"k6-test"}, "X-Default": {"1"}}, state.DefaultHeaders)
+		})
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			status, _ := strconv.Atoi(r.URL.Path[1:])
+			w.WriteHeader(status)
+			_, _ = fmt.Fprint(w, "body")
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		testdata := map[int]struct {
+			ok   bool
+			text string
+		}{
+			200: {true, "OK"},
+			204: {true, "No Content"},
+			304: {false, "Not Modified"},
+			404: {false, "Not Found"},
+			500: {false, "Internal Server Error"},
+		}
+		for status, data := range testdata {
+			t.Run(strconv.Itoa(status), func(t *testing.T) {
+				v, err := common.RunString(rt, fmt.Sprintf(`
+				let res = http.get(srvURL + "/%d");
+				[res.status, res.ok, res.status_text].join(" ");
+				`, status))
+				if assert.NoError(t, err) {
+					assert.Equal(t, fmt.Sprintf("%d %v %s", status, data.ok, data.text), v.String())
+				}
+
+				_, err = common.RunString(rt, fmt.Sprintf(`http.get(srvURL + "/%d", { throwOnError: true });`, status))
+				if status < 400 {
+					assert.NoError(t, err)
+				} else {
+					assert.EqualError(t, err, fmt.Sprintf("GoError: GET %s/%d: %d %s", srv.URL, status, status, data.text))
+				}
+			})
+		}
+
+		t.Run("Thrown", func(t *testing.T) {
+			v, err := common.RunString(rt, `
+			(function() {
+				try {
+					http.batch([["GET", srvURL + "/503", { throwOnError: true }]]);
+				} catch (e) {
+					return [e.status, e.response.status_text, e.response.body, e.url == srvURL + "/503"].join(" ");
+				}
+			})()`)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "503 Service Unavailable body true", v.String())
+			}
+		})
+	})
+
+	t.Run("Debug", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, "response body")
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		hook := logtest.NewGlobal()
+		defer func() { state.HTTPDebug = "" }()
+		testdata := map[string]struct {
+			mode, params string
+			messages     []string
+		}{
+			"off":         {"", `{}`, nil},
+			"option":      {lib.HTTPDebugHeaders, `{}`, []string{"POST " + srv.URL + " HTTP/1.1", "HTTP/1.1 200 OK"}},
+			"param":       {"", `{ debug: true }`, []string{"request body", "response body"}},
+			"param mode":  {lib.HTTPDebugFull, `{ debug: "headers" }`, []string{"POST " + srv.URL + " HTTP/1.1", "HTTP/1.1 200 OK"}},
+			"param false": {lib.HTTPDebugFull, `{ debug: false }`, nil},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				hook.Reset()
+				state.HTTPDebug = data.mode
+				_, err := common.RunString(rt, `http.post(srvURL, "request body", `+data.params+`);`)
+				assert.NoError(t, err)
+
+				entries := hook.AllEntries()
+				if data.messages == nil {
+					assert.Len(t, entries, 0)
+					return
+				}
+				if assert.Len(t, entries, 2) {
+					for i, msg := range data.messages {
+						assert.Contains(t, entries[i].Message, msg)
+					}
+					for _, entry := range entries {
+						assert.Equal(t, log.Fields{"vu_id": int64(0), "iteration": int64(0)}, entry.Data)
+					}
+				}
+				if data.params == `{ debug: "headers" }` {
+					assert.NotContains(t, entries[0].Message, "request body")
+				}
+			})
+		}
+
+		t.Run("invalid", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.get(srvURL, { debug: "nope" });`)
+			assert.EqualError(t, err, "GoError: invalid debug mode: nope")
+		})
+	})
+	t.Run("Retries", func(t *testing.T) {
+		var hits, failures int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			if hits <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = ioutil.ReadAll(r.Body)
+			_, _ = fmt.Fprint(w, "ok")
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		testdata := map[string]struct {
+			src              string
+			status, attempts int
+		}{
+			"None":         {`http.get(srvURL)`, 503, 1},
+			"Status":       {`http.get(srvURL, { retries: 3, retryBackoff: 1 })`, 503, 1},
+			"ServerErrors": {`http.get(srvURL, { retries: 3, retryBackoff: "1ms", retryServerErrors: true })`, 200, 3},
+			"Exhausted":    {`http.get(srvURL, { retries: 1, retryBackoff: 1, retryServerErrors: true })`, 503, 2},
+			"POST":         {`http.post(srvURL, "body", { retries: 3, retryBackoff: 1, retryServerErrors: true })`, 503, 1},
+			"RetryAll":     {`http.post(srvURL, "body", { retries: 3, retryBackoff: 1, retryServerErrors: true, retryAll: true })`, 200, 3},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				hits = 0
+				failures = 2
+				state.Samples = nil
+				v, err := common.RunString(rt, data.src)
+				if !assert.NoError(t, err) {
+					return
+				}
+				res := v.Export().(*HTTPResponse)
+				assert.Equal(t, data.status, res.Status)
+				assert.Equal(t, data.attempts, res.Attempts)
+				assert.Equal(t, data.attempts, hits)
+
+				var attempts []string
+				for _, sample := range state.Samples {
+					if sample.Metric == metrics.HTTPReqs {
+						attempts = append(attempts, sample.Tags["attempt"])
+					}
+				}
+				assert.Len(t, attempts, data.attempts)
+				if strings.Contains(data.src, "retries") && data.attempts > 1 {
+					assert.Equal(t, strconv.Itoa(data.attempts), attempts[len(attempts)-1])
+				}
+			})
+		}
+
+		t.Run("NetworkError", func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if !assert.NoError(t, err) {
+				return
+			}
+			addr := l.Addr().String()
+			assert.NoError(t, l.Close())
+
+			state.Samples = nil
+			_, err = common.RunString(rt, fmt.Sprintf(`http.get("http://%s/", { retries: 2, retryBackoff: 1 })`, addr))
+			assert.Error(t, err)
+
+			reqs := 0
+			for _, sample := range state.Samples {
+				if sample.Metric == metrics.HTTPReqs {
+					reqs++
+				}
+			}
+			assert.Equal(t, 3, reqs)
+		})
+		t.Run("InvalidBackoff", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.get(srvURL, { retries: 1, retryBackoff: "nope" })`)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "GoError: retryBackoff: time: invalid duration")
+			}
+		})
+	})
+
+	t.Run("MaxResponseBodySize", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, `{"data":"0123456789"}`)
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		defer func() { state.MaxResponseBodySize = 0 }()
+		testdata := map[string]struct {
+			limit     int64
+			params    string
+			body      string
+			truncated bool
+		}{
+			"unlimited": {0, `{}`, `{"data":"0123456789"}`, false},
+			"fits":      {1024, `{}`, `{"data":"0123456789"}`, false},
+			"option":    {10, `{}`, `{"data":"0`, true},
+			"param":     {0, `{ maxResponseBodySize: 5 }`, `{"dat`, true},
+			"param 0":   {10, `{ maxResponseBodySize: 0 }`, `{"data":"0123456789"}`, false},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				state.MaxResponseBodySize = data.limit
+				state.Samples = nil
+				v, err := common.RunString(rt, `http.get(srvURL, `+data.params+`);`)
+				if !assert.NoError(t, err) {
+					return
+				}
+				res := v.Export().(*HTTPResponse)
+				assert.Equal(t, data.body, res.Body)
+				assert.Equal(t, data.truncated, res.BodyTruncated)
+
+				// The discarded remainder is still received.
+				for _, sample := range state.Samples {
+					if sample.Metric == metrics.DataReceived {
+						assert.True(t, sample.Value > float64(len(`{"data":"0123456789"}`)))
+					}
+				}
+			})
+		}
+
+		t.Run("json", func(t *testing.T) {
+			state.MaxResponseBodySize = 5
+			_, err := common.RunString(rt, `
+			let res = http.get(srvURL);
+			if (!res.body_truncated) { throw new Error("body not truncated"); }
+			res.json();
+			`)
+			assert.EqualError(t, err, "GoError: "+ErrBodyTruncated.Error())
+		})
+		t.Run("invalid", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.get(srvURL, { maxResponseBodySize: -1 });`)
+			assert.EqualError(t, err, "GoError: maxResponseBodySize: can't be negative")
+		})
+	})
+	t.Run("Methods", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Method", r.Method)
+			if r.Method == "PROPFIND" || r.Method == "REPORT" {
+				w.WriteHeader(207)
+			}
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		testdata := map[string]struct{ method, sent string }{
+			"uppercase":  {"GET", "GET"},
+			"lowercase":  {"get", "GET"},
+			"mixed":      {"Options", "OPTIONS"},
+			"trace":      {"trace", "TRACE"},
+			"PROPFIND":   {"PROPFIND", "PROPFIND"},
+			"REPORT":     {"REPORT", "REPORT"},
+			"MKCOL":      {"MKCOL", "MKCOL"},
+			"custom":     {"x-Custom_1", "x-Custom_1"},
+			"lowercased": {"propfind", "propfind"},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				state.Samples = nil
+				v, err := common.RunString(rt, fmt.Sprintf(`
+				let res = http.request(%q, srvURL);
+				if (res.request.method != %[2]q) { throw new Error("wrong method: " + res.request.method); }
+				res;
+				`, data.method, data.sent))
+				if !assert.NoError(t, err) {
+					return
+				}
+				res := v.Export().(*HTTPResponse)
+				assert.Equal(t, data.sent, res.Headers["X-Method"])
+				for _, sample := range state.Samples {
+					assert.Equal(t, data.sent, sample.Tags["method"])
+				}
+			})
+		}
+
+		t.Run("WebDAV", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.request("PROPFIND", srvURL, "<propfind/>", { headers: { "Depth": "1" } });
+			if (res.status != 207) { throw new Error("wrong status: " + res.status); }
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("Batch", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = http.batch([["get", srvURL], ["REPORT", srvURL]]);
+			if (res[0].request.method != "GET") { throw new Error("wrong method: " + res[0].request.method); }
+			if (res[1].status != 207) { throw new Error("wrong status: " + res[1].status); }
+			`)
+			assert.NoError(t, err)
+		})
+
+		for _, method := range []string{"", "GE T", "GET\\n", "G\\x00T", "GÉT"} {
+			t.Run("invalid/"+method, func(t *testing.T) {
+				_, err := common.RunString(rt, `http.request("`+method+`", srvURL);`)
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "TypeError: invalid HTTP method")
+				}
+
+				_, err = common.RunString(rt, `http.batch([["`+method+`", srvURL]]);`)
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "TypeError: invalid HTTP method")
+				}
+			})
+		}
+	})
+	t.Run("BatchDependencies", func(t *testing.T) {
+		var mutex sync.Mutex
+		var order []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/html" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			mutex.Lock()
+			order = append(order, r.URL.Path)
+			mutex.Unlock()
+			if r.URL.Path == "/fail" {
+				hj, _ := w.(http.Hijacker)
+				conn, _, _ := hj.Hijack()
+				_ = conn.Close()
+				return
+			}
+			_, _ = fmt.Fprint(w, "ok")
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+
+		t.Run("Waves", func(t *testing.T) {
+			order = nil
+			state.Samples = nil
+			_, err := common.RunString(rt, `
+			let res = http.batch({
+				font: ["GET", srvURL + "/font", { waitFor: "css" }],
+				css: ["GET", srvURL + "/css", { waitFor: "html" }],
+				js: ["POST", srvURL + "/js", null, { waitFor: "html" }],
+				html: ["GET", srvURL + "/html"],
+				other: ["GET", srvURL + "/other"],
+			});
+			for (var key in res) {
+				if (res[key].status != 200) { throw new Error(key + ": wrong status: " + res[key].status); }
+			}
+			`)
+			if !assert.NoError(t, err) || !assert.Len(t, order, 5) {
+				return
+			}
+			assert.Equal(t, "/other", order[0])
+			assert.Equal(t, "/html", order[1])
+			assert.Equal(t, "/font", order[4])
+
+			waves := map[string]string{}
+			for _, sample := range state.Samples {
+				if sample.Metric == metrics.HTTPReqs {
+					waves[sample.Tags["url"][len(srv.URL):]] = sample.Tags["batch_wave"]
+				}
+			}
+			assert.Equal(t, map[string]string{"/html": "0", "/other": "0", "/css": "1", "/js": "1", "/font": "2"}, waves)
+		})
+		t.Run("Untagged", func(t *testing.T) {
+			state.Samples = nil
+			_, err := common.RunString(rt, `http.batch([srvURL + "/a", srvURL + "/b"]);`)
+			assert.NoError(t, err)
+			for _, sample := range state.Samples {
+				_, ok := sample.Tags["batch_wave"]
+				assert.False(t, ok)
+			}
+		})
+		t.Run("Failed", func(t *testing.T) {
+			order = nil
+			_, err := common.RunString(rt, `http.batch({
+				page: ["GET", srvURL + "/fail"],
+				asset: ["GET", srvURL + "/asset", { waitFor: "page" }],
+			});`)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "GET "+srv.URL+"/fail")
+			}
+			assert.Equal(t, []string{"/fail"}, order)
+		})
+
+		testdata := map[string]string{
+			`{ a: ["GET", srvURL, { waitFor: "b" }], b: ["GET", srvURL, { waitFor: "a" }] }`: "GoError: batch: dependency cycle: a -> b -> a",
+			`{ a: ["GET", srvURL, { waitFor: "a" }] }`:                                       "GoError: batch: dependency cycle: a -> a",
+			`{ a: ["GET", srvURL, { waitFor: "nope" }] }`:                                    "GoError: batch: a waits for unknown request: nope",
+		}
+		for src, msg := range testdata {
+			t.Run(src, func(t *testing.T) {
+				order = nil
+				_, err := common.RunString(rt, `http.batch(`+src+`);`)
+				assert.EqualError(t, err, msg)
+				assert.Len(t, order, 0)
+			})
+		}
+	})
+	t.Run("Auth", func(t *testing.T) {
+		// Accepts basic auth and MD5 Digest auth (qop=auth) for "user" with the password "pass".
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := func(parts ...string) string {
+				sum := md5.Sum([]byte(strings.Join(parts, ":")))
+				return hex.EncodeToString(sum[:])
+			}
+			if r.URL.Path == "/digest" {
+				header := r.Header.Get("Authorization")
+				params := map[string]string{}
+				for _, part := range strings.Split(strings.TrimPrefix(header, "Digest "), ", ") {
+					if kv := strings.SplitN(part, "=", 2); len(kv) == 2 {
+						params[kv[0]] = strings.Trim(kv[1], `"`)
+					}
+				}
+				expected := h(h("user", "test", "pass"), "abc123", params["nc"], params["cnonce"], "auth", h(r.Method, r.URL.RequestURI()))
+				if params["response"] != expected {
+					w.Header().Set("WWW-Authenticate", `Digest realm="test", nonce="abc123", qop="auth"`)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+			} else if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = fmt.Fprint(w, "ok")
+		}))
+		defer srv.Close()
+		rt.Set("srvURL", srv.URL)
+		rt.Set("credsURL", strings.Replace(srv.URL, "://", "://user:pass@", 1))
+
+		testdata := map[string]struct {
+			src    string
+			status int
+		}{
+			"basic":               {`http.get(srvURL, { auth: "basic", username: "user", password: "pass" })`, 200},
+			"basic/implied":       {`http.get(srvURL, { username: "user", password: "pass" })`, 200},
+			"basic/url":           {`http.get(credsURL, { auth: "basic" })`, 200},
+			"basic/wrong":         {`http.get(credsURL, { password: "wrong" })`, 401},
+			"digest":              {`http.get(srvURL + "/digest?a=b", { auth: "digest", username: "user", password: "pass" })`, 200},
+			"digest/url":          {`http.post(credsURL + "/digest", "body", { auth: "digest" })`, 200},
+			"digest/wrong":        {`http.get(srvURL + "/digest", { auth: "digest", username: "user", password: "wrong" })`, 401},
+			"digest/unchallenged": {`http.get(srvURL, { auth: "digest", username: "user", password: "pass" })`, 401},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				v, err := common.RunString(rt, `(`+data.src+`).status`)
+				if assert.NoError(t, err) {
+					assert.Equal(t, int64(data.status), v.ToInteger())
+				}
+			})
+		}
+
+		t.Run("unknown", func(t *testing.T) {
+			_, err := common.RunString(rt, `http.get("https://httpbin.org/get", { auth: "nope" })`)
+			assert.EqualError(t, err, "GoError: unknown auth type: nope")
+		})
+		t.Run("ntlm/noConnectionReuse", func(t *testing.T) {
+			state.NoConnectionReuse = true
+			defer func() { state.NoConnectionReuse = false }()
+			_, err := common.RunString(rt, `http.get(srvURL, { auth: "ntlm", username: "user", password: "pass" })`)
+			assert.EqualError(t, err, "GoError: "+netext.ErrNTLMNoKeepAlive.Error())
+		})
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, "ok")
+		}))
+		srv.StartTLS()
+		defer srv.Close()
+
+		// Staple a (self-signed) OCSP response to the server's certificate.
+		cert := &srv.TLS.Certificates[0]
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if !assert.NoError(t, err) {
+			return
+		}
+		now := time.Now()
+		staple, err := ocsp.CreateResponse(leaf, leaf, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: leaf.SerialNumber,
+			ThisUpdate:   now,
+			NextUpdate:   now.Add(1 * time.Hour),
+		}, cert.PrivateKey.(crypto.Signer))
+		if !assert.NoError(t, err) {
+			return
+		}
+		cert.OCSPStaple = staple
+
+		oldTransport := state.HTTPTransport
+		defer func() { state.HTTPTransport = oldTransport }()
+		state.HTTPTransport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		rt.Set("srvURL", srv.URL)
+
+		for _, name := range []string{"first", "reused"} {
+			t.Run(name, func(t *testing.T) {
+				_, err := common.RunString(rt, `
+				let res = http.get(srvURL);
+				if (!res.tls) { throw new Error("no tls details"); }
+				if (res.tls.version.indexOf("tls1.") != 0) { throw new Error("wrong version: " + res.tls.version); }
+				if (res.tls.cipher_suite.indexOf("TLS_") != 0) { throw new Error("wrong cipher suite: " + res.tls.cipher_suite); }
+				if (res.tls.certificate.sans.indexOf("127.0.0.1") == -1) { throw new Error("wrong SANs: " + res.tls.certificate.sans); }
+				if (new Date(res.tls.certificate.not_after) < new Date()) { throw new Error("certificate expired"); }
+				if (res.tls.ocsp.status != "good") { throw new Error("wrong ocsp status: " + res.tls.ocsp.status); }
+				if (res.tls.ocsp.next_update <= res.tls.ocsp.this_update) { throw new Error("wrong ocsp update times"); }
+				`)
+				assert.NoError(t, err)
+			})
+		}
+
+		t.Run("plaintext", func(t *testing.T) {
+			state.HTTPTransport = oldTransport
+			_, err := common.RunString(rt, `
+			let res = http.get("http://httpbin.org/get");
+			if (res.tls !== null) { throw new Error("tls details for plaintext response"); }
+			`)
+			assert.NoError(t, err)
+		})
+	})
 
 	t.Run("Params", func(t *testing.T) {
 		for _, literal := range []string{`undefined`, `null`} {
@@ -0,0 +1,133 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"golang.org/x/crypto/ocsp"
+)
+
+// TLS details of a response. Times are in milliseconds since the epoch, so they can be passed
+// straight to new Date() in scripts.
+type HTTPResponseTLS struct {
+	Version     string
+	CipherSuite string
+	Resumed     bool
+	Certificate *HTTPResponseTLSCertificate
+	OCSP        *HTTPResponseOCSP
+}
+
+type HTTPResponseTLSCertificate struct {
+	Subject   string
+	Issuer    string
+	SANs      []string `js:"sans"`
+	NotBefore int64
+	NotAfter  int64
+}
+
+// A stapled OCSP response; Status is one of "good", "revoked" or "unknown".
+type HTTPResponseOCSP struct {
+	Status     string
+	ProducedAt int64
+	ThisUpdate int64
+	NextUpdate int64
+	RevokedAt  int64
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func tlsVersionName(v uint16) string {
+	if name, ok := lib.TLSVersionNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+func tlsCipherSuiteName(id uint16) string {
+	if name, ok := lib.TLSCipherSuiteNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", id)
+}
+
+// Summarises a connection's TLS state; returns nil for plaintext connections. Go hands every
+// response on a connection its state, so this works just the same for reused connections.
+func newHTTPResponseTLS(state *tls.ConnectionState) *HTTPResponseTLS {
+	if state == nil {
+		return nil
+	}
+
+	t := &HTTPResponseTLS{
+		Version:     tlsVersionName(state.Version),
+		CipherSuite: tlsCipherSuiteName(state.CipherSuite),
+		Resumed:     state.DidResume,
+	}
+
+	var issuer *x509.Certificate
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		sans := append([]string{}, cert.DNSNames...)
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		t.Certificate = &HTTPResponseTLSCertificate{
+			Subject:   cert.Subject.CommonName,
+			Issuer:    cert.Issuer.CommonName,
+			SANs:      sans,
+			NotBefore: millis(cert.NotBefore),
+			NotAfter:  millis(cert.NotAfter),
+		}
+		if len(state.PeerCertificates) > 1 {
+			issuer = state.PeerCertificates[1]
+		}
+	}
+
+	if len(state.OCSPResponse) > 0 {
+		if res, err := ocsp.ParseResponse(state.OCSPResponse, issuer); err == nil {
+			status := "unknown"
+			switch res.Status {
+			case ocsp.Good:
+				status = "good"
+			case ocsp.Revoked:
+				status = "revoked"
+			}
+			t.OCSP = &HTTPResponseOCSP{
+				Status:     status,
+				ProducedAt: millis(res.ProducedAt),
+				ThisUpdate: millis(res.ThisUpdate),
+				NextUpdate: millis(res.NextUpdate),
+				RevokedAt:  millis(res.RevokedAt),
+			}
+		}
+	}
+
+	return t
+}
@@ -22,6 +22,9 @@ package k6
 
 import (
 	"context"
+	"math"
+	"math/rand"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -29,17 +32,92 @@ import (
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 )
 
-type K6 struct{}
+type K6 struct {
+	// The script API version; see common.APIVersion.
+	APIVersion int `js:"apiVersion"`
+}
+
+func init() {
+	common.RegisterFeature("k6.sleep.distributions", "k6.weightedRandom")
+}
+
+// Returns whether this version of k6 has a feature, eg. "http.batch.dag"; scripts can use this to
+// fail fast with a clear message, rather than on an undefined function later.
+func (*K6) HasFeature(name string) bool {
+	return common.HasFeature(name)
+}
+
+// Sleeps for a number of seconds, or for a think time sampled from a distribution, using the VU's
+// seeded RNG: {dist: "exponential", mean}, {dist: "normal", mean, stddev} or
+// {dist: "uniform", min, max}. Sampled times are clamped to be non-negative.
+func (*K6) Sleep(ctx context.Context, v goja.Value) error {
+	secs := v.ToFloat()
+	if _, ok := v.Export().(map[string]interface{}); ok {
+		rnd := rand.Float64
+		if state := common.GetState(ctx); state != nil {
+			rnd = state.Rand
+		}
+		s, err := sampleDistribution(rnd, v.ToObject(common.GetRuntime(ctx)))
+		if err != nil {
+			return err
+		}
+		secs = s
+	}
 
-func (*K6) Sleep(ctx context.Context, secs float64) {
+	startTime := time.Now()
 	timer := time.NewTimer(time.Duration(secs * float64(time.Second)))
 	select {
 	case <-timer.C:
 	case <-ctx.Done():
 		timer.Stop()
 	}
+	if state := common.GetState(ctx); state != nil {
+		state.Slept += time.Since(startTime)
+	}
+	return nil
+}
+
+// Samples a distribution described by an object given to sleep().
+func sampleDistribution(rnd func() float64, obj *goja.Object) (float64, error) {
+	param := func(name string) float64 {
+		v := obj.Get(name)
+		if v == nil || goja.IsUndefined(v) {
+			return 0
+		}
+		return v.ToFloat()
+	}
+
+	var v float64
+	switch dist := obj.Get("dist"); {
+	case dist == nil || goja.IsUndefined(dist):
+		return 0, errors.New("sleep: no distribution given")
+	case dist.String() == "exponential":
+		mean := param("mean")
+		if mean < 0 {
+			return 0, errors.New("sleep: mean can't be negative")
+		}
+		v = -mean * math.Log(1-rnd())
+	case dist.String() == "normal":
+		stddev := param("stddev")
+		if stddev < 0 {
+			return 0, errors.New("sleep: stddev can't be negative")
+		}
+		// Box-Muller; 1-rnd() is in (0, 1], so the logarithm is finite.
+		z := math.Sqrt(-2*math.Log(1-rnd())) * math.Cos(2*math.Pi*rnd())
+		v = param("mean") + z*stddev
+	case dist.String() == "uniform":
+		min, max := param("min"), param("max")
+		if max < min {
+			return 0, errors.New("sleep: max can't be less than min")
+		}
+		v = min + rnd()*(max-min)
+	default:
+		return 0, errors.Errorf("sleep: unknown distribution: %s", dist.String())
+	}
+	return math.Max(v, 0), nil
 }
 
 func (*K6) Group(ctx context.Context, name string, fn goja.Callable) (goja.Value, error) {
@@ -113,3 +191,49 @@ func (*K6) Check(ctx context.Context, arg0, checks goja.Value, extras ...goja.Va
 
 	return succ, nil
 }
+
+// Picks a value out of a list of [weight, value] pairs, with a probability proportional to its
+// weight, using the VU's seeded RNG. Weights don't have to add up to 1.
+func (*K6) WeightedRandom(ctx context.Context, choices goja.Value) (goja.Value, error) {
+	state := common.GetState(ctx)
+	rt := common.GetRuntime(ctx)
+
+	if goja.IsUndefined(choices) || goja.IsNull(choices) {
+		return goja.Undefined(), errors.New("weightedRandom: no choices given")
+	}
+
+	obj := choices.ToObject(rt)
+	n := obj.Get("length").ToInteger()
+	weights := make([]float64, 0, n)
+	values := make([]goja.Value, 0, n)
+	total := 0.0
+	for i := int64(0); i < n; i++ {
+		pair := obj.Get(strconv.FormatInt(i, 10)).ToObject(rt)
+		weight := pair.Get("0").ToFloat()
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return goja.Undefined(), errors.Errorf("weightedRandom: invalid weight for choice %d", i)
+		}
+		weights = append(weights, weight)
+		values = append(values, pair.Get("1"))
+		total += weight
+	}
+	if total <= 0 {
+		return goja.Undefined(), errors.New("weightedRandom: weights must add up to more than zero")
+	}
+
+	r := state.Rand() * total
+	for i, weight := range weights {
+		if r < weight {
+			return values[i], nil
+		}
+		r -= weight
+	}
+
+	// Floating point rounding may leave us just past the end; the last nonzero choice wins.
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return values[i], nil
+		}
+	}
+	return goja.Undefined(), nil
+}
@@ -23,6 +23,7 @@ package k6
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"runtime"
 	"testing"
 	"time"
@@ -74,6 +75,71 @@ func TestSleep(t *testing.T) {
 	})
 }
 
+func TestSleepDistribution(t *testing.T) {
+	rt := goja.New()
+	r := rand.New(rand.NewSource(1))
+	state := &common.State{Rand: r.Float64}
+	ctx := common.WithRuntime(common.WithState(context.Background(), state), rt)
+	rt.Set("k6", common.Bind(rt, &K6{}, &ctx))
+
+	t.Run("Sleep", func(t *testing.T) {
+		startTime := time.Now()
+		_, err := common.RunString(rt, `k6.sleep({ dist: "uniform", min: 0.2, max: 0.3 })`)
+		assert.NoError(t, err)
+		d := time.Since(startTime)
+		assert.True(t, d >= 200*time.Millisecond, "did not sleep long enough")
+		assert.True(t, d < time.Second, "slept for too long")
+	})
+
+	testdata := map[string]struct {
+		src       string
+		mean, min float64
+	}{
+		"exponential":  {`({ dist: "exponential", mean: 2 })`, 2, 0},
+		"normal":       {`({ dist: "normal", mean: 3, stddev: 1 })`, 3, 0},
+		"normal,clamp": {`({ dist: "normal", mean: 0, stddev: 1 })`, 0.4, 0},
+		"uniform":      {`({ dist: "uniform", min: 1, max: 2 })`, 1.5, 1},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			v, err := common.RunString(rt, data.src)
+			if !assert.NoError(t, err) {
+				return
+			}
+			obj := v.ToObject(rt)
+
+			sum := 0.0
+			n := 100000
+			for i := 0; i < n; i++ {
+				s, err := sampleDistribution(r.Float64, obj)
+				if !assert.NoError(t, err) {
+					return
+				}
+				if s < data.min {
+					assert.Fail(t, "sample out of range", "%v < %v", s, data.min)
+					return
+				}
+				sum += s
+			}
+			assert.InDelta(t, data.mean, sum/float64(n), 0.05)
+		})
+	}
+
+	errdata := map[string]string{
+		`{}`:                                "sleep: no distribution given",
+		`{ dist: "nope" }`:                  "sleep: unknown distribution: nope",
+		`{ dist: "exponential", mean: -1 }`: "sleep: mean can't be negative",
+		`{ dist: "normal", mean: 1, stddev: -1 }`: "sleep: stddev can't be negative",
+		`{ dist: "uniform", min: 2, max: 1 }`:     "sleep: max can't be less than min",
+	}
+	for src, msg := range errdata {
+		t.Run(src, func(t *testing.T) {
+			_, err := common.RunString(rt, `k6.sleep(`+src+`)`)
+			assert.EqualError(t, err, "GoError: "+msg)
+		})
+	}
+}
+
 func TestGroup(t *testing.T) {
 	root, err := lib.NewGroup("", nil)
 	assert.NoError(t, err)
@@ -240,3 +306,86 @@ func TestCheck(t *testing.T) {
 		}
 	})
 }
+
+func TestWeightedRandom(t *testing.T) {
+	rt := goja.New()
+	var r float64
+	state := &common.State{Rand: func() float64 { return r }}
+
+	ctx := context.Background()
+	ctx = common.WithState(ctx, state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("k6", common.Bind(rt, &K6{}, &ctx))
+
+	src := `k6.weightedRandom([[7, "browse"], [2, "search"], [0, "never"], [1, "checkout"]])`
+	testdata := map[float64]string{
+		0.0:   "browse",
+		0.69:  "browse",
+		0.75:  "search",
+		0.89:  "search",
+		0.95:  "checkout",
+		0.999: "checkout",
+	}
+	for rv, expected := range testdata {
+		t.Run(fmt.Sprintf("%v", rv), func(t *testing.T) {
+			r = rv
+			v, err := common.RunString(rt, src)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, v.Export())
+			}
+		})
+	}
+
+	t.Run("Distribution", func(t *testing.T) {
+		state.Rand = common.NewRandSource()
+		counts := map[string]int{}
+		for i := 0; i < 10000; i++ {
+			v, err := common.RunString(rt, `k6.weightedRandom([[3, "a"], [1, "b"]])`)
+			if !assert.NoError(t, err) {
+				return
+			}
+			counts[v.String()]++
+		}
+		assert.InDelta(t, 7500, counts["a"], 300)
+		assert.InDelta(t, 2500, counts["b"], 300)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		testdata := map[string]string{
+			"none":      "GoError: weightedRandom: no choices given",
+			"[]":        "GoError: weightedRandom: weights must add up to more than zero",
+			"[[0, 1]]":  "GoError: weightedRandom: weights must add up to more than zero",
+			"[[-1, 1]]": "GoError: weightedRandom: invalid weight for choice 0",
+		}
+		for arg, msg := range testdata {
+			t.Run(arg, func(t *testing.T) {
+				if arg == "none" {
+					arg = ""
+				}
+				_, err := common.RunString(rt, "k6.weightedRandom("+arg+")")
+				assert.EqualError(t, err, msg)
+			})
+		}
+	})
+}
+
+func TestFeatures(t *testing.T) {
+	rt := goja.New()
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("k6", common.Bind(rt, &K6{APIVersion: common.APIVersion}, &ctx))
+
+	testdata := map[string]interface{}{
+		`k6.apiVersion`:                           int64(common.APIVersion),
+		`k6.hasFeature("k6.weightedRandom")`:      true,
+		`k6.hasFeature("k6.sleep.distributions")`: true,
+		`k6.hasFeature("nope")`:                   false,
+	}
+	for src, expected := range testdata {
+		t.Run(src, func(t *testing.T) {
+			v, err := common.RunString(rt, src)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, v.Export())
+			}
+		})
+	}
+}
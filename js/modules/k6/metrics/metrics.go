@@ -27,6 +27,7 @@ import (
 
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -44,8 +45,12 @@ func newMetric(ctxPtr *context.Context, name string, t stats.MetricType, isTime
 		valueType = stats.Time
 	}
 
+	m := stats.New(name, t, valueType)
+	if reg := common.GetMetricRegistry(*ctxPtr); reg != nil {
+		reg.Metrics = append(reg.Metrics, m)
+	}
 	rt := common.GetRuntime(*ctxPtr)
-	return common.Bind(rt, Metric{stats.New(name, t, valueType)}, ctxPtr), nil
+	return common.Bind(rt, Metric{m}, ctxPtr), nil
 }
 
 func (m Metric) Add(ctx context.Context, v goja.Value, addTags ...map[string]string) {
@@ -72,6 +77,24 @@ func (m Metric) Add(ctx context.Context, v goja.Value, addTags ...map[string]str
 
 type Metrics struct{}
 
+func init() {
+	common.RegisterFeature("metrics", "metrics.reset")
+}
+
+// Marks a boundary, eg. the end of a warmup phase: everything aggregated so far is discarded, so
+// only later samples count towards the end-of-test summary and thresholds. Samples are still sent
+// to outputs as usual. It affects all VUs, so it should only be called once, by a single VU.
+func (*Metrics) Reset(ctx context.Context) error {
+	state := common.GetState(ctx)
+	if state == nil {
+		return errors.New("Metrics can't be reset in the init context")
+	}
+	state.Samples = append(state.Samples,
+		stats.Sample{Time: time.Now(), Metric: metrics.MetricsReset, Value: 1},
+	)
+	return nil
+}
+
 func (*Metrics) XCounter(ctx *context.Context, name string, isTime ...bool) (interface{}, error) {
 	return newMetric(ctx, name, stats.Counter, isTime)
 }
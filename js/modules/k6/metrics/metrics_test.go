@@ -28,6 +28,7 @@ import (
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
 	"github.com/stretchr/testify/assert"
 )
@@ -129,3 +130,20 @@ func TestMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestReset(t *testing.T) {
+	rt := goja.New()
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("metrics", common.Bind(rt, &Metrics{}, &ctx))
+
+	_, err := common.RunString(rt, `metrics.reset()`)
+	assert.EqualError(t, err, "GoError: Metrics can't be reset in the init context")
+
+	state := &common.State{}
+	ctx = common.WithState(ctx, state)
+	_, err = common.RunString(rt, `metrics.reset()`)
+	assert.NoError(t, err)
+	if assert.Len(t, state.Samples, 1) {
+		assert.Equal(t, metrics.MetricsReset, state.Samples[0].Metric)
+	}
+}
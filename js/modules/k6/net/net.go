@@ -0,0 +1,287 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package net
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// How long a call may take in total, unless overridden with timeoutMs.
+const DefaultTimeout = 10 * time.Second
+
+// Responses are cut off past this size; this is for banners and pings, not bulk transfers.
+const MaxResponseSize = 1 << 20
+
+// Just enough raw TCP and UDP to check that ports are reachable and to grab banners; anything
+// resembling a protocol is up to the script.
+type Net struct{}
+
+func init() {
+	common.RegisterFeature("net.tcp", "net.udp")
+}
+
+// The outcome of an exchange. If anything went wrong, Error says what, and whatever was received
+// up to that point is still reported. Response is the data received as a string, Bytes the same
+// data as an array of byte values, for protocols that aren't text.
+type Result struct {
+	ConnectTime float64
+	Response    string
+	Bytes       []byte
+	Error       string
+}
+
+type dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Connects to a TCP port and hangs up straight away. Returns the connect time in milliseconds, or
+// a Result holding an error if the port couldn't be reached.
+func (*Net) TcpConnect(ctx context.Context, host string, port int, timeoutMs ...float64) (interface{}, error) {
+	state := common.GetState(ctx)
+	if state == nil {
+		return nil, errors.New("net: connections can't be made in the init context")
+	}
+
+	timeout := DefaultTimeout
+	if len(timeoutMs) > 0 && timeoutMs[0] > 0 {
+		timeout = time.Duration(timeoutMs[0] * float64(time.Millisecond))
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res := &Result{}
+	conn, err := dial(ctx, state, "tcp", host, port, res)
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil
+	}
+	_ = conn.Close()
+	return res.ConnectTime, nil
+}
+
+// Connects to a TCP port, sends a payload (a string or an array of byte values; may be empty) and
+// reads a response. Without the readUntil param, the first chunk of data received is returned;
+// with it, data is read until that string turns up. The timeoutMs param limits the whole exchange.
+func (*Net) TcpSendRecv(ctx context.Context, host string, port int, payload goja.Value, params ...goja.Value) (*Result, error) {
+	state := common.GetState(ctx)
+	if state == nil {
+		return nil, errors.New("net: connections can't be made in the init context")
+	}
+	p, err := parseParams(common.GetRuntime(ctx), params)
+	if err != nil {
+		return nil, err
+	}
+	data, err := toBytes(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return exchange(ctx, state, "tcp", host, port, data, func(conn net.Conn) ([]byte, error) {
+		return readUntil(conn, p.readUntil)
+	}), nil
+}
+
+// Sends a payload in a single datagram and waits for a single datagram in return. Only the
+// timeoutMs param applies.
+func (*Net) UdpSendRecv(ctx context.Context, host string, port int, payload goja.Value, params ...goja.Value) (*Result, error) {
+	state := common.GetState(ctx)
+	if state == nil {
+		return nil, errors.New("net: connections can't be made in the init context")
+	}
+	p, err := parseParams(common.GetRuntime(ctx), params)
+	if err != nil {
+		return nil, err
+	}
+	data, err := toBytes(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return exchange(ctx, state, "udp", host, port, data, func(conn net.Conn) ([]byte, error) {
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		return buf[:n], err
+	}), nil
+}
+
+type exchangeParams struct {
+	readUntil []byte
+	timeout   time.Duration
+}
+
+func parseParams(rt *goja.Runtime, params []goja.Value) (exchangeParams, error) {
+	p := exchangeParams{timeout: DefaultTimeout}
+	if len(params) == 0 || goja.IsUndefined(params[0]) || goja.IsNull(params[0]) {
+		return p, nil
+	}
+	obj := params[0].ToObject(rt)
+	for _, k := range obj.Keys() {
+		switch k {
+		case "readUntil":
+			delim, err := toBytes(obj.Get(k))
+			if err != nil {
+				return p, errors.Wrap(err, "readUntil")
+			}
+			if len(delim) > 0 {
+				p.readUntil = delim
+			}
+		case "timeoutMs":
+			if ms := obj.Get(k).ToFloat(); ms > 0 {
+				p.timeout = time.Duration(ms * float64(time.Millisecond))
+			}
+		}
+	}
+	return p, nil
+}
+
+// Payloads are either strings, sent as UTF-8, or arrays of byte values, eg. a previous Result's
+// Bytes.
+func toBytes(v goja.Value) ([]byte, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, nil
+	}
+	if s, ok := v.Export().(string); ok {
+		return []byte(s), nil
+	}
+	b, ok, err := common.ToByteArray(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "net")
+	}
+	if !ok {
+		return nil, errors.New("net: payload must be a string or an array of byte values")
+	}
+	return b, nil
+}
+
+// Connects, sends the payload and reads a response with read. Network errors end up in the result.
+func exchange(ctx context.Context, state *common.State, proto, host string, port int, data []byte, read func(net.Conn) ([]byte, error)) *Result {
+	res := &Result{}
+	conn, err := dial(ctx, state, proto, host, port, res)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer func() { _ = conn.Close() }()
+
+	// The deadline makes for nicer errors, closing the connection on cancellation makes sure an
+	// aborted iteration doesn't hang around.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	tags := sampleTags(state, proto, host, port)
+	var received []byte
+	sent, err := conn.Write(data)
+	if err == nil {
+		received, err = read(conn)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	res.Response = string(received)
+	res.Bytes = received
+
+	now := time.Now()
+	state.Samples = append(state.Samples,
+		stats.Sample{Metric: metrics.DataSent, Time: now, Tags: tags, Value: float64(sent)},
+		stats.Sample{Metric: metrics.DataReceived, Time: now, Tags: tags, Value: float64(len(received))},
+	)
+	return res
+}
+
+// Connects, recording the connect time in both the result and a sample.
+func dial(ctx context.Context, state *common.State, proto, host string, port int, res *Result) (net.Conn, error) {
+	var d dialer = &net.Dialer{}
+	if state.Dialer != nil {
+		d = state.Dialer
+	}
+
+	startTime := time.Now()
+	conn, err := d.DialContext(ctx, proto, net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	endTime := time.Now()
+
+	res.ConnectTime = stats.D(endTime.Sub(startTime))
+	state.Samples = append(state.Samples, stats.Sample{
+		Metric: metrics.NetConnectTime,
+		Time:   endTime,
+		Tags:   sampleTags(state, proto, host, port),
+		Value:  res.ConnectTime,
+	})
+	return conn, nil
+}
+
+func sampleTags(state *common.State, proto, host string, port int) map[string]string {
+	return map[string]string{
+		"host":  net.JoinHostPort(host, strconv.Itoa(port)),
+		"proto": proto,
+		"group": state.Group.Path,
+	}
+}
+
+// Reads until delim is seen, or just the first chunk if delim is nil.
+func readUntil(r io.Reader, delim []byte) ([]byte, error) {
+	var buf []byte
+	chunk := make([]byte, 4096)
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if delim == nil && n > 0 {
+			return buf, nil
+		}
+		if delim != nil && bytes.Contains(buf, delim) {
+			return buf, nil
+		}
+		if len(buf) >= MaxResponseSize {
+			return buf, errors.New("net: response too large")
+		}
+		if err == io.EOF {
+			if delim == nil {
+				return buf, nil
+			}
+			return buf, errors.Errorf("net: connection closed before %q was received", delim)
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package net
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// Greets every connection with a banner, then echoes lines back with a "+" prepended.
+func startTCPServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _ = conn.Write([]byte("220 hello\r\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					_, _ = conn.Write(append([]byte("+"), line...))
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func startUDPServer(t *testing.T) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(buf[:n], addr)
+		}
+	}()
+	return pc
+}
+
+func TestNet(t *testing.T) {
+	l := startTCPServer(t)
+	defer func() { _ = l.Close() }()
+	pc := startUDPServer(t)
+	defer func() { _ = pc.Close() }()
+
+	root, err := lib.NewGroup("", nil)
+	assert.NoError(t, err)
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("net", common.Bind(rt, &Net{}, &ctx))
+	rt.Set("tcpPort", l.Addr().(*net.TCPAddr).Port)
+	rt.Set("udpPort", pc.LocalAddr().(*net.UDPAddr).Port)
+
+	t.Run("InitContext", func(t *testing.T) {
+		_, err := common.RunString(rt, `net.tcpConnect("127.0.0.1", tcpPort);`)
+		assert.EqualError(t, err, "GoError: net: connections can't be made in the init context")
+	})
+
+	state := &common.State{Group: root}
+	ctx = common.WithState(ctx, state)
+
+	t.Run("TcpConnect", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let t = net.tcpConnect("127.0.0.1", tcpPort, 1000);
+		if (typeof t !== "number" || t < 0) { throw new Error("wrong connect time: " + JSON.stringify(t)); }
+		`)
+		assert.NoError(t, err)
+		if assert.Len(t, state.Samples, 1) {
+			s := state.Samples[0]
+			assert.Equal(t, metrics.NetConnectTime, s.Metric)
+			assert.Equal(t, "127.0.0.1:"+strconv.Itoa(l.Addr().(*net.TCPAddr).Port), s.Tags["host"])
+			assert.Equal(t, "tcp", s.Tags["proto"])
+		}
+
+		t.Run("Refused", func(t *testing.T) {
+			closed, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			rt.Set("closedPort", closed.Addr().(*net.TCPAddr).Port)
+			_ = closed.Close()
+
+			_, err = common.RunString(rt, `
+			let res = net.tcpConnect("127.0.0.1", closedPort);
+			if (!res.error) { throw new Error("no error: " + JSON.stringify(res)); }
+			`)
+			assert.NoError(t, err)
+		})
+	})
+	t.Run("TcpSendRecv", func(t *testing.T) {
+		t.Run("Banner", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = net.tcpSendRecv("127.0.0.1", tcpPort, "", { readUntil: "\r\n" });
+			if (res.error) { throw new Error("unexpected error: " + res.error); }
+			if (res.response != "220 hello\r\n") { throw new Error("wrong response: " + res.response); }
+			if (res.connect_time < 0) { throw new Error("wrong connect time: " + res.connect_time); }
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("Exchange", func(t *testing.T) {
+			state.Samples = nil
+			_, err := common.RunString(rt, `
+			let res = net.tcpSendRecv("127.0.0.1", tcpPort, "PING\r\n", { readUntil: "+PING\r\n", timeoutMs: 1000 });
+			if (res.error) { throw new Error("unexpected error: " + res.error); }
+			if (res.response != "220 hello\r\n+PING\r\n") { throw new Error("wrong response: " + res.response); }
+			`)
+			assert.NoError(t, err)
+
+			seen := map[string]float64{}
+			for _, s := range state.Samples {
+				seen[s.Metric.Name] += s.Value
+			}
+			assert.Contains(t, seen, metrics.NetConnectTime.Name)
+			assert.Equal(t, float64(6), seen[metrics.DataSent.Name])
+			assert.Equal(t, float64(18), seen[metrics.DataReceived.Name])
+		})
+		t.Run("Binary", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = net.tcpSendRecv("127.0.0.1", tcpPort, [0, 255, 10], { readUntil: [0, 255, 10] });
+			if (res.error) { throw new Error("unexpected error: " + res.error); }
+			let tail = [];
+			for (let i = res.bytes.length - 4; i < res.bytes.length; i++) { tail.push(res.bytes[i]); }
+			if (tail.join(",") != "43,0,255,10") { throw new Error("wrong bytes: " + tail.join(",")); }
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("Timeout", func(t *testing.T) {
+			_, err := common.RunString(rt, `
+			let res = net.tcpSendRecv("127.0.0.1", tcpPort, "", { readUntil: "nope", timeoutMs: 100 });
+			if (!res.error) { throw new Error("no error"); }
+			if (res.response != "220 hello\r\n") { throw new Error("wrong partial response: " + res.response); }
+			`)
+			assert.NoError(t, err)
+		})
+		t.Run("InvalidPayload", func(t *testing.T) {
+			_, err := common.RunString(rt, `net.tcpSendRecv("127.0.0.1", tcpPort, [256]);`)
+			assert.EqualError(t, err, "GoError: net: invalid byte at index 0: 256")
+		})
+	})
+	t.Run("UdpSendRecv", func(t *testing.T) {
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let res = net.udpSendRecv("127.0.0.1", udpPort, "ping", { timeoutMs: 1000 });
+		if (res.error) { throw new Error("unexpected error: " + res.error); }
+		if (res.response != "ping") { throw new Error("wrong response: " + res.response); }
+		`)
+		assert.NoError(t, err)
+		for _, s := range state.Samples {
+			assert.Equal(t, "udp", s.Tags["proto"])
+		}
+	})
+}
@@ -0,0 +1,102 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sse
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Event is a single event received from a stream.
+type Event struct {
+	ID   string `js:"id"`
+	Type string `js:"event"`
+	Data string `js:"data"`
+}
+
+// An eventReader parses a text/event-stream, as specified by the HTML standard:
+// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+type eventReader struct {
+	r *bufio.Reader
+
+	// The last event ID seen, which carries over to subsequent events, and the reconnection delay
+	// requested by the server, if any.
+	lastID string
+	retry  time.Duration
+}
+
+func newEventReader(r io.Reader, lastID string) *eventReader {
+	return &eventReader{r: bufio.NewReader(r), lastID: lastID}
+}
+
+// Returns the next event, or io.EOF if the stream ends; a trailing incomplete event is discarded.
+func (er *eventReader) Next() (Event, error) {
+	var typ string
+	var data []string
+	hasData := false
+	for {
+		line, err := er.r.ReadString('\n')
+		if err != nil {
+			return Event{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// A blank line dispatches the event, if it has any data.
+		if line == "" {
+			if !hasData {
+				typ = ""
+				continue
+			}
+			if typ == "" {
+				typ = "message"
+			}
+			return Event{ID: er.lastID, Type: typ, Data: strings.Join(data, "\n")}, nil
+		}
+
+		// Lines starting with a colon are comments.
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			typ = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				er.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 64); err == nil {
+				er.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
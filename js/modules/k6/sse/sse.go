@@ -0,0 +1,309 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sse
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// Default delay before reconnecting to a stream, unless the server asks for something else.
+const DefaultRetry = 3 * time.Second
+
+type SSE struct{}
+
+func init() {
+	common.RegisterFeature("sse")
+}
+
+// A Stream is handed to the setup function passed to connect(), which uses it to listen for
+// events, and to close the stream.
+type Stream struct {
+	rt       *goja.Runtime
+	handlers map[string][]goja.Callable
+	cancel   context.CancelFunc
+}
+
+// Registers a handler for "event", "error" or "close".
+func (s *Stream) On(event string, handler goja.Value) {
+	fn, ok := goja.AssertFunction(handler)
+	if !ok {
+		common.Throw(s.rt, errors.New("handler must be a function"))
+	}
+	s.handlers[event] = append(s.handlers[event], fn)
+}
+
+// Closes the stream; no further events will be dispatched, and connect() will return.
+func (s *Stream) Close() {
+	s.cancel()
+}
+
+func (s *Stream) dispatch(event string, arg interface{}) error {
+	for _, fn := range s.handlers[event] {
+		if _, err := fn(goja.Undefined(), s.rt.ToValue(arg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// An SSEResponse summarizes a stream, once it's closed.
+type SSEResponse struct {
+	URL    string
+	Status int
+	Events int
+}
+
+// Connects to an event stream, and dispatches its events until it's closed, either by the server,
+// by the script, or when the maxDuration param is reached. Handlers are called on the VU's own
+// goroutine. With the reconnect param, the stream is resumed after connection failures, passing
+// the last seen event ID along in a Last-Event-ID header.
+func (*SSE) Connect(ctx context.Context, url string, args ...goja.Value) (*SSEResponse, error) {
+	rt := common.GetRuntime(ctx)
+	state := common.GetState(ctx)
+	if state == nil {
+		return nil, errors.New("sse: streams can't be opened in the init context")
+	}
+
+	// The setup function comes last; params are optional.
+	if len(args) == 0 {
+		return nil, errors.New("sse: no setup function given")
+	}
+	setupFn, ok := goja.AssertFunction(args[len(args)-1])
+	if !ok {
+		return nil, errors.New("sse: setup function must be a function")
+	}
+
+	header := make(http.Header)
+	tags := map[string]string{
+		"url":   url,
+		"group": state.Group.Path,
+	}
+	var maxDuration time.Duration
+	reconnect := false
+	if len(args) > 1 {
+		paramsV := args[0]
+		if !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+			params := paramsV.ToObject(rt)
+			for _, k := range params.Keys() {
+				switch k {
+				case "headers":
+					headersV := params.Get(k)
+					if goja.IsUndefined(headersV) || goja.IsNull(headersV) {
+						continue
+					}
+					headers := headersV.ToObject(rt)
+					for _, key := range headers.Keys() {
+						header.Set(key, headers.Get(key).String())
+					}
+				case "tags":
+					tagsV := params.Get(k)
+					if goja.IsUndefined(tagsV) || goja.IsNull(tagsV) {
+						continue
+					}
+					tagObj := tagsV.ToObject(rt)
+					for _, key := range tagObj.Keys() {
+						tags[key] = tagObj.Get(key).String()
+					}
+				case "maxDuration":
+					d, err := common.ToDuration(params.Get(k))
+					if err != nil {
+						return nil, errors.Wrap(err, "maxDuration")
+					}
+					maxDuration = d
+				case "reconnect":
+					reconnect = params.Get(k).ToBoolean()
+				}
+			}
+		}
+	}
+	header.Set("Accept", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+
+	var streamCtx context.Context
+	var cancel context.CancelFunc
+	if maxDuration > 0 {
+		streamCtx, cancel = context.WithTimeout(ctx, maxDuration)
+	} else {
+		streamCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	stream := &Stream{rt: rt, handlers: make(map[string][]goja.Callable), cancel: cancel}
+	if _, err := setupFn(goja.Undefined(), rt.ToValue(stream)); err != nil {
+		return nil, err
+	}
+
+	client := http.Client{Transport: state.HTTPTransport, Jar: state.CookieJar}
+	resp := &SSEResponse{URL: url}
+	startTime := time.Now()
+	var firstEventTime time.Time
+	lastID := ""
+	retry := DefaultRetry
+	for {
+		reader, err := openStream(streamCtx, client, url, header, lastID)
+		if reader != nil {
+			resp.Status = reader.status
+		}
+		if err != nil && streamCtx.Err() == nil {
+			if err := stream.dispatch("error", err.Error()); err != nil {
+				return nil, err
+			}
+		}
+
+		if err == nil {
+			for ev := range reader.events {
+				resp.Events++
+				if firstEventTime.IsZero() {
+					firstEventTime = time.Now()
+				}
+				if err := stream.dispatch("event", ev); err != nil {
+					cancel()
+					reader.drain()
+					return nil, err
+				}
+			}
+			reader.drain()
+			lastID = reader.lastID
+			if reader.retry > 0 {
+				retry = reader.retry
+			}
+			if reader.err != nil && streamCtx.Err() == nil {
+				if err := stream.dispatch("error", reader.err.Error()); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		// Only dropped connections are resumed; the server can refuse with a non-200 response.
+		if !reconnect || streamCtx.Err() != nil || (err != nil && reader != nil) {
+			break
+		}
+		timer := time.NewTimer(retry)
+		select {
+		case <-timer.C:
+		case <-streamCtx.Done():
+			timer.Stop()
+		}
+	}
+	endTime := time.Now()
+
+	if err := stream.dispatch("close", goja.Undefined()); err != nil {
+		return nil, err
+	}
+
+	tags["status"] = strconv.Itoa(resp.Status)
+	state.Samples = append(state.Samples,
+		stats.Sample{Metric: metrics.SSEStreams, Time: endTime, Tags: tags, Value: 1},
+		stats.Sample{Metric: metrics.SSEEvents, Time: endTime, Tags: tags, Value: float64(resp.Events)},
+		stats.Sample{Metric: metrics.SSEStreamDuration, Time: endTime, Tags: tags, Value: stats.D(endTime.Sub(startTime))},
+	)
+	if !firstEventTime.IsZero() {
+		state.Samples = append(state.Samples,
+			stats.Sample{Metric: metrics.SSETimeToFirstEvent, Time: endTime, Tags: tags, Value: stats.D(firstEventTime.Sub(startTime))},
+		)
+	}
+
+	return resp, nil
+}
+
+// A streamReader reads events off a connection in the background, and hands them over through the
+// events channel, which is closed once the connection is.
+type streamReader struct {
+	status int
+	body   io.ReadCloser
+	events chan Event
+
+	// Only safe to read once events is closed.
+	lastID string
+	retry  time.Duration
+	err    error
+}
+
+// Opens a connection to an event stream. If the server responds, but not with an event stream, a
+// non-nil reader is returned along with the error, to tell refusals from connection failures.
+func openStream(ctx context.Context, client http.Client, url string, header http.Header, lastID string) (*streamReader, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return &streamReader{status: res.StatusCode}, errors.Errorf("sse: unexpected status: %d", res.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		_ = res.Body.Close()
+		return &streamReader{status: res.StatusCode}, errors.Errorf("sse: unexpected content type: %s", mediaType)
+	}
+
+	r := &streamReader{status: res.StatusCode, body: res.Body, events: make(chan Event)}
+	go func() {
+		defer close(r.events)
+		er := newEventReader(res.Body, lastID)
+		defer func() { r.lastID, r.retry = er.lastID, er.retry }()
+		for {
+			ev, err := er.Next()
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					r.err = err
+				}
+				return
+			}
+			select {
+			case r.events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return r, nil
+}
+
+// Closes the connection, and waits for the background reader to finish.
+func (r *streamReader) drain() {
+	if r.body == nil {
+		return
+	}
+	_ = r.body.Close()
+	for range r.events {
+	}
+}
@@ -0,0 +1,194 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sse
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventReader(t *testing.T) {
+	src := ": a comment\r\n" +
+		"data: first\n" +
+		"\n" +
+		"event: update\n" +
+		"id: 2\n" +
+		"data: multi\n" +
+		"data:line\n" +
+		"\n" +
+		"retry: 1500\n" +
+		"id\n" +
+		"\n" +
+		"data\n" +
+		"\n" +
+		"data: incomplete\n"
+	er := newEventReader(strings.NewReader(src), "1")
+
+	events := []Event{}
+	for {
+		ev, err := er.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		events = append(events, ev)
+	}
+	assert.Equal(t, []Event{
+		{ID: "1", Type: "message", Data: "first"},
+		{ID: "2", Type: "update", Data: "multi\nline"},
+		{ID: "", Type: "message", Data: ""},
+	}, events)
+	assert.Equal(t, 1500*time.Millisecond, er.retry)
+}
+
+func TestConnect(t *testing.T) {
+	var lastIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events":
+			lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+			w.Header().Set("Content-Type", "text/event-stream")
+			if len(lastIDs) == 1 {
+				_, _ = fmt.Fprint(w, "retry: 10\nid: 1\ndata: a\n\nid: 2\nevent: b\ndata: b\n\n")
+			} else {
+				_, _ = fmt.Fprint(w, "id: 3\ndata: c\n\n")
+			}
+		case "/forever":
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; ; i++ {
+				if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+					return
+				}
+				w.(http.Flusher).Flush()
+				select {
+				case <-time.After(10 * time.Millisecond):
+				case <-r.Context().Done():
+					return
+				}
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	root, err := lib.NewGroup("", nil)
+	assert.NoError(t, err)
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	state := &common.State{Group: root, HTTPTransport: http.DefaultTransport}
+	ctx := common.WithState(context.Background(), state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("sse", common.Bind(rt, &SSE{}, &ctx))
+	rt.Set("srvURL", srv.URL)
+
+	t.Run("Events", func(t *testing.T) {
+		lastIDs = nil
+		state.Samples = nil
+		_, err := common.RunString(rt, `
+		let events = [];
+		let closed = false;
+		let res = sse.connect(srvURL + "/events", function(stream) {
+			stream.on("event", function(e) { events.push(e.id + ":" + e.event + ":" + e.data); });
+			stream.on("close", function() { closed = true; });
+		});
+		if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+		if (res.events != 2) { throw new Error("wrong number of events: " + res.events); }
+		if (events.join(",") != "1:message:a,2:b:b") { throw new Error("wrong events: " + events.join(",")); }
+		if (!closed) { throw new Error("close not dispatched"); }
+		`)
+		assert.NoError(t, err)
+
+		seen := map[*stats.Metric]float64{}
+		for _, s := range state.Samples {
+			seen[s.Metric] = s.Value
+			assert.Equal(t, srv.URL+"/events", s.Tags["url"])
+			assert.Equal(t, "200", s.Tags["status"])
+		}
+		assert.Equal(t, float64(1), seen[metrics.SSEStreams])
+		assert.Equal(t, float64(2), seen[metrics.SSEEvents])
+		assert.Contains(t, seen, metrics.SSETimeToFirstEvent)
+		assert.Contains(t, seen, metrics.SSEStreamDuration)
+	})
+	t.Run("Reconnect", func(t *testing.T) {
+		lastIDs = nil
+		_, err := common.RunString(rt, `
+		let data = [];
+		sse.connect(srvURL + "/events", { reconnect: true, maxDuration: "500ms" }, function(stream) {
+			stream.on("event", function(e) {
+				data.push(e.data);
+				if (e.id == "3") { stream.close(); }
+			});
+		});
+		if (data.join(",") != "a,b,c") { throw new Error("wrong data: " + data.join(",")); }
+		`)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"", "2"}, lastIDs)
+	})
+	t.Run("MaxDuration", func(t *testing.T) {
+		startTime := time.Now()
+		_, err := common.RunString(rt, `
+		let res = sse.connect(srvURL + "/forever", { maxDuration: 100 }, function(stream) {});
+		if (res.events < 1) { throw new Error("no events"); }
+		`)
+		assert.NoError(t, err)
+		assert.True(t, time.Since(startTime) < 1*time.Second, "stream wasn't closed in time")
+	})
+	t.Run("Close", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		let res = sse.connect(srvURL + "/forever", function(stream) {
+			stream.on("event", function(e) { if (e.data == "2") { stream.close(); } });
+		});
+		if (res.events != 3) { throw new Error("wrong number of events: " + res.events); }
+		`)
+		assert.NoError(t, err)
+	})
+	t.Run("Error", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		let errors = [];
+		let res = sse.connect(srvURL + "/nonexistent", { reconnect: true }, function(stream) {
+			stream.on("error", function(e) { errors.push(e); });
+		});
+		if (res.status != 404) { throw new Error("wrong status: " + res.status); }
+		if (errors.join(",") != "sse: unexpected status: 404") { throw new Error("wrong errors: " + errors.join(",")); }
+		`)
+		assert.NoError(t, err)
+	})
+	t.Run("NoSetupFunction", func(t *testing.T) {
+		_, err := common.RunString(rt, `sse.connect(srvURL + "/events")`)
+		assert.EqualError(t, err, "GoError: sse: no setup function given")
+	})
+}
@@ -0,0 +1,89 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// Store gives scripts access to the VU's key/value store, which persists across iterations.
+type Store struct{}
+
+func init() {
+	common.RegisterFeature("store")
+}
+
+func (*Store) Get(ctx context.Context, key string) (goja.Value, error) {
+	state := common.GetState(ctx)
+	if state == nil || state.Store == nil {
+		return nil, errors.New("store: not available in the init context")
+	}
+
+	data, ok := state.Store.Get(key)
+	if !ok {
+		return goja.Undefined(), nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return nil, err
+	}
+	return common.GetRuntime(ctx).ToValue(v), nil
+}
+
+func (*Store) Set(ctx context.Context, key string, value goja.Value) error {
+	state := common.GetState(ctx)
+	if state == nil || state.Store == nil {
+		return errors.New("store: not available in the init context")
+	}
+
+	if goja.IsUndefined(value) {
+		state.Store.Delete(key)
+		return nil
+	}
+	data, err := json.Marshal(value.Export())
+	if err != nil {
+		return errors.Wrapf(err, "store: can't serialize value for %s", key)
+	}
+	return state.Store.Set(key, string(data))
+}
+
+func (*Store) Delete(ctx context.Context, key string) error {
+	state := common.GetState(ctx)
+	if state == nil || state.Store == nil {
+		return errors.New("store: not available in the init context")
+	}
+	state.Store.Delete(key)
+	return nil
+}
+
+func (*Store) Clear(ctx context.Context) error {
+	state := common.GetState(ctx)
+	if state == nil || state.Store == nil {
+		return errors.New("store: not available in the init context")
+	}
+	state.Store.Clear()
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// Sync gives scripts counters and latches shared by all VUs; see common.Coordinator.
+type Sync struct{}
+
+func init() {
+	common.RegisterFeature("sync")
+}
+
+// Adds to a counter, by 1 unless another delta is given, and returns its new value; eg.
+// sync.add("users") - 1 gives every call a unique index, counting from 0.
+func (*Sync) Add(ctx context.Context, name string, delta ...int64) (int64, error) {
+	c, err := coordinator(ctx)
+	if err != nil {
+		return 0, err
+	}
+	d := int64(1)
+	if len(delta) > 0 {
+		d = delta[0]
+	}
+	return c.Add(name, d), nil
+}
+
+// Returns a counter's value.
+func (*Sync) Get(ctx context.Context, name string) (int64, error) {
+	c, err := coordinator(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.Counter(name), nil
+}
+
+// Counts down a latch, which is released once it's been counted down count times.
+func (*Sync) CountDown(ctx context.Context, name string, count int64) error {
+	c, err := coordinator(ctx)
+	if err != nil {
+		return err
+	}
+	l, err := c.Latch(name, count)
+	if err != nil {
+		return err
+	}
+	l.CountDown()
+	return nil
+}
+
+// Waits for a latch to be released, giving up after timeout seconds if given; returns whether it
+// was. Eg. with 10 VUs, sync.countDown("login", 10) after logging in, followed by
+// sync.wait("login", 10), has every VU log in before any goes on.
+func (*Sync) Wait(ctx context.Context, name string, count int64, timeout ...float64) (bool, error) {
+	c, err := coordinator(ctx)
+	if err != nil {
+		return false, err
+	}
+	l, err := c.Latch(name, count)
+	if err != nil {
+		return false, err
+	}
+	if len(timeout) > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout[0]*float64(time.Second)))
+		defer cancel()
+	}
+	return l.Wait(ctx) == nil, nil
+}
+
+func coordinator(ctx context.Context) (*common.Coordinator, error) {
+	state := common.GetState(ctx)
+	if state == nil || state.Coordinator == nil {
+		return nil, errors.New("sync: not available in the init context")
+	}
+	return state.Coordinator, nil
+}
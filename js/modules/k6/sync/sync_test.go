@@ -0,0 +1,79 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSync(t *testing.T) {
+	c := common.NewCoordinator()
+	newRuntime := func() *goja.Runtime {
+		rt := goja.New()
+		state := &common.State{Coordinator: c}
+		ctx := common.WithRuntime(common.WithState(context.Background(), state), rt)
+		rt.Set("sync", common.Bind(rt, &Sync{}, &ctx))
+		return rt
+	}
+	rt1, rt2 := newRuntime(), newRuntime()
+
+	t.Run("Counter", func(t *testing.T) {
+		v, err := common.RunString(rt1, `sync.add("users")`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(1), v.Export())
+		}
+		v, err = common.RunString(rt2, `sync.add("users", 10)`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(11), v.Export())
+		}
+		v, err = common.RunString(rt1, `sync.get("users")`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(11), v.Export())
+		}
+	})
+	t.Run("Latch", func(t *testing.T) {
+		v, err := common.RunString(rt1, `sync.countDown("login", 2); sync.wait("login", 2, 0.01)`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, false, v.Export())
+		}
+		v, err = common.RunString(rt2, `sync.countDown("login", 2); sync.wait("login", 2)`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, true, v.Export())
+		}
+
+		t.Run("Wrong Count", func(t *testing.T) {
+			_, err := common.RunString(rt1, `sync.wait("login", 5)`)
+			assert.EqualError(t, err, "GoError: latch login was made with a count of 2, not 5")
+		})
+	})
+	t.Run("Init Context", func(t *testing.T) {
+		rt := goja.New()
+		ctx := common.WithRuntime(context.Background(), rt)
+		rt.Set("sync", common.Bind(rt, &Sync{}, &ctx))
+		_, err := common.RunString(rt, `sync.add("users")`)
+		assert.EqualError(t, err, "GoError: sync: not available in the init context")
+	})
+}
@@ -0,0 +1,101 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package time
+
+import (
+	"time"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// Reference point for Mono(); times since it are measured with the monotonic clock.
+var monoStart = time.Now()
+
+// Time helpers that work in UTC, unless a zone (eg. "Europe/Stockholm") is explicitly given.
+// Timestamps are milliseconds since the epoch, like Date.now().
+type Time struct{}
+
+func init() {
+	common.RegisterFeature("time")
+}
+
+// Returns the current time, in milliseconds since the epoch.
+func (*Time) Now() int64 {
+	return toMillis(time.Now())
+}
+
+// Returns the current time as an RFC3339 timestamp in UTC, optionally offset by some seconds.
+func (*Time) Iso(offset ...float64) string {
+	t := time.Now().UTC()
+	if len(offset) > 0 {
+		t = t.Add(time.Duration(offset[0] * float64(time.Second)))
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Formats a timestamp using a Go layout string, eg. "2006-01-02 15:04:05".
+func (*Time) Format(ms int64, layout string, zone ...string) (string, error) {
+	loc, err := location(zone)
+	if err != nil {
+		return "", err
+	}
+	return fromMillis(ms).In(loc).Format(layout), nil
+}
+
+// Parses a time using a Go layout string; times without a zone of their own are taken to be in
+// UTC, or the given zone.
+func (*Time) Parse(value, layout string, zone ...string) (int64, error) {
+	loc, err := location(zone)
+	if err != nil {
+		return 0, err
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return 0, err
+	}
+	return toMillis(t), nil
+}
+
+// Returns milliseconds since an arbitrary point in time, from a monotonic clock; useful for
+// measuring durations, which mustn't be thrown off by changes to the wall clock.
+func (*Time) Mono() float64 {
+	return float64(time.Since(monoStart)) / float64(time.Millisecond)
+}
+
+func location(zone []string) (*time.Location, error) {
+	if len(zone) == 0 || zone[0] == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(zone[0])
+	if err != nil {
+		return nil, errors.Errorf("unknown time zone: %s", zone[0])
+	}
+	return loc, nil
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
@@ -0,0 +1,134 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package time
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRuntime() *goja.Runtime {
+	rt := goja.New()
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("time", common.Bind(rt, &Time{}, &ctx))
+	return rt
+}
+
+func TestTime(t *testing.T) {
+	rt := newRuntime()
+
+	t.Run("Now", func(t *testing.T) {
+		before := time.Now().UnixNano() / int64(time.Millisecond)
+		v, err := common.RunString(rt, `time.now()`)
+		after := time.Now().UnixNano() / int64(time.Millisecond)
+		if assert.NoError(t, err) {
+			assert.True(t, v.ToInteger() >= before && v.ToInteger() <= after)
+		}
+	})
+	t.Run("Iso", func(t *testing.T) {
+		v, err := common.RunString(rt, `time.iso()`)
+		if assert.NoError(t, err) {
+			ts, err := time.Parse(time.RFC3339, v.String())
+			assert.NoError(t, err)
+			assert.Equal(t, time.UTC, ts.Location())
+			assert.InDelta(t, 0, time.Since(ts).Seconds(), 2)
+		}
+
+		t.Run("offset", func(t *testing.T) {
+			v, err := common.RunString(rt, `time.iso(-3600)`)
+			if assert.NoError(t, err) {
+				ts, err := time.Parse(time.RFC3339, v.String())
+				assert.NoError(t, err)
+				assert.InDelta(t, 3600, time.Since(ts).Seconds(), 2)
+			}
+		})
+	})
+	t.Run("Format", func(t *testing.T) {
+		testdata := map[string]string{
+			`time.format(0, "2006-01-02T15:04:05Z07:00")`:                           "1970-01-01T00:00:00Z",
+			`time.format(1489057200000, "2006-01-02 15:04 MST")`:                    "2017-03-09 11:00 UTC",
+			`time.format(1489057200000, "15:04 MST", "America/New_York")`:           "06:00 EST",
+			`time.format(1489303800000, "15:04 MST", "America/New_York")`:           "03:30 EDT",
+			`time.format(1489303800000 - 3600000, "15:04 MST", "America/New_York")`: "01:30 EST",
+		}
+		for src, expected := range testdata {
+			t.Run(src, func(t *testing.T) {
+				v, err := common.RunString(rt, src)
+				if assert.NoError(t, err) {
+					assert.Equal(t, expected, v.String())
+				}
+			})
+		}
+	})
+	t.Run("Parse", func(t *testing.T) {
+		testdata := map[string]int64{
+			`time.parse("1970-01-01T00:00:00Z", "2006-01-02T15:04:05Z07:00")`:          0,
+			`time.parse("2017-03-09 11:00", "2006-01-02 15:04")`:                       1489057200000,
+			`time.parse("2017-03-09 06:00", "2006-01-02 15:04", "America/New_York")`:   1489057200000,
+			`time.parse("2017-03-12 03:30", "2006-01-02 15:04", "America/New_York")`:   1489303800000,
+			`time.parse("2017-03-09T11:00:00.250+01:00", "2006-01-02T15:04:05Z07:00")`: 1489053600250,
+		}
+		for src, expected := range testdata {
+			t.Run(src, func(t *testing.T) {
+				v, err := common.RunString(rt, src)
+				if assert.NoError(t, err) {
+					assert.Equal(t, expected, v.ToInteger())
+				}
+			})
+		}
+
+		t.Run("invalid", func(t *testing.T) {
+			_, err := common.RunString(rt, `time.parse("nope", "2006-01-02")`)
+			assert.Error(t, err)
+		})
+	})
+	t.Run("Zone", func(t *testing.T) {
+		_, err := common.RunString(rt, `time.format(0, "15:04", "Nowhere/Nope")`)
+		assert.EqualError(t, err, "GoError: unknown time zone: Nowhere/Nope")
+	})
+	t.Run("Mono", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		let start = time.mono();
+		let end = time.mono();
+		if (!(end >= start)) { throw new Error("clock went backwards: " + start + " -> " + end); }
+		`)
+		assert.NoError(t, err)
+	})
+}
+
+func BenchmarkIso(b *testing.B) {
+	rt := newRuntime()
+	b.Run("time.iso", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = common.RunString(rt, `time.iso(30)`)
+		}
+	})
+	b.Run("Date", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = common.RunString(rt, `new Date(Date.now() + 30000).toISOString().replace(/\.\d+Z$/, "Z")`)
+		}
+	})
+}
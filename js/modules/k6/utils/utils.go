@@ -0,0 +1,273 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package utils
+
+import (
+	"context"
+	"math/rand"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// Characters random strings are made of, unless another set is given.
+const alphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Longest string or array the helpers will make, so that a typo'd length throws rather than
+// exhausting memory and taking the whole process down with it.
+const maxLength = 1 << 24
+
+// Small helpers for strings, arrays, URLs and form bodies, so scripts don't each carry their own.
+// Anything random uses the VU's seeded RNG, so runs with a fixed seed are reproducible.
+type Utils struct{}
+
+func init() {
+	common.RegisterFeature("utils")
+}
+
+// Returns a random string of a length, made of the given characters, or letters and digits.
+func (*Utils) RandomString(ctx context.Context, n int, charset ...string) (string, error) {
+	chars := []rune(alphanumeric)
+	if len(charset) > 0 {
+		chars = []rune(charset[0])
+	}
+	if len(chars) == 0 {
+		return "", errors.New("charset can't be empty")
+	}
+	if n < 0 || n > maxLength {
+		return "", errors.Errorf("length must be between 0 and %d", maxLength)
+	}
+	rnd := random(ctx)
+	s := make([]rune, n)
+	for i := range s {
+		s[i] = chars[int(rnd()*float64(len(chars)))]
+	}
+	return string(s), nil
+}
+
+// Pads the start of a string to a length, with spaces or the given string.
+func (*Utils) PadStart(s string, n int, pad ...string) (string, error) {
+	p, err := padding(s, n, pad)
+	return p + s, err
+}
+
+// Pads the end of a string to a length, with spaces or the given string.
+func (*Utils) PadEnd(s string, n int, pad ...string) (string, error) {
+	p, err := padding(s, n, pad)
+	return s + p, err
+}
+
+// Returns a random item from an array, or undefined if it's empty.
+func (*Utils) RandomItem(ctx context.Context, items []goja.Value) goja.Value {
+	if len(items) == 0 {
+		return goja.Undefined()
+	}
+	return items[int(random(ctx)()*float64(len(items)))]
+}
+
+// Returns a shuffled copy of an array.
+func (*Utils) Shuffle(ctx context.Context, items []goja.Value) []goja.Value {
+	rnd := random(ctx)
+	shuffled := make([]goja.Value, len(items))
+	copy(shuffled, items)
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := int(rnd() * float64(i+1))
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return shuffled
+}
+
+// Splits an array into chunks of a size; the last one holds whatever is left over.
+func (*Utils) Chunk(items []goja.Value, size int) ([][]goja.Value, error) {
+	if size <= 0 {
+		return nil, errors.New("chunk size must be positive")
+	}
+	chunks := make([][]goja.Value, 0, (len(items)+size-1)/size)
+	for len(items) > size {
+		chunks = append(chunks, items[:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		chunks = append(chunks, items)
+	}
+	return chunks, nil
+}
+
+// Returns an array without duplicates, keeping the first of each; objects and arrays are
+// compared by their contents.
+func (*Utils) Uniq(items []goja.Value) []goja.Value {
+	uniq := make([]goja.Value, 0, len(items))
+	seen := make(map[interface{}]bool, len(items))
+	var seenObjs []interface{}
+	for _, item := range items {
+		v := item.Export()
+		if v != nil && !reflect.TypeOf(v).Comparable() {
+			dup := false
+			for _, obj := range seenObjs {
+				if reflect.DeepEqual(obj, v) {
+					dup = true
+					break
+				}
+			}
+			if dup {
+				continue
+			}
+			seenObjs = append(seenObjs, v)
+		} else {
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+		}
+		uniq = append(uniq, item)
+	}
+	return uniq
+}
+
+// Returns the numbers from start up to, but not including, end, counting by step (default 1).
+func (*Utils) Range(start, end int64, step ...int64) ([]int64, error) {
+	by := int64(1)
+	if start > end {
+		by = -1
+	}
+	if len(step) > 0 {
+		by = step[0]
+	}
+	if by == 0 {
+		return nil, errors.New("step can't be 0")
+	}
+
+	// Counted up front, in unsigned arithmetic, so that neither the count nor the numbers can
+	// overflow near the ends of the int64 range.
+	dist, stride := uint64(0), uint64(1)
+	switch {
+	case by > 0 && end > start:
+		dist, stride = uint64(end)-uint64(start), uint64(by)
+	case by < 0 && end < start:
+		dist, stride = uint64(start)-uint64(end), -uint64(by)
+	}
+	count := dist / stride
+	if dist%stride != 0 {
+		count++
+	}
+	if count > maxLength {
+		return nil, errors.Errorf("ranges can't be longer than %d", maxLength)
+	}
+	nums := make([]int64, count)
+	for i := range nums {
+		nums[i] = start + int64(i)*by
+	}
+	return nums, nil
+}
+
+// Adds query parameters to a URL, keeping any it already has; array values give a parameter
+// several times, eg. utils.buildURL("http://example.com/?a=1", { b: [2, 3] }).
+func (*Utils) BuildURL(ctx context.Context, base string, params ...map[string]goja.Value) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	if len(params) > 0 {
+		query := u.Query()
+		for k, vs := range toValues(common.GetRuntime(ctx), params[0]) {
+			query[k] = append(query[k], vs...)
+		}
+		u.RawQuery = encodeQuery(query)
+	}
+	return u.String(), nil
+}
+
+// Encodes an object as a query string, without the leading "?"; spaces become "%20".
+func (*Utils) EncodeQuery(ctx context.Context, params map[string]goja.Value) string {
+	return encodeQuery(toValues(common.GetRuntime(ctx), params))
+}
+
+// Parses a query string, with or without the leading "?"; parameters given several times are
+// returned as arrays.
+func (*Utils) ParseQuery(s string) (map[string]interface{}, error) {
+	values, err := url.ParseQuery(strings.TrimPrefix(s, "?"))
+	if err != nil {
+		return nil, err
+	}
+	params := make(map[string]interface{}, len(values))
+	for k, vs := range values {
+		if len(vs) == 1 {
+			params[k] = vs[0]
+		} else {
+			params[k] = vs
+		}
+	}
+	return params, nil
+}
+
+// Encodes an object as an application/x-www-form-urlencoded body; spaces become "+".
+func (*Utils) EncodeForm(ctx context.Context, params map[string]goja.Value) string {
+	return toValues(common.GetRuntime(ctx), params).Encode()
+}
+
+func random(ctx context.Context) func() float64 {
+	if state := common.GetState(ctx); state != nil {
+		return state.Rand
+	}
+	return rand.Float64
+}
+
+func padding(s string, n int, pad []string) (string, error) {
+	p := " "
+	if len(pad) > 0 {
+		p = pad[0]
+	}
+	if n > maxLength {
+		return "", errors.Errorf("length must be at most %d", maxLength)
+	}
+	missing := n - len([]rune(s))
+	if missing <= 0 || p == "" {
+		return "", nil
+	}
+	return string([]rune(strings.Repeat(p, missing))[:missing]), nil
+}
+
+func toValues(rt *goja.Runtime, params map[string]goja.Value) url.Values {
+	values := make(url.Values, len(params))
+	for k, v := range params {
+		if goja.IsUndefined(v) || goja.IsNull(v) {
+			continue
+		}
+		if items, ok := v.Export().([]interface{}); ok {
+			for _, item := range items {
+				values.Add(k, rt.ToValue(item).String())
+			}
+			continue
+		}
+		values.Add(k, v.String())
+	}
+	return values
+}
+
+// Like url.Values.Encode(), but with spaces as "%20", which is understood everywhere; "+" only
+// means a space in form bodies. Literal pluses are escaped, so this can't mangle anything.
+func encodeQuery(values url.Values) string {
+	return strings.Replace(values.Encode(), "+", "%20", -1)
+}
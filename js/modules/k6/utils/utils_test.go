@@ -0,0 +1,204 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package utils
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRuntime(seed int64) *goja.Runtime {
+	rt := goja.New()
+	state := &common.State{Rand: rand.New(rand.NewSource(seed)).Float64}
+	ctx := common.WithRuntime(common.WithState(context.Background(), state), rt)
+	rt.Set("utils", common.Bind(rt, &Utils{}, &ctx))
+	return rt
+}
+
+func TestUtils(t *testing.T) {
+	rt := newRuntime(1)
+
+	t.Run("RandomString", func(t *testing.T) {
+		v, err := common.RunString(rt, `utils.randomString(16)`)
+		if assert.NoError(t, err) {
+			assert.Regexp(t, `^[a-zA-Z0-9]{16}$`, v.String())
+		}
+
+		t.Run("charset", func(t *testing.T) {
+			v, err := common.RunString(rt, `utils.randomString(8, "ab")`)
+			if assert.NoError(t, err) {
+				assert.Regexp(t, `^[ab]{8}$`, v.String())
+			}
+		})
+		t.Run("negative length", func(t *testing.T) {
+			_, err := common.RunString(rt, `utils.randomString(-1)`)
+			assert.EqualError(t, err, "GoError: length must be between 0 and 16777216")
+		})
+		t.Run("huge length", func(t *testing.T) {
+			_, err := common.RunString(rt, `utils.randomString(1e12)`)
+			assert.EqualError(t, err, "GoError: length must be between 0 and 16777216")
+		})
+		t.Run("empty charset", func(t *testing.T) {
+			_, err := common.RunString(rt, `utils.randomString(8, "")`)
+			assert.EqualError(t, err, "GoError: charset can't be empty")
+		})
+		t.Run("seeded", func(t *testing.T) {
+			v1, err := common.RunString(newRuntime(42), `utils.randomString(32)`)
+			assert.NoError(t, err)
+			v2, err := common.RunString(newRuntime(42), `utils.randomString(32)`)
+			assert.NoError(t, err)
+			assert.Equal(t, v1.String(), v2.String())
+		})
+	})
+	t.Run("Pad", func(t *testing.T) {
+		testdata := map[string]string{
+			`utils.padStart("7", 3, "0")`:   "007",
+			`utils.padStart("abc", 2)`:      "abc",
+			`utils.padEnd("ab", 4)`:         "ab  ",
+			`utils.padEnd("ab", 7, "xyz")`:  "abxyzxy",
+			`utils.padStart("åäö", 4, "-")`: "-åäö",
+		}
+		for src, expected := range testdata {
+			t.Run(src, func(t *testing.T) {
+				v, err := common.RunString(rt, src)
+				if assert.NoError(t, err) {
+					assert.Equal(t, expected, v.String())
+				}
+			})
+		}
+
+		t.Run("huge length", func(t *testing.T) {
+			_, err := common.RunString(rt, `utils.padStart("", 1e12)`)
+			assert.EqualError(t, err, "GoError: length must be at most 16777216")
+		})
+	})
+	t.Run("RandomItem", func(t *testing.T) {
+		v, err := common.RunString(rt, `utils.randomItem(["a", "b", "c"])`)
+		if assert.NoError(t, err) {
+			assert.Contains(t, []string{"a", "b", "c"}, v.String())
+		}
+
+		t.Run("empty", func(t *testing.T) {
+			v, err := common.RunString(rt, `utils.randomItem([])`)
+			if assert.NoError(t, err) {
+				assert.True(t, goja.IsUndefined(v))
+			}
+		})
+	})
+	t.Run("Shuffle", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		let items = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10];
+		let shuffled = utils.shuffle(items);
+		if (shuffled.length !== 10) { throw new Error("wrong length: " + shuffled.length); }
+		if (items.join() !== "1,2,3,4,5,6,7,8,9,10") { throw new Error("original changed: " + items.join()); }
+		let sorted = [];
+		for (let i = 0; i < shuffled.length; i++) { sorted.push(shuffled[i]); }
+		sorted.sort(function(a, b) { return a - b; });
+		if (sorted.join() !== items.join()) { throw new Error("wrong items: " + sorted.join()); }
+		`)
+		assert.NoError(t, err)
+	})
+	t.Run("Chunk", func(t *testing.T) {
+		v, err := common.RunString(rt, `JSON.stringify(utils.chunk([1, 2, 3, 4, 5], 2))`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "[[1,2],[3,4],[5]]", v.String())
+		}
+
+		t.Run("invalid size", func(t *testing.T) {
+			_, err := common.RunString(rt, `utils.chunk([1, 2], 0)`)
+			assert.EqualError(t, err, "GoError: chunk size must be positive")
+		})
+	})
+	t.Run("Uniq", func(t *testing.T) {
+		v, err := common.RunString(rt, `JSON.stringify(utils.uniq([1, "1", 2, 1, {a: 1}, {a: 1}, [2], [2], "x", "x"]))`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, `[1,"1",2,{"a":1},[2],"x"]`, v.String())
+		}
+	})
+	t.Run("Range", func(t *testing.T) {
+		testdata := map[string]string{
+			`utils.range(0, 4)`:     "[0,1,2,3]",
+			`utils.range(1, 10, 3)`: "[1,4,7]",
+			`utils.range(3, 0)`:     "[3,2,1]",
+			`utils.range(2, 2)`:     "[]",
+			`utils.range(0, 5, -1)`: "[]",
+			`utils.range(5, 0, -2)`: "[5,3,1]",
+		}
+		for src, expected := range testdata {
+			t.Run(src, func(t *testing.T) {
+				v, err := common.RunString(rt, `JSON.stringify(`+src+`)`)
+				if assert.NoError(t, err) {
+					assert.Equal(t, expected, v.String())
+				}
+			})
+		}
+
+		t.Run("zero step", func(t *testing.T) {
+			_, err := common.RunString(rt, `utils.range(0, 4, 0)`)
+			assert.EqualError(t, err, "GoError: step can't be 0")
+		})
+		t.Run("huge", func(t *testing.T) {
+			_, err := common.RunString(rt, `utils.range(0, 1e15)`)
+			assert.EqualError(t, err, "GoError: ranges can't be longer than 16777216")
+		})
+	})
+	t.Run("BuildURL", func(t *testing.T) {
+		v, err := common.RunString(rt, `utils.buildURL("http://example.com/path?a=1", { b: [2, 3], c: "x y", d: null })`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "http://example.com/path?a=1&b=2&b=3&c=x%20y", v.String())
+		}
+
+		t.Run("no params", func(t *testing.T) {
+			v, err := common.RunString(rt, `utils.buildURL("http://example.com/")`)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "http://example.com/", v.String())
+			}
+		})
+	})
+	t.Run("EncodeQuery", func(t *testing.T) {
+		v, err := common.RunString(rt, `utils.encodeQuery({ q: "a b+c", n: 1, tags: ["x", "y"] })`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "n=1&q=a%20b%2Bc&tags=x&tags=y", v.String())
+		}
+	})
+	t.Run("ParseQuery", func(t *testing.T) {
+		v, err := common.RunString(rt, `JSON.stringify(utils.parseQuery("?q=a%20b&tags=x&tags=y"))`)
+		if assert.NoError(t, err) {
+			assert.JSONEq(t, `{"q":"a b","tags":["x","y"]}`, v.String())
+		}
+
+		t.Run("invalid", func(t *testing.T) {
+			_, err := common.RunString(rt, `utils.parseQuery("a=%zz")`)
+			assert.EqualError(t, err, `GoError: invalid URL escape "%zz"`)
+		})
+	})
+	t.Run("EncodeForm", func(t *testing.T) {
+		v, err := common.RunString(rt, `utils.encodeForm({ name: "Jane Doe", ok: true })`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "name=Jane+Doe&ok=true", v.String())
+		}
+	})
+}
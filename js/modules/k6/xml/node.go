@@ -0,0 +1,165 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package xml
+
+import (
+	"bytes"
+	encxml "encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+)
+
+// A Node is an element of a parsed document. The document itself is a node too, with no name, whose
+// only child is the root element; paths starting with "/" are resolved from it.
+type Node struct {
+	// Local name and namespace URI; prefixes are resolved away by the parser.
+	Name  string
+	Space string
+
+	// Attributes, by local name; namespace declarations are kept as "xmlns" and "xmlns:prefix".
+	Attrs map[string]string
+
+	// Child elements, in document order.
+	Children []*Node
+
+	// All the text inside the element, including its descendants'.
+	Text string
+
+	parent *Node
+	rt     *goja.Runtime
+}
+
+// A malformed document; Throw() exposes the line and column to scripts.
+type SyntaxError struct {
+	Line, Column int
+	Msg          string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("xml: line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+func (e *SyntaxError) Properties() map[string]interface{} {
+	return map[string]interface{}{"line": e.Line, "column": e.Column}
+}
+
+// Parses a document, returning its document node.
+func Parse(rt *goja.Runtime, src string) (*Node, error) {
+	doc := &Node{Attrs: map[string]string{}, rt: rt}
+	d := encxml.NewDecoder(strings.NewReader(src))
+	d.Strict = true
+
+	stack := []*Node{doc}
+	var text []*bytes.Buffer
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, syntaxError(src, d.InputOffset(), err)
+		}
+
+		cur := stack[len(stack)-1]
+		switch tok := tok.(type) {
+		case encxml.StartElement:
+			if cur == doc && len(doc.Children) > 0 {
+				return nil, syntaxError(src, d.InputOffset(), fmt.Errorf("more than one root element"))
+			}
+			n := &Node{
+				Name:   tok.Name.Local,
+				Space:  tok.Name.Space,
+				Attrs:  make(map[string]string, len(tok.Attr)),
+				parent: cur,
+				rt:     rt,
+			}
+			for _, attr := range tok.Attr {
+				switch {
+				case attr.Name.Space == "xmlns":
+					n.Attrs["xmlns:"+attr.Name.Local] = attr.Value
+				default:
+					n.Attrs[attr.Name.Local] = attr.Value
+				}
+			}
+			cur.Children = append(cur.Children, n)
+			stack = append(stack, n)
+			text = append(text, &bytes.Buffer{})
+		case encxml.EndElement:
+			n := stack[len(stack)-1]
+			n.Text = text[len(text)-1].String()
+			stack = stack[:len(stack)-1]
+			text = text[:len(text)-1]
+			if len(text) > 0 {
+				text[len(text)-1].WriteString(n.Text)
+			}
+		case encxml.CharData:
+			if len(text) > 0 {
+				text[len(text)-1].Write(tok)
+			}
+		}
+	}
+	if len(doc.Children) == 0 {
+		return nil, &SyntaxError{Line: 1, Column: 1, Msg: "no root element"}
+	}
+	return doc, nil
+}
+
+// Works out where in the source a decoding error happened; encoding/xml only reports lines.
+func syntaxError(src string, offset int64, err error) *SyntaxError {
+	msg := err.Error()
+	if serr, ok := err.(*encxml.SyntaxError); ok {
+		msg = serr.Msg
+	}
+	if offset > int64(len(src)) {
+		offset = int64(len(src))
+	}
+	before := src[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := len(before) - strings.LastIndex(before, "\n")
+	return &SyntaxError{Line: line, Column: column, Msg: msg}
+}
+
+// Returns everything a path matches: nodes, or strings for paths ending in an attribute or text().
+// namespaces optionally maps prefixes used in the path to namespace URIs; without it, prefixes are
+// ignored, and only local names are matched.
+func (n *Node) Find(path string, namespaces ...map[string]string) []interface{} {
+	var ns map[string]string
+	if len(namespaces) > 0 {
+		ns = namespaces[0]
+	}
+	res, err := find(n, path, ns)
+	if err != nil {
+		common.Throw(n.rt, err)
+	}
+	return res
+}
+
+// Like Find(), but returns only the first match, or null if there's none.
+func (n *Node) Get(path string, namespaces ...map[string]string) interface{} {
+	if res := n.Find(path, namespaces...); len(res) > 0 {
+		return res[0]
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package xml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A step in a path, eg. "item[@id='1']"; if descendant is set, it was preceded by "//".
+type step struct {
+	descendant bool
+
+	// The kind of step: "." and ".." for self and parent, "@" for an attribute, "text()" for
+	// text, or "" for an element name test, with prefix and name (which may be "*").
+	kind         string
+	prefix, name string
+
+	preds []predicate
+}
+
+// A predicate, eg. "[2]", "[@id='1']" or "[name='Bob']".
+type predicate struct {
+	pos   int
+	kind  string // "@", "text()" or "" for a child element
+	name  string
+	value *string
+}
+
+func pathError(path, format string, args ...interface{}) error {
+	return fmt.Errorf("xml: invalid path: %q: %s", path, fmt.Sprintf(format, args...))
+}
+
+// Splits a string on sep, ignoring anything inside brackets or quotes.
+func splitPath(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Returns the index of the "]" closing the predicate s starts with, or -1 if it's unterminated.
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func unquote(s string) (string, bool) {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return "", false
+	}
+	return s[1 : len(s)-1], true
+}
+
+// Strips a namespace prefix from an attribute name, since attributes are stored by local name.
+func localName(name string) string {
+	if idx := strings.IndexByte(name, ':'); idx != -1 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+func parsePredicate(path, src string) (predicate, error) {
+	src = strings.TrimSpace(src)
+	if pos, err := strconv.Atoi(src); err == nil {
+		if pos < 1 {
+			return predicate{}, pathError(path, "positions start at 1")
+		}
+		return predicate{pos: pos}, nil
+	}
+
+	var p predicate
+	parts := splitPath(src, '=')
+	switch len(parts) {
+	case 1:
+	case 2:
+		val, ok := unquote(strings.TrimSpace(parts[1]))
+		if !ok {
+			return p, pathError(path, "predicate values must be quoted: %s", src)
+		}
+		p.value = &val
+	default:
+		return p, pathError(path, "unsupported predicate: %s", src)
+	}
+
+	lhs := strings.TrimSpace(parts[0])
+	switch {
+	case lhs == "text()" || lhs == ".":
+		if p.value == nil {
+			return p, pathError(path, "unsupported predicate: %s", src)
+		}
+		p.kind = "text()"
+	case strings.HasPrefix(lhs, "@") && len(lhs) > 1:
+		p.kind = "@"
+		p.name = localName(lhs[1:])
+	case lhs != "" && !strings.ContainsAny(lhs, "@()[]/'\""):
+		p.name = lhs
+	default:
+		return p, pathError(path, "unsupported predicate: %s", src)
+	}
+	return p, nil
+}
+
+func parseStep(path, src string) (step, error) {
+	var s step
+	if idx := strings.IndexByte(src, '['); idx != -1 {
+		preds := src[idx:]
+		for preds != "" {
+			end := closingBracket(preds)
+			if preds[0] != '[' || end == -1 {
+				return s, pathError(path, "unterminated predicate")
+			}
+			p, err := parsePredicate(path, preds[1:end])
+			if err != nil {
+				return s, err
+			}
+			s.preds = append(s.preds, p)
+			preds = preds[end+1:]
+		}
+		src = src[:idx]
+	}
+
+	switch {
+	case src == "." || src == "..":
+		s.kind = src
+	case src == "text()":
+		s.kind = src
+	case strings.HasPrefix(src, "@") && len(src) > 1:
+		s.kind = "@"
+		s.name = localName(src[1:])
+	case src == "" || strings.ContainsAny(src, "@()[]'\"="):
+		return s, pathError(path, "unsupported step: %s", src)
+	default:
+		if idx := strings.IndexByte(src, ':'); idx != -1 {
+			s.prefix, s.name = src[:idx], src[idx+1:]
+		} else {
+			s.name = src
+		}
+	}
+	if s.kind != "" && len(s.preds) > 0 {
+		return s, pathError(path, "predicates are only supported on elements")
+	}
+	return s, nil
+}
+
+func parsePath(path string) (absolute bool, steps []step, err error) {
+	src := strings.TrimSpace(path)
+	if src == "" {
+		return false, nil, pathError(path, "empty path")
+	}
+	if strings.HasPrefix(src, "/") {
+		absolute = true
+		src = src[1:]
+		if src == "" {
+			return true, nil, nil
+		}
+	}
+
+	descendant := false
+	parts := splitPath(src, '/')
+	for i, part := range parts {
+		if part == "" {
+			if descendant || i == len(parts)-1 {
+				return false, nil, pathError(path, "empty step")
+			}
+			descendant = true
+			continue
+		}
+		s, err := parseStep(path, part)
+		if err != nil {
+			return false, nil, err
+		}
+		if (s.kind == "@" || s.kind == "text()") && i != len(parts)-1 {
+			return false, nil, pathError(path, "%s must be the last step", part)
+		}
+		s.descendant = descendant
+		descendant = false
+		steps = append(steps, s)
+	}
+	return absolute, steps, nil
+}
+
+func (p predicate) match(n *Node) bool {
+	switch p.kind {
+	case "@":
+		v, ok := n.Attrs[p.name]
+		return ok && (p.value == nil || v == *p.value)
+	case "text()":
+		return n.Text == *p.value
+	default:
+		for _, c := range n.Children {
+			if c.Name == p.name && (p.value == nil || c.Text == *p.value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Appends n and all of its descendants to nodes, in document order.
+func descendants(nodes []*Node, n *Node) []*Node {
+	nodes = append(nodes, n)
+	for _, c := range n.Children {
+		nodes = descendants(nodes, c)
+	}
+	return nodes
+}
+
+// Resolves a path against a node; see Node.Find().
+func find(n *Node, path string, ns map[string]string) ([]interface{}, error) {
+	absolute, steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if absolute {
+		for n.parent != nil {
+			n = n.parent
+		}
+	}
+
+	nodes := []*Node{n}
+	for _, s := range steps {
+		if s.descendant {
+			var all []*Node
+			for _, n := range nodes {
+				all = descendants(all, n)
+			}
+			nodes = all
+		}
+
+		space, checkSpace := "", false
+		if s.prefix != "" && ns != nil {
+			uri, ok := ns[s.prefix]
+			if !ok {
+				return nil, pathError(path, "unknown namespace prefix: %s", s.prefix)
+			}
+			space, checkSpace = uri, true
+		}
+
+		switch s.kind {
+		case "@":
+			var res []interface{}
+			for _, n := range nodes {
+				if v, ok := n.Attrs[s.name]; ok {
+					res = append(res, v)
+				}
+			}
+			return res, nil
+		case "text()":
+			var res []interface{}
+			for _, n := range nodes {
+				if n.parent != nil {
+					res = append(res, n.Text)
+				}
+			}
+			return res, nil
+		}
+
+		seen := make(map[*Node]bool)
+		var next []*Node
+		for _, n := range nodes {
+			var matches []*Node
+			switch s.kind {
+			case ".":
+				matches = []*Node{n}
+			case "..":
+				if n.parent != nil {
+					matches = []*Node{n.parent}
+				}
+			default:
+				for _, c := range n.Children {
+					if (s.name == "*" || c.Name == s.name) && (!checkSpace || c.Space == space) {
+						matches = append(matches, c)
+					}
+				}
+			}
+			for _, p := range s.preds {
+				var filtered []*Node
+				for i, m := range matches {
+					if (p.pos > 0 && i+1 == p.pos) || (p.pos == 0 && p.match(m)) {
+						filtered = append(filtered, m)
+					}
+				}
+				matches = filtered
+			}
+			for _, m := range matches {
+				if !seen[m] {
+					seen[m] = true
+					next = append(next, m)
+				}
+			}
+		}
+		nodes = next
+	}
+
+	res := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		res[i] = n
+	}
+	return res, nil
+}
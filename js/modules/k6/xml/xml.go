@@ -0,0 +1,119 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package xml
+
+import (
+	"bytes"
+	"context"
+	encxml "encoding/xml"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+type XML struct{}
+
+func init() {
+	common.RegisterFeature("xml")
+}
+
+func (XML) Parse(ctx context.Context, src string) (*Node, error) {
+	return Parse(common.GetRuntime(ctx), src)
+}
+
+// Builds a document from an object with a single key, the root element's name. Keys starting with
+// "@" become attributes, "#text" becomes text content, arrays repeat an element, and anything else
+// becomes a child element. Keys are written in the order they were defined.
+func (XML) Build(ctx context.Context, obj goja.Value) (string, error) {
+	rt := common.GetRuntime(ctx)
+	if goja.IsUndefined(obj) || goja.IsNull(obj) {
+		return "", errors.New("xml: build() needs an object")
+	}
+	o := obj.ToObject(rt)
+	keys := o.Keys()
+	if len(keys) != 1 {
+		return "", errors.Errorf("xml: a document must have exactly one root element, not %d", len(keys))
+	}
+
+	var buf bytes.Buffer
+	if err := buildElement(rt, &buf, keys[0], o.Get(keys[0])); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func buildElement(rt *goja.Runtime, buf *bytes.Buffer, name string, v goja.Value) error {
+	if name == "" || strings.HasPrefix(name, "@") || strings.HasPrefix(name, "#") {
+		return errors.Errorf("xml: invalid element name: %q", name)
+	}
+
+	if v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+		if arr, ok := v.Export().([]interface{}); ok {
+			o := v.ToObject(rt)
+			for i := range arr {
+				if err := buildElement(rt, buf, name, o.Get(strconv.Itoa(i))); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	buf.WriteString("<" + name)
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		buf.WriteString("/>")
+		return nil
+	}
+	if _, ok := v.Export().(map[string]interface{}); !ok {
+		buf.WriteString(">")
+		_ = encxml.EscapeText(buf, []byte(v.String()))
+		buf.WriteString("</" + name + ">")
+		return nil
+	}
+
+	o := v.ToObject(rt)
+	keys := o.Keys()
+	for _, k := range keys {
+		if !strings.HasPrefix(k, "@") {
+			continue
+		}
+		buf.WriteString(" " + k[1:] + `="`)
+		_ = encxml.EscapeText(buf, []byte(o.Get(k).String()))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">")
+	for _, k := range keys {
+		switch {
+		case strings.HasPrefix(k, "@"):
+		case k == "#text":
+			_ = encxml.EscapeText(buf, []byte(o.Get(k).String()))
+		default:
+			if err := buildElement(rt, buf, k, o.Get(k)); err != nil {
+				return err
+			}
+		}
+	}
+	buf.WriteString("</" + name + ">")
+	return nil
+}
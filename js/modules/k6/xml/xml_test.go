@@ -0,0 +1,131 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package xml
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/stretchr/testify/assert"
+)
+
+const testXML = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+	<title>Example Feed</title>
+	<entry id="1" lang="en">
+		<title>First</title>
+		<media:thumbnail url="a.png"/>
+	</entry>
+	<entry id="2" lang="sv">
+		<title>Second</title>
+		<media:thumbnail url="b.png"/>
+	</entry>
+</feed>
+`
+
+func TestParse(t *testing.T) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("src", testXML)
+	rt.Set("xml", common.Bind(rt, &XML{}, &ctx))
+
+	_, err := common.RunString(rt, `let doc = xml.parse(src)`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	testdata := map[string]string{
+		`doc.get("/feed/title/text()")`:                                         "Example Feed",
+		`doc.get("feed").name`:                                                  "feed",
+		`doc.get("feed").space`:                                                 "http://www.w3.org/2005/Atom",
+		`doc.find("/feed/entry").length`:                                        "2",
+		`doc.find("//title").length`:                                            "3",
+		`doc.find("//entry/@id").join(",")`:                                     "1,2",
+		`doc.get("/feed/entry[@lang='sv']/title/text()")`:                       "Second",
+		`doc.get("/feed/entry[2]/@id")`:                                         "2",
+		`doc.get("/feed/entry[title='First']/@lang")`:                           "en",
+		`doc.get("//media:thumbnail/@url")`:                                     "a.png",
+		`doc.get("//m:thumbnail/@url", { m: "http://search.yahoo.com/mrss/" })`: "a.png",
+		`doc.get("//m:thumbnail/@url", { m: "http://example.com/" })`:           "null",
+		`doc.get("/feed/*[2]/title/text()")`:                                    "First",
+		`doc.get("/feed/entry[@id='2']/title/../@lang")`:                        "sv",
+		`doc.get("/feed/entry").get("title").text`:                              "First",
+		`doc.get("/feed/nope")`:                                                 "null",
+	}
+	for src, expected := range testdata {
+		t.Run(src, func(t *testing.T) {
+			v, err := common.RunString(rt, src)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, v.String())
+			}
+		})
+	}
+
+	t.Run("Invalid Path", func(t *testing.T) {
+		_, err := common.RunString(rt, `doc.find("/feed/@id/title")`)
+		assert.EqualError(t, err, `GoError: xml: invalid path: "/feed/@id/title": @id must be the last step`)
+	})
+	t.Run("Unknown Prefix", func(t *testing.T) {
+		_, err := common.RunString(rt, `doc.find("//x:entry", {})`)
+		assert.EqualError(t, err, `GoError: xml: invalid path: "//x:entry": unknown namespace prefix: x`)
+	})
+	t.Run("Malformed", func(t *testing.T) {
+		v, err := common.RunString(rt, `
+		let e;
+		try { xml.parse("<a>\n  <b></a>"); } catch (err) { e = err; }
+		[e.line, e.column].join(":")
+		`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "2:10", v.String())
+		}
+	})
+}
+
+func TestBuild(t *testing.T) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("xml", common.Bind(rt, &XML{}, &ctx))
+
+	testdata := map[string]string{
+		`xml.build({ a: "b & c" })`:                                   `<a>b &amp; c</a>`,
+		`xml.build({ a: null })`:                                      `<a/>`,
+		`xml.build({ a: { "@id": 1, "@q": "\"", b: 2, c: [3, 4] } })`: `<a id="1" q="&#34;"><b>2</b><c>3</c><c>4</c></a>`,
+		`xml.build({ a: { "@id": "x", "#text": "hi" } })`:             `<a id="x">hi</a>`,
+		`xml.build({ a: { b: { c: true } } })`:                        `<a><b><c>true</c></b></a>`,
+	}
+	for src, expected := range testdata {
+		t.Run(src, func(t *testing.T) {
+			v, err := common.RunString(rt, src)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, v.String())
+			}
+		})
+	}
+
+	t.Run("Multiple Roots", func(t *testing.T) {
+		_, err := common.RunString(rt, `xml.build({ a: 1, b: 2 })`)
+		assert.EqualError(t, err, "GoError: xml: a document must have exactly one root element, not 2")
+	})
+}
@@ -0,0 +1,733 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	common.RegisterFeature("promises", "async")
+}
+
+// Promises and async functions aren't natively supported by the runtime, so every one gets a
+// Promise polyfill, whose jobs are run by the VU's event loop, and the parts of regenerator's
+// runtime that Babel's output for async functions (and generators) needs.
+var promiseProgram = common.MustCompile("__promise__", `
+	(function(global) {
+		"use strict";
+
+		var hasOwn = Object.prototype.hasOwnProperty;
+
+		// Promise jobs, run by the VU's event loop through drain().
+		var jobs = [];
+		function enqueue(job) {
+			jobs.push(job);
+		}
+		function drain() {
+			for (var i = 0; i < jobs.length; i++) {
+				jobs[i]();
+			}
+			jobs = [];
+		}
+		function reset() {
+			jobs = [];
+		}
+
+		var PENDING = "pending", FULFILLED = "fulfilled", REJECTED = "rejected";
+
+		function Promise(executor) {
+			if (!(this instanceof Promise)) {
+				throw new TypeError("Promise must be called with new");
+			}
+			if (typeof executor !== "function") {
+				throw new TypeError("Promise resolver is not a function");
+			}
+			this._state = PENDING;
+			this._value = undefined;
+			this._reactions = [];
+			var fns = resolvingFunctions(this);
+			try {
+				executor(fns.resolve, fns.reject);
+			} catch (e) {
+				fns.reject(e);
+			}
+		}
+
+		function resolvingFunctions(p) {
+			var done = false;
+			return {
+				resolve: function(v) {
+					if (!done) {
+						done = true;
+						resolvePromise(p, v);
+					}
+				},
+				reject: function(e) {
+					if (!done) {
+						done = true;
+						settle(p, REJECTED, e);
+					}
+				}
+			};
+		}
+
+		function resolvePromise(p, v) {
+			if (v === p) {
+				settle(p, REJECTED, new TypeError("a promise can't be resolved with itself"));
+				return;
+			}
+			if (v !== null && (typeof v === "object" || typeof v === "function")) {
+				var then;
+				try {
+					then = v.then;
+				} catch (e) {
+					settle(p, REJECTED, e);
+					return;
+				}
+				if (typeof then === "function") {
+					enqueue(function() {
+						var fns = resolvingFunctions(p);
+						try {
+							then.call(v, fns.resolve, fns.reject);
+						} catch (e) {
+							fns.reject(e);
+						}
+					});
+					return;
+				}
+			}
+			settle(p, FULFILLED, v);
+		}
+
+		function settle(p, state, value) {
+			if (p._state !== PENDING) {
+				return;
+			}
+			p._state = state;
+			p._value = value;
+			var reactions = p._reactions;
+			p._reactions = undefined;
+			for (var i = 0; i < reactions.length; i++) {
+				react(p, reactions[i]);
+			}
+		}
+
+		function react(p, reaction) {
+			enqueue(function() {
+				var handler = p._state === FULFILLED ? reaction.onFulfilled : reaction.onRejected;
+				if (typeof handler !== "function") {
+					if (p._state === FULFILLED) {
+						reaction.resolve(p._value);
+					} else {
+						reaction.reject(p._value);
+					}
+					return;
+				}
+				var result;
+				try {
+					result = handler(p._value);
+				} catch (e) {
+					reaction.reject(e);
+					return;
+				}
+				reaction.resolve(result);
+			});
+		}
+
+		Promise.prototype.then = function(onFulfilled, onRejected) {
+			var reaction = { onFulfilled: onFulfilled, onRejected: onRejected };
+			var next = new Promise(function(resolve, reject) {
+				reaction.resolve = resolve;
+				reaction.reject = reject;
+			});
+			if (this._state === PENDING) {
+				this._reactions.push(reaction);
+			} else {
+				react(this, reaction);
+			}
+			return next;
+		};
+
+		Promise.prototype["catch"] = function(onRejected) {
+			return this.then(undefined, onRejected);
+		};
+
+		Promise.resolve = function(v) {
+			if (v instanceof Promise) {
+				return v;
+			}
+			return new Promise(function(resolve) { resolve(v); });
+		};
+
+		Promise.reject = function(e) {
+			return new Promise(function(resolve, reject) { reject(e); });
+		};
+
+		Promise.all = function(values) {
+			return new Promise(function(resolve, reject) {
+				var results = new Array(values.length);
+				var remaining = values.length;
+				if (remaining === 0) {
+					resolve(results);
+					return;
+				}
+				values.forEach(function(v, i) {
+					Promise.resolve(v).then(function(result) {
+						results[i] = result;
+						if (--remaining === 0) {
+							resolve(results);
+						}
+					}, reject);
+				});
+			});
+		};
+
+		Promise.race = function(values) {
+			return new Promise(function(resolve, reject) {
+				values.forEach(function(v) {
+					Promise.resolve(v).then(resolve, reject);
+				});
+			});
+		};
+
+		// Returns [state, value] for a promise, or undefined for anything else.
+		function promiseState(p) {
+			if (!(p instanceof Promise)) {
+				return undefined;
+			}
+			return [p._state, p._value];
+		}
+
+		// The subset of regenerator's runtime that Babel's output for generators and async functions
+		// relies on; see https://github.com/facebook/regenerator.
+		var regeneratorRuntime = (function() {
+			var GenStateSuspendedStart = "suspendedStart";
+			var GenStateSuspendedYield = "suspendedYield";
+			var GenStateExecuting = "executing";
+			var GenStateCompleted = "completed";
+
+			// Returned by context methods to make the generator loop continue.
+			var ContinueSentinel = {};
+
+			function Generator() {}
+			function GeneratorFunction() {}
+			function GeneratorFunctionPrototype() {}
+
+			var Gp = GeneratorFunctionPrototype.prototype = Generator.prototype = Object.create({});
+			GeneratorFunction.prototype = Gp.constructor = GeneratorFunctionPrototype;
+			GeneratorFunctionPrototype.constructor = GeneratorFunction;
+			GeneratorFunction.displayName = "GeneratorFunction";
+
+			["next", "throw", "return"].forEach(function(method) {
+				Gp[method] = function(arg) {
+					return this._invoke(method, arg);
+				};
+			});
+			Gp.toString = function() {
+				return "[object Generator]";
+			};
+			if (typeof Symbol === "function" && Symbol.iterator) {
+				Gp[Symbol.iterator] = function() {
+					return this;
+				};
+			}
+
+			function tryCatch(fn, obj, arg) {
+				try {
+					return { type: "normal", arg: fn.call(obj, arg) };
+				} catch (err) {
+					return { type: "throw", arg: err };
+				}
+			}
+
+			function wrap(innerFn, outerFn, self, tryLocsList) {
+				var protoGenerator = outerFn && outerFn.prototype instanceof Generator ? outerFn : Generator;
+				var generator = Object.create(protoGenerator.prototype);
+				var context = new Context(tryLocsList || []);
+				generator._invoke = makeInvokeMethod(innerFn, self, context);
+				return generator;
+			}
+
+			function isGeneratorFunction(genFun) {
+				var ctor = typeof genFun === "function" && genFun.constructor;
+				return ctor ? ctor === GeneratorFunction || (ctor.displayName || ctor.name) === "GeneratorFunction" : false;
+			}
+
+			function mark(genFun) {
+				if (Object.setPrototypeOf) {
+					Object.setPrototypeOf(genFun, GeneratorFunctionPrototype);
+				}
+				genFun.prototype = Object.create(Gp);
+				return genFun;
+			}
+
+			function awrap(arg) {
+				return { __await: arg };
+			}
+
+			function AsyncIterator(generator) {
+				function invoke(method, arg, resolve, reject) {
+					var record = tryCatch(generator[method], generator, arg);
+					if (record.type === "throw") {
+						reject(record.arg);
+						return;
+					}
+					var result = record.arg;
+					var value = result.value;
+					if (value && typeof value === "object" && hasOwn.call(value, "__await")) {
+						Promise.resolve(value.__await).then(function(value) {
+							invoke("next", value, resolve, reject);
+						}, function(err) {
+							invoke("throw", err, resolve, reject);
+						});
+						return;
+					}
+					Promise.resolve(value).then(function(unwrapped) {
+						result.value = unwrapped;
+						resolve(result);
+					}, reject);
+				}
+
+				var previousPromise;
+				this._invoke = function(method, arg) {
+					function callInvoke() {
+						return new Promise(function(resolve, reject) {
+							invoke(method, arg, resolve, reject);
+						});
+					}
+					previousPromise = previousPromise ? previousPromise.then(callInvoke, callInvoke) : callInvoke();
+					return previousPromise;
+				};
+			}
+			["next", "throw", "return"].forEach(function(method) {
+				AsyncIterator.prototype[method] = function(arg) {
+					return this._invoke(method, arg);
+				};
+			});
+
+			function async(innerFn, outerFn, self, tryLocsList) {
+				var iter = new AsyncIterator(wrap(innerFn, outerFn, self, tryLocsList));
+				if (isGeneratorFunction(outerFn)) {
+					return iter;
+				}
+				return iter.next().then(function(result) {
+					return result.done ? result.value : iter.next();
+				});
+			}
+
+			function makeInvokeMethod(innerFn, self, context) {
+				var state = GenStateSuspendedStart;
+
+				return function invoke(method, arg) {
+					if (state === GenStateExecuting) {
+						throw new Error("Generator is already running");
+					}
+					if (state === GenStateCompleted) {
+						if (method === "throw") {
+							throw arg;
+						}
+						return doneResult();
+					}
+
+					context.method = method;
+					context.arg = arg;
+
+					for (;;) {
+						var delegate = context.delegate;
+						if (delegate) {
+							var delegateResult = maybeInvokeDelegate(delegate, context);
+							if (delegateResult) {
+								if (delegateResult === ContinueSentinel) {
+									continue;
+								}
+								return delegateResult;
+							}
+						}
+
+						if (context.method === "next") {
+							context.sent = context._sent = context.arg;
+						} else if (context.method === "throw") {
+							if (state === GenStateSuspendedStart) {
+								state = GenStateCompleted;
+								throw context.arg;
+							}
+							context.dispatchException(context.arg);
+						} else if (context.method === "return") {
+							context.abrupt("return", context.arg);
+						}
+
+						state = GenStateExecuting;
+						var record = tryCatch(innerFn, self, context);
+						if (record.type === "normal") {
+							state = context.done ? GenStateCompleted : GenStateSuspendedYield;
+							if (record.arg === ContinueSentinel) {
+								continue;
+							}
+							return { value: record.arg, done: context.done };
+						}
+						state = GenStateCompleted;
+						context.method = "throw";
+						context.arg = record.arg;
+					}
+				};
+			}
+
+			function maybeInvokeDelegate(delegate, context) {
+				var method = delegate.iterator[context.method];
+				if (method === undefined) {
+					context.delegate = null;
+					if (context.method === "throw") {
+						if (delegate.iterator["return"]) {
+							context.method = "return";
+							context.arg = undefined;
+							maybeInvokeDelegate(delegate, context);
+							if (context.method === "throw") {
+								return ContinueSentinel;
+							}
+						}
+						context.method = "throw";
+						context.arg = new TypeError("The iterator does not provide a 'throw' method");
+					}
+					return ContinueSentinel;
+				}
+
+				var record = tryCatch(method, delegate.iterator, context.arg);
+				if (record.type === "throw") {
+					context.method = "throw";
+					context.arg = record.arg;
+					context.delegate = null;
+					return ContinueSentinel;
+				}
+
+				var info = record.arg;
+				if (!info) {
+					context.method = "throw";
+					context.arg = new TypeError("iterator result is not an object");
+					context.delegate = null;
+					return ContinueSentinel;
+				}
+				if (!info.done) {
+					return info;
+				}
+				context[delegate.resultName] = info.value;
+				context.next = delegate.nextLoc;
+				if (context.method !== "return") {
+					context.method = "next";
+					context.arg = undefined;
+				}
+				context.delegate = null;
+				return ContinueSentinel;
+			}
+
+			function pushTryEntry(locs) {
+				var entry = { tryLoc: locs[0] };
+				if (1 in locs) {
+					entry.catchLoc = locs[1];
+				}
+				if (2 in locs) {
+					entry.finallyLoc = locs[2];
+					entry.afterLoc = locs[3];
+				}
+				this.tryEntries.push(entry);
+			}
+
+			function resetTryEntry(entry) {
+				var record = entry.completion || {};
+				record.type = "normal";
+				delete record.arg;
+				entry.completion = record;
+			}
+
+			function Context(tryLocsList) {
+				this.tryEntries = [{ tryLoc: "root" }];
+				tryLocsList.forEach(pushTryEntry, this);
+				this.reset(true);
+			}
+
+			Context.prototype = {
+				constructor: Context,
+
+				reset: function(skipTempReset) {
+					this.prev = 0;
+					this.next = 0;
+					this.sent = this._sent = undefined;
+					this.done = false;
+					this.delegate = null;
+					this.method = "next";
+					this.arg = undefined;
+					this.tryEntries.forEach(resetTryEntry);
+					if (!skipTempReset) {
+						for (var name in this) {
+							if (name.charAt(0) === "t" && hasOwn.call(this, name) && !isNaN(+name.slice(1))) {
+								this[name] = undefined;
+							}
+						}
+					}
+				},
+
+				stop: function() {
+					this.done = true;
+					var rootRecord = this.tryEntries[0].completion;
+					if (rootRecord.type === "throw") {
+						throw rootRecord.arg;
+					}
+					return this.rval;
+				},
+
+				dispatchException: function(exception) {
+					if (this.done) {
+						throw exception;
+					}
+					var context = this;
+					function handle(record, loc, caught) {
+						record.type = "throw";
+						record.arg = exception;
+						context.next = loc;
+						if (caught) {
+							context.method = "next";
+							context.arg = undefined;
+						}
+						return !!caught;
+					}
+
+					for (var i = this.tryEntries.length - 1; i >= 0; --i) {
+						var entry = this.tryEntries[i];
+						var record = entry.completion;
+						if (entry.tryLoc === "root") {
+							return handle(record, "end");
+						}
+						if (entry.tryLoc <= this.prev) {
+							var hasCatch = hasOwn.call(entry, "catchLoc");
+							var hasFinally = hasOwn.call(entry, "finallyLoc");
+							if (hasCatch && this.prev < entry.catchLoc) {
+								return handle(record, entry.catchLoc, true);
+							}
+							if (hasFinally && this.prev < entry.finallyLoc) {
+								return handle(record, entry.finallyLoc);
+							}
+							if (!hasCatch && !hasFinally) {
+								throw new Error("try statement without catch or finally");
+							}
+						}
+					}
+				},
+
+				abrupt: function(type, arg) {
+					var finallyEntry;
+					for (var i = this.tryEntries.length - 1; i >= 0; --i) {
+						var entry = this.tryEntries[i];
+						if (entry.tryLoc <= this.prev && hasOwn.call(entry, "finallyLoc") && this.prev < entry.finallyLoc) {
+							finallyEntry = entry;
+							break;
+						}
+					}
+					if (finallyEntry && (type === "break" || type === "continue") &&
+						finallyEntry.tryLoc <= arg && arg <= finallyEntry.finallyLoc) {
+						// Jumping within the try block itself doesn't run the finally block.
+						finallyEntry = null;
+					}
+
+					var record = finallyEntry ? finallyEntry.completion : {};
+					record.type = type;
+					record.arg = arg;
+					if (finallyEntry) {
+						this.method = "next";
+						this.next = finallyEntry.finallyLoc;
+						return ContinueSentinel;
+					}
+					return this.complete(record);
+				},
+
+				complete: function(record, afterLoc) {
+					if (record.type === "throw") {
+						throw record.arg;
+					}
+					if (record.type === "break" || record.type === "continue") {
+						this.next = record.arg;
+					} else if (record.type === "return") {
+						this.rval = this.arg = record.arg;
+						this.method = "return";
+						this.next = "end";
+					} else if (record.type === "normal" && afterLoc) {
+						this.next = afterLoc;
+					}
+					return ContinueSentinel;
+				},
+
+				finish: function(finallyLoc) {
+					for (var i = this.tryEntries.length - 1; i >= 0; --i) {
+						var entry = this.tryEntries[i];
+						if (entry.finallyLoc === finallyLoc) {
+							this.complete(entry.completion, entry.afterLoc);
+							resetTryEntry(entry);
+							return ContinueSentinel;
+						}
+					}
+				},
+
+				"catch": function(tryLoc) {
+					for (var i = this.tryEntries.length - 1; i >= 0; --i) {
+						var entry = this.tryEntries[i];
+						if (entry.tryLoc === tryLoc) {
+							var record = entry.completion;
+							var thrown;
+							if (record.type === "throw") {
+								thrown = record.arg;
+								resetTryEntry(entry);
+							}
+							return thrown;
+						}
+					}
+					throw new Error("illegal catch attempt");
+				},
+
+				delegateYield: function(iterable, resultName, nextLoc) {
+					this.delegate = { iterator: values(iterable), resultName: resultName, nextLoc: nextLoc };
+					if (this.method === "next") {
+						this.arg = undefined;
+					}
+					return ContinueSentinel;
+				}
+			};
+
+			function values(iterable) {
+				if (iterable) {
+					var iteratorMethod = typeof Symbol === "function" && Symbol.iterator && iterable[Symbol.iterator];
+					if (iteratorMethod) {
+						return iteratorMethod.call(iterable);
+					}
+					if (typeof iterable.next === "function") {
+						return iterable;
+					}
+					if (!isNaN(iterable.length)) {
+						var i = -1;
+						return {
+							next: function() {
+								while (++i < iterable.length) {
+									if (hasOwn.call(iterable, i)) {
+										return { value: iterable[i], done: false };
+									}
+								}
+								return doneResult();
+							}
+						};
+					}
+				}
+				return { next: doneResult };
+			}
+
+			function keys(object) {
+				var keys = [];
+				for (var key in object) {
+					keys.push(key);
+				}
+				keys.reverse();
+				return function next() {
+					while (keys.length) {
+						var key = keys.pop();
+						if (key in object) {
+							next.value = key;
+							next.done = false;
+							return next;
+						}
+					}
+					next.done = true;
+					return next;
+				};
+			}
+
+			function doneResult() {
+				return { value: undefined, done: true };
+			}
+
+			return {
+				wrap: wrap,
+				mark: mark,
+				isGeneratorFunction: isGeneratorFunction,
+				awrap: awrap,
+				AsyncIterator: AsyncIterator,
+				async: async,
+				keys: keys,
+				values: values
+			};
+		})();
+
+		global.Promise = Promise;
+		global.regeneratorRuntime = regeneratorRuntime;
+		return { drain: drain, reset: reset, state: promiseState };
+	})(this);
+`, false)
+
+// Hooks into a runtime's Promise polyfill.
+type promiseHooks struct {
+	rt    *goja.Runtime
+	drain goja.Callable
+	reset goja.Callable
+	state goja.Callable
+}
+
+// Installs Promise and regeneratorRuntime into a runtime.
+func installPromises(rt *goja.Runtime) (*promiseHooks, error) {
+	v, err := rt.RunProgram(promiseProgram)
+	if err != nil {
+		return nil, err
+	}
+	obj := v.ToObject(rt)
+	h := &promiseHooks{rt: rt}
+	h.drain, _ = goja.AssertFunction(obj.Get("drain"))
+	h.reset, _ = goja.AssertFunction(obj.Get("reset"))
+	h.state, _ = goja.AssertFunction(obj.Get("state"))
+	return h, nil
+}
+
+// Runs queued promise jobs, including any they queue in turn, until there are none left.
+func (h *promiseHooks) RunJobs() error {
+	_, err := h.drain(goja.Undefined())
+	return err
+}
+
+// Drops queued promise jobs.
+func (h *promiseHooks) Reset() {
+	_, _ = h.reset(goja.Undefined())
+}
+
+// Returns an error if v is a promise that was rejected, or is still pending; anything else,
+// including fulfilled promises, is fine.
+func (h *promiseHooks) Check(v goja.Value) error {
+	res, err := h.state(goja.Undefined(), v)
+	if err != nil {
+		return err
+	}
+	if goja.IsUndefined(res) {
+		return nil
+	}
+	obj := res.ToObject(h.rt)
+	switch obj.Get("0").String() {
+	case "rejected":
+		return errors.New(obj.Get("1").String())
+	case "pending":
+		return errors.New("promise never settled")
+	}
+	return nil
+}
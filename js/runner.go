@@ -22,16 +22,24 @@ package js
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/compiler"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/netext"
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
+	"golang.org/x/net/http2"
 )
 
 type Runner struct {
@@ -39,10 +47,84 @@ type Runner struct {
 	defaultGroup *lib.Group
 
 	Dialer *netext.Dialer
+
+	// Shared by all VUs, to enforce the rps option.
+	RateLimiter *netext.RateLimiter
+
+	// Seed for the VUs' RNGs, from which each iteration's seed is derived; see common.IterationSeed.
+	// Random, unless the seed option is set.
+	Seed int64
+
+	// If set, VUs send HTTP requests through this instead of transports of their own, eg. to mock
+	// responses in tests, or to add logging. It's shared by all VUs, so it must be thread-safe.
+	Transport http.RoundTripper
+
+	// Where VUs' log output goes, eg. console.log() and dumped requests; logrus' standard logger by
+	// default. Only VUs created after this is changed use the new logger.
+	Logger *log.Logger
+
+	// Records VUs' requests for the har option; nil if it's not set.
+	HAR *netext.HARRecorder
+
+	// If set, called before every iteration, with the result exposed to the script as __DATA, eg. to
+	// hand out sequential account numbers from a shared counter. It's called from all VUs at once,
+	// so it must be thread-safe; an error fails the iteration without running it.
+	IterationData func(vuID, iteration int64) (interface{}, error)
+
+	// Counters and latches shared by all VUs, for the k6/sync module.
+	Coordinator *common.Coordinator
+
+	// Called around every HTTP request any VU makes; see AddRequestHook().
+	requestHooks []netext.RequestHook
+
+	// Client certificates from the tlsAuth option, parsed once and shared by all VUs.
+	tlsAuth []tlsAuth
+}
+
+type tlsAuth struct {
+	domains []string
+	cert    tls.Certificate
+}
+
+// Parses client certificates; invalid ones are left out, as the engine rejects them anyway.
+func parseTLSAuth(auths []lib.TLSAuth) []tlsAuth {
+	var parsed []tlsAuth
+	for _, auth := range auths {
+		cert, err := auth.Certificate()
+		if err != nil {
+			continue
+		}
+		domains := make([]string, len(auth.Domains))
+		for i, domain := range auth.Domains {
+			domains[i] = strings.ToLower(domain)
+		}
+		parsed = append(parsed, tlsAuth{domains: domains, cert: cert})
+	}
+	return parsed
+}
+
+// Registers a hook to be called around every HTTP request any VU makes, including redirect hops and
+// batched requests, eg. to inject auth headers or trace requests. Hooks are called in the order
+// they were added; see netext.HookTransport. Only VUs created after this see the hook, so register
+// hooks before starting a test.
+func (r *Runner) AddRequestHook(hook netext.RequestHook) {
+	r.requestHooks = append(r.requestHooks, hook)
 }
 
 func New(src *lib.SourceData, fs afero.Fs) (*Runner, error) {
-	bundle, err := NewBundle(src, fs)
+	return NewWithCompatibilityMode(src, fs, compiler.CompatibilityModeES6)
+}
+
+// Creates a runner for a script written in the given compatibility mode; see
+// compiler.CompatibilityModeES6 and compiler.CompatibilityModeES5.
+func NewWithCompatibilityMode(src *lib.SourceData, fs afero.Fs, mode string) (*Runner, error) {
+	// Check the script's requirements before running any of it, for a clearer error than the
+	// script's own code would likely fail with.
+	if err := common.CheckRequires(string(src.Data)); err != nil {
+		return nil, err
+	}
+
+	bundle, err := NewBundleWithCompatibilityMode(src, fs, mode)
 	if err != nil {
 		return nil, err
 	}
@@ -52,15 +134,72 @@ func New(src *lib.SourceData, fs afero.Fs) (*Runner, error) {
 		return nil, err
 	}
 
-	return &Runner{
+	r := &Runner{
 		Bundle:       bundle,
 		defaultGroup: defaultGroup,
+		Logger:       log.StandardLogger(),
+		Coordinator:  common.NewCoordinator(),
 		Dialer: netext.NewDialer(net.Dialer{
 			Timeout:   30 * time.Second,
 			KeepAlive: 30 * time.Second,
 			DualStack: true,
 		}),
-	}, nil
+	}
+	r.Dialer.UnixSockets = bundle.Options.UnixSockets
+	r.Dialer.LocalIPs = bundle.Options.LocalIPs
+	applyDNSOptions(r.Dialer, bundle.Options.DNS)
+	r.HAR = newHARRecorder(bundle.Options.HAR)
+	r.tlsAuth = parseTLSAuth(bundle.Options.TLSAuth)
+	r.RateLimiter = netext.NewRateLimiter(bundle.Options.RPS.Int64)
+	r.Seed = common.NewSeed()
+	if bundle.Options.Seed.Valid {
+		r.Seed = bundle.Options.Seed.Int64
+	}
+	return r, nil
+}
+
+// Replaces the dialer's resolver, so that lookups cached under earlier options are dropped.
+func applyDNSOptions(d *netext.Dialer, opts *lib.DNSOptions) {
+	if opts == nil {
+		opts = &lib.DNSOptions{}
+	}
+	ttl, _ := opts.ParseTTL()
+	policy := netext.IPAny
+	switch opts.Policy.String {
+	case lib.DNSPolicyPreferIPv4:
+		policy = netext.IPPreferV4
+	case lib.DNSPolicyPreferIPv6:
+		policy = netext.IPPreferV6
+	case lib.DNSPolicyOnlyIPv4:
+		policy = netext.IPOnlyV4
+	case lib.DNSPolicyOnlyIPv6:
+		policy = netext.IPOnlyV6
+	}
+	d.Resolver = netext.NewResolver(ttl, policy)
+	switch opts.Select.String {
+	case lib.DNSSelectRoundRobin:
+		d.IPSelect = netext.IPSelectRoundRobin
+	case lib.DNSSelectRandom:
+		d.IPSelect = netext.IPSelectRandom
+	default:
+		d.IPSelect = netext.IPSelectFirst
+	}
+}
+
+// Returns a recorder for the har option, or nil if it's not set.
+func newHARRecorder(opts *lib.HAROptions) *netext.HARRecorder {
+	if opts == nil {
+		return nil
+	}
+	sample := 1.0
+	if opts.Sample.Valid {
+		sample = opts.Sample.Float64
+	}
+	bodyLimit := int64(netext.DefaultDumpBodyLimit)
+	if opts.MaxBodySize.Valid {
+		bodyLimit = opts.MaxBodySize.Int64
+	}
+	return netext.NewHARRecorder(sample, opts.FailedOnly.Bool, bodyLimit)
 }
 
 func (r *Runner) NewVU() (lib.VU, error) {
@@ -78,14 +217,109 @@ func (r *Runner) newVU() (*VU, error) {
 		return nil, err
 	}
 
+	// Every VU is a client of its own, with its own connections and TLS session cache.
+	opts := r.Bundle.Options
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipTLSVerify.Bool,
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+	// Validated by the engine, so unknown names are ignored here.
+	if v, err := lib.ParseTLSVersion(opts.TLSMinVersion.String); err == nil {
+		tlsConfig.MinVersion = v
+	}
+	if v, err := lib.ParseTLSVersion(opts.TLSMaxVersion.String); err == nil {
+		tlsConfig.MaxVersion = v
+	}
+	for _, name := range opts.TLSCipherSuites {
+		if id, err := lib.ParseTLSCipherSuite(name); err == nil {
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+	if opts.NoTLSResumption.Bool {
+		tlsConfig.ClientSessionCache = nil
+		tlsConfig.SessionTicketsDisabled = true
+	}
+	// DNS records are round-robined, and connections per host limited, separately for every VU.
+	dialer := r.Dialer.ForVU()
+	dialer.MaxConnsPerHost = int(opts.MaxConnsPerHost.Int64)
+	dialer.Rand = bi.Rand
+	dialer.Stats.SetLogger(r.Logger)
+	newTLSConfig := func(certs []tls.Certificate) *tls.Config {
+		config := tlsConfig.Clone()
+		config.Certificates = certs
+		return config
+	}
+	newTransport := func(certs []tls.Certificate) *http.Transport {
+		transport := &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     newTLSConfig(certs),
+			DisableKeepAlives:   opts.NoConnectionReuse.Bool,
+			MaxIdleConns:        int(opts.MaxIdleConns.Int64),
+			MaxIdleConnsPerHost: int(opts.MaxIdleConnsPerHost.Int64),
+		}
+		// A custom dialer or TLS config turns HTTP/2 off, unless it's explicitly turned back on;
+		// this only fails if it's already configured.
+		if !opts.NoHTTP2.Bool {
+			_ = http2.ConfigureTransport(transport)
+		}
+		return transport
+	}
+
+	// Hosts with client certificates of their own get transports of their own.
+	var certs []tls.Certificate
+	hostCerts := make(map[string][]tls.Certificate)
+	for _, auth := range r.tlsAuth {
+		if len(auth.domains) == 0 {
+			certs = append(certs, auth.cert)
+		}
+		for _, domain := range auth.domains {
+			hostCerts[domain] = append(hostCerts[domain], auth.cert)
+		}
+	}
+	var transport http.RoundTripper = newTransport(certs)
+	if len(hostCerts) > 0 {
+		hosts := make(map[string]http.RoundTripper, len(hostCerts))
+		for host, hc := range hostCerts {
+			hosts[host] = newTransport(append(hc, certs...))
+		}
+		transport = &netext.HostTransport{Transport: transport, Hosts: hosts}
+	}
+	if r.Transport != nil {
+		transport = r.Transport
+	}
+	if opts.ConnectionMaxAge.String != "" || opts.ConnectionMaxRequests.Int64 > 0 {
+		maxAge, _ := time.ParseDuration(opts.ConnectionMaxAge.String)
+		transport = &netext.LifetimeTransport{
+			Transport:   transport,
+			MaxAge:      maxAge,
+			MaxRequests: opts.ConnectionMaxRequests.Int64,
+		}
+	}
+	if r.HAR != nil {
+		transport = &netext.HARTransport{Transport: transport, Recorder: r.HAR, Rand: bi.Rand}
+	}
+	if len(r.requestHooks) > 0 {
+		hooks := append([]netext.RequestHook(nil), r.requestHooks...)
+		transport = &netext.HookTransport{Transport: transport, Hooks: hooks}
+	}
+
 	// Make a VU, apply the VU context.
 	vu := &VU{
 		BundleInstance: *bi,
 		Runner:         r,
-		HTTPTransport:  &http.Transport{DialContext: r.Dialer.DialContext},
+		Dialer:         dialer,
+		TLSConfig:      newTLSConfig(certs),
+		HTTPTransport:  transport,
+		CookieJar:      lib.NewCookieJar(),
+		HTTPCache:      netext.NewCache(netext.DefaultCacheSize),
+		RateLimiter:    netext.NewRateLimiter(0),
+		Store:          common.NewStore(common.DefaultStoreSize),
 		VUContext:      NewVUContext(),
 	}
+	vu.VUContext.Console.Logger = r.Logger
+	vu.VUContext.loop.promises = bi.promises
 	common.BindToGlobal(vu.Runtime, common.Bind(vu.Runtime, vu.VUContext, vu.Context))
+	vu.globals = snapshotGlobals(vu.Runtime)
 
 	// Give the VU an initial sense of identity.
 	if err := vu.Reconfigure(0); err != nil {
@@ -99,46 +333,433 @@ func (r *Runner) GetDefaultGroup() *lib.Group {
 	return r.defaultGroup
 }
 
+// Reports the state of connections made by all VUs; see netext.ConnStats.
+func (r *Runner) EmitMetrics(t time.Time) []stats.Sample {
+	return r.Dialer.Stats.Samples(t)
+}
+
 func (r *Runner) GetOptions() lib.Options {
 	return r.Bundle.Options
 }
 
 func (r *Runner) ApplyOptions(opts lib.Options) {
 	r.Bundle.Options = r.Bundle.Options.Apply(opts)
+	r.Dialer.UnixSockets = r.Bundle.Options.UnixSockets
+	r.Dialer.LocalIPs = r.Bundle.Options.LocalIPs
+	applyDNSOptions(r.Dialer, r.Bundle.Options.DNS)
+	if opts.HAR != nil {
+		r.HAR = newHARRecorder(r.Bundle.Options.HAR)
+	}
+	if opts.TLSAuth != nil {
+		r.tlsAuth = parseTLSAuth(r.Bundle.Options.TLSAuth)
+	}
+	r.RateLimiter.SetRate(r.Bundle.Options.RPS.Int64)
+	if r.Bundle.Options.Seed.Valid {
+		r.Seed = r.Bundle.Options.Seed.Int64
+	}
+}
+
+// Replays a single iteration on a fresh VU, eg. one that failed with a lib.IterationError. Note
+// that state carried over from earlier iterations, such as cookies, isn't reproduced. If verbose,
+// every request and response exchanged is dumped to the log.
+func (r *Runner) Replay(ctx context.Context, id, iteration, seed int64, verbose bool) ([]stats.Sample, error) {
+	vu, err := r.newVU()
+	if err != nil {
+		return nil, err
+	}
+	if err := vu.Reconfigure(id); err != nil {
+		return nil, err
+	}
+	if verbose {
+		vu.HTTPTransport = &netext.DumpTransport{
+			Transport: vu.HTTPTransport,
+			Logger:    r.Logger.WithFields(log.Fields{"vu_id": id, "iteration": iteration}),
+			Body:      true,
+		}
+	}
+	return vu.RunIteration(ctx, iteration, seed)
+}
+
+// Runs a single iteration on a fresh VU 1, dumping every request and response to the log, to debug a
+// script without running a test. It fails if the iteration does, or if any checks failed in it.
+func (r *Runner) DryRun(ctx context.Context) ([]stats.Sample, error) {
+	samples, err := r.Replay(ctx, 1, 0, common.IterationSeed(r.Seed, 1, 0), true)
+	if err != nil {
+		return samples, err
+	}
+	total, failed := 0, 0
+	for _, s := range samples {
+		if s.Metric != metrics.Checks {
+			continue
+		}
+		total++
+		if s.Value == 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return samples, errors.Errorf("%d of %d checks failed", failed, total)
+	}
+	return samples, nil
+}
+
+// Calls the script's exported handleSummary(data), if any, in a VM of its own. It returns a map of
+// output filenames to contents; non-string contents are JSON-encoded.
+func (r *Runner) HandleSummary(ctx context.Context, summary *lib.Summary) (map[string]string, error) {
+	bi, err := r.Bundle.Instantiate()
+	if err != nil {
+		return nil, err
+	}
+	rt := bi.Runtime
+	fn, ok := goja.AssertFunction(rt.Get("exports").ToObject(rt).Get("handleSummary"))
+	if !ok {
+		return nil, nil
+	}
+	*bi.Context = common.WithRuntime(ctx, rt)
+
+	// Round-trip through JSON, so the script sees exactly the documented shape.
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	var dataObj interface{}
+	if err := json.Unmarshal(data, &dataObj); err != nil {
+		return nil, err
+	}
+
+	v, err := fn(goja.Undefined(), rt.ToValue(dataObj))
+	if err != nil {
+		return nil, err
+	}
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return map[string]string{}, nil
+	}
+	obj := v.ToObject(rt)
+	out := make(map[string]string, len(obj.Keys()))
+	for _, k := range obj.Keys() {
+		content := obj.Get(k)
+		if s, ok := content.Export().(string); ok {
+			out[k] = s
+			continue
+		}
+		b, err := json.Marshal(content.Export())
+		if err != nil {
+			return nil, errors.Wrapf(err, "handleSummary: %s", k)
+		}
+		out[k] = string(b)
+	}
+	return out, nil
 }
 
 type VU struct {
 	BundleInstance
 
 	Runner        *Runner
-	HTTPTransport *http.Transport
+	Dialer        *netext.Dialer
+	TLSConfig     *tls.Config
+	HTTPTransport http.RoundTripper
+	CookieJar     *lib.CookieJar
+	HTTPCache     *netext.Cache
+	RateLimiter   *netext.RateLimiter
+	Store         *common.Store
 	ID            int64
 	Iteration     int64
 
 	VUContext *VUContext
+
+	// The global scope as it was after init; see lib.Options.IsolateGlobals.
+	globals map[string]goja.Value
+
+	// Time the last iteration spent in sleep().
+	lastSleep time.Duration
+}
+
+// Ensure VU conforms to lib.SleepTracker.
+var _ lib.SleepTracker = &VU{}
+
+func (u *VU) LastIterationSleep() time.Duration {
+	return u.lastSleep
+}
+
+// Ensure VU conforms to lib.ScenarioVU.
+var _ lib.ScenarioVU = &VU{}
+
+// Makes the VU run the exported function exec in place of the default one.
+func (u *VU) SetScenario(name, exec string) error {
+	fn, ok := goja.AssertFunction(u.Runtime.Get("exports").ToObject(u.Runtime).Get(exec))
+	if !ok {
+		return errors.Errorf("%s is not an exported function", exec)
+	}
+	u.Default = fn
+	return nil
 }
 
 func (u *VU) RunOnce(ctx context.Context) ([]stats.Sample, error) {
+	iteration := u.Iteration
+	u.Iteration++
+	return u.RunIteration(ctx, iteration, common.IterationSeed(u.Runner.Seed, u.ID, iteration))
+}
+
+// Runs a specific iteration, with the VU's RNG seeded with the given seed. Given the same VU ID,
+// iteration number and seed, a script makes the same random choices; failures are returned as a
+// lib.IterationError recording these, so they can be replayed with Runner.Replay().
+func (u *VU) RunIteration(ctx context.Context, iteration, seed int64) ([]stats.Sample, error) {
+	// Fetched before anything is set up, so there's nothing to tear down if it fails.
+	var data interface{}
+	if fn := u.Runner.IterationData; fn != nil {
+		var err error
+		if data, err = fn(u.ID, iteration); err != nil {
+			err = errors.Wrap(err, "iteration data")
+			return nil, &lib.IterationError{VU: u.ID, Iteration: iteration, Seed: seed, Err: err}
+		}
+	}
+
+	// Iterations running for too long, eg. stuck in an infinite loop, are aborted. The limit covers
+	// the iteration's whole wall-clock time; calls into Go (eg. HTTP requests) are cancelled, and
+	// JS code is interrupted. JS code is also interrupted if the context is cancelled, eg. because
+	// the test is being stopped, which would otherwise wait for it forever. Likewise, iterations
+	// are aborted if the process' heap outgrows maxHeapSize; see checkHeapSize().
+	d, _ := time.ParseDuration(u.Runner.Bundle.Options.MaxIterationDuration.String)
+	heapLimit := uint64(u.Runner.Bundle.Options.MaxHeapSize.Int64)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watch := u.watchIteration(ctx, d, heapLimit, cancel)
+
+	// Cookies persist across iterations by default, but can be cleared or disabled outright.
+	var cookieJar http.CookieJar
+	switch u.Runner.Bundle.Options.CookieMode.String {
+	case lib.CookieModeDisabled:
+	case lib.CookieModeReset:
+		u.CookieJar.Clear()
+		cookieJar = u.CookieJar
+	default:
+		cookieJar = u.CookieJar
+	}
+
+	var httpCache *netext.Cache
+	if opts := u.Runner.Bundle.Options; opts.HTTPCache.Bool {
+		if opts.HTTPCacheSize.Valid {
+			u.HTTPCache.SetMaxSize(opts.HTTPCacheSize.Int64)
+		}
+		httpCache = u.HTTPCache
+	}
+
+	maxResponseBodySize := int64(lib.DefaultMaxResponseBodySize)
+	if opts := u.Runner.Bundle.Options; opts.MaxResponseBodySize.Valid {
+		maxResponseBodySize = opts.MaxResponseBodySize.Int64
+	}
+
+	httpTimeout := lib.DefaultHTTPTimeout
+	if opts := u.Runner.Bundle.Options; opts.HTTPTimeout.Valid && opts.HTTPTimeout.String != "" {
+		httpTimeout, _ = time.ParseDuration(opts.HTTPTimeout.String)
+	}
+
+	defaultHeaders := newDefaultHeaders(u.Runner.Bundle.Options)
+
+	var rateLimiters []*netext.RateLimiter
+	if opts := u.Runner.Bundle.Options; opts.RPS.Int64 > 0 {
+		rateLimiters = append(rateLimiters, u.Runner.RateLimiter)
+	}
+	if opts := u.Runner.Bundle.Options; opts.RPSPerVU.Int64 > 0 {
+		u.RateLimiter.SetRate(opts.RPSPerVU.Int64)
+		rateLimiters = append(rateLimiters, u.RateLimiter)
+	}
+
+	var tracePropagator string
+	traceSampling := 1.0
+	if tracing := u.Runner.Bundle.Options.Tracing; tracing != nil {
+		tracePropagator = tracing.Propagator.String
+		if tracing.Sampling.Valid {
+			traceSampling = tracing.Sampling.Float64
+		}
+	}
+
+	if opts := u.Runner.Bundle.Options; opts.VUStoreSize.Valid {
+		u.Store.MaxSize = opts.VUStoreSize.Int64
+	}
+	dnsTags := false
+	if dns := u.Runner.Bundle.Options.DNS; dns != nil {
+		dnsTags = dns.Tags.Bool
+	}
+
 	state := &common.State{
-		Group:         u.Runner.defaultGroup,
-		HTTPTransport: u.HTTPTransport,
+		Group:               u.Runner.defaultGroup,
+		HTTPTransport:       u.HTTPTransport,
+		Dialer:              u.Dialer,
+		TLSConfig:           u.TLSConfig,
+		NoConnectionReuse:   u.Runner.Bundle.Options.NoConnectionReuse.Bool,
+		DefaultHeaders:      defaultHeaders,
+		HTTPDebug:           u.Runner.Bundle.Options.HTTPDebug.String,
+		HTTPDebugRedact:     u.Runner.Bundle.Options.HTTPDebugRedact.Bool,
+		NoHTTPMetrics:       u.Runner.Bundle.Options.NoHTTPMetrics.Bool,
+		DNSTags:             dnsTags,
+		MaxResponseBodySize: maxResponseBodySize,
+		MaxRedirects:        u.Runner.Bundle.Options.MaxRedirects,
+		HTTPTimeout:         httpTimeout,
+		RateLimiters:        rateLimiters,
+		TracePropagator:     tracePropagator,
+		TraceSampling:       traceSampling,
+		CookieJar:           cookieJar,
+		HTTPCache:           httpCache,
+		Rand:                u.Rand,
+		Store:               u.Store,
+		Coordinator:         u.Runner.Coordinator,
+		VUID:                u.ID,
+		Iteration:           iteration,
+		Logger:              u.Runner.Logger,
 	}
 
 	ctx = common.WithRuntime(ctx, u.Runtime)
 	ctx = common.WithState(ctx, state)
 	*u.Context = ctx
 
-	u.Runtime.Set("__ITER", u.Iteration)
-	u.Iteration++
+	if u.Runner.Bundle.Options.IsolateGlobals.Bool {
+		u.resetGlobals()
+	}
+
+	u.RNG.Seed(seed)
+	u.Runtime.Set("__ITER", iteration)
 
-	_, err := u.Default(goja.Undefined())
+	u.Runtime.Set("__DATA", data)
 
-	return state.Samples, err
+	// An async default function's iteration is over once its promise settles; a rejection fails it.
+	v, err := u.Default(goja.Undefined())
+	if err == nil {
+		err = u.VUContext.loop.Run(ctx)
+	}
+	if err == nil && ctx.Err() == nil {
+		err = u.promises.Check(v)
+	}
+	// Timers set by an iteration that threw are dropped, rather than run by the next one.
+	u.VUContext.loop.Reset()
+	u.lastSleep = state.Slept
+	if werr := watch.stop(); werr != nil {
+		err = werr
+	}
+	if err != nil {
+		err = u.Runner.Bundle.withSourceFrame(err)
+		return state.Samples, &lib.IterationError{VU: u.ID, Iteration: iteration, Seed: seed, Err: err}
+	}
+	return state.Samples, nil
+}
+
+// Returns the headers sent with every HTTP request: the headers option, and a User-Agent, which
+// is lib.DefaultUserAgent unless the userAgent or headers options say otherwise. An empty
+// User-Agent is kept, rather than dropped, as that's how Go is told not to send one at all.
+func newDefaultHeaders(opts lib.Options) http.Header {
+	headers := make(http.Header, len(opts.Headers)+1)
+	for k, v := range opts.Headers {
+		headers.Set(k, v)
+	}
+	if opts.UserAgent.Valid {
+		headers.Set("User-Agent", opts.UserAgent.String)
+	} else if _, ok := headers["User-Agent"]; !ok {
+		headers.Set("User-Agent", lib.DefaultUserAgent)
+	}
+	return headers
+}
+
+// An iterationWatch interrupts an iteration's JS code when its context is done, once it's run
+// for too long, or once the heap has outgrown its limit.
+type iterationWatch struct {
+	rt      *goja.Runtime
+	stopped chan struct{}
+	exited  chan struct{}
+	fired   bool
+	err     error
+}
+
+// Starts watching an iteration; a timeout or heap limit of 0 means there's no such limit. On a
+// timeout or an overgrown heap, cancel is called to abort calls into Go as well.
+func (u *VU) watchIteration(ctx context.Context, timeout time.Duration, heapLimit uint64, cancel context.CancelFunc) *iterationWatch {
+	w := &iterationWatch{rt: u.Runtime, stopped: make(chan struct{}), exited: make(chan struct{})}
+	go func() {
+		defer close(w.exited)
+
+		var timeoutC <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			timeoutC = timer.C
+		}
+		var heapC <-chan time.Time
+		if heapLimit > 0 {
+			ticker := time.NewTicker(heapCheckInterval)
+			defer ticker.Stop()
+			heapC = ticker.C
+		}
+		for w.err == nil {
+			select {
+			case <-w.stopped:
+				return
+			case <-timeoutC:
+				w.err = lib.ErrIterationTimeout
+				cancel()
+				w.rt.Interrupt(w.err)
+			case <-heapC:
+				if w.err = checkHeapSize(heapLimit); w.err != nil {
+					cancel()
+					w.rt.Interrupt(w.err)
+				}
+			case <-ctx.Done():
+				w.rt.Interrupt(ctx.Err())
+				w.fired = true
+				return
+			}
+		}
+		w.fired = true
+	}()
+	return w
+}
+
+// Stops watching, returning why the iteration was aborted, if it timed out or outgrew the heap
+// limit. If the JS code was interrupted, but finished before it got to notice, the pending
+// interrupt is flushed out so it can't hit the next iteration.
+func (w *iterationWatch) stop() error {
+	close(w.stopped)
+	<-w.exited
+	if w.fired {
+		_, _ = w.rt.RunString("")
+	}
+	return w.err
 }
 
 func (u *VU) Reconfigure(id int64) error {
 	u.ID = id
 	u.Iteration = 0
+	u.CookieJar.Clear()
+	u.HTTPCache.Clear()
+	u.Store.Clear()
 	u.Runtime.Set("__VU", u.ID)
+	u.Runtime.Set("__VU_STATE__", u.Runtime.NewObject())
 	return nil
 }
+
+// Globals managed by the VU itself, which are never snapshotted or reset. __VU_STATE__ is an
+// object scripts can use to deliberately carry state across iterations.
+var vuGlobals = map[string]bool{"__VU": true, "__ITER": true, "__DATA": true, "__VU_STATE__": true}
+
+// Takes a snapshot of the global scope's bindings. Note that only the bindings themselves are
+// captured; objects they point to may still be mutated in place.
+func snapshotGlobals(rt *goja.Runtime) map[string]goja.Value {
+	global := rt.GlobalObject()
+	globals := make(map[string]goja.Value)
+	for _, k := range global.Keys() {
+		if !vuGlobals[k] {
+			globals[k] = global.Get(k)
+		}
+	}
+	return globals
+}
+
+// Restores the global scope from the VU's snapshot; bindings added since are made undefined.
+func (u *VU) resetGlobals() {
+	for _, k := range u.Runtime.GlobalObject().Keys() {
+		if _, ok := u.globals[k]; !ok && !vuGlobals[k] {
+			u.Runtime.Set(k, goja.Undefined())
+		}
+	}
+	for k, v := range u.globals {
+		u.Runtime.Set(k, v)
+	}
+}
@@ -22,15 +22,36 @@ package js
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	logtest "github.com/Sirupsen/logrus/hooks/test"
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
 	"gopkg.in/guregu/null.v3"
 )
 
@@ -66,6 +87,17 @@ func TestRunnerNew(t *testing.T) {
 		}, afero.NewMemMapFs())
 		assert.EqualError(t, err, "ReferenceError: blarg is not defined at /script.js:1:14(0)")
 	})
+
+	t.Run("Requires", func(t *testing.T) {
+		_, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`// @requires api>=999
+			blarg`),
+		}, afero.NewMemMapFs())
+		assert.EqualError(t, err, fmt.Sprintf(
+			"script requires api>=999, but this version of k6 has api=%d; try upgrading k6", common.APIVersion,
+		))
+	})
 }
 
 func TestRunnerGetDefaultGroup(t *testing.T) {
@@ -94,6 +126,56 @@ func TestRunnerOptions(t *testing.T) {
 	assert.Equal(t, null.NewBool(false, true), r.Bundle.Options.Paused)
 }
 
+func TestRunnerHandleSummary(t *testing.T) {
+	summary := &lib.Summary{
+		Metrics: map[string]lib.SummaryMetric{
+			"my_metric": {Type: stats.Counter, Contains: stats.Default, Values: map[string]float64{"count": 3}},
+		},
+		RootGroup: lib.SummaryGroup{Groups: []lib.SummaryGroup{}, Checks: []lib.SummaryCheck{}},
+	}
+
+	testdata := map[string]struct {
+		src string
+		out map[string]string
+		err string
+	}{
+		"none":  {``, nil, ""},
+		"empty": {`export function handleSummary(data) {}`, map[string]string{}, ""},
+		"outputs": {`
+			export function handleSummary(data) {
+				return {
+					"stdout": "count=" + data.metrics.my_metric.values.count + " type=" + data.metrics.my_metric.type,
+					"summary.json": { groups: data.root_group.groups },
+				};
+			}`,
+			map[string]string{"stdout": "count=3 type=counter", "summary.json": `{"groups":[]}`},
+			"",
+		},
+		"error": {`export function handleSummary(data) { throw new Error("oops"); }`, nil, "Error: oops"},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			r, err := New(&lib.SourceData{
+				Filename: "/script.js",
+				Data:     []byte(data.src + "\nexport default function() {};"),
+			}, afero.NewMemMapFs())
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			out, err := r.HandleSummary(context.Background(), summary)
+			if data.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), data.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, data.out, out)
+		})
+	}
+}
+
 func TestRunnerIntegrationImports(t *testing.T) {
 	modules := []string{
 		"k6",
@@ -137,6 +219,191 @@ func TestVURunContext(t *testing.T) {
 	assert.True(t, fnCalled, "fn() not called")
 }
 
+func TestVUInitOnce(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		let inits = 0, iterations = 0;
+		inits++;
+		export default function() {
+			iterations++;
+			if (inits != 1) { throw new Error("init code ran " + inits + " times"); }
+			if (iterations != __ITER + 1) { throw new Error("wrong iterations: " + iterations); }
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		vu, err := r.newVU()
+		if !assert.NoError(t, err) {
+			return
+		}
+		for j := 0; j < 3; j++ {
+			_, err := vu.RunOnce(context.Background())
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestVULastIterationSleep(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		import { sleep } from "k6";
+		export default function() { sleep(0.05); sleep(0.05); }
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = vu.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, vu.LastIterationSleep() >= 100*time.Millisecond, "wrong sleep: %s", vu.LastIterationSleep())
+}
+
+func TestVUSetScenario(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		export let notAFunction = 1;
+		export function admin() { __VU_STATE__.ran = "admin"; }
+		export default function() { __VU_STATE__.ran = "default"; }
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.EqualError(t, vu.SetScenario("admin", "nope"), "nope is not an exported function")
+	assert.EqualError(t, vu.SetScenario("admin", "notAFunction"), "notAFunction is not an exported function")
+
+	assert.NoError(t, vu.SetScenario("admin", "admin"))
+	_, err = vu.RunOnce(context.Background())
+	assert.NoError(t, err)
+	ran, err := common.RunString(vu.Runtime, `__VU_STATE__.ran`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "admin", ran.Export())
+	}
+}
+
+func TestVUIterationData(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		export default function() {
+			if (__DATA.account != "acc-" + __VU + "-" + __ITER) { throw new Error("wrong account: " + __DATA.account); }
+			__VU_STATE__.seq = (__VU_STATE__.seq || []).concat([__DATA.seq]);
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var seq int64
+	r.IterationData = func(vuID, iteration int64) (interface{}, error) {
+		if iteration == 2 {
+			return nil, errors.New("out of accounts")
+		}
+		return map[string]interface{}{
+			"account": fmt.Sprintf("acc-%d-%d", vuID, iteration),
+			"seq":     atomic.AddInt64(&seq, 1),
+		}, nil
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, vu.Reconfigure(3))
+	for i := 0; i < 2; i++ {
+		_, err = vu.RunOnce(context.Background())
+		assert.NoError(t, err)
+	}
+	_, err = vu.RunOnce(context.Background())
+	assert.EqualError(t, err, "iteration data: out of accounts")
+
+	v, err := common.RunString(vu.Runtime, `__VU_STATE__.seq.join(",")`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1,2", v.Export())
+	}
+}
+
+func TestVUSourceFrame(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/lib.js", []byte(`export function fail() {
+		throw new Error("nope");
+	}`), 0644))
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		import { fail } from "/lib.js";
+		export default function() { fail(); }
+		`),
+	}, fs)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.NewVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = vu.RunOnce(context.Background())
+	if assert.Error(t, err) {
+		lines := strings.Split(err.Error(), "\n")
+		assert.Regexp(t, `^Error: nope at /lib.js:2:\d+\(\d+\)$`, lines[0])
+		assert.Contains(t, err.Error(), "\n> 2 | ")
+		assert.Contains(t, err.Error(), `throw new Error("nope");`)
+
+		// The logged trace includes the caller in the script, followed by the frame.
+		s := err.(fmt.Stringer).String()
+		assert.Contains(t, s, "/script.js:3:")
+		assert.Contains(t, s, "\n> 2 | ")
+	}
+}
+
+func TestVUSourceFrameTypeScript(t *testing.T) {
+	// Stripping the types moves the throw left; its location is mapped back to the .ts source.
+	failLine := `export function fail(reason: string, code: number): void { throw new Error(reason + code); }`
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/lib.ts", []byte("// Fails.\n"+failLine), 0644))
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		import { fail } from "/lib.ts";
+		export default function() { fail("nope", 1); }
+		`),
+	}, fs)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.NewVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = vu.RunOnce(context.Background())
+	if assert.Error(t, err) {
+		col := strings.Index(failLine, "new Error") + 1
+		lines := strings.Split(err.Error(), "\n")
+		assert.Regexp(t, fmt.Sprintf(`^Error: nope1 at /lib.ts:2:%d\(\d+\)$`, col), lines[0])
+		assert.Contains(t, err.Error(), "\n> 2 | "+failLine+"\n    | "+strings.Repeat(" ", col-1)+"^")
+	}
+}
+
 func TestVURunSamples(t *testing.T) {
 	r, err := New(&lib.SourceData{
 		Filename: "/script.js",
@@ -241,3 +508,771 @@ func TestVUIntegrationMetrics(t *testing.T) {
 		assert.Equal(t, stats.Trend, samples[0].Metric.Type)
 	}
 }
+
+func TestVUCookieMode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/set" {
+			http.SetCookie(w, &http.Cookie{Name: "key", Value: "value"})
+			return
+		}
+		if c, err := r.Cookie("key"); err == nil {
+			_, _ = fmt.Fprint(w, c.Value)
+		}
+	}))
+	defer srv.Close()
+
+	testdata := map[string][]string{
+		"":                     {"", "value"},
+		lib.CookieModePersist:  {"", "value"},
+		lib.CookieModeReset:    {"", ""},
+		lib.CookieModeDisabled: {"", ""},
+	}
+	for mode, expected := range testdata {
+		t.Run(mode, func(t *testing.T) {
+			r, err := New(&lib.SourceData{
+				Filename: "/script.js",
+				Data: []byte(fmt.Sprintf(`
+				import http from "k6/http";
+				export default function() {
+					let res = http.get("%[1]s/get");
+					if (res.body != expected) { throw new Error("wrong cookie: " + res.body); }
+					http.get("%[1]s/set");
+				}
+				`, srv.URL)),
+			}, afero.NewMemMapFs())
+			if !assert.NoError(t, err) {
+				return
+			}
+			if mode != "" {
+				r.ApplyOptions(lib.Options{CookieMode: null.StringFrom(mode)})
+			}
+
+			vu, err := r.newVU()
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			for i, exp := range expected {
+				vu.Runtime.Set("expected", exp)
+				_, err := vu.RunOnce(context.Background())
+				assert.NoError(t, err, "iteration %d", i)
+			}
+
+			t.Run("Reconfigure", func(t *testing.T) {
+				assert.NoError(t, vu.Reconfigure(1))
+				vu.Runtime.Set("expected", "")
+				_, err := vu.RunOnce(context.Background())
+				assert.NoError(t, err)
+			})
+		})
+	}
+}
+
+// Injects a trace ID into every request, and records the status each one got.
+type traceHook struct {
+	mutex    sync.Mutex
+	next     int
+	statuses map[string]int
+	err      error
+}
+
+func (h *traceHook) BeforeRequest(req *http.Request) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.next++
+	req.Header.Set("X-Trace-Id", fmt.Sprintf("trace-%d", h.next))
+	return h.err
+}
+
+func (h *traceHook) AfterResponse(req *http.Request, res *http.Response, err error) {
+	if err != nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.statuses[req.Header.Get("X-Trace-Id")] = res.StatusCode
+}
+
+func TestRunnerRequestHooks(t *testing.T) {
+	var seenMutex sync.Mutex
+	seen := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenMutex.Lock()
+		seen[r.Header.Get("X-Trace-Id")] = r.URL.Path
+		seenMutex.Unlock()
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/target", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		import http from "k6/http";
+		export default function() {
+			http.get(srvURL + "/redirect");
+			http.batch([srvURL + "/a", srvURL + "/b"]);
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+	hook := &traceHook{statuses: map[string]int{}}
+	r.AddRequestHook(hook)
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	vu.Runtime.Set("srvURL", srv.URL)
+
+	t.Run("Trace", func(t *testing.T) {
+		_, err := vu.RunOnce(context.Background())
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		// Every hop and batched request gets a trace ID of its own.
+		paths := make([]string, 0, len(seen))
+		for id, path := range seen {
+			assert.NotEmpty(t, id)
+			paths = append(paths, path)
+			assert.Contains(t, hook.statuses, id)
+		}
+		sort.Strings(paths)
+		assert.Equal(t, []string{"/a", "/b", "/redirect", "/target"}, paths)
+		assert.Equal(t, 4, len(hook.statuses))
+	})
+	t.Run("Error", func(t *testing.T) {
+		hook.err = errors.New("no token")
+		defer func() { hook.err = nil }()
+		_, err := vu.RunOnce(context.Background())
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "no token")
+		}
+	})
+}
+
+func TestVUTLSResumption(t *testing.T) {
+	var conns int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns++
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	testdata := map[string]struct {
+		opts    lib.Options
+		resumed bool
+		conns   int
+	}{
+		"default":           {lib.Options{}, false, 1},
+		"NoConnectionReuse": {lib.Options{NoConnectionReuse: null.BoolFrom(true)}, true, 2},
+		"NoTLSResumption": {lib.Options{
+			NoConnectionReuse: null.BoolFrom(true),
+			NoTLSResumption:   null.BoolFrom(true),
+		}, false, 2},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			r, err := New(&lib.SourceData{
+				Filename: "/script.js",
+				Data: []byte(fmt.Sprintf(`
+				import http from "k6/http";
+				export default function() {
+					let res = http.get("%[1]s");
+					if (res.tls.resumed) { throw new Error("first connection resumed"); }
+					res = http.get("%[1]s");
+					if (res.tls.resumed != expected) { throw new Error("wrong resumed: " + res.tls.resumed); }
+				}
+				`, srv.URL)),
+			}, afero.NewMemMapFs())
+			if !assert.NoError(t, err) {
+				return
+			}
+			r.ApplyOptions(lib.Options{InsecureSkipTLSVerify: null.BoolFrom(true)}.Apply(data.opts))
+
+			vu, err := r.newVU()
+			if !assert.NoError(t, err) {
+				return
+			}
+			conns = 0
+			vu.Runtime.Set("expected", data.resumed)
+			_, err = vu.RunOnce(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, data.conns, conns)
+		})
+	}
+}
+
+func TestVUTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(fmt.Sprintf(`
+		import http from "k6/http";
+		export default function() {
+			let res = http.get("%s");
+			if (res.tls.version != "tls1.2") { throw new Error("wrong version: " + res.tls.version); }
+			if (res.tls.cipher_suite != "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384") {
+				throw new Error("wrong cipher suite: " + res.tls.cipher_suite);
+			}
+		}
+		`, srv.URL)),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+	r.ApplyOptions(lib.Options{
+		InsecureSkipTLSVerify: null.BoolFrom(true),
+		TLSMinVersion:         null.StringFrom("tls1.2"),
+		TLSMaxVersion:         null.StringFrom("tls1.2"),
+		TLSCipherSuites:       []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+	})
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = vu.RunOnce(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestVUHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{NextProtos: []string{"h2"}}
+	if !assert.NoError(t, http2.ConfigureServer(srv.Config, nil)) {
+		return
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	testdata := map[string]struct {
+		opts  lib.Options
+		proto string
+	}{
+		"default": {lib.Options{}, "HTTP/2.0"},
+		"NoHTTP2": {lib.Options{NoHTTP2: null.BoolFrom(true)}, "HTTP/1.1"},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			r, err := New(&lib.SourceData{
+				Filename: "/script.js",
+				Data: []byte(fmt.Sprintf(`
+				import http from "k6/http";
+				export default function() {
+					let res = http.get("%s");
+					if (res.proto != expected) { throw new Error("wrong proto: " + res.proto); }
+				}
+				`, srv.URL)),
+			}, afero.NewMemMapFs())
+			if !assert.NoError(t, err) {
+				return
+			}
+			r.ApplyOptions(lib.Options{InsecureSkipTLSVerify: null.BoolFrom(true)}.Apply(data.opts))
+
+			vu, err := r.newVU()
+			if !assert.NoError(t, err) {
+				return
+			}
+			vu.Runtime.Set("expected", data.proto)
+			samples, err := vu.RunOnce(context.Background())
+			assert.NoError(t, err)
+			for _, s := range samples {
+				if s.Metric == metrics.HTTPReqs {
+					assert.Equal(t, data.proto, s.Tags["proto"])
+				}
+			}
+		})
+	}
+}
+
+func TestVUTLSAuth(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "k6 test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if !assert.NoError(t, err) {
+		return
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if !assert.NoError(t, err) {
+		return
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	// Responds with the common name of the client's certificate.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/client.crt", certPEM, 0644))
+	assert.NoError(t, afero.WriteFile(fs, "/client.key", keyPEM, 0644))
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(fmt.Sprintf(`
+		import http from "k6/http";
+		export let options = {
+			tlsAuth: [{ domains: ["127.0.0.1"], cert: open("/client.crt"), key: open("/client.key") }],
+		};
+		export default function() {
+			let res = http.get("%[1]s");
+			if (res.body != "k6 test client") { throw new Error("wrong body: " + res.body); }
+			try {
+				http.get("%[2]s");
+				throw new Error("certificate presented to localhost");
+			} catch (e) {
+				if (e.message.indexOf("GET %[2]s: ") != 0) { throw e; }
+			}
+		}
+		`, srv.URL, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))),
+	}, fs)
+	if !assert.NoError(t, err) {
+		return
+	}
+	r.ApplyOptions(lib.Options{InsecureSkipTLSVerify: null.BoolFrom(true)})
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = vu.RunOnce(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestVUConnectionLifetime(t *testing.T) {
+	var conns int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns++
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(fmt.Sprintf(`
+		import http from "k6/http";
+		export default function() {
+			for (let i = 0; i < 5; i++) { http.get("%s"); }
+		}
+		`, srv.URL)),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+	r.ApplyOptions(lib.Options{ConnectionMaxRequests: null.IntFrom(2)})
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	samples, err := vu.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, conns)
+
+	var reconnects float64
+	for _, s := range samples {
+		if s.Metric == metrics.HTTPReconnects {
+			reconnects += s.Value
+		}
+	}
+	assert.Equal(t, float64(2), reconnects)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return fn(req) }
+
+func TestVUTransport(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		import http from "k6/http";
+		export default function() {
+			let res = http.get("http://mocked.example.com/path");
+			if (res.status != 418) { throw new Error("wrong status: " + res.status); }
+			if (res.body != "mocked /path") { throw new Error("wrong body: " + res.body); }
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var requests int
+	r.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return &http.Response{
+			StatusCode: 418,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader("mocked " + req.URL.Path)),
+			Request:    req,
+		}, nil
+	})
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = vu.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests)
+}
+
+func TestNewDefaultHeaders(t *testing.T) {
+	testdata := map[string]struct {
+		opts lib.Options
+		ua   []string
+	}{
+		"Default":   {lib.Options{}, []string{lib.DefaultUserAgent}},
+		"Null":      {lib.Options{UserAgent: null.NewString("", false)}, []string{lib.DefaultUserAgent}},
+		"Set":       {lib.Options{UserAgent: null.StringFrom("custom")}, []string{"custom"}},
+		"Empty":     {lib.Options{UserAgent: null.StringFrom("")}, []string{""}},
+		"Headers":   {lib.Options{Headers: map[string]string{"user-agent": "custom"}}, []string{"custom"}},
+		"Overrides": {lib.Options{UserAgent: null.StringFrom("a"), Headers: map[string]string{"User-Agent": "b"}}, []string{"a"}},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, data.ua, newDefaultHeaders(data.opts)["User-Agent"])
+		})
+	}
+}
+
+func TestVUStore(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		import store from "k6/store";
+		export default function() {
+			let n = store.get("n") || 0;
+			if (n != __ITER) { throw new Error("wrong count: " + n + " != " + __ITER); }
+			store.set("n", n + 1);
+			store.set("obj", { a: [1, 2], b: "x" });
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 3; i++ {
+		_, err = vu.RunOnce(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, map[string]json.RawMessage{
+		"n":   json.RawMessage(`3`),
+		"obj": json.RawMessage(`{"a":[1,2],"b":"x"}`),
+	}, vu.Store.Snapshot())
+
+	t.Run("Reconfigure", func(t *testing.T) {
+		assert.NoError(t, vu.Reconfigure(1))
+		assert.Empty(t, vu.Store.Snapshot())
+		_, err := vu.RunOnce(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("Isolation", func(t *testing.T) {
+		// Another VU starts out with a store of its own, and doesn't see this one's.
+		vu2, err := r.newVU()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Empty(t, vu2.Store.Snapshot())
+		_, err = vu2.RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, json.RawMessage(`1`), vu2.Store.Snapshot()["n"])
+		assert.Equal(t, json.RawMessage(`1`), vu.Store.Snapshot()["n"])
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		r.ApplyOptions(lib.Options{VUStoreSize: null.IntFrom(10)})
+		assert.NoError(t, vu.Reconfigure(2))
+		_, err := vu.RunOnce(context.Background())
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "store: size limit of 10 bytes exceeded")
+		}
+	})
+}
+
+func TestVUReplay(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		export default function() {
+			let n = Math.random();
+			if (__ITER % 2 == 1) { throw new Error("failed: " + __VU + " " + __ITER + " " + n); }
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, vu.Reconfigure(57))
+
+	_, err = vu.RunOnce(context.Background())
+	assert.NoError(t, err)
+	_, err = vu.RunOnce(context.Background())
+	ierr, ok := err.(*lib.IterationError)
+	if !assert.True(t, ok, "not an IterationError: %#v", err) {
+		return
+	}
+	assert.Equal(t, int64(57), ierr.VU)
+	assert.Equal(t, int64(1), ierr.Iteration)
+	assert.Equal(t, common.IterationSeed(r.Seed, 57, 1), ierr.Seed)
+	assert.Contains(t, err.Error(), "failed: 57 1 ")
+
+	t.Run("Replay", func(t *testing.T) {
+		_, rerr := r.Replay(context.Background(), ierr.VU, ierr.Iteration, ierr.Seed, false)
+		assert.EqualError(t, rerr, err.Error())
+	})
+
+	t.Run("Seed", func(t *testing.T) {
+		r.ApplyOptions(lib.Options{Seed: null.IntFrom(12345)})
+		assert.Equal(t, int64(12345), r.Seed)
+
+		var errs []string
+		for i := 0; i < 2; i++ {
+			vu, err := r.newVU()
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.NoError(t, vu.Reconfigure(1))
+			_, _ = vu.RunOnce(context.Background())
+			_, err = vu.RunOnce(context.Background())
+			if assert.Error(t, err) {
+				errs = append(errs, err.Error())
+			}
+		}
+		if assert.Len(t, errs, 2) {
+			assert.Equal(t, errs[0], errs[1])
+		}
+	})
+}
+
+func TestRunnerDryRun(t *testing.T) {
+	testdata := map[string]string{
+		`check(1, { "ok": function(v) { return v === 1; } })`:                                         "",
+		`check(1, { "ok": function(v) { return v === 1; }, "bad": function(v) { return v === 2; } })`: "1 of 2 checks failed",
+		`throw new Error("oops")`: "Error: oops",
+	}
+	for body, msg := range testdata {
+		t.Run(body, func(t *testing.T) {
+			r, err := New(&lib.SourceData{
+				Filename: "/script.js",
+				Data: []byte(`
+				import { check } from "k6";
+				export default function() { ` + body + ` }
+				`),
+			}, afero.NewMemMapFs())
+			if !assert.NoError(t, err) {
+				return
+			}
+			r.Logger, _ = logtest.NewNullLogger()
+
+			samples, err := r.DryRun(context.Background())
+			if msg == "" {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, samples)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), msg)
+			}
+		})
+	}
+}
+
+func TestVUIsolateGlobals(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		let counter = 0;
+		export default function() {
+			counter++;
+			__VU_STATE__.counter = (__VU_STATE__.counter || 0) + 1;
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	testdata := map[string]struct {
+		isolate bool
+		counter func(iter int64) int64
+	}{
+		"default":  {false, func(iter int64) int64 { return iter + 1 }},
+		"isolated": {true, func(iter int64) int64 { return 1 }},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			r.ApplyOptions(lib.Options{IsolateGlobals: null.BoolFrom(data.isolate)})
+			vu, err := r.newVU()
+			if !assert.NoError(t, err) {
+				return
+			}
+			for i := int64(0); i < 3; i++ {
+				_, err := vu.RunOnce(context.Background())
+				assert.NoError(t, err)
+				assert.Equal(t, data.counter(i), vu.Runtime.Get("counter").ToInteger())
+
+				// __VU_STATE__ always persists.
+				state := vu.Runtime.Get("__VU_STATE__").ToObject(vu.Runtime)
+				assert.Equal(t, i+1, state.Get("counter").ToInteger())
+			}
+		})
+	}
+}
+
+func TestVUMaxIterationDuration(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		import { sleep } from "k6";
+		export default function() {
+			switch (__ITER) {
+			case 0: while (true) {}
+			case 1: sleep(10);
+			}
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+	r.ApplyOptions(lib.Options{MaxIterationDuration: null.StringFrom("100ms")})
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("Loop", func(t *testing.T) {
+		_, err := vu.RunOnce(context.Background())
+		assert.True(t, lib.IsIterationTimeout(err), "not a timeout: %v", err)
+	})
+	t.Run("Sleep", func(t *testing.T) {
+		startTime := time.Now()
+		_, err := vu.RunOnce(context.Background())
+		assert.True(t, lib.IsIterationTimeout(err), "not a timeout: %v", err)
+		assert.True(t, time.Since(startTime) < 1*time.Second, "iteration wasn't aborted in time")
+	})
+	t.Run("Next", func(t *testing.T) {
+		// The VM must still be usable, without any leftover interrupts.
+		for i := 0; i < 2; i++ {
+			_, err := vu.RunOnce(context.Background())
+			assert.NoError(t, err)
+		}
+	})
+}
+
+func TestVUMaxHeapSize(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		export default function() {
+			if (__ITER == 0) {
+				let garbage = [];
+				while (true) { garbage.push({}); }
+			}
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("Exceeded", func(t *testing.T) {
+		// Any heap is larger than a byte, so the first check aborts the iteration.
+		r.ApplyOptions(lib.Options{MaxHeapSize: null.IntFrom(1)})
+		startTime := time.Now()
+		_, err := vu.RunOnce(context.Background())
+		if assert.IsType(t, &lib.IterationError{}, err) {
+			herr, ok := err.(*lib.IterationError).Err.(HeapLimitError)
+			if assert.True(t, ok, "not a heap limit error: %v", err) {
+				assert.Equal(t, uint64(1), herr.Limit)
+				assert.Contains(t, herr.Error(), "exceeds maxHeapSize")
+			}
+		}
+		assert.False(t, lib.IsIterationTimeout(err), "reported as a timeout")
+		assert.True(t, time.Since(startTime) < 1*time.Second, "iteration wasn't aborted in time")
+	})
+	t.Run("Next", func(t *testing.T) {
+		r.ApplyOptions(lib.Options{MaxHeapSize: null.IntFrom(0)})
+		for i := 0; i < 2; i++ {
+			_, err := vu.RunOnce(context.Background())
+			assert.NoError(t, err)
+		}
+	})
+}
+
+func TestVUInterrupt(t *testing.T) {
+	r, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		export default function() {
+			if (__ITER == 0) { while (true) {} }
+		}
+		`),
+	}, afero.NewMemMapFs())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	vu, err := r.newVU()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		startTime := time.Now()
+		_, err := vu.RunOnce(ctx)
+		assert.Error(t, err)
+		assert.False(t, lib.IsIterationTimeout(err), "cancellation reported as a timeout")
+		assert.True(t, time.Since(startTime) < 1*time.Second, "iteration wasn't aborted in time")
+	})
+	t.Run("Next", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			_, err := vu.RunOnce(context.Background())
+			assert.NoError(t, err)
+		}
+	})
+}
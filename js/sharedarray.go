@@ -0,0 +1,125 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+// Data of the SharedArrays made by a script, by name. This is shared by all VUs' init contexts, so
+// an array's data is only built and held in memory once, however many VUs there are.
+type sharedArrays struct {
+	mutex  sync.Mutex
+	arrays map[string]*sharedArrayData
+}
+
+func newSharedArrays() *sharedArrays {
+	return &sharedArrays{arrays: make(map[string]*sharedArrayData)}
+}
+
+func (s *sharedArrays) get(name string) (*sharedArrayData, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.arrays[name]
+	return data, ok
+}
+
+// Stores an array's data, unless another VU got there first; returns whichever was stored.
+func (s *sharedArrays) set(name string, data *sharedArrayData) *sharedArrayData {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if existing, ok := s.arrays[name]; ok {
+		return existing
+	}
+	s.arrays[name] = data
+	return data
+}
+
+// The items of a SharedArray, each JSON-encoded; they're decoded whenever they're accessed, so no
+// VU can change what the others see.
+type sharedArrayData struct {
+	items [][]byte
+}
+
+func newSharedArrayData(name string, v goja.Value) (*sharedArrayData, error) {
+	items, ok := v.Export().([]interface{})
+	if !ok {
+		return nil, errors.Errorf("SharedArray %s: function must return an array", name)
+	}
+	data := &sharedArrayData{items: make([][]byte, len(items))}
+	for i, item := range items {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "SharedArray %s: item %d", name, i)
+		}
+		data.items[i] = b
+	}
+	return data, nil
+}
+
+// A SharedArray is a read-only array whose data is shared by all VUs, rather than each having its
+// own copy; eg. for large data files, which would otherwise be held in memory once per VU. Items
+// are copied into the VU's runtime whenever they're accessed, so changes to them aren't seen by
+// other VUs, or even by later calls.
+//
+// It isn't a JS array, so items can only be read with get() and slice(): arr[i] is undefined, and
+// for...of doesn't work. Loop up to length instead, or iterate over a slice() of it, which is a
+// plain array of copies.
+type SharedArray struct {
+	Length int `js:"length"`
+
+	data *sharedArrayData
+	rt   *goja.Runtime
+}
+
+// Returns a copy of the item at an index, or undefined if it's out of range.
+func (a *SharedArray) Get(i int) goja.Value {
+	if i < 0 || i >= len(a.data.items) {
+		return goja.Undefined()
+	}
+	var v interface{}
+	if err := json.Unmarshal(a.data.items[i], &v); err != nil {
+		common.Throw(a.rt, err)
+	}
+	return a.rt.ToValue(v)
+}
+
+// Returns copies of the items from start up to, but not including, end; both are optional, and
+// clamped to the array's bounds.
+func (a *SharedArray) Slice(args ...int) []goja.Value {
+	start, end := 0, len(a.data.items)
+	if len(args) > 0 && args[0] > start {
+		start = args[0]
+	}
+	if len(args) > 1 && args[1] < end {
+		end = args[1]
+	}
+	items := []goja.Value{}
+	for i := start; i < end; i++ {
+		items = append(items, a.Get(i))
+	}
+	return items
+}
@@ -0,0 +1,96 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"testing"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedArray(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/users.json", []byte(`[
+		{"name": "alice", "tags": ["a"]},
+		{"name": "bob", "tags": []},
+		{"name": "carol", "tags": ["b", "c"]}
+	]`), 0644))
+	b, err := NewBundle(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			let calls = 0;
+			export let users = new SharedArray("users", function() {
+				calls++;
+				return JSON.parse(open("/users.json"));
+			});
+			export let again = new SharedArray("users", function() { throw new Error("called again"); });
+			export let fnCalls = calls;
+			export default function() {}
+		`),
+	}, fs)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		bi, err := b.Instantiate()
+		if !assert.NoError(t, err) {
+			return
+		}
+		v, err := bi.Runtime.RunString(`
+			if (exports.fnCalls !== 0) { throw new Error("function called by a VU"); }
+			var users = exports.users;
+			if (users.length !== 3) { throw new Error("wrong length: " + users.length); }
+			if (exports.again.length !== 3) { throw new Error("wrong length: " + exports.again.length); }
+			if (users.get(3) !== undefined) { throw new Error("out of range item: " + users.get(3)); }
+			if (users[0] !== undefined) { throw new Error("indexable: " + users[0]); }
+
+			// Items are copies, so changing one changes nothing for anyone else.
+			users.get(0).name = "mallory";
+			var first = users.slice(0, 2);
+			[first.length, first[0].name, first[1].name, users.get(2).tags.join("+")].join(",");
+		`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "2,alice,bob,b+c", v.String())
+		}
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		testdata := map[string]string{
+			`new SharedArray("", function() { return []; })`:       "GoError: SharedArray needs a name",
+			`new SharedArray("obj", function() { return {}; })`:    "GoError: SharedArray obj: function must return an array",
+			`new SharedArray("err", function() { throw "oops"; })`: "oops",
+		}
+		for src, msg := range testdata {
+			t.Run(src, func(t *testing.T) {
+				_, err := NewBundle(&lib.SourceData{
+					Filename: "/script.js",
+					Data:     []byte(src + "; export default function() {}"),
+				}, afero.NewMemMapFs())
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), msg)
+				}
+			})
+		}
+	})
+}
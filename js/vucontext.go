@@ -20,14 +20,46 @@
 
 package js
 
+import (
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+)
+
+func init() {
+	common.RegisterFeature("timers")
+}
+
 // Provides APIs and state for use in a VU context.
 type VUContext struct {
 	// Console Object.
 	Console *Console `js:"console"`
+
+	// Runs timers set with setTimeout() and setInterval() at the end of each iteration.
+	loop *EventLoop
 }
 
 func NewVUContext() *VUContext {
 	return &VUContext{
 		Console: NewConsole(),
+		loop:    NewEventLoop(),
 	}
 }
+
+// Calls fn with args after delay milliseconds, once the default function has returned.
+func (c *VUContext) SetTimeout(fn goja.Callable, delay float64, args ...goja.Value) int64 {
+	return c.loop.Add(fn, timerDelay(delay), false, args)
+}
+
+// Calls fn with args every delay milliseconds, until it's cleared; the iteration doesn't end
+// until then.
+func (c *VUContext) SetInterval(fn goja.Callable, delay float64, args ...goja.Value) int64 {
+	return c.loop.Add(fn, timerDelay(delay), true, args)
+}
+
+func (c *VUContext) ClearTimeout(id int64) {
+	c.loop.Clear(id)
+}
+
+func (c *VUContext) ClearInterval(id int64) {
+	c.loop.Clear(id)
+}
@@ -0,0 +1,84 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How often checkpoints are written, unless Options.CheckpointInterval says otherwise.
+const DefaultCheckpointInterval = 10 * time.Second
+
+// Writes the engine's summary (see Summary) to a file as JSON. The file is replaced atomically, so
+// anyone reading it, eg. after k6 was killed, sees either the previous checkpoint or this one.
+// Only aggregates are snapshotted, so this holds up sample processing very briefly.
+func (e *Engine) WriteCheckpoint(filename string, interrupted bool) error {
+	summary := e.Summary()
+	summary.State.Interrupted = interrupted
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+func (e *Engine) runCheckpoints(ctx context.Context) {
+	interval := DefaultCheckpointInterval
+	if d, _ := time.ParseDuration(e.Options.CheckpointInterval.String); d > 0 {
+		interval = d
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.WriteCheckpoint(e.Options.Checkpoint.String, false); err != nil {
+				e.Logger.WithError(err).Error("Couldn't write checkpoint")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
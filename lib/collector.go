@@ -22,11 +22,14 @@ package lib
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/loadimpact/k6/stats"
 )
 
-// A Collector abstracts away the details of a storage backend from the application.
+// A Collector abstracts away the details of a storage backend from the application. It's the
+// older interface for outputs, which manage their own goroutine; wrap one with CollectorOutput()
+// to use it as an Output.
 type Collector interface {
 	// Init is called between the collector's creation and the call to Run(), right after the k6
 	// banner has been printed to stdout.
@@ -40,3 +43,48 @@ type Collector interface {
 	// the context for Run() is valid, but should defer as much work as possible to Run().
 	Collect(samples []stats.Sample)
 }
+
+// Adapts a Collector to the Output interface: Start() calls Init() and runs it, and Stop() waits
+// for it to commit its samples and return. It commits samples on its own schedule, so Flush()
+// does nothing.
+func CollectorOutput(c Collector) Output {
+	return &collectorOutput{collector: c}
+}
+
+type collectorOutput struct {
+	collector Collector
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func (o *collectorOutput) Start() error {
+	o.collector.Init()
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.done = make(chan struct{})
+	go func() {
+		defer close(o.done)
+		o.collector.Run(ctx)
+	}()
+	return nil
+}
+
+func (o *collectorOutput) AddSamples(samples []stats.Sample) {
+	o.collector.Collect(samples)
+}
+
+func (o *collectorOutput) Flush() error {
+	return nil
+}
+
+func (o *collectorOutput) Stop() error {
+	if o.cancel != nil {
+		o.cancel()
+		<-o.done
+	}
+	return nil
+}
+
+func (o *collectorOutput) String() string {
+	return fmt.Sprint(o.collector)
+}
@@ -0,0 +1,68 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCollector struct {
+	lock    sync.Mutex
+	inited  bool
+	samples []stats.Sample
+	stopped bool
+}
+
+func (c *testCollector) Init() {
+	c.inited = true
+}
+
+func (c *testCollector) Run(ctx context.Context) {
+	<-ctx.Done()
+	c.lock.Lock()
+	c.stopped = true
+	c.lock.Unlock()
+}
+
+func (c *testCollector) Collect(samples []stats.Sample) {
+	c.lock.Lock()
+	c.samples = append(c.samples, samples...)
+	c.lock.Unlock()
+}
+
+func TestCollectorOutput(t *testing.T) {
+	c := &testCollector{}
+	out := CollectorOutput(c)
+	assert.NoError(t, out.Start())
+	assert.True(t, c.inited)
+
+	samples := []stats.Sample{{Metric: stats.New("my_metric", stats.Counter), Value: 1}}
+	out.AddSamples(samples)
+	assert.NoError(t, out.Flush())
+	assert.NoError(t, out.Stop())
+	assert.True(t, c.stopped)
+	assert.Equal(t, samples, c.samples)
+}
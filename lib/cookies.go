@@ -25,12 +25,14 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 )
 
 // CookieJar implements a simplified version of net/http/cookiejar, that most notably can be
 // cleared without reinstancing the whole thing.
 type CookieJar struct {
 	cookies map[string][]*http.Cookie
+	lock    sync.Mutex
 }
 
 func NewCookieJar() *CookieJar {
@@ -43,15 +45,21 @@ func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
 	if u.Scheme != "http" && u.Scheme != "https" {
 		return
 	}
+	j.lock.Lock()
 	j.cookies[cookieHostKey(u.Host)] = cookies
+	j.lock.Unlock()
 }
 
 func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.lock.Lock()
+	defer j.lock.Unlock()
 	return j.cookies[cookieHostKey(u.Host)]
 }
 
 func (j *CookieJar) Clear() {
+	j.lock.Lock()
 	j.cookies = make(map[string][]*http.Cookie)
+	j.lock.Unlock()
 }
 
 func cookieHostKey(host string) string {
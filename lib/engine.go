@@ -23,6 +23,8 @@ package lib
 import (
 	"context"
 	"fmt"
+	"net"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -44,28 +46,49 @@ const (
 
 	BackoffAmount = 50 * time.Millisecond
 	BackoffMax    = 10 * time.Second
+
+	// Default number of iterations' worth of samples that may be buffered before collection.
+	DefaultSamplesBufferSize = 1000
 )
 
 type vuEntry struct {
-	VU     VU
+	VU VU
+
+	// Stops the VU once it's done with its current iteration.
 	Cancel context.CancelFunc
 
-	Samples    []stats.Sample
+	// Closed when the VU's goroutine exits; nil if it's never been started.
+	done chan struct{}
+
 	Iterations int64
-	lock       sync.Mutex
+
+	// The scenario the VU belongs to, if any; see Options.Scenarios.
+	Scenario string
+
+	// Consecutive iterations aborted for running too long; see Options.MaxIterationTimeouts.
+	Timeouts int64
 }
 
 // The Engine is the beating heart of K6.
 type Engine struct {
-	Runner    Runner
-	Options   Options
-	Collector Collector
-	Logger    *log.Logger
+	Runner  Runner
+	Options Options
+	Logger  *log.Logger
+
+	// Samples are passed on to all of these, after being aggregated; see Output. They're started
+	// and stopped by Run().
+	Outputs []Output
+
+	// Lifecycle callbacks for embedders; must be set before the test is started.
+	Hooks Hooks
 
 	Stages      []Stage
 	Metrics     map[string]*stats.Metric
 	MetricsLock sync.RWMutex
 
+	// HTTP statistics broken down by the "host" tag; also guarded by MetricsLock.
+	Hosts map[string]*HostStats
+
 	// Assigned to metrics upon first received sample.
 	thresholds map[string]stats.Thresholds
 	submetrics map[string][]stats.Submetric
@@ -85,9 +108,28 @@ type Engine struct {
 
 	nextVUID int64
 
+	// Thins out samples passed on to the collector; nil to pass everything.
+	outputFilter *OutputFilter
+
+	// Caps the number of distinct values per tag; nil for no limit.
+	tagLimiter *TagLimiter
+
+	// The share of the workload this instance runs; VU counts and IDs are adjusted to match.
+	segment ExecutionSegment
+
+	// Samples from before warmupEnd are left out of aggregation; see Options.DiscardFirst. Both
+	// are guarded by MetricsLock.
+	discardFirst        time.Duration
+	warmupEnd           time.Time
+	numDiscardedSamples int64
+
+	// Samples are pushed here by VUs, one batch per iteration, and drained by the collection loop.
+	samples chan []stats.Sample
+
 	// Atomic counters.
-	numIterations int64
-	numErrors     int64
+	numIterations     int64
+	numErrors         int64
+	numDroppedSamples int64
 
 	thresholdsTainted bool
 
@@ -105,13 +147,54 @@ func NewEngine(r Runner, o Options) (*Engine, error) {
 		Logger:  log.StandardLogger(),
 
 		Metrics: make(map[string]*stats.Metric),
+		Hosts:   make(map[string]*HostStats),
 
 		vuStop: make(chan interface{}),
 	}
 	e.clearSubcontext()
 
+	samplesBufferSize := int64(DefaultSamplesBufferSize)
+	if o.SamplesBufferSize.Valid {
+		if o.SamplesBufferSize.Int64 < 0 {
+			return nil, errors.New("options.samplesBufferSize: can't be negative")
+		}
+		samplesBufferSize = o.SamplesBufferSize.Int64
+	}
+	e.samples = make(chan []stats.Sample, samplesBufferSize)
+
+	outputFilter, err := NewOutputFilter(o)
+	if err != nil {
+		return nil, err
+	}
+	e.outputFilter = outputFilter
+
+	maxTagValues := int64(DefaultMaxTagValues)
+	if o.MaxTagValues.Valid {
+		if o.MaxTagValues.Int64 < 0 {
+			return nil, errors.New("options.maxTagValues: can't be negative")
+		}
+		maxTagValues = o.MaxTagValues.Int64
+	}
+	if maxTagValues > 0 {
+		e.tagLimiter = NewTagLimiter(int(maxTagValues), e.Logger)
+	}
+
+	if o.ExecutionSegment.Valid {
+		segment, err := ParseExecutionSegment(o.ExecutionSegment.String)
+		if err != nil {
+			return nil, errors.Wrap(err, "options.executionSegment")
+		}
+		e.segment = segment
+	}
+
 	if o.Stages != nil {
-		e.Stages = o.Stages
+		e.Stages = make([]Stage, len(o.Stages))
+		for i, stage := range o.Stages {
+			if stage.Target.Valid {
+				stage.Target = null.IntFrom(e.segment.Scale(stage.Target.Int64))
+			}
+			e.Stages[i] = stage
+		}
 	} else if o.Duration.Valid {
 		d, err := time.ParseDuration(o.Duration.String)
 		if err != nil {
@@ -121,13 +204,195 @@ func NewEngine(r Runner, o Options) (*Engine, error) {
 	} else {
 		e.Stages = []Stage{{Duration: 0}}
 	}
-	if o.VUsMax.Valid {
-		if err := e.SetVUsMax(o.VUsMax.Int64); err != nil {
+	if o.MaxIterationDuration.Valid && o.MaxIterationDuration.String != "" {
+		if _, err := time.ParseDuration(o.MaxIterationDuration.String); err != nil {
+			return nil, errors.Wrap(err, "options.maxIterationDuration")
+		}
+	}
+	if o.MaxHeapSize.Int64 < 0 {
+		return nil, errors.New("options.maxHeapSize: can't be negative")
+	}
+	if o.DiscardFirst.Valid && o.DiscardFirst.String != "" {
+		d, err := time.ParseDuration(o.DiscardFirst.String)
+		if err != nil {
+			return nil, errors.Wrap(err, "options.discardFirst")
+		}
+		if d < 0 {
+			return nil, errors.New("options.discardFirst: can't be negative")
+		}
+		e.discardFirst = d
+	}
+	if o.CheckpointInterval.Valid && o.CheckpointInterval.String != "" {
+		if d, err := time.ParseDuration(o.CheckpointInterval.String); err != nil {
+			return nil, errors.Wrap(err, "options.checkpointInterval")
+		} else if d <= 0 {
+			return nil, errors.New("options.checkpointInterval: must be positive")
+		}
+	}
+	if o.CookieMode.Valid {
+		switch o.CookieMode.String {
+		case CookieModePersist, CookieModeReset, CookieModeDisabled:
+		default:
+			return nil, errors.Errorf("options.cookieMode: invalid mode: %s", o.CookieMode.String)
+		}
+	}
+	if o.RPS.Int64 < 0 {
+		return nil, errors.New("options.rps: can't be negative")
+	}
+	if o.RPSPerVU.Int64 < 0 {
+		return nil, errors.New("options.rpsPerVU: can't be negative")
+	}
+	var tlsMinVersion, tlsMaxVersion uint16
+	if o.TLSMinVersion.Valid && o.TLSMinVersion.String != "" {
+		v, err := ParseTLSVersion(o.TLSMinVersion.String)
+		if err != nil {
+			return nil, errors.Wrap(err, "options.tlsMinVersion")
+		}
+		tlsMinVersion = v
+	}
+	if o.TLSMaxVersion.Valid && o.TLSMaxVersion.String != "" {
+		v, err := ParseTLSVersion(o.TLSMaxVersion.String)
+		if err != nil {
+			return nil, errors.Wrap(err, "options.tlsMaxVersion")
+		}
+		tlsMaxVersion = v
+	}
+	if tlsMinVersion != 0 && tlsMaxVersion != 0 && tlsMinVersion > tlsMaxVersion {
+		return nil, errors.New("options.tlsMinVersion: can't be above tlsMaxVersion")
+	}
+	for _, name := range o.TLSCipherSuites {
+		if _, err := ParseTLSCipherSuite(name); err != nil {
+			return nil, errors.Wrap(err, "options.tlsCipherSuites")
+		}
+	}
+	for i, auth := range o.TLSAuth {
+		if _, err := auth.Certificate(); err != nil {
+			return nil, errors.Wrapf(err, "options.tlsAuth[%d]", i)
+		}
+	}
+	if o.ConnectionMaxAge.Valid && o.ConnectionMaxAge.String != "" {
+		if d, err := time.ParseDuration(o.ConnectionMaxAge.String); err != nil {
+			return nil, errors.Wrap(err, "options.connectionMaxAge")
+		} else if d < 0 {
+			return nil, errors.New("options.connectionMaxAge: can't be negative")
+		}
+	}
+	if o.MaxRedirects.Int64 < 0 {
+		return nil, errors.New("options.maxRedirects: can't be negative")
+	}
+	if o.ConnectionMaxRequests.Int64 < 0 {
+		return nil, errors.New("options.connectionMaxRequests: can't be negative")
+	}
+	if o.MaxIdleConns.Int64 < 0 {
+		return nil, errors.New("options.maxIdleConns: can't be negative")
+	}
+	if o.MaxIdleConnsPerHost.Int64 < 0 {
+		return nil, errors.New("options.maxIdleConnsPerHost: can't be negative")
+	}
+	if o.MaxConnsPerHost.Int64 < 0 {
+		return nil, errors.New("options.maxConnsPerHost: can't be negative")
+	}
+	if o.MaxResponseBodySize.Int64 < 0 {
+		return nil, errors.New("options.maxResponseBodySize: can't be negative")
+	}
+	if o.HTTPTimeout.Valid && o.HTTPTimeout.String != "" {
+		if d, err := time.ParseDuration(o.HTTPTimeout.String); err != nil {
+			return nil, errors.Wrap(err, "options.httpTimeout")
+		} else if d < 0 {
+			return nil, errors.New("options.httpTimeout: can't be negative")
+		}
+	}
+	if o.HTTPDebug.Valid && o.HTTPDebug.String != "" {
+		switch o.HTTPDebug.String {
+		case HTTPDebugHeaders, HTTPDebugFull:
+		default:
+			return nil, errors.Errorf("options.httpDebug: invalid mode: %s", o.HTTPDebug.String)
+		}
+	}
+	if dns := o.DNS; dns != nil {
+		if _, err := dns.ParseTTL(); err != nil {
+			return nil, errors.Wrap(err, "options.dns.ttl")
+		}
+		switch dns.Select.String {
+		case "", DNSSelectFirst, DNSSelectRoundRobin, DNSSelectRandom:
+		default:
+			return nil, errors.Errorf("options.dns.select: invalid strategy: %s", dns.Select.String)
+		}
+		switch dns.Policy.String {
+		case "", DNSPolicyAny, DNSPolicyPreferIPv4, DNSPolicyPreferIPv6, DNSPolicyOnlyIPv4, DNSPolicyOnlyIPv6:
+		default:
+			return nil, errors.Errorf("options.dns.policy: invalid policy: %s", dns.Policy.String)
+		}
+	}
+	if t := o.Tracing; t != nil {
+		switch t.Propagator.String {
+		case TracingPropagatorW3C, TracingPropagatorB3:
+		default:
+			return nil, errors.Errorf("options.tracing.propagator: invalid propagator: %s", t.Propagator.String)
+		}
+		if t.Sampling.Valid && (t.Sampling.Float64 < 0 || t.Sampling.Float64 > 1) {
+			return nil, errors.Errorf("options.tracing.sampling: must be between 0 and 1: %v", t.Sampling.Float64)
+		}
+	}
+	if har := o.HAR; har != nil {
+		if har.File.String == "" {
+			return nil, errors.New("options.har.file: required")
+		}
+		if har.Sample.Valid && (har.Sample.Float64 < 0 || har.Sample.Float64 > 1) {
+			return nil, errors.Errorf("options.har.sample: must be between 0 and 1: %v", har.Sample.Float64)
+		}
+		if har.MaxBodySize.Int64 < 0 {
+			return nil, errors.New("options.har.maxBodySize: can't be negative")
+		}
+	}
+	for _, name := range scenarioNames(o.Scenarios) {
+		sc := o.Scenarios[name]
+		switch sc.Executor.String {
+		case "", ExecutorConstantVUs:
+		default:
+			return nil, errors.Errorf("options.scenarios.%s.executor: invalid executor: %s", name, sc.Executor.String)
+		}
+		if sc.VUs.Int64 <= 0 {
+			return nil, errors.Errorf("options.scenarios.%s.vus: must be positive", name)
+		}
+	}
+	if len(o.Scenarios) > 0 && len(o.Stages) > 0 {
+		return nil, errors.New("options.scenarios: can't be used with stages")
+	}
+	for _, ip := range o.LocalIPs {
+		l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: ip})
+		if err != nil {
+			return nil, errors.Wrapf(err, "options.localIPs: can't bind to %s", ip)
+		}
+		_ = l.Close()
+	}
+	if o.TrendSink.Valid {
+		switch o.TrendSink.String {
+		case TrendSinkExact, TrendSinkHistogram:
+		default:
+			return nil, errors.Errorf("options.trendSink: invalid mode: %s", o.TrendSink.String)
+		}
+	}
+	for _, p := range o.Percentiles {
+		if p <= 0 || p > 100 {
+			return nil, errors.Errorf("options.percentiles: invalid percentile: %v", p)
+		}
+	}
+	if len(o.Scenarios) > 0 {
+		if err := e.allocateScenarios(o.Scenarios); err != nil {
+			return nil, err
+		}
+	} else if o.VUsMax.Valid {
+		if err := e.SetVUsMax(e.segment.Scale(o.VUsMax.Int64)); err != nil {
 			return nil, err
 		}
 	}
-	if o.VUs.Valid {
-		if err := e.SetVUs(o.VUs.Int64); err != nil {
+	if len(o.Scenarios) > 0 {
+		if err := e.SetVUs(e.vusMax); err != nil {
+			return nil, err
+		}
+	} else if o.VUs.Valid {
+		if err := e.SetVUs(e.segment.Scale(o.VUs.Int64)); err != nil {
 			return nil, err
 		}
 	}
@@ -151,16 +416,18 @@ func NewEngine(r Runner, o Options) (*Engine, error) {
 }
 
 func (e *Engine) Run(ctx context.Context) error {
-	collectorctx, collectorcancel := context.WithCancel(context.Background())
-	collectorch := make(chan interface{})
-	if e.Collector != nil {
-		go func() {
-			e.Collector.Run(collectorctx)
-			close(collectorch)
-		}()
-	} else {
-		close(collectorch)
+	for i, out := range e.Outputs {
+		if err := out.Start(); err != nil {
+			e.stopOutputs(e.Outputs[:i])
+			return errors.Wrapf(err, "couldn't start output %s", out)
+		}
 	}
+	flushctx, flushcancel := context.WithCancel(context.Background())
+	flushch := make(chan struct{})
+	go func() {
+		e.runOutputFlushing(flushctx)
+		close(flushch)
+	}()
 
 	e.lock.Lock()
 	{
@@ -184,6 +451,15 @@ func (e *Engine) Run(ctx context.Context) error {
 			e.runThresholds(ctx)
 			e.subwg.Done()
 		}(e.subctx)
+
+		// Write checkpoints, if asked to.
+		if e.Options.Checkpoint.String != "" {
+			e.subwg.Add(1)
+			go func(ctx context.Context) {
+				e.runCheckpoints(ctx)
+				e.subwg.Done()
+			}(e.subctx)
+		}
 	}
 	e.lock.Unlock()
 
@@ -207,9 +483,10 @@ func (e *Engine) Run(ctx context.Context) error {
 		// Process final thresholds.
 		e.processThresholds()
 
-		// Shut down collector
-		collectorcancel()
-		<-collectorch
+		// Shut down outputs, once the last samples have been passed on to them.
+		flushcancel()
+		<-flushch
+		e.stopOutputs(e.Outputs)
 	}()
 
 	// Set tracking to defaults.
@@ -224,6 +501,16 @@ func (e *Engine) Run(ctx context.Context) error {
 
 	atomic.StoreInt64(&e.numIterations, 0)
 
+	// The warm-up window starts with the test, not with each VU.
+	var warmupEnd time.Time
+	if e.discardFirst > 0 {
+		warmupEnd = time.Now().Add(e.discardFirst)
+	}
+	e.MetricsLock.Lock()
+	e.warmupEnd = warmupEnd
+	e.numDiscardedSamples = 0
+	e.MetricsLock.Unlock()
+
 	var lastTick time.Time
 	ticker := time.NewTicker(TickRate)
 
@@ -260,6 +547,17 @@ func (e *Engine) Run(ctx context.Context) error {
 		dT := now.Sub(lastTick)
 		lastTick = now
 
+		// Checks are counted as they're made rather than from samples, so the ones made during
+		// warm-up are discarded all at once when it's over.
+		if !warmupEnd.IsZero() && !now.Before(warmupEnd) {
+			if e.Runner != nil {
+				if g := e.Runner.GetDefaultGroup(); g != nil {
+					g.ResetChecks()
+				}
+			}
+			warmupEnd = time.Time{}
+		}
+
 		// Update state.
 		keepRunning, err := e.processStages(dT)
 		if err != nil {
@@ -279,6 +577,20 @@ func (e *Engine) Run(ctx context.Context) error {
 	}
 }
 
+// Returns how many samples were left out of the results for being part of the warm-up; see
+// Options.DiscardFirst. The caller must hold MetricsLock.
+func (e *Engine) DiscardedSamples() int64 {
+	return e.numDiscardedSamples
+}
+
+// Replaces the engine's logger, including where the tag limiter's warnings go. Call it before Run.
+func (e *Engine) SetLogger(logger *log.Logger) {
+	e.Logger = logger
+	if e.tagLimiter != nil {
+		e.tagLimiter.Logger = logger
+	}
+}
+
 func (e *Engine) IsRunning() bool {
 	e.lock.RLock()
 	vuStop := e.vuStop
@@ -334,23 +646,48 @@ func (e *Engine) setVUsNoLock(v int64) error {
 			panic(errors.New("fatal miscalculation: attempted to re-schedule active VU"))
 		}
 
-		id := atomic.AddInt64(&e.nextVUID, 1)
+		id := e.segment.VUID(atomic.AddInt64(&e.nextVUID, 1))
+
+		// A VU that was recently scaled down may still be finishing up its last iteration. It
+		// can't be touched until it's done, but we can't wait for it while holding the lock.
+		prevDone := vu.done
+		if prevDone != nil {
+			select {
+			case <-prevDone:
+				prevDone = nil
+			default:
+			}
+		}
 
 		// nil runners are used for testing.
-		if vu.VU != nil {
+		if vu.VU != nil && prevDone == nil {
 			if err := vu.VU.Reconfigure(id); err != nil {
 				return err
 			}
 		}
 
-		ctx, cancel := context.WithCancel(e.subctx)
+		// Cancelling the stop context lets the VU finish its current iteration before exiting;
+		// iterations themselves are only interrupted when the engine shuts down.
+		stopCtx, cancel := context.WithCancel(e.subctx)
 		vu.Cancel = cancel
+		vu.done = make(chan struct{})
 
 		e.subwg.Add(1)
-		go func() {
-			e.runVU(ctx, vu)
-			e.subwg.Done()
-		}()
+		go func(ctx context.Context, done chan struct{}) {
+			defer e.subwg.Done()
+			defer close(done)
+
+			if prevDone != nil {
+				<-prevDone
+				if vu.VU != nil {
+					if err := vu.VU.Reconfigure(id); err != nil {
+						e.Logger.WithError(err).Error("Couldn't reconfigure VU")
+						return
+					}
+				}
+			}
+			e.runVU(ctx, stopCtx, vu)
+		}(e.subctx, vu.done)
 	}
 
 	// Scale down
@@ -371,6 +708,41 @@ func (e *Engine) GetVUs() int64 {
 	return e.vus
 }
 
+// Allocates every scenario's VUs, in order of name, and points them at the scenario. Each scenario's
+// VU count is scaled to the execution segment separately, so none of them can end up with another's.
+func (e *Engine) allocateScenarios(scenarios map[string]Scenario) error {
+	for _, name := range scenarioNames(scenarios) {
+		sc := scenarios[name]
+		start := e.vusMax
+		if err := e.SetVUsMax(start + e.segment.Scale(sc.VUs.Int64)); err != nil {
+			return err
+		}
+		exec := sc.Exec.String
+		if exec == "" {
+			exec = "default"
+		}
+		for _, vu := range e.vuEntries[start:] {
+			vu.Scenario = name
+			if svu, ok := vu.VU.(ScenarioVU); ok {
+				if err := svu.SetScenario(name, exec); err != nil {
+					return errors.Wrapf(err, "options.scenarios.%s.exec", name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the names of scenarios, sorted.
+func scenarioNames(scenarios map[string]Scenario) []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (e *Engine) SetVUsMax(v int64) error {
 	if v < 0 {
 		return errors.New("vus-max can't be negative")
@@ -392,6 +764,7 @@ func (e *Engine) SetVUsMax(v int64) error {
 				return err
 			}
 			entry.VU = vu
+			e.Hooks.vuCreated(vu)
 		}
 		e.vuEntries = append(e.vuEntries, &entry)
 	}
@@ -426,6 +799,57 @@ func (e *Engine) AtTime() time.Duration {
 	return e.atTime
 }
 
+// A Snapshot is a summary of a test's progress so far, cheap enough to poll while it's running.
+type Snapshot struct {
+	AtTime     time.Duration
+	VUs        int64
+	VUsMax     int64
+	Iterations int64
+	Errors     int64
+
+	// Fraction of iterations that ended with an error.
+	ErrorRate float64
+
+	// HTTP requests made, their average rate since the start, and the 95th percentile duration.
+	Requests           float64
+	RequestsPerSecond  float64
+	RequestDurationP95 float64
+}
+
+// Takes a Snapshot of the running test. VUs are never blocked by this; the collection loop may
+// wait a moment while the request duration percentile is calculated.
+func (e *Engine) Snapshot() Snapshot {
+	s := Snapshot{
+		AtTime:     e.AtTime(),
+		VUs:        e.GetVUs(),
+		VUsMax:     e.GetVUsMax(),
+		Iterations: atomic.LoadInt64(&e.numIterations),
+		Errors:     atomic.LoadInt64(&e.numErrors),
+	}
+	if s.Iterations > 0 {
+		s.ErrorRate = float64(s.Errors) / float64(s.Iterations)
+	}
+
+	// Trend percentiles may need to sort the sink, so this needs a write lock.
+	e.MetricsLock.Lock()
+	if m, ok := e.Metrics[metrics.HTTPReqs.Name]; ok {
+		if sink, ok := m.Sink.(*stats.CounterSink); ok {
+			s.Requests = sink.Value
+		}
+	}
+	if m, ok := e.Metrics[metrics.HTTPReqDuration.Name]; ok {
+		if sink, ok := m.Sink.(stats.PercentileSink); ok {
+			s.RequestDurationP95 = sink.P(0.95)
+		}
+	}
+	e.MetricsLock.Unlock()
+
+	if secs := s.AtTime.Seconds(); secs > 0 {
+		s.RequestsPerSecond = s.Requests / secs
+	}
+	return s
+}
+
 func (e *Engine) TotalTime() time.Duration {
 	e.lock.RLock()
 	defer e.lock.RUnlock()
@@ -514,45 +938,55 @@ func (e *Engine) processStages(dT time.Duration) (bool, error) {
 	return true, nil
 }
 
-func (e *Engine) runVU(ctx context.Context, vu *vuEntry) {
+// Runs iterations on a VU until stopCtx is cancelled; ctx is only cancelled to abort the
+// iteration in progress, eg. when the engine shuts down.
+func (e *Engine) runVU(ctx, stopCtx context.Context, vu *vuEntry) {
 	maxIterations := e.Options.Iterations.Int64
 
 	// nil runners that produce nil VUs are used for testing.
 	if vu.VU == nil {
-		<-ctx.Done()
+		<-stopCtx.Done()
 		return
 	}
 
 	// Sleep until the engine starts running.
 	select {
 	case <-e.vuStop:
-	case <-ctx.Done():
+	case <-stopCtx.Done():
 		return
 	}
 
 	backoffCounter := 0
 	backoff := time.Duration(0)
 	for {
-		// Exit if the VU has run all its intended iterations.
+		// Exit if the VU has run all its intended iterations, or been told to stop. This must
+		// happen without taking the lock, as a scale-up may be holding it, waiting for us.
 		if maxIterations > 0 && vu.Iterations >= maxIterations {
 			return
 		}
+		select {
+		case <-stopCtx.Done():
+			return
+		default:
+		}
 
 		// If the engine is paused, sleep until it resumes.
 		e.lock.RLock()
 		vuPause := e.vuPause
 		e.lock.RUnlock()
 		if vuPause != nil {
-			<-vuPause
+			select {
+			case <-vuPause:
+			case <-stopCtx.Done():
+				return
+			}
 		}
 
-		select {
-		case <-ctx.Done():
+		succ := e.runVUOnce(ctx, vu)
+		if max := e.Options.MaxIterationTimeouts.Int64; max > 0 && vu.Timeouts >= max {
+			e.Logger.WithField("timeouts", vu.Timeouts).Error("VU stopped after too many consecutive iteration timeouts")
 			return
-		default:
 		}
-
-		succ := e.runVUOnce(ctx, vu)
 		if !succ {
 			backoff += BackoffAmount * time.Duration(backoffCounter)
 			if backoff > BackoffMax {
@@ -561,7 +995,7 @@ func (e *Engine) runVU(ctx context.Context, vu *vuEntry) {
 			backoffCounter++
 			select {
 			case <-time.After(backoff):
-			case <-ctx.Done():
+			case <-stopCtx.Done():
 			}
 		} else {
 			backoff = 0
@@ -570,7 +1004,11 @@ func (e *Engine) runVU(ctx context.Context, vu *vuEntry) {
 }
 
 func (e *Engine) runVUOnce(ctx context.Context, vu *vuEntry) bool {
+	iteration := atomic.LoadInt64(&vu.Iterations)
+	e.Hooks.iterationStart(vu.VU, iteration)
+	startTime := time.Now()
 	samples, err := vu.VU.RunOnce(ctx)
+	e.Hooks.iterationEnd(vu.VU, iteration, time.Since(startTime), err)
 
 	// Expired VUs usually have request cancellation errors, and thus skewed metrics and
 	// unhelpful "request cancelled" errors. Don't process those.
@@ -581,6 +1019,12 @@ func (e *Engine) runVUOnce(ctx context.Context, vu *vuEntry) bool {
 	}
 
 	t := time.Now()
+	duration := t.Sub(startTime)
+	if e.Options.IterationDurationExcludesSleep.Bool {
+		if st, ok := vu.VU.(SleepTracker); ok {
+			duration -= st.LastIterationSleep()
+		}
+	}
 
 	atomic.AddInt64(&vu.Iterations, 1)
 	atomic.AddInt64(&e.numIterations, 1)
@@ -589,32 +1033,98 @@ func (e *Engine) runVUOnce(ctx context.Context, vu *vuEntry) bool {
 			Time:   t,
 			Metric: metrics.Iterations,
 			Value:  1,
-		})
+		},
+		stats.Sample{
+			Time:   t,
+			Metric: metrics.IterationDuration,
+			Value:  stats.D(duration),
+		},
+	)
+	if IsIterationTimeout(err) {
+		vu.Timeouts++
+	} else {
+		vu.Timeouts = 0
+	}
 	if err != nil {
+		// Errors from replayable iterations carry the VU, iteration and seed needed to do so.
+		// Only the first line of the message is used as a tag; the rest is eg. a source frame,
+		// which is logged, but would make for a unique tag value per location.
+		msg := err.Error()
+		if i := strings.IndexByte(msg, '\n'); i != -1 {
+			msg = msg[:i]
+		}
+		tags := map[string]string{"error": msg}
+		fields := log.Fields{}
+		if ierr, ok := err.(*IterationError); ok {
+			for k, v := range ierr.Tags() {
+				tags[k] = v
+				fields[k] = v
+			}
+		}
 		if serr, ok := err.(fmt.Stringer); ok {
-			e.Logger.Error(serr.String())
+			e.Logger.WithFields(fields).Error(serr.String())
 		} else {
-			e.Logger.WithError(err).Error("VU Error")
+			e.Logger.WithFields(fields).WithError(err).Error("VU Error")
 		}
 		samples = append(samples,
 			stats.Sample{
 				Time:   t,
 				Metric: metrics.Errors,
-				Tags:   map[string]string{"error": err.Error()},
+				Tags:   tags,
 				Value:  1,
 			},
 		)
+		if IsIterationTimeout(err) {
+			samples = append(samples,
+				stats.Sample{
+					Time:   t,
+					Metric: metrics.IterationTimeouts,
+					Tags:   tags,
+					Value:  1,
+				},
+			)
+		}
 		atomic.AddInt64(&e.numErrors, 1)
 	}
+	if vu.Scenario != "" {
+		tagScenario(samples, vu.Scenario)
+	}
 
-	vu.lock.Lock()
-	vu.Samples = append(vu.Samples, samples...)
-	vu.lock.Unlock()
+	// Hand the whole iteration's samples over in one go. If the engine can't keep up, either wait
+	// for it to catch up (the default), or throw the samples away, if we've been told to.
+	if e.Options.DropSamples.Bool {
+		select {
+		case e.samples <- samples:
+		default:
+			atomic.AddInt64(&e.numDroppedSamples, int64(len(samples)))
+		}
+	} else {
+		select {
+		case e.samples <- samples:
+		case <-ctx.Done():
+		}
+	}
 
 	return err == nil
 }
 
+// Tags samples with the scenario they came from. Tag maps may be shared between samples, so each
+// sample gets a copy rather than having its map modified.
+func tagScenario(samples []stats.Sample, scenario string) {
+	for i := range samples {
+		tags := make(map[string]string, len(samples[i].Tags)+1)
+		for k, v := range samples[i].Tags {
+			tags[k] = v
+		}
+		tags["scenario"] = scenario
+		samples[i].Tags = tags
+	}
+}
+
 func (e *Engine) runMetricsEmission(ctx context.Context) {
+	// Emit right away, so time series start with the test rather than a tick into it.
+	e.emitMetrics()
+
 	ticker := time.NewTicker(MetricsRate)
 	for {
 		select {
@@ -630,8 +1140,9 @@ func (e *Engine) emitMetrics() {
 	e.lock.RLock()
 	defer e.lock.RUnlock()
 
+	// Per-scenario samples go first; gauges keep the last value they got, which must be the total.
 	t := time.Now()
-	e.processSamples(
+	samples := append(e.scenarioVUSamples(t),
 		stats.Sample{
 			Time:   t,
 			Metric: metrics.VUs,
@@ -643,6 +1154,47 @@ func (e *Engine) emitMetrics() {
 			Value:  float64(e.vusMax),
 		},
 	)
+	if emitter, ok := e.Runner.(MetricsEmitter); ok {
+		samples = append(samples, emitter.EmitMetrics(t)...)
+	}
+	if dropped := atomic.SwapInt64(&e.numDroppedSamples, 0); dropped > 0 {
+		samples = append(samples, stats.Sample{
+			Time:   t,
+			Metric: metrics.DroppedSamples,
+			Value:  float64(dropped),
+		})
+	}
+	e.processSamples(samples...)
+}
+
+// Returns a vus sample tagged with each scenario's name, counting its active VUs; nothing if the
+// test has no scenarios. Must be called with the lock held.
+func (e *Engine) scenarioVUSamples(t time.Time) []stats.Sample {
+	var names []string
+	active := make(map[string]int64)
+	for i, vu := range e.vuEntries {
+		if vu.Scenario == "" {
+			continue
+		}
+		if _, ok := active[vu.Scenario]; !ok {
+			names = append(names, vu.Scenario)
+			active[vu.Scenario] = 0
+		}
+		if int64(i) < e.vus {
+			active[vu.Scenario]++
+		}
+	}
+
+	samples := make([]stats.Sample, len(names))
+	for i, name := range names {
+		samples[i] = stats.Sample{
+			Time:   t,
+			Metric: metrics.VUs,
+			Tags:   map[string]string{"scenario": name},
+			Value:  float64(active[name]),
+		}
+	}
+	return samples
 }
 
 func (e *Engine) runThresholds(ctx context.Context) {
@@ -657,6 +1209,36 @@ func (e *Engine) runThresholds(ctx context.Context) {
 	}
 }
 
+// Flushes the outputs every OutputFlushInterval, until ctx is done.
+func (e *Engine) runOutputFlushing(ctx context.Context) {
+	if len(e.Outputs) == 0 {
+		return
+	}
+	ticker := time.NewTicker(OutputFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, out := range e.Outputs {
+				if err := out.Flush(); err != nil {
+					e.Logger.WithError(err).WithField("output", fmt.Sprint(out)).Warn("Couldn't flush output")
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stops outputs, which sends on whatever samples they have left.
+func (e *Engine) stopOutputs(outputs []Output) {
+	for _, out := range outputs {
+		if err := out.Stop(); err != nil {
+			e.Logger.WithError(err).WithField("output", fmt.Sprint(out)).Error("Couldn't stop output")
+		}
+	}
+}
+
 func (e *Engine) processThresholds() {
 	e.MetricsLock.Lock()
 	defer e.MetricsLock.Unlock()
@@ -682,6 +1264,23 @@ func (e *Engine) processThresholds() {
 	}
 }
 
+// Returns the names of metrics, or submetrics, that have thresholds but no samples, sorted. Their
+// thresholds are neither passed nor failed, which usually means a typo in a tag filter. The caller
+// must hold MetricsLock.
+func (e *Engine) UnmatchedThresholds() []string {
+	var names []string
+	for name, thresholds := range e.thresholds {
+		if len(thresholds.Thresholds) == 0 {
+			continue
+		}
+		if _, ok := e.Metrics[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (e *Engine) runCollection(ctx context.Context) {
 	ticker := time.NewTicker(CollectRate)
 	for {
@@ -695,19 +1294,75 @@ func (e *Engine) runCollection(ctx context.Context) {
 }
 
 func (e *Engine) collect() []stats.Sample {
-	e.lock.RLock()
-	defer e.lock.RUnlock()
-
 	samples := []stats.Sample{}
-	for _, vu := range e.vuEntries {
-		vu.lock.Lock()
-		if len(vu.Samples) > 0 {
-			samples = append(samples, vu.Samples...)
-			vu.Samples = nil
+	for {
+		select {
+		case batch := <-e.samples:
+			samples = append(samples, batch...)
+		default:
+			return samples
+		}
+	}
+}
+
+// Applies engine-wide sink options to a newly seen metric.
+func (e *Engine) configureSink(m *stats.Metric) {
+	if m.Type != stats.Trend {
+		return
+	}
+
+	switch e.Options.TrendSink.String {
+	case TrendSinkHistogram:
+		if _, ok := m.Sink.(*stats.HistogramSink); !ok {
+			m.Sink = &stats.HistogramSink{}
+		}
+	default:
+		if _, ok := m.Sink.(*stats.TrendSink); !ok {
+			m.Sink = &stats.TrendSink{}
+		}
+	}
+
+	if e.Options.Percentiles != nil {
+		switch sink := m.Sink.(type) {
+		case *stats.TrendSink:
+			sink.Percentiles = e.Options.Percentiles
+		case *stats.HistogramSink:
+			sink.Percentiles = e.Options.Percentiles
+		}
+	}
+}
+
+// Discards everything aggregated so far, eg. at the end of a warmup phase, so that only later
+// samples count towards the summary and thresholds. Outputs have already received the samples.
+func (e *Engine) ResetMetrics() {
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+
+	e.resetMetrics()
+}
+
+func (e *Engine) newHostStats() *HostStats {
+	m := stats.New(metrics.HTTPReqDuration.Name, stats.Trend, stats.Time)
+	e.configureSink(m)
+	return &HostStats{Duration: m.Sink.(stats.PercentileSink)}
+}
+
+func (e *Engine) resetMetrics() {
+	e.Hosts = make(map[string]*HostStats)
+	for _, m := range e.Metrics {
+		m.Sink = stats.New(m.Name, m.Type, m.Contains).Sink
+		e.configureSink(m)
+		m.Tainted = null.Bool{}
+		for _, th := range m.Thresholds.Thresholds {
+			th.Failed = false
+		}
+	}
+	e.thresholdsTainted = false
+	if e.Runner != nil {
+		if g := e.Runner.GetDefaultGroup(); g != nil {
+			g.ResetChecks()
 		}
-		vu.lock.Unlock()
 	}
-	return samples
 }
 
 func (e *Engine) processSamples(samples ...stats.Sample) {
@@ -718,17 +1373,52 @@ func (e *Engine) processSamples(samples ...stats.Sample) {
 	e.MetricsLock.Lock()
 	defer e.MetricsLock.Unlock()
 
-	for _, sample := range samples {
+	samples = e.tagLimiter.Limit(samples)
+
+	hasMarkers := false
+	for i, sample := range samples {
+		if sample.Metric == metrics.MetricsReset {
+			e.resetMetrics()
+			hasMarkers = true
+			continue
+		}
+
+		// Samples are timestamped when they end, so iterations spanning the end of the warm-up
+		// count towards the results. Tags may be shared between samples, so they're copied.
+		if sample.Time.Before(e.warmupEnd) {
+			tags := make(map[string]string, len(sample.Tags)+1)
+			for k, v := range sample.Tags {
+				tags[k] = v
+			}
+			tags["warmup"] = "true"
+			samples[i].Tags = tags
+			e.numDiscardedSamples++
+			continue
+		}
+
 		m, ok := e.Metrics[sample.Metric.Name]
 		if !ok {
 			m = sample.Metric
 			m.Thresholds = e.thresholds[m.Name]
 			m.Submetrics = e.submetrics[m.Name]
+			e.configureSink(m)
 			e.Metrics[m.Name] = m
 		}
 		m.Sink.Add(sample)
 
-		for _, sm := range m.Submetrics {
+		if host, ok := sample.Tags["host"]; ok {
+			if sample.Metric == metrics.HTTPReqs || sample.Metric == metrics.HTTPReqDuration {
+				hs, ok := e.Hosts[host]
+				if !ok {
+					hs = e.newHostStats()
+					e.Hosts[host] = hs
+				}
+				hs.add(sample)
+			}
+		}
+
+		for i := range m.Submetrics {
+			sm := &m.Submetrics[i]
 			passing := true
 			for k, v := range sm.Tags {
 				if sample.Tags[k] != v {
@@ -743,13 +1433,28 @@ func (e *Engine) processSamples(samples ...stats.Sample) {
 			if sm.Metric == nil {
 				sm.Metric = stats.New(sm.Name, sample.Metric.Type, sample.Metric.Contains)
 				sm.Metric.Thresholds = e.thresholds[sm.Name]
+				e.configureSink(sm.Metric)
 				e.Metrics[sm.Name] = sm.Metric
 			}
 			sm.Metric.Sink.Add(sample)
 		}
 	}
 
-	if e.Collector != nil {
-		e.Collector.Collect(samples)
+	if hasMarkers {
+		filtered := make([]stats.Sample, 0, len(samples))
+		for _, sample := range samples {
+			if sample.Metric != metrics.MetricsReset {
+				filtered = append(filtered, sample)
+			}
+		}
+		samples = filtered
+	}
+
+	if len(e.Outputs) > 0 {
+		if samples := e.outputFilter.Filter(samples); len(samples) > 0 {
+			for _, out := range e.Outputs {
+				out.AddSamples(samples)
+			}
+		}
 	}
 }
@@ -22,12 +22,21 @@ package lib
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	logtest "github.com/Sirupsen/logrus/hooks/test"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/stats/dummy"
 	"github.com/pkg/errors"
@@ -185,6 +194,279 @@ func TestNewEngineOptions(t *testing.T) {
 			assert.True(t, e.IsPaused())
 		})
 	})
+	t.Run("CookieMode", func(t *testing.T) {
+		for _, mode := range []string{CookieModePersist, CookieModeReset, CookieModeDisabled} {
+			t.Run(mode, func(t *testing.T) {
+				_, err, _ := newTestEngine(nil, Options{CookieMode: null.StringFrom(mode)})
+				assert.NoError(t, err)
+			})
+		}
+		t.Run("invalid", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{CookieMode: null.StringFrom("nope")})
+			assert.EqualError(t, err, "options.cookieMode: invalid mode: nope")
+		})
+	})
+	t.Run("MaxIterationDuration", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{MaxIterationDuration: null.StringFrom("1s")})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{MaxIterationDuration: null.StringFrom("nope")})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "options.maxIterationDuration: ")
+		}
+	})
+	t.Run("MaxHeapSize", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{MaxHeapSize: null.IntFrom(1 << 30)})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{MaxHeapSize: null.IntFrom(-1)})
+		assert.EqualError(t, err, "options.maxHeapSize: can't be negative")
+	})
+	t.Run("CheckpointInterval", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{CheckpointInterval: null.StringFrom("5s")})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{CheckpointInterval: null.StringFrom("nope")})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "options.checkpointInterval: ")
+		}
+		_, err, _ = newTestEngine(nil, Options{CheckpointInterval: null.StringFrom("0s")})
+		assert.EqualError(t, err, "options.checkpointInterval: must be positive")
+	})
+	t.Run("LocalIPs", func(t *testing.T) {
+		t.Run("valid", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{LocalIPs: []net.IP{net.ParseIP("127.0.0.1")}})
+			assert.NoError(t, err)
+		})
+		t.Run("unbindable", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{LocalIPs: []net.IP{net.ParseIP("192.0.2.1")}})
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "options.localIPs: can't bind to 192.0.2.1")
+			}
+		})
+	})
+	t.Run("HTTPDebug", func(t *testing.T) {
+		for _, mode := range []string{"", HTTPDebugHeaders, HTTPDebugFull} {
+			t.Run(mode, func(t *testing.T) {
+				_, err, _ := newTestEngine(nil, Options{HTTPDebug: null.StringFrom(mode)})
+				assert.NoError(t, err)
+			})
+		}
+		t.Run("invalid", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{HTTPDebug: null.StringFrom("nope")})
+			assert.EqualError(t, err, "options.httpDebug: invalid mode: nope")
+		})
+	})
+	t.Run("SamplesBufferSize", func(t *testing.T) {
+		t.Run("default", func(t *testing.T) {
+			e, err, _ := newTestEngine(nil, Options{})
+			assert.NoError(t, err)
+			assert.Equal(t, DefaultSamplesBufferSize, cap(e.samples))
+		})
+		t.Run("set", func(t *testing.T) {
+			e, err, _ := newTestEngine(nil, Options{SamplesBufferSize: null.IntFrom(10)})
+			assert.NoError(t, err)
+			assert.Equal(t, 10, cap(e.samples))
+		})
+		t.Run("negative", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{SamplesBufferSize: null.IntFrom(-1)})
+			assert.EqualError(t, err, "options.samplesBufferSize: can't be negative")
+		})
+	})
+	t.Run("ExecutionSegment", func(t *testing.T) {
+		e, err, _ := newTestEngine(RunnerFunc(nil), Options{
+			ExecutionSegment: null.StringFrom("2/4"),
+			VUsMax:           null.IntFrom(10),
+			VUs:              null.IntFrom(10),
+			Stages:           []Stage{{Duration: 10 * time.Second, Target: null.IntFrom(8)}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, ExecutionSegment{2, 4}, e.segment)
+		assert.Equal(t, int64(3), e.GetVUsMax())
+		assert.Equal(t, int64(3), e.GetVUs())
+		assert.Equal(t, null.IntFrom(2), e.Stages[0].Target)
+		for i, id := range []int64{2, 6, 10} {
+			assert.Equal(t, id, e.vuEntries[i].VU.(*RunnerFuncVU).ID)
+		}
+
+		t.Run("invalid", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, Options{ExecutionSegment: null.StringFrom("5/4")})
+			assert.EqualError(t, err, "options.executionSegment: invalid execution segment: 5/4")
+		})
+	})
+	t.Run("OutputSampleRate", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{OutputSampleRate: null.FloatFrom(0.5)})
+		assert.NoError(t, err)
+		assert.NotNil(t, e.outputFilter)
+
+		_, err, _ = newTestEngine(nil, Options{OutputSampleRate: null.FloatFrom(-1)})
+		assert.EqualError(t, err, "options.outputSampleRate: must be between 0 and 1: -1")
+	})
+	t.Run("TrendSink", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{TrendSink: null.StringFrom(TrendSinkHistogram)})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{TrendSink: null.StringFrom("nope")})
+		assert.EqualError(t, err, "options.trendSink: invalid mode: nope")
+	})
+	t.Run("RPS", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{RPS: null.IntFrom(10), RPSPerVU: null.IntFrom(1)})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{RPS: null.IntFrom(-1)})
+		assert.EqualError(t, err, "options.rps: can't be negative")
+
+		_, err, _ = newTestEngine(nil, Options{RPSPerVU: null.IntFrom(-1)})
+		assert.EqualError(t, err, "options.rpsPerVU: can't be negative")
+	})
+	t.Run("ConnectionLifetime", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{
+			ConnectionMaxAge:      null.StringFrom("1m"),
+			ConnectionMaxRequests: null.IntFrom(100),
+		})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{ConnectionMaxAge: null.StringFrom("nope")})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "options.connectionMaxAge: ")
+		}
+
+		_, err, _ = newTestEngine(nil, Options{ConnectionMaxAge: null.StringFrom("-1s")})
+		assert.EqualError(t, err, "options.connectionMaxAge: can't be negative")
+
+		_, err, _ = newTestEngine(nil, Options{ConnectionMaxRequests: null.IntFrom(-1)})
+		assert.EqualError(t, err, "options.connectionMaxRequests: can't be negative")
+	})
+	t.Run("ConnectionPool", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{
+			MaxIdleConns:        null.IntFrom(100),
+			MaxIdleConnsPerHost: null.IntFrom(10),
+			MaxConnsPerHost:     null.IntFrom(20),
+		})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{MaxIdleConns: null.IntFrom(-1)})
+		assert.EqualError(t, err, "options.maxIdleConns: can't be negative")
+
+		_, err, _ = newTestEngine(nil, Options{MaxIdleConnsPerHost: null.IntFrom(-1)})
+		assert.EqualError(t, err, "options.maxIdleConnsPerHost: can't be negative")
+
+		_, err, _ = newTestEngine(nil, Options{MaxConnsPerHost: null.IntFrom(-1)})
+		assert.EqualError(t, err, "options.maxConnsPerHost: can't be negative")
+	})
+	t.Run("TLS", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{
+			TLSMinVersion:   null.StringFrom("tls1.1"),
+			TLSMaxVersion:   null.StringFrom("TLS1.2"),
+			TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{TLSMinVersion: null.StringFrom("tls9")})
+		assert.EqualError(t, err, "options.tlsMinVersion: unknown TLS version: tls9")
+
+		_, err, _ = newTestEngine(nil, Options{TLSMaxVersion: null.StringFrom("tls9")})
+		assert.EqualError(t, err, "options.tlsMaxVersion: unknown TLS version: tls9")
+
+		_, err, _ = newTestEngine(nil, Options{TLSMinVersion: null.StringFrom("tls1.2"), TLSMaxVersion: null.StringFrom("tls1.1")})
+		assert.EqualError(t, err, "options.tlsMinVersion: can't be above tlsMaxVersion")
+
+		_, err, _ = newTestEngine(nil, Options{TLSCipherSuites: []string{"nope"}})
+		assert.EqualError(t, err, "options.tlsCipherSuites: unknown TLS cipher suite: nope")
+
+		cert, key := newTestCertificate(t)
+		_, err, _ = newTestEngine(nil, Options{TLSAuth: []TLSAuth{{Domains: []string{"example.com"}, Cert: cert, Key: key}}})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{TLSAuth: []TLSAuth{{Cert: cert, Key: key}, {Cert: "nope"}}})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "options.tlsAuth[1]: ")
+		}
+	})
+	t.Run("DNS", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{DNS: &DNSOptions{
+			TTL:    null.StringFrom("1m"),
+			Select: null.StringFrom(DNSSelectRoundRobin),
+			Policy: null.StringFrom(DNSPolicyPreferIPv4),
+		}})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{DNS: &DNSOptions{TTL: null.StringFrom("inf")}})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{DNS: &DNSOptions{TTL: null.StringFrom("-1s")}})
+		assert.EqualError(t, err, "options.dns.ttl: can't be negative")
+
+		_, err, _ = newTestEngine(nil, Options{DNS: &DNSOptions{Select: null.StringFrom("nope")}})
+		assert.EqualError(t, err, "options.dns.select: invalid strategy: nope")
+
+		_, err, _ = newTestEngine(nil, Options{DNS: &DNSOptions{Policy: null.StringFrom("nope")}})
+		assert.EqualError(t, err, "options.dns.policy: invalid policy: nope")
+	})
+	t.Run("HAR", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{HAR: &HAROptions{
+			File:        null.StringFrom("out.har"),
+			Sample:      null.FloatFrom(0.5),
+			MaxBodySize: null.IntFrom(0),
+		}})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{HAR: &HAROptions{}})
+		assert.EqualError(t, err, "options.har.file: required")
+
+		_, err, _ = newTestEngine(nil, Options{HAR: &HAROptions{File: null.StringFrom("out.har"), Sample: null.FloatFrom(2)}})
+		assert.EqualError(t, err, "options.har.sample: must be between 0 and 1: 2")
+
+		_, err, _ = newTestEngine(nil, Options{HAR: &HAROptions{File: null.StringFrom("out.har"), MaxBodySize: null.IntFrom(-1)}})
+		assert.EqualError(t, err, "options.har.maxBodySize: can't be negative")
+	})
+	t.Run("Scenarios", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{Scenarios: map[string]Scenario{
+			"browse": {Executor: null.StringFrom(ExecutorConstantVUs), VUs: null.IntFrom(5)},
+		}})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{Scenarios: map[string]Scenario{
+			"browse": {Executor: null.StringFrom("ramping-vus"), VUs: null.IntFrom(5)},
+		}})
+		assert.EqualError(t, err, "options.scenarios.browse.executor: invalid executor: ramping-vus")
+
+		_, err, _ = newTestEngine(nil, Options{Scenarios: map[string]Scenario{"browse": {}}})
+		assert.EqualError(t, err, "options.scenarios.browse.vus: must be positive")
+
+		_, err, _ = newTestEngine(nil, Options{
+			Scenarios: map[string]Scenario{"browse": {VUs: null.IntFrom(5)}},
+			Stages:    []Stage{{Duration: 10 * time.Second}},
+		})
+		assert.EqualError(t, err, "options.scenarios: can't be used with stages")
+	})
+	t.Run("Tracing", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{Tracing: &TracingOptions{
+			Propagator: null.StringFrom(TracingPropagatorB3),
+			Sampling:   null.FloatFrom(0.1),
+		}})
+		assert.NoError(t, err)
+
+		_, err, _ = newTestEngine(nil, Options{Tracing: &TracingOptions{Propagator: null.StringFrom("nope")}})
+		assert.EqualError(t, err, "options.tracing.propagator: invalid propagator: nope")
+
+		_, err, _ = newTestEngine(nil, Options{Tracing: &TracingOptions{
+			Propagator: null.StringFrom(TracingPropagatorW3C),
+			Sampling:   null.FloatFrom(2),
+		}})
+		assert.EqualError(t, err, "options.tracing.sampling: must be between 0 and 1: 2")
+	})
+	t.Run("Percentiles", func(t *testing.T) {
+		_, err, _ := newTestEngine(nil, Options{Percentiles: []float64{50, 99.9, 100}})
+		assert.NoError(t, err)
+
+		for _, p := range []float64{0, -1, 101} {
+			t.Run(fmt.Sprint(p), func(t *testing.T) {
+				_, err, _ := newTestEngine(nil, Options{Percentiles: []float64{p}})
+				assert.EqualError(t, err, fmt.Sprintf("options.percentiles: invalid percentile: %v", p))
+			})
+		}
+	})
 	t.Run("thresholds", func(t *testing.T) {
 		e, err, _ := newTestEngine(nil, Options{
 			Thresholds: map[string]stats.Thresholds{
@@ -304,12 +586,82 @@ func TestEngineRun(t *testing.T) {
 					return
 				}
 				sink := e.Metrics["test_metric"].Sink.(*stats.TrendSink)
-				assert.True(t, len(sink.Values) > int(float64(e.numIterations)*0.99), "more than 1%% of iterations missed")
+				assert.True(t, sink.Count() > uint64(float64(e.numIterations)*0.99), "more than 1%% of iterations missed")
 			})
 		}
 	})
 }
 
+// Soak test for the sample path: at 10k samples/s, memory must stay flat rather than grow with
+// the number of samples seen. It takes a while, so it only runs if K6_SOAK_DURATION is set, eg.
+// to "10m"; memory is measured after every tenth of it.
+func TestEngineSoak(t *testing.T) {
+	duration, _ := time.ParseDuration(os.Getenv("K6_SOAK_DURATION"))
+	if duration <= 0 {
+		t.Skip("K6_SOAK_DURATION isn't set")
+	}
+
+	// 10 VUs, each doing 10 iterations of 100 samples a second. Durations go to a trend, like
+	// http_req_duration, as that's where samples would pile up; the counter just keeps track of
+	// how many were processed.
+	const vus, iterationsPerSec, samplesPerIteration = 10, 10, 100
+	testTrend := stats.New("test_trend", stats.Trend, stats.Time)
+	testCounter := stats.New("test_counter", stats.Counter)
+	e, err, _ := newTestEngine(RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+		samples := make([]stats.Sample, 0, 2*samplesPerIteration)
+		for i := 0; i < samplesPerIteration; i++ {
+			now := time.Now()
+			samples = append(samples,
+				stats.Sample{Metric: testTrend, Value: rand.Float64() * 1000, Time: now},
+				stats.Sample{Metric: testCounter, Value: 1, Time: now},
+			)
+		}
+		select {
+		case <-time.After(time.Second / iterationsPerSec):
+		case <-ctx.Done():
+		}
+		return samples, nil
+	}), Options{VUsMax: null.IntFrom(vus), VUs: null.IntFrom(vus)})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- e.Run(ctx) }()
+
+	heap := func() uint64 {
+		runtime.GC()
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		return mem.HeapAlloc
+	}
+	var heaps []uint64
+	for i := 1; i < 10; i++ {
+		time.Sleep(duration / 10)
+		heaps = append(heaps, heap())
+		t.Logf("%s: heap %d KiB", duration/10*time.Duration(i), heaps[len(heaps)-1]/1024)
+	}
+	assert.NoError(t, <-done)
+
+	// Allow for noise, but not for memory that grows along with the samples seen. The first
+	// measurement is taken once everything's warmed up; the trend's reservoir of at most
+	// stats.MaxTrendValues values is well within the allowance.
+	for _, h := range heaps[1:] {
+		assert.True(t, h < heaps[0]*3/2+8<<20, "heap grew from %d to %d bytes", heaps[0], h)
+	}
+
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+	expected := float64(vus*iterationsPerSec*samplesPerIteration) * duration.Seconds()
+	count := e.Metrics["test_counter"].Sink.(*stats.CounterSink).Value
+	assert.True(t, count > expected*0.9, "only %.0f of %.0f samples processed", count, expected)
+	trend := e.Metrics["test_trend"].Sink.(*stats.TrendSink)
+	assert.True(t, len(trend.Values) <= stats.MaxTrendValues, "trend kept %d values", len(trend.Values))
+	assert.True(t, trend.Format()["p95"] > 0)
+}
+
 func TestEngineIsRunning(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	e, err, _ := newTestEngine(nil, Options{})
@@ -375,6 +727,42 @@ func TestEngineAtTime(t *testing.T) {
 	assert.NoError(t, e.Run(ctx))
 }
 
+func TestEngineSnapshot(t *testing.T) {
+	e, err, _ := newTestEngine(nil, Options{VUsMax: null.IntFrom(10), VUs: null.IntFrom(5)})
+	assert.NoError(t, err)
+
+	t.Run("empty", func(t *testing.T) {
+		s := e.Snapshot()
+		assert.Equal(t, int64(5), s.VUs)
+		assert.Equal(t, int64(10), s.VUsMax)
+		assert.Equal(t, 0.0, s.ErrorRate)
+		assert.Equal(t, 0.0, s.RequestsPerSecond)
+	})
+
+	t.Run("running", func(t *testing.T) {
+		reqs := stats.New(metrics.HTTPReqs.Name, stats.Counter)
+		duration := stats.New(metrics.HTTPReqDuration.Name, stats.Trend, stats.Time)
+		for i := 1; i <= 100; i++ {
+			e.processSamples(
+				stats.Sample{Metric: reqs, Value: 1},
+				stats.Sample{Metric: duration, Value: float64(i)},
+			)
+		}
+		e.atTime = 4 * time.Second
+		e.numIterations = 20
+		e.numErrors = 5
+
+		s := e.Snapshot()
+		assert.Equal(t, 4*time.Second, s.AtTime)
+		assert.Equal(t, int64(20), s.Iterations)
+		assert.Equal(t, int64(5), s.Errors)
+		assert.Equal(t, 0.25, s.ErrorRate)
+		assert.Equal(t, 100.0, s.Requests)
+		assert.Equal(t, 25.0, s.RequestsPerSecond)
+		assert.Equal(t, 96.0, s.RequestDurationP95)
+	})
+}
+
 func TestEngineSetPaused(t *testing.T) {
 	t.Run("offline", func(t *testing.T) {
 		e, err, _ := newTestEngine(nil, Options{})
@@ -565,6 +953,42 @@ func TestEngineSetVUs(t *testing.T) {
 	})
 }
 
+func TestEngineSetVUsGraceful(t *testing.T) {
+	var started, finished, interrupted int64
+	e, err, _ := newTestEngine(RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+		atomic.AddInt64(&started, 1)
+		select {
+		case <-time.After(200 * time.Millisecond):
+			atomic.AddInt64(&finished, 1)
+		case <-ctx.Done():
+			atomic.AddInt64(&interrupted, 1)
+		}
+		return nil, nil
+	}), Options{VUsMax: null.IntFrom(1), VUs: null.IntFrom(1)})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { assert.NoError(t, e.Run(ctx)) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// Scaling down lets the iteration in progress finish, but doesn't start another one.
+	assert.NoError(t, e.SetVUs(0))
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&started))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&finished))
+	assert.Equal(t, int64(0), atomic.LoadInt64(&interrupted))
+
+	t.Run("rescale", func(t *testing.T) {
+		// Scaling back up while a VU is still winding down must not block.
+		assert.NoError(t, e.SetVUs(1))
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, e.SetVUs(0))
+		assert.NoError(t, e.SetVUs(1))
+		assert.Equal(t, int64(1), e.GetVUs())
+	})
+}
+
 func TestEngine_runVUOnceKeepsCounters(t *testing.T) {
 	e, err, hook := newTestEngine(nil, Options{})
 	assert.NoError(t, err)
@@ -660,6 +1084,350 @@ func TestEngine_runVUOnceKeepsCounters(t *testing.T) {
 	})
 }
 
+func TestEngine_runVUOnceSamplesBuffer(t *testing.T) {
+	testMetric := stats.New("test_metric", stats.Trend)
+	vu := &vuEntry{
+		VU: RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+			return []stats.Sample{{Metric: testMetric, Value: 1}}, nil
+		}).VU(),
+	}
+
+	t.Run("collect", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{})
+		assert.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			e.runVUOnce(context.Background(), vu)
+		}
+		// One test_metric, one iterations and one iteration_duration sample per iteration.
+		assert.Len(t, e.collect(), 9)
+		assert.Len(t, e.collect(), 0)
+	})
+	t.Run("block", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{SamplesBufferSize: null.IntFrom(1)})
+		assert.NoError(t, err)
+		e.runVUOnce(context.Background(), vu)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			e.runVUOnce(ctx, vu)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			assert.Fail(t, "iteration didn't block on a full buffer")
+		case <-time.After(50 * time.Millisecond):
+		}
+		assert.Len(t, e.collect(), 3)
+
+		select {
+		case <-done:
+		case <-time.After(1 * time.Second):
+			assert.Fail(t, "iteration didn't unblock after collection")
+		}
+		cancel()
+		assert.Len(t, e.collect(), 3)
+	})
+	t.Run("drop", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{
+			SamplesBufferSize: null.IntFrom(1),
+			DropSamples:       null.BoolFrom(true),
+		})
+		assert.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			e.runVUOnce(context.Background(), vu)
+		}
+		assert.Equal(t, int64(6), e.numDroppedSamples)
+		assert.Len(t, e.collect(), 3)
+
+		sink := metrics.DroppedSamples.Sink.(*stats.CounterSink)
+		before := sink.Value
+		e.emitMetrics()
+		assert.Equal(t, int64(0), e.numDroppedSamples)
+		assert.Equal(t, float64(6), sink.Value-before)
+	})
+}
+
+func TestEngine_emitMetrics(t *testing.T) {
+	t.Run("totals", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{VUs: null.IntFrom(2), VUsMax: null.IntFrom(5)})
+		assert.NoError(t, err)
+		collector, stop := startDummyCollector()
+		defer stop()
+		e.Outputs = []Output{collector}
+
+		e.emitMetrics()
+		if assert.Len(t, collector.Samples, 2) {
+			assert.Equal(t, metrics.VUs, collector.Samples[0].Metric)
+			assert.Equal(t, float64(2), collector.Samples[0].Value)
+			assert.Equal(t, metrics.VUsMax, collector.Samples[1].Metric)
+			assert.Equal(t, float64(5), collector.Samples[1].Value)
+			assert.False(t, collector.Samples[0].Time.IsZero())
+		}
+	})
+	t.Run("scenarios", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{Scenarios: map[string]Scenario{
+			"browse": {VUs: null.IntFrom(3)},
+			"admin":  {VUs: null.IntFrom(2)},
+		}})
+		assert.NoError(t, err)
+		assert.NoError(t, e.SetVUs(4))
+		collector, stop := startDummyCollector()
+		defer stop()
+		e.Outputs = []Output{collector}
+
+		e.emitMetrics()
+		vus := map[string]float64{}
+		for _, s := range collector.Samples {
+			if s.Metric == metrics.VUs {
+				vus[s.Tags["scenario"]] = s.Value
+			}
+		}
+		assert.Equal(t, map[string]float64{"": 4, "admin": 2, "browse": 2}, vus)
+		assert.Equal(t, float64(4), e.Metrics["vus"].Sink.(*stats.GaugeSink).Value)
+	})
+}
+
+type sleepyVU struct {
+	RunnerFuncVU
+	slept time.Duration
+}
+
+func (u *sleepyVU) LastIterationSleep() time.Duration {
+	return u.slept
+}
+
+func TestEngine_runVUOnceIterationDuration(t *testing.T) {
+	vu := &vuEntry{VU: &sleepyVU{
+		RunnerFuncVU: RunnerFuncVU{Fn: func(ctx context.Context) ([]stats.Sample, error) {
+			time.Sleep(50 * time.Millisecond)
+			return nil, nil
+		}},
+		slept: 40 * time.Millisecond,
+	}}
+
+	for name, excludeSleep := range map[string]bool{"total": false, "active": true} {
+		t.Run(name, func(t *testing.T) {
+			e, err, _ := newTestEngine(nil, Options{IterationDurationExcludesSleep: null.BoolFrom(excludeSleep)})
+			assert.NoError(t, err)
+			e.runVUOnce(context.Background(), vu)
+
+			var durations []float64
+			for _, s := range e.collect() {
+				if s.Metric == metrics.IterationDuration {
+					durations = append(durations, s.Value)
+				}
+			}
+			if assert.Len(t, durations, 1) {
+				if excludeSleep {
+					assert.True(t, durations[0] >= 10 && durations[0] < 40, "wrong duration: %v", durations[0])
+				} else {
+					assert.True(t, durations[0] >= 50, "wrong duration: %v", durations[0])
+				}
+			}
+		})
+	}
+}
+
+func TestEngine_runVUIterationTimeouts(t *testing.T) {
+	var iterations int64
+	vu := &vuEntry{
+		VU: RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+			atomic.AddInt64(&iterations, 1)
+			return nil, &IterationError{VU: 1, Err: ErrIterationTimeout}
+		}).VU(),
+	}
+
+	e, err, _ := newTestEngine(nil, Options{MaxIterationTimeouts: null.IntFrom(2)})
+	assert.NoError(t, err)
+	close(e.vuStop)
+
+	done := make(chan struct{})
+	go func() {
+		e.runVU(context.Background(), context.Background(), vu)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		assert.Fail(t, "VU didn't stop")
+		return
+	}
+	assert.Equal(t, int64(2), atomic.LoadInt64(&iterations))
+
+	var timeouts int
+	for _, s := range e.collect() {
+		if s.Metric == metrics.IterationTimeouts {
+			timeouts++
+			assert.Equal(t, "1", s.Tags["vu"])
+		}
+	}
+	assert.Equal(t, 2, timeouts)
+}
+
+func TestEngine_runVUOnceIterationError(t *testing.T) {
+	vu := &vuEntry{
+		VU: RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+			return nil, &IterationError{VU: 57, Iteration: 48213, Seed: -1, Err: errors.New("oops\n> 1 | oops()")}
+		}).VU(),
+	}
+
+	e, err, _ := newTestEngine(nil, Options{})
+	assert.NoError(t, err)
+	assert.False(t, e.runVUOnce(context.Background(), vu))
+
+	var found bool
+	for _, s := range e.collect() {
+		if s.Metric != metrics.Errors {
+			continue
+		}
+		found = true
+		assert.Equal(t, map[string]string{
+			"error": "oops",
+			"vu":    "57",
+			"iter":  "48213",
+			"seed":  "-1",
+		}, s.Tags)
+	}
+	assert.True(t, found, "no error sample")
+}
+
+// A VU recording the scenario it's been assigned to.
+type scenarioTestVU struct {
+	RunnerFuncVU
+	scenario, exec string
+}
+
+func (vu *scenarioTestVU) SetScenario(name, exec string) error {
+	if exec == "missing" {
+		return errors.New("no such function")
+	}
+	vu.scenario, vu.exec = name, exec
+	return nil
+}
+
+type scenarioTestRunner struct {
+	RunnerFunc
+}
+
+func (r scenarioTestRunner) NewVU() (VU, error) {
+	return &scenarioTestVU{RunnerFuncVU: RunnerFuncVU{Fn: r.RunnerFunc}}, nil
+}
+
+func TestEngineScenarios(t *testing.T) {
+	testMetric := stats.New("test_metric", stats.Trend)
+	runner := scenarioTestRunner{RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+		return []stats.Sample{{Metric: testMetric, Tags: map[string]string{"a": "1"}, Value: 1}}, nil
+	})}
+	t.Run("allocation", func(t *testing.T) {
+		e, err, _ := newTestEngine(runner, Options{Scenarios: map[string]Scenario{
+			"browse": {VUs: null.IntFrom(3)},
+			"admin":  {VUs: null.IntFrom(2), Exec: null.StringFrom("admin")},
+		}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, int64(5), e.GetVUsMax())
+		assert.Equal(t, int64(5), e.GetVUs())
+
+		expected := []struct{ scenario, exec string }{
+			{"admin", "admin"}, {"admin", "admin"},
+			{"browse", "default"}, {"browse", "default"}, {"browse", "default"},
+		}
+		for i, entry := range e.vuEntries {
+			vu := entry.VU.(*scenarioTestVU)
+			assert.Equal(t, expected[i].scenario, entry.Scenario)
+			assert.Equal(t, expected[i].scenario, vu.scenario)
+			assert.Equal(t, expected[i].exec, vu.exec)
+		}
+	})
+	t.Run("segment", func(t *testing.T) {
+		e, err, _ := newTestEngine(runner, Options{
+			ExecutionSegment: null.StringFrom("1/2"),
+			Scenarios: map[string]Scenario{
+				"browse": {VUs: null.IntFrom(4)},
+				"admin":  {VUs: null.IntFrom(2)},
+			},
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, int64(3), e.GetVUsMax())
+		assert.Equal(t, "admin", e.vuEntries[0].Scenario)
+		assert.Equal(t, "browse", e.vuEntries[1].Scenario)
+	})
+	t.Run("invalid exec", func(t *testing.T) {
+		_, err, _ := newTestEngine(runner, Options{Scenarios: map[string]Scenario{
+			"admin": {VUs: null.IntFrom(1), Exec: null.StringFrom("missing")},
+		}})
+		assert.EqualError(t, err, "options.scenarios.admin.exec: no such function")
+	})
+	t.Run("tags", func(t *testing.T) {
+		e, err, _ := newTestEngine(runner, Options{Scenarios: map[string]Scenario{
+			"browse": {VUs: null.IntFrom(1)},
+		}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, e.runVUOnce(context.Background(), e.vuEntries[0]))
+		samples := e.collect()
+		assert.NotEmpty(t, samples)
+		for _, s := range samples {
+			assert.Equal(t, "browse", s.Tags["scenario"], s.Metric.Name)
+		}
+		assert.Equal(t, map[string]string{"a": "1", "scenario": "browse"}, samples[0].Tags)
+	})
+}
+
+func TestEngineHooks(t *testing.T) {
+	t.Run("VU created", func(t *testing.T) {
+		e, err, _ := newTestEngine(RunnerFunc(nil), Options{})
+		assert.NoError(t, err)
+		var created []VU
+		e.Hooks.OnVUCreated = func(vu VU) { created = append(created, vu) }
+		assert.NoError(t, e.SetVUsMax(3))
+		if assert.Len(t, created, 3) {
+			for i, vu := range created {
+				assert.Equal(t, e.vuEntries[i].VU, vu)
+			}
+		}
+	})
+	t.Run("iterations", func(t *testing.T) {
+		vu := &vuEntry{
+			VU: RunnerFunc(func(ctx context.Context) ([]stats.Sample, error) {
+				time.Sleep(1 * time.Millisecond)
+				return nil, errors.New("oops")
+			}).VU(),
+		}
+		e, err, _ := newTestEngine(nil, Options{})
+		assert.NoError(t, err)
+
+		var starts, ends []int64
+		e.Hooks.OnIterationStart = func(v VU, iteration int64) {
+			assert.Equal(t, vu.VU, v)
+			starts = append(starts, iteration)
+		}
+		e.Hooks.OnIterationEnd = func(v VU, iteration int64, d time.Duration, err error) {
+			assert.Equal(t, vu.VU, v)
+			assert.True(t, d >= 1*time.Millisecond, "duration too short: %s", d)
+			assert.EqualError(t, err, "oops")
+			ends = append(ends, iteration)
+		}
+		for i := 0; i < 2; i++ {
+			e.runVUOnce(context.Background(), vu)
+		}
+		assert.Equal(t, []int64{0, 1}, starts)
+		assert.Equal(t, []int64{0, 1}, ends)
+	})
+	t.Run("nil", func(t *testing.T) {
+		e, err, _ := newTestEngine(RunnerFunc(nil), Options{})
+		assert.NoError(t, err)
+		assert.NoError(t, e.SetVUsMax(1))
+		assert.False(t, e.runVUOnce(context.Background(), e.vuEntries[0]))
+	})
+}
+
 func TestEngine_processStages(t *testing.T) {
 	type checkpoint struct {
 		D    time.Duration
@@ -845,7 +1613,7 @@ func TestEngine_processStages(t *testing.T) {
 	}
 }
 
-func TestEngineCollector(t *testing.T) {
+func TestEngineOutputs(t *testing.T) {
 	testMetric := stats.New("test_metric", stats.Trend)
 	c := &dummy.Collector{}
 
@@ -853,7 +1621,7 @@ func TestEngineCollector(t *testing.T) {
 		return []stats.Sample{{Metric: testMetric}}, nil
 	}), Options{VUs: null.IntFrom(1), VUsMax: null.IntFrom(1)})
 	assert.NoError(t, err)
-	e.Collector = c
+	e.Outputs = []Output{c}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	ch := make(chan error)
@@ -861,13 +1629,13 @@ func TestEngineCollector(t *testing.T) {
 
 	time.Sleep(100 * time.Millisecond)
 	assert.True(t, e.IsRunning(), "engine not running")
-	assert.True(t, c.IsRunning(), "collector not running")
+	assert.True(t, c.IsRunning(), "output not running")
 
 	cancel()
 	assert.NoError(t, <-ch)
 
 	assert.False(t, e.IsRunning(), "engine still running")
-	assert.False(t, c.IsRunning(), "collector still running")
+	assert.False(t, c.IsRunning(), "output still running")
 
 	cSamples := []stats.Sample{}
 	for _, sample := range c.Samples {
@@ -876,10 +1644,17 @@ func TestEngineCollector(t *testing.T) {
 		}
 	}
 	numCollectorSamples := len(cSamples)
-	numEngineSamples := len(e.Metrics["test_metric"].Sink.(*stats.TrendSink).Values)
+	numEngineSamples := int(e.Metrics["test_metric"].Sink.(*stats.TrendSink).Count())
 	assert.Equal(t, numEngineSamples, numCollectorSamples)
 }
 
+// Returns a started output, which stops when the returned function is called.
+func startDummyCollector() (*dummy.Collector, func()) {
+	c := &dummy.Collector{}
+	_ = c.Start()
+	return c, func() { _ = c.Stop() }
+}
+
 func TestEngine_processSamples(t *testing.T) {
 	metric := stats.New("my_metric", stats.Gauge)
 
@@ -915,6 +1690,154 @@ func TestEngine_processSamples(t *testing.T) {
 
 		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric"].Sink)
 		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric{a:1}"].Sink)
+
+		// Later samples go to the same submetric, rather than replacing it.
+		sm := e.Metrics["my_metric{a:1}"]
+		e.processSamples(
+			stats.Sample{Metric: metric, Value: 2, Tags: map[string]string{"a": "1"}},
+			stats.Sample{Metric: metric, Value: 3, Tags: map[string]string{"a": "2"}},
+		)
+		assert.True(t, sm == e.Metrics["my_metric{a:1}"], "submetric was replaced")
+		assert.Equal(t, 2.0, sm.Sink.(*stats.GaugeSink).Value)
+		assert.Equal(t, 3.0, e.Metrics["my_metric"].Sink.(*stats.GaugeSink).Value)
+	})
+	t.Run("hosts", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{})
+		assert.NoError(t, err)
+
+		for host, statuses := range map[string][]string{
+			"a.example.com":     {"200", "200", "500", "0"},
+			"b.example.com:443": {"200"},
+		} {
+			for i, status := range statuses {
+				tags := map[string]string{"host": host, "status": status}
+				e.processSamples(
+					stats.Sample{Metric: metrics.HTTPReqs, Value: 1, Tags: tags},
+					stats.Sample{Metric: metrics.HTTPReqDuration, Value: float64(100 * (i + 1)), Tags: tags},
+				)
+			}
+		}
+
+		if assert.Len(t, e.Hosts, 2) {
+			a := e.Hosts["a.example.com"]
+			assert.Equal(t, int64(4), a.Requests)
+			assert.Equal(t, int64(2), a.Errors)
+			assert.Equal(t, 0.5, a.ErrorRate())
+			assert.Equal(t, 400.0, a.Duration.P(0.95))
+
+			b := e.Hosts["b.example.com:443"]
+			assert.Equal(t, int64(1), b.Requests)
+			assert.Equal(t, 0.0, b.ErrorRate())
+		}
+	})
+	t.Run("maxTagValues", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{MaxTagValues: null.IntFrom(1)})
+		assert.NoError(t, err)
+		collector, stop := startDummyCollector()
+		defer stop()
+		e.Outputs = []Output{collector}
+
+		e.processSamples(
+			stats.Sample{Metric: metric, Value: 1, Tags: map[string]string{"url": "a"}},
+			stats.Sample{Metric: metric, Value: 1, Tags: map[string]string{"url": "b"}},
+		)
+		if assert.Len(t, collector.Samples, 2) {
+			assert.Equal(t, "a", collector.Samples[0].Tags["url"])
+			assert.Equal(t, OtherTagValue, collector.Samples[1].Tags["url"])
+		}
+
+		_, err, _ = newTestEngine(nil, Options{MaxTagValues: null.IntFrom(-1)})
+		assert.EqualError(t, err, "options.maxTagValues: can't be negative")
+	})
+	t.Run("reset", func(t *testing.T) {
+		ths, err := stats.NewThresholds([]string{`value<2`})
+		assert.NoError(t, err)
+
+		e, err, _ := newTestEngine(nil, Options{
+			Thresholds: map[string]stats.Thresholds{"my_metric": ths},
+		})
+		assert.NoError(t, err)
+		collector, stop := startDummyCollector()
+		defer stop()
+		e.Outputs = []Output{collector}
+
+		e.processSamples(stats.Sample{Metric: metric, Value: 5})
+		e.processThresholds()
+		assert.True(t, e.IsTainted())
+
+		e.processSamples(
+			stats.Sample{Metric: metric, Value: 3},
+			stats.Sample{Metric: metrics.MetricsReset, Value: 1},
+			stats.Sample{Metric: metric, Value: 1.25},
+		)
+		assert.Equal(t, 1.25, e.Metrics["my_metric"].Sink.(*stats.GaugeSink).Value)
+		assert.False(t, e.Metrics["my_metric"].Thresholds.Thresholds[0].Failed)
+		assert.False(t, e.IsTainted())
+		e.processThresholds()
+		assert.False(t, e.IsTainted())
+
+		for _, s := range collector.Samples {
+			assert.NotEqual(t, metrics.MetricsReset, s.Metric)
+		}
+		assert.Len(t, collector.Samples, 3)
+	})
+	t.Run("discardFirst", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{DiscardFirst: null.StringFrom("10s")})
+		assert.NoError(t, err)
+		collector, stop := startDummyCollector()
+		defer stop()
+		e.Outputs = []Output{collector}
+
+		now := time.Now()
+		e.warmupEnd = now
+		tags := map[string]string{"a": "1"}
+		e.processSamples(
+			stats.Sample{Metric: metric, Time: now.Add(-1 * time.Second), Value: 5, Tags: tags},
+			stats.Sample{Metric: metric, Time: now.Add(-1 * time.Second), Value: 4, Tags: tags},
+			stats.Sample{Metric: metric, Time: now, Value: 1.25, Tags: tags},
+		)
+		assert.Equal(t, 1.25, e.Metrics["my_metric"].Sink.(*stats.GaugeSink).Value)
+		assert.Equal(t, int64(2), e.DiscardedSamples())
+		assert.Equal(t, int64(2), e.Summary().State.DiscardedSamples)
+
+		// Outputs still get everything, with warm-up samples tagged as such.
+		if assert.Len(t, collector.Samples, 3) {
+			assert.Equal(t, map[string]string{"a": "1", "warmup": "true"}, collector.Samples[0].Tags)
+			assert.Equal(t, map[string]string{"a": "1", "warmup": "true"}, collector.Samples[1].Tags)
+			assert.Equal(t, map[string]string{"a": "1"}, collector.Samples[2].Tags)
+		}
+
+		_, err, _ = newTestEngine(nil, Options{DiscardFirst: null.StringFrom("-1s")})
+		assert.EqualError(t, err, "options.discardFirst: can't be negative")
+	})
+	t.Run("percentiles", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{Percentiles: []float64{50, 99.9}})
+		assert.NoError(t, err)
+
+		e.processSamples(
+			stats.Sample{Metric: stats.New("my_trend", stats.Trend), Value: 1.25},
+		)
+
+		sink := e.Metrics["my_trend"].Sink.(*stats.TrendSink)
+		assert.Equal(t, []float64{50, 99.9}, sink.Percentiles)
+		assert.Contains(t, sink.Format(), "p99.9")
+	})
+	t.Run("histogram", func(t *testing.T) {
+		e, err, _ := newTestEngine(nil, Options{
+			TrendSink:   null.StringFrom(TrendSinkHistogram),
+			Percentiles: []float64{99.9},
+		})
+		assert.NoError(t, err)
+
+		e.processSamples(
+			stats.Sample{Metric: stats.New("my_histogram", stats.Trend), Value: 1.25},
+			stats.Sample{Metric: stats.New("my_counter", stats.Counter), Value: 1},
+		)
+
+		sink := e.Metrics["my_histogram"].Sink.(*stats.HistogramSink)
+		assert.Equal(t, uint64(1), sink.Count())
+		assert.Equal(t, 1.25, sink.Format()["p99.9"])
+		assert.IsType(t, &stats.CounterSink{}, e.Metrics["my_counter"].Sink)
 	})
 }
 
@@ -955,3 +1878,174 @@ func TestEngine_processThresholds(t *testing.T) {
 		})
 	}
 }
+
+func TestEngine_Summary(t *testing.T) {
+	root, err := NewGroup("", nil)
+	assert.NoError(t, err)
+	group, err := root.Group("my group")
+	assert.NoError(t, err)
+	check, err := group.Check("my check")
+	assert.NoError(t, err)
+	check.Passes = 3
+	check.Fails = 1
+
+	ths, err := stats.NewThresholds([]string{"value<1", "value<2"})
+	assert.NoError(t, err)
+	e, err, _ := newTestEngine(runnerWithGroup{group: root}, Options{
+		Thresholds: map[string]stats.Thresholds{"my_metric": ths},
+	})
+	assert.NoError(t, err)
+
+	metric := stats.New("my_metric", stats.Gauge, stats.Time)
+	e.processSamples(stats.Sample{Metric: metric, Value: 1.25})
+	e.processThresholds()
+
+	summary := e.Summary()
+	if assert.Contains(t, summary.Metrics, "my_metric") {
+		m := summary.Metrics["my_metric"]
+		assert.Equal(t, stats.Gauge, m.Type)
+		assert.Equal(t, stats.Time, m.Contains)
+		assert.Equal(t, map[string]float64{"value": 1.25}, m.Values)
+		assert.Equal(t, map[string]SummaryThreshold{
+			"value<1": {OK: false},
+			"value<2": {OK: true},
+		}, m.Thresholds)
+	}
+	assert.Equal(t, SummaryGroup{
+		Groups: []SummaryGroup{{
+			Name:   "my group",
+			Path:   "::my group",
+			Groups: []SummaryGroup{},
+			Checks: []SummaryCheck{{Name: "my check", Path: "::my group::my check", Passes: 3, Fails: 1}},
+		}},
+		Checks: []SummaryCheck{},
+	}, summary.RootGroup)
+
+	t.Run("unmatched", func(t *testing.T) {
+		ths, err := stats.NewThresholds([]string{"value<1"})
+		assert.NoError(t, err)
+		e, err, _ := newTestEngine(runnerWithGroup{group: root}, Options{
+			Thresholds: map[string]stats.Thresholds{
+				"my_metric{a:1}":     ths,
+				"my_metric{a:2}":     ths,
+				"other_metric":       ths,
+				"my_metric{a:\"1\"}": ths,
+			},
+		})
+		assert.NoError(t, err)
+
+		metric := stats.New("my_metric", stats.Gauge, stats.Time)
+		e.processSamples(stats.Sample{Metric: metric, Value: 0.5, Tags: map[string]string{"a": "1"}})
+		e.processThresholds()
+		assert.False(t, e.IsTainted())
+		assert.Equal(t, []string{"my_metric{a:2}", "other_metric"}, e.UnmatchedThresholds())
+
+		summary := e.Summary()
+		assert.Equal(t, map[string]SummaryThreshold{"value<1": {OK: true}}, summary.Metrics["my_metric{a:1}"].Thresholds)
+		assert.Equal(t, map[string]SummaryThreshold{"value<1": {OK: true}}, summary.Metrics[`my_metric{a:"1"}`].Thresholds)
+		if assert.Contains(t, summary.Metrics, "my_metric{a:2}") {
+			m := summary.Metrics["my_metric{a:2}"]
+			assert.Equal(t, stats.Gauge, m.Type)
+			assert.Equal(t, map[string]float64{}, m.Values)
+			assert.Equal(t, map[string]SummaryThreshold{"value<1": {NoSamples: true}}, m.Thresholds)
+		}
+		assert.Contains(t, summary.Metrics, "other_metric")
+	})
+
+	t.Run("values", func(t *testing.T) {
+		// Value names are part of handleSummary()'s API; scripts read eg. values.p95.
+		keys := func(m map[string]float64) []string {
+			var keys []string
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return keys
+		}
+
+		for name, data := range map[string]struct {
+			Options Options
+			Keys    map[stats.MetricType][]string
+		}{
+			"default": {Options{}, map[stats.MetricType][]string{
+				stats.Counter: {"count"},
+				stats.Gauge:   {"value"},
+				stats.Rate:    {"rate"},
+				stats.Trend:   {"avg", "max", "med", "min", "p90", "p95", "p99"},
+			}},
+			"percentiles": {Options{Percentiles: []float64{50, 99.9}}, map[stats.MetricType][]string{
+				stats.Trend: {"avg", "max", "med", "min", "p50", "p99.9"},
+			}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				e, err, _ := newTestEngine(nil, data.Options)
+				assert.NoError(t, err)
+				for typ := range data.Keys {
+					e.processSamples(stats.Sample{Metric: stats.New("my_"+typ.String(), typ), Value: 1})
+				}
+
+				summary := e.Summary()
+				for typ, expected := range data.Keys {
+					if assert.Contains(t, summary.Metrics, "my_"+typ.String()) {
+						assert.Equal(t, expected, keys(summary.Metrics["my_"+typ.String()].Values), typ.String())
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(summary)
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), `"my_metric":{"type":"gauge","contains":"time","values":{"value":1.25}`)
+		assert.Contains(t, string(data), `"root_group":{"name":"","path":""`)
+		assert.Contains(t, string(data), `"state":{"test_run_duration_ms":0,"interrupted":false,"discarded_samples":0}`)
+	})
+}
+
+type runnerWithGroup struct {
+	RunnerFunc
+	group *Group
+}
+
+func (r runnerWithGroup) GetDefaultGroup() *Group {
+	return r.group
+}
+
+func TestEngine_WriteCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k6-checkpoint")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	filename := filepath.Join(dir, "checkpoint.json")
+
+	e, err, _ := newTestEngine(nil, Options{})
+	assert.NoError(t, err)
+	e.processSamples(stats.Sample{Metric: stats.New("my_metric", stats.Counter), Value: 2})
+
+	for _, interrupted := range []bool{false, true} {
+		t.Run(fmt.Sprintf("interrupted=%v", interrupted), func(t *testing.T) {
+			assert.NoError(t, e.WriteCheckpoint(filename, interrupted))
+
+			data, err := ioutil.ReadFile(filename)
+			if !assert.NoError(t, err) {
+				return
+			}
+			var summary Summary
+			if assert.NoError(t, json.Unmarshal(data, &summary)) {
+				assert.Equal(t, interrupted, summary.State.Interrupted)
+				assert.Equal(t, map[string]float64{"count": 2}, summary.Metrics["my_metric"].Values)
+			}
+
+			// Nothing but the checkpoint itself should be left behind.
+			files, err := ioutil.ReadDir(dir)
+			if assert.NoError(t, err) && assert.Len(t, files, 1) {
+				assert.Equal(t, "checkpoint.json", files[0].Name())
+			}
+		})
+	}
+	t.Run("unwritable", func(t *testing.T) {
+		assert.Error(t, e.WriteCheckpoint(filepath.Join(dir, "nope", "checkpoint.json"), false))
+	})
+}
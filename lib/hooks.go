@@ -0,0 +1,59 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"time"
+)
+
+// Callbacks for embedders that want to observe a test as it runs, eg. to plug in their own
+// tracing or bookkeeping; see Engine.Hooks. Any of them may be left nil.
+//
+// They're called from the engine's and VUs' goroutines, so they must be safe for concurrent use,
+// and should return quickly, since the VU waits for them.
+type Hooks struct {
+	// Called whenever the engine creates a new VU, before it runs anything.
+	OnVUCreated func(vu VU)
+
+	// Called right before and after each iteration. iteration counts from 0 for each VU; duration
+	// is the wall time spent in RunOnce, and err what it returned. Iterations cut short by the test
+	// ending are reported too, usually with a cancellation error.
+	OnIterationStart func(vu VU, iteration int64)
+	OnIterationEnd   func(vu VU, iteration int64, duration time.Duration, err error)
+}
+
+func (h Hooks) vuCreated(vu VU) {
+	if h.OnVUCreated != nil {
+		h.OnVUCreated(vu)
+	}
+}
+
+func (h Hooks) iterationStart(vu VU, iteration int64) {
+	if h.OnIterationStart != nil {
+		h.OnIterationStart(vu, iteration)
+	}
+}
+
+func (h Hooks) iterationEnd(vu VU, iteration int64, duration time.Duration, err error) {
+	if h.OnIterationEnd != nil {
+		h.OnIterationEnd(vu, iteration, duration, err)
+	}
+}
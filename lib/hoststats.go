@@ -0,0 +1,57 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"strconv"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// HTTP statistics for a single host, for a per-host breakdown in the summary.
+type HostStats struct {
+	Requests int64
+	Errors   int64
+
+	// Request durations; see metrics.HTTPReqDuration.
+	Duration stats.PercentileSink
+}
+
+// Returns the share of requests that failed, either at the network level or with a status >= 400.
+func (h *HostStats) ErrorRate() float64 {
+	if h.Requests == 0 {
+		return 0
+	}
+	return float64(h.Errors) / float64(h.Requests)
+}
+
+func (h *HostStats) add(sample stats.Sample) {
+	switch sample.Metric {
+	case metrics.HTTPReqs:
+		h.Requests++
+		if status, _ := strconv.Atoi(sample.Tags["status"]); status <= 0 || status >= 400 {
+			h.Errors++
+		}
+	case metrics.HTTPReqDuration:
+		h.Duration.Add(sample)
+	}
+}
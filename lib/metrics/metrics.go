@@ -11,17 +11,76 @@ var (
 	Iterations = stats.New("iterations", stats.Counter)
 	Errors     = stats.New("errors", stats.Counter)
 
+	// Wall-clock time of every iteration, successful or not; see also
+	// Options.IterationDurationExcludesSleep. Failed iterations are counted in Errors.
+	IterationDuration = stats.New("iteration_duration", stats.Trend, stats.Time)
+
+	// Iterations aborted for exceeding Options.MaxIterationDuration.
+	IterationTimeouts = stats.New("iteration_timeouts", stats.Counter)
+
+	// Samples thrown away because the engine couldn't keep up; see Options.DropSamples.
+	DroppedSamples = stats.New("dropped_samples", stats.Counter)
+
 	// Runner-emitted.
 	Checks = stats.New("checks", stats.Rate)
 
+	// Not a real metric; a sample of this resets all aggregated metrics, see Engine.ResetMetrics().
+	// It's never passed on to outputs.
+	MetricsReset = stats.New("__metrics_reset__", stats.Counter)
+
 	// HTTP-related.
-	HTTPReqs          = stats.New("http_reqs", stats.Counter)
-	HTTPReqDuration   = stats.New("http_req_duration", stats.Trend, stats.Time)
-	HTTPReqBlocked    = stats.New("http_req_blocked", stats.Trend, stats.Time)
-	HTTPReqConnecting = stats.New("http_req_connecting", stats.Trend, stats.Time)
-	HTTPReqSending    = stats.New("http_req_sending", stats.Trend, stats.Time)
-	HTTPReqWaiting    = stats.New("http_req_waiting", stats.Trend, stats.Time)
-	HTTPReqReceiving  = stats.New("http_req_receiving", stats.Trend, stats.Time)
+	HTTPReqs              = stats.New("http_reqs", stats.Counter)
+	HTTPReqDuration       = stats.New("http_req_duration", stats.Trend, stats.Time)
+	HTTPReqBlocked        = stats.New("http_req_blocked", stats.Trend, stats.Time)
+	HTTPReqConnecting     = stats.New("http_req_connecting", stats.Trend, stats.Time)
+	HTTPReqTLSHandshaking = stats.New("http_req_tls_handshaking", stats.Trend, stats.Time)
+	HTTPReqSending        = stats.New("http_req_sending", stats.Trend, stats.Time)
+	HTTPReqWaiting        = stats.New("http_req_waiting", stats.Trend, stats.Time)
+	HTTPReqReceiving      = stats.New("http_req_receiving", stats.Trend, stats.Time)
+
+	// Responses whose body couldn't be read in full, eg. because the connection dropped.
+	HTTPReqReadErrors = stats.New("http_req_read_errors", stats.Counter)
+
+	// Requests aborted for taking longer than their timeout; see lib.Options.HTTPTimeout.
+	HTTPReqTimeouts = stats.New("http_req_timeouts", stats.Counter)
+
+	// Sizes of request bodies sent with compressBody, before and after compression.
+	HTTPReqBodySize       = stats.New("http_req_body_size", stats.Trend, stats.Data)
+	HTTPReqBodyCompressed = stats.New("http_req_body_compressed_size", stats.Trend, stats.Data)
+
+	// Time spent waiting for the rps options' rate limits; not part of http_req_duration.
+	HTTPReqRateLimited = stats.New("http_req_rate_limited", stats.Trend, stats.Time)
+
+	// Connections closed for exceeding connectionMaxAge or connectionMaxRequests, each of which
+	// forces a reconnect.
+	HTTPReconnects = stats.New("http_reconnects", stats.Counter)
+
+	// Host lookups for new connections, and the share of them answered from the DNS cache.
+	DNSLookupDuration = stats.New("dns_lookup_duration", stats.Trend, stats.Time)
+	DNSCacheHits      = stats.New("dns_cache_hits", stats.Rate)
+
+	// Time requests spent waiting for an idle connection from the pool; only for reused ones, since
+	// http_req_blocked covers connecting too for new connections.
+	HTTPReqPoolWait = stats.New("http_req_pool_wait", stats.Trend, stats.Time)
+
+	// Connections made by the shared dialer: open ones per host, new ones, and errors by class
+	// ("refused", "reset", "timeout" or "other").
+	ConnsOpen  = stats.New("conns_open", stats.Gauge)
+	ConnsNew   = stats.New("conns_new", stats.Counter)
+	ConnErrors = stats.New("conn_errors", stats.Counter)
+
+	// gRPC-related.
+	GRPCReqs        = stats.New("grpc_reqs", stats.Counter)
+	GRPCReqDuration = stats.New("grpc_req_duration", stats.Trend, stats.Time)
+
+	// Server-Sent Events-related.
+	SSEStreams          = stats.New("sse_streams", stats.Counter)
+	SSEEvents           = stats.New("sse_events", stats.Counter)
+	SSETimeToFirstEvent = stats.New("sse_time_to_first_event", stats.Trend, stats.Time)
+	SSEStreamDuration   = stats.New("sse_stream_duration", stats.Trend, stats.Time)
+
+	// Raw TCP/UDP connections, made with k6/net.
+	NetConnectTime = stats.New("net_connect_time", stats.Trend, stats.Time)
 
 	// Network-related; used for future protocols as well.
 	DataSent     = stats.New("data_sent", stats.Counter, stats.Data)
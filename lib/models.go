@@ -26,6 +26,7 @@ import (
 	"encoding/json"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -144,6 +145,26 @@ func (g *Group) Check(name string) (*Check, error) {
 	return check, nil
 }
 
+// Zeroes the pass and fail counts of all checks in this group and its subgroups.
+func (g *Group) ResetChecks() {
+	g.checkMutex.Lock()
+	for _, check := range g.Checks {
+		atomic.StoreInt64(&check.Passes, 0)
+		atomic.StoreInt64(&check.Fails, 0)
+	}
+	g.checkMutex.Unlock()
+
+	g.groupMutex.Lock()
+	groups := make([]*Group, 0, len(g.Groups))
+	for _, group := range g.Groups {
+		groups = append(groups, group)
+	}
+	g.groupMutex.Unlock()
+	for _, group := range groups {
+		group.ResetChecks()
+	}
+}
+
 type Check struct {
 	ID    string `json:"id"`
 	Path  string `json:"path"`
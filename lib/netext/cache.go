@@ -0,0 +1,203 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default maximum size of a Cache, in bytes.
+const DefaultCacheSize = 10 * 1024 * 1024
+
+// A CacheEntry is a cached HTTP response.
+type CacheEntry struct {
+	URL     string
+	Status  int
+	Headers map[string]string
+	Body    []byte
+
+	// Validators, used to make conditional requests once the entry is stale.
+	ETag         string
+	LastModified string
+
+	// The entry is fresh, and can be used without revalidation, until this time.
+	Expires time.Time
+}
+
+// Makes a cache entry from a response, or returns nil if the response is not cacheable; that is,
+// if it's marked as no-store, or has neither a max-age nor any validators.
+func NewCacheEntry(url string, t time.Time, status int, header http.Header, body []byte) *CacheEntry {
+	maxAge, noStore := cacheControl(header)
+	if noStore {
+		return nil
+	}
+
+	etag := header.Get("ETag")
+	lastModified := header.Get("Last-Modified")
+	if maxAge == 0 && etag == "" && lastModified == "" {
+		return nil
+	}
+
+	headers := make(map[string]string, len(header))
+	for k, vs := range header {
+		headers[k] = strings.Join(vs, ", ")
+	}
+	return &CacheEntry{
+		URL:          url,
+		Status:       status,
+		Headers:      headers,
+		Body:         body,
+		ETag:         etag,
+		LastModified: lastModified,
+		Expires:      t.Add(maxAge),
+	}
+}
+
+// Returns whether the entry can be used without revalidation at the given time.
+func (e *CacheEntry) IsFresh(t time.Time) bool {
+	return t.Before(e.Expires)
+}
+
+// Returns a copy of the entry, with its freshness updated from a 304 Not Modified response.
+func (e CacheEntry) Revalidated(t time.Time, header http.Header) *CacheEntry {
+	maxAge, _ := cacheControl(header)
+	e.Expires = t.Add(maxAge)
+	return &e
+}
+
+// Parses the Cache-Control header; "no-cache" is treated as "max-age=0".
+func cacheControl(header http.Header) (maxAge time.Duration, noStore bool) {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store":
+			return 0, true
+		case directive == "no-cache":
+			return 0, false
+		case strings.HasPrefix(directive, "max-age="):
+			secs, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64)
+			if err == nil && secs > 0 {
+				maxAge = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return maxAge, false
+}
+
+type cacheItem struct {
+	url   string
+	entry *CacheEntry
+}
+
+// A Cache is a size-bounded cache of HTTP responses, keyed by URL, which emulates a browser's cache.
+// When the total size of the cached bodies exceeds its max size, the least recently used entries
+// are evicted. It's safe for concurrent use.
+type Cache struct {
+	maxSize int64
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+	lock    sync.Mutex
+}
+
+func NewCache(maxSize int64) *Cache {
+	return &Cache{
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Returns the entry for a URL, or nil if there is none.
+func (c *Cache) Get(url string) *CacheEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	el, ok := c.entries[url]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(cacheItem).entry
+}
+
+// Stores an entry under the given URL, replacing any previous one. Entries larger than the cache
+// itself are silently discarded.
+func (c *Cache) Set(url string, e *CacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.remove(url)
+	if int64(len(e.Body)) > c.maxSize {
+		return
+	}
+
+	c.entries[url] = c.lru.PushFront(cacheItem{url, e})
+	c.size += int64(len(e.Body))
+	c.evict()
+}
+
+// Changes the cache's max size, evicting entries if they no longer fit.
+func (c *Cache) SetMaxSize(maxSize int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.maxSize = maxSize
+	c.evict()
+}
+
+// Returns the number of entries in the cache.
+func (c *Cache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len()
+}
+
+// Removes all entries from the cache.
+func (c *Cache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+}
+
+func (c *Cache) evict() {
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back().Value.(cacheItem).url)
+	}
+}
+
+func (c *Cache) remove(url string) {
+	el, ok := c.entries[url]
+	if !ok {
+		return
+	}
+	c.lru.Remove(el)
+	delete(c.entries, url)
+	c.size -= int64(len(el.Value.(cacheItem).entry.Body))
+}
@@ -0,0 +1,116 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCacheEntry(t *testing.T) {
+	now := time.Now()
+	testdata := map[string]struct {
+		Header  http.Header
+		Valid   bool
+		Expires time.Time
+	}{
+		"none":          {http.Header{}, false, time.Time{}},
+		"no-store":      {http.Header{"Cache-Control": {"no-store, max-age=60"}}, false, time.Time{}},
+		"max-age":       {http.Header{"Cache-Control": {"public, max-age=60"}}, true, now.Add(60 * time.Second)},
+		"no-cache":      {http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"abc"`}}, true, now},
+		"ETag":          {http.Header{"Etag": {`"abc"`}}, true, now},
+		"Last-Modified": {http.Header{"Last-Modified": {"Mon, 01 May 2017 00:00:00 GMT"}}, true, now},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			e := NewCacheEntry("http://example.com/", now, 200, data.Header, []byte("body"))
+			if !data.Valid {
+				assert.Nil(t, e)
+				return
+			}
+			if assert.NotNil(t, e) {
+				assert.Equal(t, data.Expires, e.Expires)
+				assert.Equal(t, data.Header.Get("ETag"), e.ETag)
+				assert.Equal(t, data.Header.Get("Last-Modified"), e.LastModified)
+			}
+		})
+	}
+}
+
+func TestCacheEntryRevalidated(t *testing.T) {
+	now := time.Now()
+	e := &CacheEntry{Body: []byte("body"), ETag: `"abc"`, Expires: now}
+	assert.False(t, e.IsFresh(now))
+
+	e2 := e.Revalidated(now, http.Header{"Cache-Control": {"max-age=60"}})
+	assert.True(t, e2.IsFresh(now))
+	assert.Equal(t, `"abc"`, e2.ETag)
+	assert.False(t, e.IsFresh(now), "original entry was modified")
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(10)
+	assert.Nil(t, c.Get("a"))
+
+	c.Set("a", &CacheEntry{Body: []byte("aaaa")})
+	c.Set("b", &CacheEntry{Body: []byte("bbbb")})
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, "aaaa", string(c.Get("a").Body))
+
+	t.Run("Evict", func(t *testing.T) {
+		// "b" is the least recently used entry, as "a" was just read.
+		c.Set("c", &CacheEntry{Body: []byte("cccc")})
+		assert.Equal(t, 2, c.Len())
+		assert.NotNil(t, c.Get("a"))
+		assert.Nil(t, c.Get("b"))
+		assert.NotNil(t, c.Get("c"))
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		c.Set("a", &CacheEntry{Body: []byte("AAAA")})
+		assert.Equal(t, 2, c.Len())
+		assert.Equal(t, "AAAA", string(c.Get("a").Body))
+	})
+
+	t.Run("Too Large", func(t *testing.T) {
+		c.Set("d", &CacheEntry{Body: []byte("ddddddddddd")})
+		assert.Nil(t, c.Get("d"))
+		assert.Equal(t, 2, c.Len())
+	})
+
+	t.Run("SetMaxSize", func(t *testing.T) {
+		// "c" was used less recently than "a", which was just replaced.
+		c.SetMaxSize(5)
+		assert.Equal(t, 1, c.Len())
+		assert.NotNil(t, c.Get("a"))
+		assert.Nil(t, c.Get("c"))
+		c.SetMaxSize(10)
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		c.Clear()
+		assert.Equal(t, 0, c.Len())
+		assert.Nil(t, c.Get("a"))
+	})
+}
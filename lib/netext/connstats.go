@@ -0,0 +1,238 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// Classes of connection errors, as used for the "class" tag on conn_errors.
+const (
+	ConnErrorRefused = "refused"
+	ConnErrorReset   = "reset"
+	ConnErrorTimeout = "timeout"
+	ConnErrorOther   = "other"
+)
+
+// ConnStats keeps count of the connections made through a Dialer, and every copy of it made with
+// ForVU(); updating them is a single atomic operation per event, so it's always on.
+type ConnStats struct {
+	// Where to warn about running out of local ports or file descriptors; see SetLogger().
+	logger      *log.Logger
+	loggerMutex sync.Mutex
+
+	// Open connections per host; the counters are never removed, so they can be used unlocked.
+	open      map[string]*int64
+	openMutex sync.RWMutex
+
+	// Counted since the last call to Samples().
+	opened                           int64
+	refused, reset, timeout, errored int64
+
+	warned int32
+}
+
+func NewConnStats() *ConnStats {
+	return &ConnStats{open: make(map[string]*int64)}
+}
+
+// Returns the counter of open connections to a host, creating it if needed.
+func (s *ConnStats) openCounter(host string) *int64 {
+	s.openMutex.RLock()
+	counter, ok := s.open[host]
+	s.openMutex.RUnlock()
+	if ok {
+		return counter
+	}
+
+	s.openMutex.Lock()
+	defer s.openMutex.Unlock()
+	if counter, ok = s.open[host]; !ok {
+		counter = new(int64)
+		s.open[host] = counter
+	}
+	return counter
+}
+
+// Records a new connection to a host, returning it wrapped to keep track of when it's closed,
+// and of resets while it's in use.
+func (s *ConnStats) track(host string, conn net.Conn) net.Conn {
+	if s == nil {
+		return conn
+	}
+	counter := s.openCounter(host)
+	atomic.AddInt64(counter, 1)
+	atomic.AddInt64(&s.opened, 1)
+	return &trackedConn{Conn: conn, stats: s, open: counter}
+}
+
+// Records a failed dial or a connection error.
+func (s *ConnStats) addError(err error) {
+	if s == nil {
+		return
+	}
+	switch classifyConnError(err) {
+	case ConnErrorRefused:
+		atomic.AddInt64(&s.refused, 1)
+	case ConnErrorReset:
+		atomic.AddInt64(&s.reset, 1)
+	case ConnErrorTimeout:
+		atomic.AddInt64(&s.timeout, 1)
+	default:
+		atomic.AddInt64(&s.errored, 1)
+	}
+
+	if errno, ok := syscallErrno(err); ok {
+		switch errno {
+		case syscall.EADDRNOTAVAIL, syscall.EMFILE, syscall.ENFILE:
+			if atomic.CompareAndSwapInt32(&s.warned, 0, 1) {
+				s.getLogger().WithError(err).Warn("Ran out of local ports or file descriptors; " +
+					"try raising the open files limit (ulimit -n), or spreading connections over more local IPs")
+			}
+		}
+	}
+}
+
+// Sets where to warn about running out of local ports or file descriptors; logrus' standard
+// logger by default. It's shared by all copies of a Dialer, so it's safe to call concurrently.
+func (s *ConnStats) SetLogger(logger *log.Logger) {
+	if s == nil {
+		return
+	}
+	s.loggerMutex.Lock()
+	defer s.loggerMutex.Unlock()
+	s.logger = logger
+}
+
+func (s *ConnStats) getLogger() *log.Logger {
+	s.loggerMutex.Lock()
+	defer s.loggerMutex.Unlock()
+	if s.logger == nil {
+		return log.StandardLogger()
+	}
+	return s.logger
+}
+
+// Returns the number of connections currently open to each host.
+func (s *ConnStats) Open() map[string]int64 {
+	s.openMutex.RLock()
+	defer s.openMutex.RUnlock()
+	open := make(map[string]int64, len(s.open))
+	for host, counter := range s.open {
+		open[host] = atomic.LoadInt64(counter)
+	}
+	return open
+}
+
+// Returns samples for the current number of open connections per host, and new connections and
+// errors since the last call.
+func (s *ConnStats) Samples(t time.Time) []stats.Sample {
+	var samples []stats.Sample
+	for host, n := range s.Open() {
+		samples = append(samples, stats.Sample{
+			Metric: metrics.ConnsOpen, Time: t, Tags: map[string]string{"host": host}, Value: float64(n),
+		})
+	}
+	if n := atomic.SwapInt64(&s.opened, 0); n > 0 {
+		samples = append(samples, stats.Sample{Metric: metrics.ConnsNew, Time: t, Value: float64(n)})
+	}
+	for class, counter := range map[string]*int64{
+		ConnErrorRefused: &s.refused,
+		ConnErrorReset:   &s.reset,
+		ConnErrorTimeout: &s.timeout,
+		ConnErrorOther:   &s.errored,
+	} {
+		if n := atomic.SwapInt64(counter, 0); n > 0 {
+			samples = append(samples, stats.Sample{
+				Metric: metrics.ConnErrors, Time: t, Tags: map[string]string{"class": class}, Value: float64(n),
+			})
+		}
+	}
+	return samples
+}
+
+// Digs the errno out of a network error, if there is one.
+func syscallErrno(err error) (syscall.Errno, bool) {
+	if oerr, ok := err.(*net.OpError); ok {
+		err = oerr.Err
+	}
+	if serr, ok := err.(*os.SyscallError); ok {
+		err = serr.Err
+	}
+	errno, ok := err.(syscall.Errno)
+	return errno, ok
+}
+
+// Returns which of the ConnError* classes an error belongs to.
+func classifyConnError(err error) string {
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return ConnErrorTimeout
+	}
+	if errno, ok := syscallErrno(err); ok {
+		switch errno {
+		case syscall.ECONNREFUSED:
+			return ConnErrorRefused
+		case syscall.ECONNRESET, syscall.EPIPE:
+			return ConnErrorReset
+		}
+	}
+	return ConnErrorOther
+}
+
+type trackedConn struct {
+	net.Conn
+
+	stats  *ConnStats
+	open   *int64
+	closed int32
+}
+
+func (c *trackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil && classifyConnError(err) == ConnErrorReset {
+		c.stats.addError(err)
+	}
+	return n, err
+}
+
+func (c *trackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if err != nil && classifyConnError(err) == ConnErrorReset {
+		c.stats.addError(err)
+	}
+	return n, err
+}
+
+func (c *trackedConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		atomic.AddInt64(c.open, -1)
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,135 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	logtest "github.com/Sirupsen/logrus/hooks/test"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnStats(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = l.Close() }()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	d := NewDialer(net.Dialer{})
+	vd := d.ForVU()
+	conn1, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	conn2, err := vd.DialContext(context.Background(), "tcp", l.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]int64{"127.0.0.1": 2}, d.Stats.Open())
+
+	assert.NoError(t, conn1.Close())
+	_ = conn1.Close()
+	assert.Equal(t, map[string]int64{"127.0.0.1": 1}, d.Stats.Open())
+
+	samples := d.Stats.Samples(time.Now())
+	if assert.Len(t, samples, 2) {
+		assert.Equal(t, metrics.ConnsOpen, samples[0].Metric)
+		assert.Equal(t, "127.0.0.1", samples[0].Tags["host"])
+		assert.Equal(t, 1.0, samples[0].Value)
+		assert.Equal(t, metrics.ConnsNew, samples[1].Metric)
+		assert.Equal(t, 2.0, samples[1].Value)
+	}
+
+	assert.NoError(t, conn2.Close())
+	samples = d.Stats.Samples(time.Now())
+	if assert.Len(t, samples, 1) {
+		assert.Equal(t, metrics.ConnsOpen, samples[0].Metric)
+		assert.Equal(t, 0.0, samples[0].Value)
+	}
+
+	t.Run("Refused", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		addr := l.Addr().String()
+		assert.NoError(t, l.Close())
+
+		d := NewDialer(net.Dialer{})
+		_, err = d.DialContext(context.Background(), "tcp", addr)
+		assert.Error(t, err)
+
+		samples := d.Stats.Samples(time.Now())
+		if assert.Len(t, samples, 1) {
+			assert.Equal(t, metrics.ConnErrors, samples[0].Metric)
+			assert.Equal(t, ConnErrorRefused, samples[0].Tags["class"])
+			assert.Equal(t, 1.0, samples[0].Value)
+		}
+	})
+}
+
+func TestClassifyConnError(t *testing.T) {
+	testdata := map[string]error{
+		ConnErrorRefused: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+		ConnErrorReset:   &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+		ConnErrorTimeout: &net.DNSError{IsTimeout: true},
+		ConnErrorOther:   &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)},
+	}
+	for class, err := range testdata {
+		t.Run(class, func(t *testing.T) {
+			assert.Equal(t, class, classifyConnError(err))
+		})
+	}
+}
+
+func TestConnStatsWarning(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	s := NewConnStats()
+	s.SetLogger(logger)
+
+	s.addError(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)})
+	assert.Len(t, hook.Entries, 0)
+
+	for i := 0; i < 2; i++ {
+		s.addError(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EADDRNOTAVAIL)})
+	}
+	if assert.Len(t, hook.Entries, 1) {
+		assert.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+		assert.Contains(t, hook.LastEntry().Message, "ulimit -n")
+	}
+}
@@ -22,43 +22,238 @@ package netext
 
 import (
 	"context"
+	"math/rand"
 	"net"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
-	"github.com/viki-org/dnscache"
+	"github.com/pkg/errors"
 )
 
 type Dialer struct {
 	net.Dialer
 
-	Resolver *dnscache.Resolver
+	// Looks up hosts; by default, lookups are cached forever, and the first address is used.
+	Resolver *Resolver
+	IPSelect IPSelect
+
+	// Picks addresses with IPSelectRandom; math/rand's by default. A VU's dialer uses the VU's
+	// seeded RNG, so a replayed iteration connects to the same addresses.
+	Rand func() float64
+
+	// Maps hosts ("host" or "host:port") to unix sockets to dial instead of resolving them. This
+	// happens below HTTP and TLS, so the URL's host is still used for the Host header and SNI.
+	UnixSockets map[string]string
+
+	// Local addresses to make connections from, taken in turns; eg. to spread connections from a
+	// multi-homed host over several source IPs. Only those of the target's family are used.
+	LocalIPs []net.IP
+
+	// Connections made and errors seen; shared by copies made with ForVU().
+	Stats *ConnStats
+
+	// Caps the connections open to a host at once; dials past it wait for one to be closed, or
+	// for their context to be done. Counted separately for every copy made with ForVU(). 0 means
+	// no limit. Use SetMaxConnsPerHost() to change it once the dialer's in use.
+	MaxConnsPerHost int
+
+	// Shared by copies made with ForVU(), so they take turns together.
+	localIPIndex *uint32
+
+	// Next address to use for each host, with IPSelectRoundRobin.
+	ipIndex      map[string]int
+	ipIndexMutex *sync.Mutex
+
+	// Semaphores for MaxConnsPerHost, by host; the mutex guards MaxConnsPerHost too.
+	hostSlots      map[string]chan struct{}
+	hostSlotsMutex *sync.Mutex
 }
 
 func NewDialer(dialer net.Dialer) *Dialer {
 	return &Dialer{
-		Dialer:   dialer,
-		Resolver: dnscache.New(0),
+		Dialer:       dialer,
+		Resolver:     NewResolver(-1, IPAny),
+		Stats:        NewConnStats(),
+		localIPIndex: new(uint32),
+		ipIndexMutex: &sync.Mutex{},
+
+		hostSlotsMutex: &sync.Mutex{},
 	}
 }
 
-func (d Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
+// Returns a copy of the dialer for a VU of its own: it shares the resolver and the turns taken
+// between local IPs, but round-robins between a host's addresses and limits connections per host
+// separately.
+func (d *Dialer) ForVU() *Dialer {
+	vd := *d
+	vd.ipIndex = nil
+	vd.ipIndexMutex = &sync.Mutex{}
+	vd.hostSlots = nil
+	vd.hostSlotsMutex = &sync.Mutex{}
+	return &vd
+}
+
+func (d *Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
 	}
-	ip, err := d.Resolver.FetchOne(host)
+
+	release, err := d.acquireSlot(ctx, host)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := d.Dialer.DialContext(ctx, proto, ip.String()+":"+port)
+	conn, err := d.dial(ctx, proto, addr, host, port)
 	if err != nil {
+		if release != nil {
+			release()
+		}
 		return nil, err
 	}
+	conn = d.Stats.track(host, conn)
+	if release != nil {
+		conn = &slotConn{Conn: conn, release: release}
+	}
 	if v := ctx.Value(ctxKeyTracer); v != nil {
 		tracer := v.(*Tracer)
 		return &Conn{conn, &tracer.bytesRead, &tracer.bytesWritten}, nil
 	}
-	return conn, err
+	return conn, nil
+}
+
+// Dials an address, through a unix socket if one is configured for it.
+func (d *Dialer) dial(ctx context.Context, proto, addr, host, port string) (net.Conn, error) {
+	if path := d.unixSocket(host, addr); path != "" {
+		conn, err := d.Dialer.DialContext(ctx, "unix", path)
+		if err != nil {
+			d.Stats.addError(err)
+			return nil, errors.Wrapf(err, "couldn't connect to %s through unix socket %s", addr, path)
+		}
+		return conn, nil
+	}
+
+	ip, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	dialer := d.Dialer
+	if strings.HasPrefix(proto, "tcp") {
+		if addr := d.localAddr(ip); addr != nil {
+			dialer.LocalAddr = addr
+		}
+	}
+	conn, err := dialer.DialContext(ctx, proto, ip.String()+":"+port)
+	if err != nil {
+		d.Stats.addError(err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Changes MaxConnsPerHost for connections made from now on; ones already open still count
+// against the old limit until they're closed.
+func (d *Dialer) SetMaxConnsPerHost(n int) {
+	d.hostSlotsMutex.Lock()
+	defer d.hostSlotsMutex.Unlock()
+	d.MaxConnsPerHost = n
+}
+
+// Waits for a free connection slot for a host, if MaxConnsPerHost is set; the returned function
+// gives it back, and is nil if there's no limit.
+func (d *Dialer) acquireSlot(ctx context.Context, host string) (func(), error) {
+	d.hostSlotsMutex.Lock()
+	if d.MaxConnsPerHost <= 0 {
+		d.hostSlotsMutex.Unlock()
+		return nil, nil
+	}
+	if d.hostSlots == nil {
+		d.hostSlots = make(map[string]chan struct{})
+	}
+	slots, ok := d.hostSlots[host]
+	if !ok || cap(slots) != d.MaxConnsPerHost {
+		slots = make(chan struct{}, d.MaxConnsPerHost)
+		d.hostSlots[host] = slots
+	}
+	d.hostSlotsMutex.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Looks up a host and picks one of its addresses, recording the lookup in the request's tracer.
+func (d *Dialer) resolve(ctx context.Context, host string) (net.IP, error) {
+	start := time.Now()
+	ips, cached, err := d.Resolver.Resolve(ctx, host)
+	if net.ParseIP(host) == nil {
+		if v := ctx.Value(ctxKeyTracer); v != nil {
+			v.(*Tracer).addDNSLookup(time.Since(start), cached)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch d.IPSelect {
+	case IPSelectRoundRobin:
+		d.ipIndexMutex.Lock()
+		if d.ipIndex == nil {
+			d.ipIndex = make(map[string]int)
+		}
+		i := d.ipIndex[host] % len(ips)
+		d.ipIndex[host] = i + 1
+		d.ipIndexMutex.Unlock()
+		return ips[i], nil
+	case IPSelectRandom:
+		rnd := d.Rand
+		if rnd == nil {
+			rnd = rand.Float64
+		}
+		return ips[int(rnd()*float64(len(ips)))], nil
+	default:
+		return ips[0], nil
+	}
+}
+
+// Returns the unix socket to use for an address, if any; "host:port" mappings take precedence.
+func (d *Dialer) unixSocket(host, addr string) string {
+	if path, ok := d.UnixSockets[addr]; ok {
+		return path
+	}
+	return d.UnixSockets[host]
+}
+
+// Returns the next local address to connect to an IP from, or nil if there's none to choose from.
+func (d *Dialer) localAddr(ip net.IP) net.Addr {
+	if len(d.LocalIPs) == 0 {
+		return nil
+	}
+	n := int(atomic.AddUint32(d.localIPIndex, 1))
+	for i := range d.LocalIPs {
+		localIP := d.LocalIPs[(n+i)%len(d.LocalIPs)]
+		if (localIP.To4() == nil) == (ip.To4() == nil) {
+			return &net.TCPAddr{IP: localIP}
+		}
+	}
+	return nil
+}
+
+// A connection holding one of its host's MaxConnsPerHost slots, until it's closed.
+type slotConn struct {
+	net.Conn
+
+	release func()
+	once    sync.Once
+}
+
+func (c *slotConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
 }
 
 type Conn struct {
@@ -0,0 +1,289 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialerUnixSockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k6-netext")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "app.sock")
+	l, err := net.Listen("unix", path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, r.Host)
+	})}
+	go func() { _ = srv.Serve(l) }()
+	defer func() { _ = l.Close() }()
+
+	testdata := map[string]map[string]string{
+		"host":      {"app": path},
+		"host:port": {"app:80": path},
+	}
+	for name, sockets := range testdata {
+		t.Run(name, func(t *testing.T) {
+			d := NewDialer(net.Dialer{})
+			d.UnixSockets = sockets
+			client := http.Client{Transport: &http.Transport{DialContext: d.DialContext}}
+
+			res, err := client.Get("http://app/")
+			if !assert.NoError(t, err) {
+				return
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.NoError(t, res.Body.Close())
+			assert.Equal(t, "app", string(body))
+		})
+	}
+
+	t.Run("Nonexistent", func(t *testing.T) {
+		d := NewDialer(net.Dialer{})
+		d.UnixSockets = map[string]string{"app": "/nonexistent.sock"}
+		_, err := d.DialContext(context.Background(), "tcp", "app:80")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "couldn't connect to app:80 through unix socket /nonexistent.sock")
+		}
+	})
+}
+
+func TestDialerLocalIPs(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = l.Close() }()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	t.Run("Family", func(t *testing.T) {
+		d := NewDialer(net.Dialer{})
+		d.LocalIPs = []net.IP{net.ParseIP("::1"), net.ParseIP("127.0.0.1")}
+		for i := 0; i < 4; i++ {
+			conn, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "127.0.0.1", conn.LocalAddr().(*net.TCPAddr).IP.String())
+			_ = conn.Close()
+		}
+	})
+	t.Run("RoundRobin", func(t *testing.T) {
+		// Only Linux routes all of 127.0.0.0/8 to the loopback interface out of the box.
+		if l, err := net.Listen("tcp", "127.0.0.2:0"); err != nil {
+			t.Skip("127.0.0.2 isn't bindable")
+		} else {
+			_ = l.Close()
+		}
+
+		d := NewDialer(net.Dialer{})
+		d.LocalIPs = []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2")}
+		seen := make(map[string]int)
+		for i := 0; i < 4; i++ {
+			conn, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+			if !assert.NoError(t, err) {
+				return
+			}
+			seen[conn.LocalAddr().(*net.TCPAddr).IP.String()]++
+			_ = conn.Close()
+		}
+		assert.Equal(t, map[string]int{"127.0.0.1": 2, "127.0.0.2": 2}, seen)
+	})
+}
+
+func TestDialerDNS(t *testing.T) {
+	// Two servers on the same port, so that a host can be pointed at either.
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = l1.Close() }()
+	_, port, _ := net.SplitHostPort(l1.Addr().String())
+	l2, err := net.Listen("tcp", "127.0.0.2:"+port)
+	if err != nil {
+		t.Skip("127.0.0.2 isn't bindable")
+	}
+	defer func() { _ = l2.Close() }()
+	for _, l := range []net.Listener{l1, l2} {
+		go func(l net.Listener) {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				_ = conn.Close()
+			}
+		}(l)
+	}
+
+	// Returns the addresses a dialer connects to for example.com.
+	dial := func(t *testing.T, d *Dialer, n int) (addrs []string) {
+		for i := 0; i < n; i++ {
+			conn, err := d.DialContext(context.Background(), "tcp", "example.com:"+port)
+			if !assert.NoError(t, err) {
+				return
+			}
+			addrs = append(addrs, conn.RemoteAddr().(*net.TCPAddr).IP.String())
+			_ = conn.Close()
+		}
+		return addrs
+	}
+
+	t.Run("TTL", func(t *testing.T) {
+		dns := &testDNS{}
+		dns.set("example.com", "127.0.0.1")
+		d := NewDialer(net.Dialer{})
+		d.Resolver = NewResolver(50*time.Millisecond, IPAny)
+		d.Resolver.LookupIP = dns.LookupIP
+
+		assert.Equal(t, []string{"127.0.0.1", "127.0.0.1"}, dial(t, d, 2))
+		dns.set("example.com", "127.0.0.2")
+		assert.Equal(t, []string{"127.0.0.1"}, dial(t, d, 1))
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(t, []string{"127.0.0.2"}, dial(t, d, 1))
+	})
+	t.Run("RoundRobin", func(t *testing.T) {
+		dns := &testDNS{}
+		dns.set("example.com", "127.0.0.1", "127.0.0.2")
+		d := NewDialer(net.Dialer{})
+		d.Resolver.LookupIP = dns.LookupIP
+		d.IPSelect = IPSelectRoundRobin
+
+		// Every VU takes turns of its own.
+		vu1, vu2 := d.ForVU(), d.ForVU()
+		assert.Equal(t, []string{"127.0.0.1", "127.0.0.2", "127.0.0.1"}, dial(t, vu1, 3))
+		assert.Equal(t, []string{"127.0.0.1", "127.0.0.2"}, dial(t, vu2, 2))
+		assert.Equal(t, 1, dns.lookups)
+	})
+	t.Run("Random", func(t *testing.T) {
+		dns := &testDNS{}
+		dns.set("example.com", "127.0.0.1", "127.0.0.2")
+		d := NewDialer(net.Dialer{})
+		d.Resolver.LookupIP = dns.LookupIP
+		d.IPSelect = IPSelectRandom
+
+		// Addresses are picked with the dialer's RNG, so a VU's seeded one picks the same ones again.
+		values := []float64{0.9, 0.1, 0.6}
+		d.Rand = func() float64 {
+			v := values[0]
+			values = values[1:]
+			return v
+		}
+		assert.Equal(t, []string{"127.0.0.2", "127.0.0.1", "127.0.0.2"}, dial(t, d, 3))
+	})
+	t.Run("Tracer", func(t *testing.T) {
+		dns := &testDNS{}
+		dns.set("example.com", "127.0.0.1")
+		d := NewDialer(net.Dialer{})
+		d.Resolver.LookupIP = dns.LookupIP
+
+		for _, cached := range []bool{false, true} {
+			var tracer Tracer
+			conn, err := d.DialContext(WithTracer(context.Background(), &tracer), "tcp", "example.com:"+port)
+			if !assert.NoError(t, err) {
+				return
+			}
+			_ = conn.Close()
+			trail := tracer.Done()
+			assert.Equal(t, int64(1), trail.DNSLookups)
+			if cached {
+				assert.Equal(t, int64(1), trail.DNSCacheHits)
+			} else {
+				assert.Equal(t, int64(0), trail.DNSCacheHits)
+			}
+		}
+	})
+}
+
+func TestDialerMaxConnsPerHost(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = l.Close() }()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	d := NewDialer(net.Dialer{}).ForVU()
+	d.MaxConnsPerHost = 1
+	conn, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("Timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := d.DialContext(ctx, "tcp", l.Addr().String())
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+	t.Run("OtherVU", func(t *testing.T) {
+		vu := d.ForVU()
+		conn, err := vu.DialContext(context.Background(), "tcp", l.Addr().String())
+		if assert.NoError(t, err) {
+			assert.NoError(t, conn.Close())
+		}
+	})
+	t.Run("Released", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_ = conn.Close()
+		}()
+		start := time.Now()
+		conn, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+		if assert.NoError(t, err) {
+			assert.True(t, time.Since(start) >= 50*time.Millisecond)
+			assert.NoError(t, conn.Close())
+		}
+	})
+}
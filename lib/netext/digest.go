@@ -0,0 +1,186 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A DigestTransport performs Digest authentication (RFC 7616) for requests that get challenged for
+// it. MD5 and SHA-256 are supported, as well as their -sess variants, with a qop of "auth" or none.
+// Every challenged request is sent twice; nonces aren't reused across requests.
+type DigestTransport struct {
+	Transport http.RoundTripper
+
+	Username, Password string
+}
+
+func (t *DigestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.Transport.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	challenge, ok := digestChallenge(res)
+	if !ok {
+		return res, nil
+	}
+	discardBody(res)
+
+	cnonce := make([]byte, 16)
+	if _, err := rand.Read(cnonce); err != nil {
+		return nil, err
+	}
+	auth, err := digestAuthorization(challenge, req.Method, req.URL.RequestURI(),
+		t.Username, t.Password, hex.EncodeToString(cnonce))
+	if err != nil {
+		return nil, err
+	}
+	authReq, err := rewindRequest(req, true)
+	if err != nil {
+		return nil, err
+	}
+	authReq.Header.Set("Authorization", auth)
+	return t.Transport.RoundTrip(authReq)
+}
+
+// Returns the parameters of the first Digest challenge in a response, if there is one.
+func digestChallenge(res *http.Response) (map[string]string, bool) {
+	for _, v := range res.Header["Www-Authenticate"] {
+		if len(v) > 7 && strings.EqualFold(v[:7], "Digest ") {
+			return parseAuthParams(v[7:]), true
+		}
+	}
+	return nil, false
+}
+
+// Parses a comma-separated list of auth-params, eg. `realm="x", qop="auth,auth-int", stale=FALSE`.
+// Keys are lowercased, and quoted values unescaped.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.IndexByte(s, '=')
+		if eq == -1 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var buf []byte
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				buf = append(buf, s[i])
+			}
+			if i < len(s) {
+				i++ // Closing quote.
+			}
+			value, s = string(buf), s[i:]
+		} else if i := strings.IndexByte(s, ','); i != -1 {
+			value, s = strings.TrimSpace(s[:i]), s[i:]
+		} else {
+			value, s = strings.TrimSpace(s), ""
+		}
+		params[key] = value
+	}
+}
+
+// Returns the Authorization header answering a Digest challenge.
+func digestAuthorization(challenge map[string]string, method, uri, username, password, cnonce string) (string, error) {
+	algorithm := challenge["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	sess := strings.HasSuffix(strings.ToUpper(algorithm), "-SESS")
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", errors.Errorf("digest: unsupported algorithm: %s", algorithm)
+	}
+	h := func(parts ...string) string {
+		hasher := newHash()
+		_, _ = hasher.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	// The server may offer a choice of qops; only "auth" is supported, as "auth-int" would mean
+	// hashing the entire body.
+	qop := ""
+	if offered := challenge["qop"]; offered != "" {
+		for _, v := range strings.Split(offered, ",") {
+			if strings.TrimSpace(v) == "auth" {
+				qop = "auth"
+			}
+		}
+		if qop == "" {
+			return "", errors.Errorf("digest: unsupported qop: %s", offered)
+		}
+	}
+
+	realm, nonce := challenge["realm"], challenge["nonce"]
+	ha1 := h(username, realm, password)
+	if sess {
+		ha1 = h(ha1, nonce, cnonce)
+	}
+	ha2 := h(method, uri)
+
+	const nc = "00000001"
+	fields := []string{
+		"username=" + quoteAuthParam(username),
+		"realm=" + quoteAuthParam(realm),
+		"nonce=" + quoteAuthParam(nonce),
+		"uri=" + quoteAuthParam(uri),
+		"algorithm=" + algorithm,
+	}
+	if qop != "" {
+		fields = append(fields,
+			"response="+quoteAuthParam(h(ha1, nonce, nc, cnonce, qop, ha2)),
+			"qop="+qop, "nc="+nc, "cnonce="+quoteAuthParam(cnonce),
+		)
+	} else {
+		fields = append(fields, "response="+quoteAuthParam(h(ha1, nonce, ha2)))
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		fields = append(fields, "opaque="+quoteAuthParam(opaque))
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+func quoteAuthParam(s string) string {
+	return fmt.Sprintf(`"%s"`, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s))
+}
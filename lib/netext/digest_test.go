@@ -0,0 +1,142 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuthParams(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"realm":     "test realm",
+		"qop":       "auth,auth-int",
+		"nonce":     `a"b\c`,
+		"algorithm": "MD5",
+		"stale":     "FALSE",
+	}, parseAuthParams(`Realm="test realm", qop="auth,auth-int",nonce="a\"b\\c", algorithm=MD5, stale=FALSE`))
+	assert.Equal(t, map[string]string{}, parseAuthParams(""))
+	assert.Equal(t, map[string]string{"realm": "unterminated"}, parseAuthParams(`realm="unterminated`))
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	// Examples from RFC 2617, 3.5 and RFC 7616, 3.9.1.
+	testdata := map[string]struct {
+		challenge map[string]string
+		password  string
+		cnonce    string
+		response  string
+	}{
+		"RFC2617": {
+			map[string]string{"realm": "testrealm@host.com", "qop": "auth,auth-int", "nonce": "dcd98b7102dd2f0e8b11d0f600bfb0c093", "opaque": "5ccc069c403ebaf9f0171e9517f40e41"},
+			"Circle Of Life", "0a4f113b", "6629fae49393a05397450978507c4ef1",
+		},
+		"MD5": {
+			map[string]string{"realm": "http-auth@example.org", "qop": "auth, auth-int", "algorithm": "MD5", "nonce": "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"},
+			"Circle of Life", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "8ca523f5e9506fed4657c9700eebdbec",
+		},
+		"SHA-256": {
+			map[string]string{"realm": "http-auth@example.org", "qop": "auth, auth-int", "algorithm": "SHA-256", "nonce": "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"},
+			"Circle of Life", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+		},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			auth, err := digestAuthorization(data.challenge, "GET", "/dir/index.html", "Mufasa", data.password, data.cnonce)
+			if assert.NoError(t, err) && assert.True(t, strings.HasPrefix(auth, "Digest ")) {
+				params := parseAuthParams(auth[7:])
+				assert.Equal(t, data.response, params["response"])
+				assert.Equal(t, "Mufasa", params["username"])
+				assert.Equal(t, "/dir/index.html", params["uri"])
+				assert.Equal(t, "auth", params["qop"])
+				assert.Equal(t, "00000001", params["nc"])
+				assert.Equal(t, data.cnonce, params["cnonce"])
+				assert.Equal(t, data.challenge["opaque"], params["opaque"])
+			}
+		})
+	}
+
+	t.Run("UnsupportedAlgorithm", func(t *testing.T) {
+		_, err := digestAuthorization(map[string]string{"algorithm": "SHA-512-256"}, "GET", "/", "user", "pass", "x")
+		assert.EqualError(t, err, "digest: unsupported algorithm: SHA-512-256")
+	})
+	t.Run("UnsupportedQop", func(t *testing.T) {
+		_, err := digestAuthorization(map[string]string{"qop": "auth-int"}, "GET", "/", "user", "pass", "x")
+		assert.EqualError(t, err, "digest: unsupported qop: auth-int")
+	})
+}
+
+// A mock server, which accepts Digest authentication for "user" with the password "pass".
+func newDigestServer(t *testing.T, algorithm string) *httptest.Server {
+	challenge := map[string]string{"realm": "test", "nonce": "abc123", "qop": "auth", "algorithm": algorithm}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Digest ") {
+			params := parseAuthParams(header[7:])
+			expected, err := digestAuthorization(challenge, r.Method, r.URL.RequestURI(), "user", "pass", params["cnonce"])
+			if assert.NoError(t, err) && parseAuthParams(expected[7:])["response"] == params["response"] {
+				_, _ = fmt.Fprintf(w, "ok %s", body)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="test", nonce="abc123", qop="auth", algorithm=%s`, algorithm))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+}
+
+func TestDigestTransport(t *testing.T) {
+	for _, algorithm := range []string{"MD5", "MD5-sess", "SHA-256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			srv := newDigestServer(t, algorithm)
+			defer srv.Close()
+
+			client := http.Client{Transport: &DigestTransport{Transport: &http.Transport{}, Username: "user", Password: "pass"}}
+			req, err := http.NewRequest("POST", srv.URL+"/path?a=b", strings.NewReader("body"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := client.Do(req)
+			if assert.NoError(t, err) {
+				data, _ := ioutil.ReadAll(res.Body)
+				_ = res.Body.Close()
+				assert.Equal(t, http.StatusOK, res.StatusCode)
+				assert.Equal(t, "ok body", string(data))
+			}
+		})
+	}
+	t.Run("BadCredentials", func(t *testing.T) {
+		srv := newDigestServer(t, "MD5")
+		defer srv.Close()
+
+		client := http.Client{Transport: &DigestTransport{Transport: &http.Transport{}, Username: "user", Password: "wrong"}}
+		res, err := client.Get(srv.URL)
+		if assert.NoError(t, err) {
+			_ = res.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Default number of bytes of each body included in a dump.
+const DefaultDumpBodyLimit = 10 * 1024
+
+// Headers that carry credentials, which can be redacted from dumps.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// A DumpTransport logs every request and response passing through it, for debugging. Bodies are
+// only included if Body is set, and truncated to BodyLimit bytes (0 = DefaultDumpBodyLimit); they
+// remain readable in full by whoever sends and receives them.
+type DumpTransport struct {
+	Transport http.RoundTripper
+	Logger    log.FieldLogger
+
+	Body      bool
+	BodyLimit int64
+
+	// Replaces the values of credential-carrying headers with "[redacted]".
+	Redact bool
+}
+
+func (t *DumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers mustn't modify the request, so the peeked body goes on a shallow copy.
+	var reqBody []byte
+	if t.Body && req.Body != nil {
+		req = req.WithContext(req.Context())
+		reqBody, req.Body = t.peek(req.Body)
+	}
+	t.Logger.Info(t.format(
+		fmt.Sprintf("%s %s %s", req.Method, req.URL, req.Proto),
+		req.Header, reqBody,
+	))
+
+	res, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		t.Logger.WithError(err).Info("Request failed")
+		return nil, err
+	}
+
+	var resBody []byte
+	if t.Body && res.Body != nil {
+		resBody, res.Body = t.peek(res.Body)
+	}
+	t.Logger.Info(t.format(
+		fmt.Sprintf("%s %s", res.Proto, res.Status),
+		res.Header, resBody,
+	))
+	return res, nil
+}
+
+// Reads the first BodyLimit bytes off a body, returning them along with a body that reads the
+// whole thing, as if nothing had happened.
+func (t *DumpTransport) peek(body io.ReadCloser) ([]byte, io.ReadCloser) {
+	buf, _ := ioutil.ReadAll(io.LimitReader(body, t.bodyLimit()+1))
+	return buf, struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), body), body}
+}
+
+// Formats a request or response: a status line, headers in sorted order, and the body, if any.
+func (t *DumpTransport) format(line string, header http.Header, body []byte) string {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := []string{line}
+	for _, k := range keys {
+		for _, v := range header[k] {
+			if t.Redact && sensitiveHeaders[k] {
+				v = "[redacted]"
+			}
+			lines = append(lines, k+": "+v)
+		}
+	}
+
+	if len(body) > 0 {
+		limit := t.bodyLimit()
+		lines = append(lines, "")
+		if int64(len(body)) > limit {
+			lines = append(lines, string(body[:limit])+fmt.Sprintf("... (truncated to %d bytes)", limit))
+		} else {
+			lines = append(lines, string(body))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *DumpTransport) bodyLimit() int64 {
+	if t.BodyLimit <= 0 {
+		return DefaultDumpBodyLimit
+	}
+	return t.BodyLimit
+}
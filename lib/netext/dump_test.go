@@ -0,0 +1,100 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	logtest "github.com/Sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Header().Set("X-Echo", "1")
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	logger, hook := logtest.NewNullLogger()
+	do := func(t *testing.T, dt *DumpTransport, body string) []*log.Entry {
+		hook.Reset()
+		dt.Transport = http.DefaultTransport
+		dt.Logger = logger
+
+		req, err := http.NewRequest("POST", srv.URL+"/path", strings.NewReader(body))
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		req.Header.Set("Authorization", "Bearer token")
+		origBody := req.Body
+		res, err := dt.RoundTrip(req)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		assert.True(t, req.Body == origBody, "the caller's request was modified")
+		defer func() { _ = res.Body.Close() }()
+
+		// The body must survive being dumped, in full.
+		resBody, err := ioutil.ReadAll(res.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(resBody))
+		return hook.AllEntries()
+	}
+
+	t.Run("Headers", func(t *testing.T) {
+		entries := do(t, &DumpTransport{}, "hello")
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, "POST "+srv.URL+"/path HTTP/1.1\nAuthorization: Bearer token", entries[0].Message)
+			assert.Contains(t, entries[1].Message, "HTTP/1.1 200 OK\n")
+			assert.Contains(t, entries[1].Message, "\nSet-Cookie: session=secret\n")
+			assert.Contains(t, entries[1].Message, "\nX-Echo: 1")
+			assert.NotContains(t, entries[1].Message, "hello")
+		}
+	})
+	t.Run("Full", func(t *testing.T) {
+		entries := do(t, &DumpTransport{Body: true}, "hello")
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, "POST "+srv.URL+"/path HTTP/1.1\nAuthorization: Bearer token\n\nhello", entries[0].Message)
+			assert.True(t, strings.HasSuffix(entries[1].Message, "\n\nhello"), entries[1].Message)
+		}
+	})
+	t.Run("Truncated", func(t *testing.T) {
+		entries := do(t, &DumpTransport{Body: true, BodyLimit: 4}, "hello")
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, "POST "+srv.URL+"/path HTTP/1.1\nAuthorization: Bearer token\n\nhell... (truncated to 4 bytes)", entries[0].Message)
+		}
+	})
+	t.Run("Redact", func(t *testing.T) {
+		entries := do(t, &DumpTransport{Redact: true}, "hello")
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, "POST "+srv.URL+"/path HTTP/1.1\nAuthorization: [redacted]", entries[0].Message)
+			assert.Contains(t, entries[1].Message, "\nSet-Cookie: [redacted]\n")
+		}
+	})
+}
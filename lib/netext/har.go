@@ -0,0 +1,465 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Default number of requests a HARRecorder keeps; later ones are counted, but dropped.
+const DefaultHARMaxEntries = 10000
+
+// A HARRecorder collects requests and responses in full, for export as a HAR (HTTP Archive) file.
+// It's shared by all VUs' HARTransports, so it's safe for concurrent use.
+type HARRecorder struct {
+	// Share of requests to record, from 0 to 1.
+	Sample float64
+
+	// Only record requests that failed, or got a 4xx or 5xx response.
+	FailedOnly bool
+
+	// Bodies are truncated past this many bytes; 0 leaves them out.
+	BodyLimit int64
+
+	// Requests past this many aren't recorded (0 = DefaultHARMaxEntries).
+	MaxEntries int
+
+	mutex   sync.Mutex
+	entries []*HAREntry
+	dropped int64
+}
+
+func NewHARRecorder(sample float64, failedOnly bool, bodyLimit int64) *HARRecorder {
+	return &HARRecorder{Sample: sample, FailedOnly: failedOnly, BodyLimit: bodyLimit}
+}
+
+func (r *HARRecorder) add(e *HAREntry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	max := r.MaxEntries
+	if max <= 0 {
+		max = DefaultHARMaxEntries
+	}
+	if len(r.entries) >= max {
+		r.dropped++
+		return
+	}
+	r.entries = append(r.entries, e)
+}
+
+// Returns the recorded entries, in the order they were started in.
+func (r *HARRecorder) Entries() []*HAREntry {
+	r.mutex.Lock()
+	entries := append([]*HAREntry(nil), r.entries...)
+	r.mutex.Unlock()
+	sort.Stable(harEntriesByStart(entries))
+	return entries
+}
+
+type harEntriesByStart []*HAREntry
+
+func (e harEntriesByStart) Len() int      { return len(e) }
+func (e harEntriesByStart) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e harEntriesByStart) Less(i, j int) bool {
+	return e[i].StartedDateTime.Before(e[j].StartedDateTime)
+}
+
+// Returns the number of requests that weren't recorded for exceeding MaxEntries.
+func (r *HARRecorder) Dropped() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.dropped
+}
+
+// Writes everything recorded so far as a HAR 1.2 document; version is k6's own.
+func (r *HARRecorder) Export(w io.Writer, version string) error {
+	doc := HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "k6", Version: version},
+		Entries: r.Entries(),
+	}}
+	if doc.Log.Entries == nil {
+		doc.Log.Entries = []*HAREntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// The HAR 1.2 format; see http://www.softwareishard.com/blog/har-12-spec/. Sizes that aren't
+// known are -1, as are timings for phases that didn't happen (eg. connecting, if a connection
+// was reused). DNS lookups are made by the dialer, and always reported as -1.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+
+	// Why the request failed, if it did.
+	Comment string `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HARCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// A HARTransport records requests made through it in a HARRecorder. Recorded bodies are captured
+// as they're sent and read, so responses are recorded once their body is read or closed.
+type HARTransport struct {
+	Transport http.RoundTripper
+	Recorder  *HARRecorder
+
+	// Decides which requests are sampled; math/rand's by default, a VU's seeded RNG in a VU.
+	Rand func() float64
+}
+
+func (t *HARTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rnd := t.Rand
+	if rnd == nil {
+		rnd = rand.Float64
+	}
+	if t.Recorder.Sample < 1 && rnd() >= t.Recorder.Sample {
+		return t.Transport.RoundTrip(req)
+	}
+
+	x := &harExchange{rec: t.Recorder, req: req, start: time.Now()}
+	r := req.WithContext(httptrace.WithClientTrace(req.Context(), x.trace()))
+	if req.Body != nil {
+		x.reqBody = &harCapture{limit: t.Recorder.BodyLimit}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(req.Body, x.reqBody), req.Body}
+	}
+
+	res, err := t.Transport.RoundTrip(r)
+	if err != nil {
+		x.finish(nil, nil, err)
+		return nil, err
+	}
+	if t.Recorder.FailedOnly && res.StatusCode < 400 {
+		return res, nil
+	}
+	res.Body = &harBody{ReadCloser: res.Body, x: x, res: res, capture: &harCapture{limit: t.Recorder.BodyLimit}}
+	return res, nil
+}
+
+// A request being recorded.
+type harExchange struct {
+	rec     *HARRecorder
+	req     *http.Request
+	reqBody *harCapture
+
+	// Timings of the request's phases; see trace().
+	start, gotConn, wroteRequest, firstByte      time.Time
+	connectStart, connectDone, tlsStart, tlsDone time.Time
+
+	remoteAddr string
+	once       sync.Once
+}
+
+func (x *harExchange) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			if x.connectStart.IsZero() {
+				x.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			x.connectDone = time.Now()
+		},
+		TLSHandshakeStart: func() { x.tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { x.tlsDone = time.Now() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			x.gotConn = time.Now()
+			if addr := info.Conn.RemoteAddr(); addr != nil {
+				x.remoteAddr = addr.String()
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { x.wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { x.firstByte = time.Now() },
+	}
+}
+
+// Returns the time between two events in milliseconds, or -1 if either didn't happen.
+func harSpan(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return -1
+	}
+	return float64(to.Sub(from)) / float64(time.Millisecond)
+}
+
+// Records the exchange, once; res is nil if the request failed.
+func (x *harExchange) finish(res *http.Response, body *harCapture, err error) {
+	x.once.Do(func() {
+		end := time.Now()
+		req := x.req
+		e := &HAREntry{
+			StartedDateTime: x.start,
+			Request: HARRequest{
+				Method:      req.Method,
+				URL:         req.URL.String(),
+				HTTPVersion: req.Proto,
+				Cookies:     harCookies(req.Cookies()),
+				Headers:     harHeaders(req.Header),
+				QueryString: []HARNameValue{},
+				HeadersSize: -1,
+				BodySize:    0,
+			},
+			Response: HARResponse{
+				Cookies:     []HARCookie{},
+				Headers:     []HARNameValue{},
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+			ServerIPAddress: x.remoteAddr,
+		}
+		if e.Request.HTTPVersion == "" {
+			e.Request.HTTPVersion = "HTTP/1.1"
+		}
+		for k, vs := range req.URL.Query() {
+			for _, v := range vs {
+				e.Request.QueryString = append(e.Request.QueryString, HARNameValue{k, v})
+			}
+		}
+		if x.reqBody != nil {
+			e.Request.BodySize = x.reqBody.size
+			text, _ := x.reqBody.text()
+			e.Request.PostData = &HARPostData{
+				MimeType: req.Header.Get("Content-Type"),
+				Text:     text,
+				Comment:  x.reqBody.comment(),
+			}
+		}
+
+		if err != nil {
+			e.Comment = err.Error()
+		}
+		if res != nil {
+			e.Response.Status = res.StatusCode
+			e.Response.StatusText = strings.TrimPrefix(res.Status, strconv.Itoa(res.StatusCode)+" ")
+			e.Response.HTTPVersion = res.Proto
+			e.Response.Cookies = harCookies(res.Cookies())
+			e.Response.Headers = harHeaders(res.Header)
+			e.Response.RedirectURL = res.Header.Get("Location")
+			e.Response.Content.MimeType = res.Header.Get("Content-Type")
+			if body != nil {
+				e.Response.BodySize = body.size
+				e.Response.Content.Size = body.size
+				e.Response.Content.Text, e.Response.Content.Encoding = body.text()
+				e.Response.Content.Comment = body.comment()
+			}
+		}
+
+		connect, ssl := harSpan(x.connectStart, x.connectDone), harSpan(x.tlsStart, x.tlsDone)
+		if ssl > 0 {
+			connect = harSpan(x.connectStart, x.tlsDone)
+		}
+		e.Timings = HARTimings{
+			Blocked: harSpan(x.start, x.gotConn),
+			DNS:     -1,
+			Connect: connect,
+			SSL:     ssl,
+			Send:    harSpan(x.gotConn, x.wroteRequest),
+			Wait:    harSpan(x.wroteRequest, x.firstByte),
+			Receive: harSpan(x.firstByte, end),
+		}
+		if e.Timings.Blocked > 0 && connect > 0 {
+			e.Timings.Blocked -= connect
+			if e.Timings.Blocked < 0 {
+				e.Timings.Blocked = 0
+			}
+		}
+		for _, v := range []float64{e.Timings.Blocked, e.Timings.Connect, e.Timings.Send, e.Timings.Wait, e.Timings.Receive} {
+			if v > 0 {
+				e.Time += v
+			}
+		}
+		x.rec.add(e)
+	})
+}
+
+func harHeaders(header http.Header) []HARNameValue {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	nvs := []HARNameValue{}
+	for _, k := range keys {
+		for _, v := range header[k] {
+			nvs = append(nvs, HARNameValue{k, v})
+		}
+	}
+	return nvs
+}
+
+func harCookies(cookies []*http.Cookie) []HARCookie {
+	res := make([]HARCookie, len(cookies))
+	for i, c := range cookies {
+		res[i] = HARCookie{c.Name, c.Value}
+	}
+	return res
+}
+
+// Keeps the first limit bytes written to it, and counts the rest.
+type harCapture struct {
+	limit int64
+	size  int64
+	buf   bytes.Buffer
+}
+
+func (c *harCapture) Write(p []byte) (int, error) {
+	if room := c.limit - int64(c.buf.Len()); room > 0 {
+		if int64(len(p)) > room {
+			c.buf.Write(p[:room])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	c.size += int64(len(p))
+	return len(p), nil
+}
+
+// Returns the captured body as text, or base64 with "base64" as the encoding if it isn't UTF-8.
+func (c *harCapture) text() (string, string) {
+	if utf8.Valid(c.buf.Bytes()) {
+		return c.buf.String(), ""
+	}
+	return base64.StdEncoding.EncodeToString(c.buf.Bytes()), "base64"
+}
+
+func (c *harCapture) comment() string {
+	if int64(c.buf.Len()) < c.size {
+		return "truncated"
+	}
+	return ""
+}
+
+// A response body being recorded; the exchange is recorded when it's read to the end or closed.
+type harBody struct {
+	io.ReadCloser
+	x       *harExchange
+	res     *http.Response
+	capture *harCapture
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	_, _ = b.capture.Write(p[:n])
+	if err == io.EOF {
+		b.x.finish(b.res, b.capture, nil)
+	} else if err != nil {
+		b.x.finish(b.res, b.capture, err)
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	b.x.finish(b.res, b.capture, nil)
+	return b.ReadCloser.Close()
+}
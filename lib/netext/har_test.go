@@ -0,0 +1,166 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHARTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/forbidden" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = fmt.Fprintf(w, "%s %s", r.Method, body)
+	}))
+	defer srv.Close()
+
+	do := func(t *testing.T, rec *HARRecorder, method, url, body string) {
+		client := http.Client{Transport: &HARTransport{Transport: http.DefaultTransport, Recorder: rec}}
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if !assert.NoError(t, err) {
+			return
+		}
+		if body == "" {
+			req.Body = nil
+		}
+		res, err := client.Do(req)
+		if assert.NoError(t, err) {
+			_, _ = ioutil.ReadAll(res.Body)
+			assert.NoError(t, res.Body.Close())
+		}
+	}
+
+	t.Run("All", func(t *testing.T) {
+		rec := NewHARRecorder(1, false, 1024)
+		do(t, rec, "GET", srv.URL+"/?a=1", "")
+		do(t, rec, "POST", srv.URL+"/", "hello")
+
+		entries := rec.Entries()
+		if !assert.Len(t, entries, 2) {
+			return
+		}
+		assert.Equal(t, "GET", entries[0].Request.Method)
+		assert.Equal(t, srv.URL+"/?a=1", entries[0].Request.URL)
+		assert.Equal(t, []HARNameValue{{"a", "1"}}, entries[0].Request.QueryString)
+		assert.Nil(t, entries[0].Request.PostData)
+		assert.Equal(t, 200, entries[0].Response.Status)
+		assert.Equal(t, "OK", entries[0].Response.StatusText)
+		assert.Equal(t, "GET ", entries[0].Response.Content.Text)
+		assert.Equal(t, "text/plain", entries[0].Response.Content.MimeType)
+		assert.NotEmpty(t, entries[0].ServerIPAddress)
+		assert.True(t, entries[0].Time > 0)
+
+		if assert.NotNil(t, entries[1].Request.PostData) {
+			assert.Equal(t, "hello", entries[1].Request.PostData.Text)
+		}
+		assert.Equal(t, int64(5), entries[1].Request.BodySize)
+		assert.Equal(t, "POST hello", entries[1].Response.Content.Text)
+	})
+	t.Run("FailedOnly", func(t *testing.T) {
+		rec := NewHARRecorder(1, true, 1024)
+		do(t, rec, "GET", srv.URL+"/", "")
+		do(t, rec, "GET", srv.URL+"/forbidden", "")
+
+		entries := rec.Entries()
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, 403, entries[0].Response.Status)
+		}
+
+		client := http.Client{Transport: &HARTransport{Transport: http.DefaultTransport, Recorder: rec}}
+		_, err := client.Get("http://127.0.0.1:1/")
+		assert.Error(t, err)
+		entries = rec.Entries()
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, 0, entries[1].Response.Status)
+			assert.NotEmpty(t, entries[1].Comment)
+		}
+	})
+	t.Run("Sample", func(t *testing.T) {
+		rec := NewHARRecorder(0, false, 1024)
+		do(t, rec, "GET", srv.URL+"/", "")
+		assert.Len(t, rec.Entries(), 0)
+	})
+	t.Run("Rand", func(t *testing.T) {
+		rec := NewHARRecorder(0.5, false, 1024)
+		for _, v := range []float64{0.7, 0.2, 0.9, 0.4} {
+			client := http.Client{Transport: &HARTransport{
+				Transport: http.DefaultTransport,
+				Recorder:  rec,
+				Rand:      func() float64 { return v },
+			}}
+			res, err := client.Get(srv.URL + "/")
+			if assert.NoError(t, err) {
+				_, _ = ioutil.ReadAll(res.Body)
+				assert.NoError(t, res.Body.Close())
+			}
+		}
+		assert.Len(t, rec.Entries(), 2)
+	})
+	t.Run("Truncated", func(t *testing.T) {
+		rec := NewHARRecorder(1, false, 4)
+		do(t, rec, "POST", srv.URL+"/", "hello")
+
+		entries := rec.Entries()
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+		assert.Equal(t, "hell", entries[0].Request.PostData.Text)
+		assert.Equal(t, "truncated", entries[0].Request.PostData.Comment)
+		assert.Equal(t, "POST", entries[0].Response.Content.Text)
+		assert.Equal(t, "truncated", entries[0].Response.Content.Comment)
+		assert.Equal(t, int64(10), entries[0].Response.Content.Size)
+	})
+	t.Run("MaxEntries", func(t *testing.T) {
+		rec := NewHARRecorder(1, false, 1024)
+		rec.MaxEntries = 1
+		do(t, rec, "GET", srv.URL+"/", "")
+		do(t, rec, "GET", srv.URL+"/", "")
+		assert.Len(t, rec.Entries(), 1)
+		assert.Equal(t, int64(1), rec.Dropped())
+	})
+	t.Run("Export", func(t *testing.T) {
+		rec := NewHARRecorder(1, false, 1024)
+		do(t, rec, "GET", srv.URL+"/", "")
+
+		var buf bytes.Buffer
+		if !assert.NoError(t, rec.Export(&buf, "1.0.0")) {
+			return
+		}
+		var har HAR
+		if assert.NoError(t, json.Unmarshal(buf.Bytes(), &har)) {
+			assert.Equal(t, "1.2", har.Log.Version)
+			assert.Equal(t, HARCreator{Name: "k6", Version: "1.0.0"}, har.Log.Creator)
+			assert.Len(t, har.Log.Entries, 1)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net/http"
+)
+
+// A RequestHook intercepts HTTP requests, eg. to add auth headers or record them for tracing. Hooks
+// are shared by all VUs, so they must be safe for concurrent use.
+type RequestHook interface {
+	// Called before a request is sent, and may change its headers. Returning an error fails the
+	// request without sending it.
+	BeforeRequest(req *http.Request) error
+
+	// Called once a request is done; err is set if it failed.
+	AfterResponse(req *http.Request, res *http.Response, err error)
+}
+
+// A HookTransport calls hooks around every request made through it; redirects and retries are
+// requests of their own, so hooks see every hop. BeforeRequest is called in the order hooks were
+// given, AfterResponse in the reverse order, so that the first hook wraps all the others. If a
+// BeforeRequest fails, the hooks that already ran get an AfterResponse with the error.
+type HookTransport struct {
+	Transport http.RoundTripper
+	Hooks     []RequestHook
+}
+
+func (t *HookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers mustn't modify the request they're given, so hooks get a copy.
+	r := *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+
+	for i, hook := range t.Hooks {
+		if err := hook.BeforeRequest(&r); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				t.Hooks[j].AfterResponse(&r, nil, err)
+			}
+			return nil, err
+		}
+	}
+	res, err := t.Transport.RoundTrip(&r)
+	for i := len(t.Hooks) - 1; i >= 0; i-- {
+		t.Hooks[i].AfterResponse(&r, res, err)
+	}
+	return res, err
+}
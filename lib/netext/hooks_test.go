@@ -0,0 +1,102 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testHook struct {
+	name string
+	log  *[]string
+	err  error
+}
+
+func (h testHook) BeforeRequest(req *http.Request) error {
+	*h.log = append(*h.log, "before "+h.name)
+	req.Header.Add("X-Hooks", h.name)
+	return h.err
+}
+
+func (h testHook) AfterResponse(req *http.Request, res *http.Response, err error) {
+	status := "error"
+	if err == nil {
+		status = res.Header.Get("X-Seen")
+	}
+	*h.log = append(*h.log, "after "+h.name+": "+status)
+}
+
+func TestHookTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Header().Set("X-Seen", strings.Join(r.Header["X-Hooks"], ", "))
+	}))
+	defer srv.Close()
+
+	t.Run("Order", func(t *testing.T) {
+		var log []string
+		client := http.Client{Transport: &HookTransport{
+			Transport: http.DefaultTransport,
+			Hooks:     []RequestHook{testHook{"a", &log, nil}, testHook{"b", &log, nil}},
+		}}
+		req, err := http.NewRequest("GET", srv.URL+"/redirect", nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		res, err := client.Do(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_ = res.Body.Close()
+
+		assert.Equal(t, "a, b", res.Header.Get("X-Seen"))
+		assert.Empty(t, req.Header.Get("X-Hooks"), "original request was modified")
+		assert.Equal(t, []string{
+			"before a", "before b", "after b: ", "after a: ",
+			"before a", "before b", "after b: a, b", "after a: a, b",
+		}, log)
+	})
+	t.Run("Error", func(t *testing.T) {
+		var log []string
+		client := http.Client{Transport: &HookTransport{
+			Transport: http.DefaultTransport,
+			Hooks: []RequestHook{
+				testHook{"a", &log, nil},
+				testHook{"b", &log, errors.New("denied")},
+				testHook{"c", &log, nil},
+			},
+		}}
+		_, err := client.Get(srv.URL)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "denied")
+		}
+		assert.Equal(t, []string{"before a", "before b", "after a: error"}, log)
+	})
+}
@@ -0,0 +1,41 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A HostTransport sends requests for some hosts over transports of their own, eg. to present
+// different client certificates to them; requests for any other host go over Transport. Hosts are
+// matched by name, without the port, and must be lowercase.
+type HostTransport struct {
+	Transport http.RoundTripper
+	Hosts     map[string]http.RoundTripper
+}
+
+func (t *HostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt, ok := t.Hosts[strings.ToLower(req.URL.Hostname())]; ok {
+		return rt.RoundTrip(req)
+	}
+	return t.Transport.RoundTrip(req)
+}
@@ -0,0 +1,64 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return fn(req) }
+
+func TestHostTransport(t *testing.T) {
+	transport := func(name string) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Status: name, Request: req}, nil
+		})
+	}
+	ht := &HostTransport{
+		Transport: transport("default"),
+		Hosts:     map[string]http.RoundTripper{"example.com": transport("example.com")},
+	}
+
+	testdata := map[string]string{
+		"http://example.com/":        "example.com",
+		"https://EXAMPLE.com:8443/a": "example.com",
+		"http://sub.example.com/":    "default",
+		"http://example.org/":        "default",
+		"http://[::1]:8080/":         "default",
+	}
+	for url, expected := range testdata {
+		t.Run(url, func(t *testing.T) {
+			req, err := http.NewRequest("GET", url, nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := ht.RoundTrip(req)
+			if assert.NoError(t, err) {
+				assert.Equal(t, expected, res.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Connections are tracked until they're retired; ones closed for other reasons (eg. by the server)
+// are never seen again, so the bookkeeping is reset past this many rather than growing forever.
+const maxTrackedConns = 1024
+
+// A LifetimeTransport retires connections once they're older than MaxAge or have served
+// MaxRequests requests, by sending the request that crosses the limit with "Connection: close";
+// the connection is then closed rather than going back into the pool, and the next request has
+// to reconnect. Age is counted from the connection's first request. Zero values mean no limit.
+//
+// This only applies to HTTP/1.x; HTTP/2 multiplexes requests over a connection of its own.
+type LifetimeTransport struct {
+	Transport   http.RoundTripper
+	MaxAge      time.Duration
+	MaxRequests int64
+
+	mutex sync.Mutex
+	conns map[net.Conn]*connLifetime
+}
+
+type connLifetime struct {
+	start    time.Time
+	requests int64
+}
+
+func (t *LifetimeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.MaxAge <= 0 && t.MaxRequests <= 0 {
+		return t.Transport.RoundTrip(req)
+	}
+
+	// The transport picks a connection before it writes the request, so whether it's the last one
+	// allowed on it can be decided from GotConn; the copy is ours to change until then.
+	var r *http.Request
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !t.retire(info.Conn, info.Reused) {
+				return
+			}
+			r.Close = true
+			if v := req.Context().Value(ctxKeyTracer); v != nil {
+				v.(*Tracer).connRetired = true
+			}
+		},
+	}
+	r = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.Transport.RoundTrip(r)
+}
+
+// Counts a request on a connection, and returns whether it should be the connection's last.
+func (t *LifetimeTransport) retire(conn net.Conn, reused bool) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.conns == nil || len(t.conns) >= maxTrackedConns {
+		t.conns = make(map[net.Conn]*connLifetime)
+	}
+	lt := t.conns[conn]
+	if lt == nil || !reused {
+		lt = &connLifetime{start: time.Now()}
+		t.conns[conn] = lt
+	}
+	lt.requests++
+
+	if (t.MaxRequests > 0 && lt.requests >= t.MaxRequests) ||
+		(t.MaxAge > 0 && time.Since(lt.start) >= t.MaxAge) {
+		delete(t.conns, conn)
+		return true
+	}
+	return false
+}
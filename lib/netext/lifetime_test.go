@@ -0,0 +1,88 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifetimeTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RemoteAddr)
+	}))
+	defer srv.Close()
+
+	// Returns the client address the server saw for each request, along with whether it retired
+	// its connection according to the tracer.
+	do := func(t *testing.T, transport *LifetimeTransport, n int) (addrs []string, retired []bool) {
+		client := http.Client{Transport: transport}
+		for i := 0; i < n; i++ {
+			var tracer Tracer
+			req, err := http.NewRequest("GET", srv.URL, nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := client.Do(req.WithContext(WithTracer(req.Context(), &tracer)))
+			if !assert.NoError(t, err) {
+				return
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			_ = res.Body.Close()
+			assert.NoError(t, err)
+			addrs = append(addrs, string(body))
+			retired = append(retired, tracer.Done().ConnRetired)
+		}
+		return addrs, retired
+	}
+
+	t.Run("Unlimited", func(t *testing.T) {
+		addrs, retired := do(t, &LifetimeTransport{Transport: &http.Transport{}}, 3)
+		assert.Equal(t, []bool{false, false, false}, retired)
+		assert.Equal(t, addrs[0], addrs[1])
+		assert.Equal(t, addrs[0], addrs[2])
+	})
+	t.Run("MaxRequests", func(t *testing.T) {
+		addrs, retired := do(t, &LifetimeTransport{Transport: &http.Transport{}, MaxRequests: 2}, 5)
+		assert.Equal(t, []bool{false, true, false, true, false}, retired)
+		assert.Equal(t, addrs[0], addrs[1])
+		assert.NotEqual(t, addrs[1], addrs[2])
+		assert.Equal(t, addrs[2], addrs[3])
+		assert.NotEqual(t, addrs[3], addrs[4])
+	})
+	t.Run("MaxAge", func(t *testing.T) {
+		transport := &LifetimeTransport{Transport: &http.Transport{}, MaxAge: 50 * time.Millisecond}
+		addrs, retired := do(t, transport, 1)
+		assert.Equal(t, []bool{false}, retired)
+
+		time.Sleep(60 * time.Millisecond)
+		addrs2, retired2 := do(t, transport, 2)
+		assert.Equal(t, []bool{true, false}, retired2)
+		assert.Equal(t, addrs[0], addrs2[0])
+		assert.NotEqual(t, addrs2[0], addrs2[1])
+	})
+}
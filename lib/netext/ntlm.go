@@ -0,0 +1,303 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/md4"
+)
+
+const (
+	ntlmSignature = "NTLMSSP\x00"
+
+	ntlmNegotiateUnicode          = 0x00000001
+	ntlmRequestTarget             = 0x00000004
+	ntlmNegotiateNTLM             = 0x00000200
+	ntlmNegotiateAlwaysSign       = 0x00008000
+	ntlmNegotiateExtendedSecurity = 0x00080000
+	ntlmNegotiateTargetInfo       = 0x00800000
+	ntlmNegotiate128              = 0x20000000
+	ntlmNegotiate56               = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSecurity | ntlmNegotiateTargetInfo |
+		ntlmNegotiate128 | ntlmNegotiate56
+
+	// AV pair ID for the server's timestamp in the challenge's target info.
+	ntlmAvTimestamp = 7
+)
+
+// ErrNTLMNoKeepAlive is returned for NTLM requests over a transport that can't reuse connections;
+// NTLM authenticates connections, not requests, so the handshake can't complete without it.
+var ErrNTLMNoKeepAlive = errors.New("ntlm: authentication requires connection reuse, but keep-alive is disabled")
+
+// An NTLMTransport performs NTLM (v2) authentication for requests that get challenged for it.
+// Once a connection has been authenticated, later requests over it pass straight through.
+// ErrNTLMNoKeepAlive is only returned if Transport is an *http.Transport itself; if it's wrapped,
+// callers must check for disabled keep-alive themselves.
+type NTLMTransport struct {
+	Transport http.RoundTripper
+
+	Domain, Username, Password string
+}
+
+// Splits "DOMAIN\user" into its parts; the domain is empty if there isn't one.
+func SplitNTLMUsername(s string) (domain, user string) {
+	if i := strings.IndexRune(s, '\\'); i != -1 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+func (t *NTLMTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if tr, ok := t.Transport.(*http.Transport); ok && tr.DisableKeepAlives {
+		return nil, ErrNTLMNoKeepAlive
+	}
+
+	// The request may already be going over an authenticated connection.
+	res, err := t.Transport.RoundTrip(req)
+	if err != nil || !ntlmChallenged(res) {
+		return res, err
+	}
+	discardBody(res)
+
+	// Negotiate; the challenge comes back as another 401. Don't send the body yet.
+	negReq, err := rewindRequest(req, false)
+	if err != nil {
+		return nil, err
+	}
+	negReq.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	res, err = t.Transport.RoundTrip(negReq)
+	if err != nil {
+		return nil, err
+	}
+	challenge, ok := ntlmChallenge(res)
+	if !ok {
+		return res, nil
+	}
+	discardBody(res)
+
+	// Authenticate, over the same connection, with the request proper.
+	auth, err := ntlmAuthenticateMessage(challenge, t.Domain, t.Username, t.Password, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	authReq, err := rewindRequest(req, true)
+	if err != nil {
+		return nil, err
+	}
+	authReq.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(auth))
+	return t.Transport.RoundTrip(authReq)
+}
+
+// Returns a copy of a request with fresh headers, and its body rewound (or removed).
+func rewindRequest(req *http.Request, withBody bool) (*http.Request, error) {
+	r := *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Body = nil
+	r.ContentLength = 0
+	if withBody && req.Body != nil {
+		if req.GetBody == nil {
+			return nil, errors.New("request body can't be resent for authentication")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+		r.ContentLength = req.ContentLength
+	}
+	return &r, nil
+}
+
+func discardBody(res *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	_ = res.Body.Close()
+}
+
+func ntlmChallenged(res *http.Response) bool {
+	if res.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	for _, v := range res.Header["Www-Authenticate"] {
+		if strings.TrimSpace(v) == "NTLM" || strings.HasPrefix(v, "NTLM ") {
+			return true
+		}
+	}
+	return false
+}
+
+func ntlmChallenge(res *http.Response) ([]byte, bool) {
+	if res.StatusCode != http.StatusUnauthorized {
+		return nil, false
+	}
+	for _, v := range res.Header["Www-Authenticate"] {
+		if !strings.HasPrefix(v, "NTLM ") {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v[5:]))
+		if err != nil {
+			continue
+		}
+		return data, true
+	}
+	return nil, false
+}
+
+// Type 1 message.
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+	return msg
+}
+
+// Type 3 message, in response to a type 2 message (the challenge).
+func ntlmAuthenticateMessage(challenge []byte, domain, user, password string, t time.Time) ([]byte, error) {
+	if len(challenge) < 48 || string(challenge[:8]) != ntlmSignature || binary.LittleEndian.Uint32(challenge[8:]) != 2 {
+		return nil, errors.New("ntlm: invalid challenge message")
+	}
+	flags := binary.LittleEndian.Uint32(challenge[20:])
+	serverChallenge := challenge[24:32]
+	targetInfo, err := ntlmReadField(challenge, 40)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prefer the server's idea of what time it is, if it gave us one.
+	timestamp := make([]byte, 8)
+	binary.LittleEndian.PutUint64(timestamp, uint64(t.UnixNano()/100+116444736000000000))
+	if ts := ntlmAvPair(targetInfo, ntlmAvTimestamp); len(ts) == 8 {
+		timestamp = ts
+	}
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	hash := NTLMv2Hash(domain, user, password)
+	ntResponse := NTLMv2Response(hash, serverChallenge, clientChallenge, timestamp, targetInfo)
+	lmResponse := append(ntlmHMAC(hash, serverChallenge, clientChallenge), clientChallenge...)
+
+	fields := [][]byte{
+		lmResponse,
+		ntResponse,
+		ntlmUnicode(domain),
+		ntlmUnicode(user),
+		nil, // Workstation
+		nil, // Encrypted random session key
+	}
+	msg := make([]byte, 64)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	for i, field := range fields {
+		offset := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[offset:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(msg[offset+2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(msg[offset+4:], uint32(len(msg)))
+		msg = append(msg, field...)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], flags&ntlmNegotiateFlags|ntlmNegotiateUnicode)
+	return msg, nil
+}
+
+// Reads a (length, capacity, offset) field descriptor at the given offset, returns its data.
+func ntlmReadField(msg []byte, at int) ([]byte, error) {
+	if len(msg) < at+8 {
+		return nil, errors.New("ntlm: message truncated")
+	}
+	l := int(binary.LittleEndian.Uint16(msg[at:]))
+	offset := int(binary.LittleEndian.Uint32(msg[at+4:]))
+	if offset+l > len(msg) {
+		return nil, errors.New("ntlm: message truncated")
+	}
+	return msg[offset : offset+l], nil
+}
+
+// Finds an AV pair in target info.
+func ntlmAvPair(info []byte, id uint16) []byte {
+	for len(info) >= 4 {
+		avID := binary.LittleEndian.Uint16(info)
+		l := int(binary.LittleEndian.Uint16(info[2:]))
+		if avID == 0 || len(info) < 4+l {
+			break
+		}
+		if avID == id {
+			return info[4 : 4+l]
+		}
+		info = info[4+l:]
+	}
+	return nil
+}
+
+// Computes the NTLMv2 hash (NTOWFv2) for a set of credentials.
+func NTLMv2Hash(domain, user, password string) []byte {
+	h := md4.New()
+	_, _ = h.Write(ntlmUnicode(password))
+	return ntlmHMAC(h.Sum(nil), ntlmUnicode(strings.ToUpper(user)+domain))
+}
+
+// Computes an NTLMv2 response; its first 16 bytes are the proof that the client knows the hash.
+func NTLMv2Response(hash, serverChallenge, clientChallenge, timestamp, targetInfo []byte) []byte {
+	var blob bytes.Buffer
+	blob.Write([]byte{1, 1, 0, 0, 0, 0, 0, 0})
+	blob.Write(timestamp)
+	blob.Write(clientChallenge)
+	blob.Write([]byte{0, 0, 0, 0})
+	blob.Write(targetInfo)
+	blob.Write([]byte{0, 0, 0, 0})
+	return append(ntlmHMAC(hash, serverChallenge, blob.Bytes()), blob.Bytes()...)
+}
+
+func ntlmHMAC(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		_, _ = mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func ntlmUnicode(s string) []byte {
+	codes := utf16.Encode([]rune(s))
+	b := make([]byte, len(codes)*2)
+	for i, c := range codes {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
@@ -0,0 +1,171 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A mock NTLM server, which authenticates connections for DOMAIN\user with the password "pass".
+func newNTLMServer(t *testing.T) *httptest.Server {
+	var lock sync.Mutex
+	authed := make(map[string]bool)
+	serverChallenge := []byte("12345678")
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if authed[r.RemoteAddr] {
+			_, _ = fmt.Fprintf(w, "ok %s", body)
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "NTLM ") {
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		msg, err := base64.StdEncoding.DecodeString(header[5:])
+		if !assert.NoError(t, err) || !assert.Equal(t, ntlmSignature, string(msg[:8])) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch binary.LittleEndian.Uint32(msg[8:]) {
+		case 1:
+			timestamp := make([]byte, 8)
+			binary.LittleEndian.PutUint64(timestamp, 131000000000000000)
+			targetInfo := []byte{ntlmAvTimestamp, 0, 8, 0}
+			targetInfo = append(targetInfo, timestamp...)
+			targetInfo = append(targetInfo, 0, 0, 0, 0)
+
+			challenge := make([]byte, 48)
+			copy(challenge, ntlmSignature)
+			binary.LittleEndian.PutUint32(challenge[8:], 2)
+			binary.LittleEndian.PutUint32(challenge[20:], ntlmNegotiateFlags)
+			copy(challenge[24:], serverChallenge)
+			binary.LittleEndian.PutUint16(challenge[40:], uint16(len(targetInfo)))
+			binary.LittleEndian.PutUint16(challenge[42:], uint16(len(targetInfo)))
+			binary.LittleEndian.PutUint32(challenge[44:], 48)
+			challenge = append(challenge, targetInfo...)
+
+			w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(challenge))
+			w.WriteHeader(http.StatusUnauthorized)
+		case 3:
+			ntResponse, err := ntlmReadField(msg, 20)
+			assert.NoError(t, err)
+			domain, err := ntlmReadField(msg, 28)
+			assert.NoError(t, err)
+			user, err := ntlmReadField(msg, 36)
+			assert.NoError(t, err)
+
+			hash := NTLMv2Hash("DOMAIN", "user", "pass")
+			proof := ntlmHMAC(hash, serverChallenge, ntResponse[16:])
+			if bytes.Equal(domain, ntlmUnicode("DOMAIN")) && bytes.Equal(user, ntlmUnicode("user")) &&
+				bytes.Equal(proof, ntResponse[:16]) {
+				authed[r.RemoteAddr] = true
+				_, _ = fmt.Fprintf(w, "ok %s", body)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestNTLMTransport(t *testing.T) {
+	srv := newNTLMServer(t)
+	defer srv.Close()
+
+	t.Run("Success", func(t *testing.T) {
+		client := http.Client{Transport: &NTLMTransport{
+			Transport: &http.Transport{},
+			Domain:    "DOMAIN",
+			Username:  "user",
+			Password:  "pass",
+		}}
+		for i := 0; i < 3; i++ {
+			res, err := client.Post(srv.URL, "text/plain", strings.NewReader("body"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			data, _ := ioutil.ReadAll(res.Body)
+			_ = res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "ok body", string(data))
+		}
+	})
+	t.Run("BadCredentials", func(t *testing.T) {
+		client := http.Client{Transport: &NTLMTransport{
+			Transport: &http.Transport{},
+			Domain:    "DOMAIN",
+			Username:  "user",
+			Password:  "wrong",
+		}}
+		res, err := client.Get(srv.URL)
+		if assert.NoError(t, err) {
+			_ = res.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		}
+	})
+	t.Run("NoKeepAlive", func(t *testing.T) {
+		client := http.Client{Transport: &NTLMTransport{
+			Transport: &http.Transport{DisableKeepAlives: true},
+			Username:  "user",
+		}}
+		_, err := client.Get(srv.URL)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), ErrNTLMNoKeepAlive.Error())
+		}
+	})
+}
+
+func TestSplitNTLMUsername(t *testing.T) {
+	domain, user := SplitNTLMUsername(`DOMAIN\user`)
+	assert.Equal(t, "DOMAIN", domain)
+	assert.Equal(t, "user", user)
+
+	domain, user = SplitNTLMUsername("user")
+	assert.Equal(t, "", domain)
+	assert.Equal(t, "user", user)
+}
+
+func TestNTLMAuthenticateMessage(t *testing.T) {
+	_, err := ntlmAuthenticateMessage([]byte("nope"), "", "user", "pass", time.Now())
+	assert.EqualError(t, err, "ntlm: invalid challenge message")
+}
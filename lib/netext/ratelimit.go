@@ -0,0 +1,83 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A RateLimiter spaces requests out evenly, to at most a given number per second. It's a token
+// bucket holding a single token, so requests can't burst after a lull. It's safe for concurrent
+// use, eg. to share a limit between VUs.
+type RateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// Creates a limiter for rate requests per second; 0 means no limit.
+func NewRateLimiter(rate int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(rate)
+	return l
+}
+
+// Changes the limit; 0 means no limit.
+func (l *RateLimiter) SetRate(rate int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.interval = 0
+	if rate > 0 {
+		l.interval = time.Second / time.Duration(rate)
+	}
+}
+
+// Blocks until a request may be made, or ctx is done. Returns how long it waited.
+func (l *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	l.mutex.Lock()
+	if l.interval == 0 {
+		l.mutex.Unlock()
+		return 0, nil
+	}
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mutex.Unlock()
+
+	wait := at.Sub(now)
+	if wait <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		return time.Since(now), ctx.Err()
+	}
+}
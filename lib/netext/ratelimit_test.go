@@ -0,0 +1,77 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("Unlimited", func(t *testing.T) {
+		l := NewRateLimiter(0)
+		for i := 0; i < 100; i++ {
+			waited, err := l.Wait(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, time.Duration(0), waited)
+		}
+	})
+	t.Run("Limited", func(t *testing.T) {
+		l := NewRateLimiter(50)
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := l.Wait(context.Background())
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		// The first request goes through right away, the rest 20ms apart.
+		assert.True(t, time.Since(start) >= 180*time.Millisecond, "too fast: %s", time.Since(start))
+	})
+	t.Run("Cancel", func(t *testing.T) {
+		l := NewRateLimiter(1)
+		_, err := l.Wait(context.Background())
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		waited, err := l.Wait(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, waited < 500*time.Millisecond, "waited too long: %s", waited)
+	})
+	t.Run("SetRate", func(t *testing.T) {
+		l := NewRateLimiter(1)
+		_, _ = l.Wait(context.Background())
+		l.SetRate(0)
+		waited, err := l.Wait(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, time.Duration(0), waited)
+	})
+}
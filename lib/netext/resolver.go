@@ -0,0 +1,157 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Which of a host's addresses a Resolver returns, and in what order.
+type IPPolicy int
+
+const (
+	IPAny      IPPolicy = iota // Whatever the lookup returned, in its order
+	IPPreferV4                 // IPv4 addresses first, then IPv6
+	IPPreferV6                 // IPv6 addresses first, then IPv4
+	IPOnlyV4                   // Only IPv4 addresses
+	IPOnlyV6                   // Only IPv6 addresses
+)
+
+// Which of a host's addresses a Dialer connects to.
+type IPSelect int
+
+const (
+	IPSelectFirst      IPSelect = iota // Always the first one
+	IPSelectRoundRobin                 // Each in turn, separately for every VU; see Dialer.ForVU()
+	IPSelectRandom                     // A random one for every connection
+)
+
+// A Resolver looks up hosts' addresses and caches them, for all VUs. Its fields mustn't be changed
+// once it's in use.
+type Resolver struct {
+	// How long lookups are cached for; 0 looks hosts up for every connection, and a negative TTL
+	// caches them forever. DNS records' own TTLs aren't taken into account.
+	TTL time.Duration
+
+	Policy IPPolicy
+
+	// Does the actual lookups; the system resolver's if nil.
+	LookupIP func(ctx context.Context, host string) ([]net.IP, error)
+
+	mutex sync.Mutex
+	cache map[string]resolverEntry
+}
+
+type resolverEntry struct {
+	ips     []net.IP
+	expires time.Time // Zero if it never does
+}
+
+func NewResolver(ttl time.Duration, policy IPPolicy) *Resolver {
+	return &Resolver{TTL: ttl, Policy: policy}
+}
+
+// Returns a host's addresses, filtered and ordered according to the policy, and whether they came
+// from the cache. IP literals are returned as they are.
+func (r *Resolver) Resolve(ctx context.Context, host string) ([]net.IP, bool, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, true, nil
+	}
+
+	now := time.Now()
+	if r.TTL != 0 {
+		r.mutex.Lock()
+		entry, ok := r.cache[host]
+		r.mutex.Unlock()
+		if ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+			return entry.ips, true, nil
+		}
+	}
+
+	ips, err := r.lookupIP(ctx, host)
+	if err != nil {
+		return nil, false, err
+	}
+	ips = r.applyPolicy(ips)
+	if len(ips) == 0 {
+		return nil, false, errors.Errorf("no addresses for %s allowed by the DNS policy", host)
+	}
+
+	if r.TTL != 0 {
+		entry := resolverEntry{ips: ips}
+		if r.TTL > 0 {
+			entry.expires = now.Add(r.TTL)
+		}
+		r.mutex.Lock()
+		if r.cache == nil {
+			r.cache = make(map[string]resolverEntry)
+		}
+		r.cache[host] = entry
+		r.mutex.Unlock()
+	}
+	return ips, false, nil
+}
+
+func (r *Resolver) lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if r.LookupIP != nil {
+		return r.LookupIP(ctx, host)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, nil
+}
+
+func (r *Resolver) applyPolicy(ips []net.IP) []net.IP {
+	if r.Policy == IPAny {
+		return ips
+	}
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	switch r.Policy {
+	case IPPreferV4:
+		return append(v4, v6...)
+	case IPPreferV6:
+		return append(v6, v4...)
+	case IPOnlyV4:
+		return v4
+	case IPOnlyV6:
+		return v6
+	default:
+		return ips
+	}
+}
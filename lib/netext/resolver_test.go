@@ -0,0 +1,150 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A stand-in for a DNS server, whose records can be changed mid-test.
+type testDNS struct {
+	mutex   sync.Mutex
+	records map[string][]net.IP
+	lookups int
+}
+
+func (dns *testDNS) set(host string, ips ...string) {
+	dns.mutex.Lock()
+	defer dns.mutex.Unlock()
+	if dns.records == nil {
+		dns.records = make(map[string][]net.IP)
+	}
+	dns.records[host] = nil
+	for _, ip := range ips {
+		dns.records[host] = append(dns.records[host], net.ParseIP(ip))
+	}
+}
+
+func (dns *testDNS) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	dns.mutex.Lock()
+	defer dns.mutex.Unlock()
+	dns.lookups++
+	ips, ok := dns.records[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+	return ips, nil
+}
+
+func TestResolver(t *testing.T) {
+	t.Run("TTL", func(t *testing.T) {
+		testdata := map[string]struct {
+			ttl     time.Duration
+			lookups int
+			ip      string
+		}{
+			"inf":    {-1, 1, "10.0.0.1"},
+			"0":      {0, 3, "10.0.0.2"},
+			"expiry": {50 * time.Millisecond, 2, "10.0.0.2"},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				dns := &testDNS{}
+				dns.set("example.com", "10.0.0.1")
+				r := NewResolver(data.ttl, IPAny)
+				r.LookupIP = dns.LookupIP
+
+				ips, cached, err := r.Resolve(context.Background(), "example.com")
+				assert.NoError(t, err)
+				assert.False(t, cached)
+				assert.Equal(t, "10.0.0.1", ips[0].String())
+
+				dns.set("example.com", "10.0.0.2")
+				_, _, err = r.Resolve(context.Background(), "example.com")
+				assert.NoError(t, err)
+				time.Sleep(60 * time.Millisecond)
+				ips, _, err = r.Resolve(context.Background(), "example.com")
+				assert.NoError(t, err)
+				assert.Equal(t, data.ip, ips[0].String())
+				assert.Equal(t, data.lookups, dns.lookups)
+			})
+		}
+	})
+	t.Run("Policy", func(t *testing.T) {
+		testdata := map[IPPolicy][]string{
+			IPAny:      {"::1", "10.0.0.1", "::2", "10.0.0.2"},
+			IPPreferV4: {"10.0.0.1", "10.0.0.2", "::1", "::2"},
+			IPPreferV6: {"::1", "::2", "10.0.0.1", "10.0.0.2"},
+			IPOnlyV4:   {"10.0.0.1", "10.0.0.2"},
+			IPOnlyV6:   {"::1", "::2"},
+		}
+		for policy, expected := range testdata {
+			dns := &testDNS{}
+			dns.set("example.com", "::1", "10.0.0.1", "::2", "10.0.0.2")
+			r := NewResolver(-1, policy)
+			r.LookupIP = dns.LookupIP
+
+			ips, _, err := r.Resolve(context.Background(), "example.com")
+			if !assert.NoError(t, err) {
+				continue
+			}
+			var strs []string
+			for _, ip := range ips {
+				strs = append(strs, ip.String())
+			}
+			assert.Equal(t, expected, strs, "policy %d", policy)
+		}
+
+		dns := &testDNS{}
+		dns.set("example.com", "10.0.0.1")
+		r := NewResolver(-1, IPOnlyV6)
+		r.LookupIP = dns.LookupIP
+		_, _, err := r.Resolve(context.Background(), "example.com")
+		assert.EqualError(t, err, "no addresses for example.com allowed by the DNS policy")
+	})
+	t.Run("Literal", func(t *testing.T) {
+		dns := &testDNS{}
+		r := NewResolver(-1, IPAny)
+		r.LookupIP = dns.LookupIP
+		ips, _, err := r.Resolve(context.Background(), "10.0.0.1")
+		assert.NoError(t, err)
+		assert.Equal(t, []net.IP{net.ParseIP("10.0.0.1")}, ips)
+		assert.Equal(t, 0, dns.lookups)
+	})
+	t.Run("Error", func(t *testing.T) {
+		dns := &testDNS{}
+		r := NewResolver(-1, IPAny)
+		r.LookupIP = dns.LookupIP
+		_, _, err := r.Resolve(context.Background(), "nonexistent.example.com")
+		assert.Error(t, err)
+
+		// Failures aren't cached.
+		dns.set("nonexistent.example.com", "10.0.0.1")
+		_, _, err = r.Resolve(context.Background(), "nonexistent.example.com")
+		assert.NoError(t, err)
+	})
+}
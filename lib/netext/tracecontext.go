@@ -0,0 +1,78 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// A TraceContext identifies a trace, propagated to the system under test so its own traces can be
+// correlated with requests; see https://www.w3.org/TR/trace-context/ for the traceparent header,
+// or https://github.com/openzipkin/b3-propagation for B3.
+type TraceContext struct {
+	TraceID string // 32 hex digits.
+	Sampled bool
+	B3      bool // Propagate using X-B3-* headers rather than traceparent.
+}
+
+// Starts a new trace, with a random ID.
+func NewTraceContext(sampled, b3 bool) (*TraceContext, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	return &TraceContext{TraceID: id, Sampled: sampled, B3: b3}, nil
+}
+
+// Sets the trace's headers on a request, with a new span ID every time, so that each attempt or
+// redirect is a span of its own. Returns the span ID.
+func (tc *TraceContext) Inject(h http.Header) (string, error) {
+	spanID, err := randomHex(8)
+	if err != nil {
+		return "", err
+	}
+	if tc.B3 {
+		h.Set("X-B3-TraceId", tc.TraceID)
+		h.Set("X-B3-SpanId", spanID)
+		if tc.Sampled {
+			h.Set("X-B3-Sampled", "1")
+		} else {
+			h.Set("X-B3-Sampled", "0")
+		}
+	} else {
+		flags := "00"
+		if tc.Sampled {
+			flags = "01"
+		}
+		h.Set("traceparent", "00-"+tc.TraceID+"-"+spanID+"-"+flags)
+	}
+	return spanID, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
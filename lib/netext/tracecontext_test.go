@@ -0,0 +1,69 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceContext(t *testing.T) {
+	t.Run("W3C", func(t *testing.T) {
+		for _, sampled := range []bool{true, false} {
+			tc, err := NewTraceContext(sampled, false)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{32}$`), tc.TraceID)
+
+			h := http.Header{}
+			span1, err := tc.Inject(h)
+			assert.NoError(t, err)
+			flags := "00"
+			if sampled {
+				flags = "01"
+			}
+			assert.Equal(t, "00-"+tc.TraceID+"-"+span1+"-"+flags, h.Get("traceparent"))
+
+			span2, err := tc.Inject(h)
+			assert.NoError(t, err)
+			assert.NotEqual(t, span1, span2)
+			assert.Equal(t, "00-"+tc.TraceID+"-"+span2+"-"+flags, h.Get("traceparent"))
+		}
+	})
+	t.Run("B3", func(t *testing.T) {
+		tc, err := NewTraceContext(true, true)
+		if !assert.NoError(t, err) {
+			return
+		}
+		h := http.Header{}
+		span, err := tc.Inject(h)
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{16}$`), span)
+		assert.Equal(t, tc.TraceID, h.Get("X-B3-TraceId"))
+		assert.Equal(t, span, h.Get("X-B3-SpanId"))
+		assert.Equal(t, "1", h.Get("X-B3-Sampled"))
+		assert.Equal(t, "", h.Get("traceparent"))
+	})
+}
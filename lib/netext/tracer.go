@@ -21,8 +21,10 @@
 package netext
 
 import (
+	"crypto/tls"
 	"net"
 	"net/http/httptrace"
+	"sync/atomic"
 	"time"
 
 	"github.com/loadimpact/k6/lib/metrics"
@@ -38,32 +40,63 @@ type Trail struct {
 	// Total request duration, excluding DNS lookup and connect time.
 	Duration time.Duration
 
-	Blocked    time.Duration // Waiting to acquire a connection.
-	Connecting time.Duration // Connecting to remote host.
-	Sending    time.Duration // Writing request.
-	Waiting    time.Duration // Waiting for first byte.
-	Receiving  time.Duration // Receiving response.
+	Blocked        time.Duration // Waiting to acquire a connection.
+	PoolWait       time.Duration // Waiting for an idle connection; Blocked, if one was reused.
+	Connecting     time.Duration // Connecting to remote host.
+	TLSHandshaking time.Duration // Executing TLS handshake.
+	Sending        time.Duration // Writing request.
+	Waiting        time.Duration // Waiting for first byte.
+	Receiving      time.Duration // Receiving response.
 
 	// Detailed connection information.
 	ConnReused     bool
 	ConnRemoteAddr net.Addr
 
+	// Whether the connection was retired after this request; see LifetimeTransport.
+	ConnRetired bool
+
+	// Time spent looking up hosts for new connections, and how many lookups that took, of which
+	// how many came from the cache; see Resolver.
+	DNSLookup    time.Duration
+	DNSLookups   int64
+	DNSCacheHits int64
+
 	// Bandwidth usage.
 	BytesRead, BytesWritten int64
 }
 
 func (tr Trail) Samples(tags map[string]string) []stats.Sample {
-	return []stats.Sample{
+	samples := []stats.Sample{
 		{Metric: metrics.HTTPReqs, Time: tr.EndTime, Tags: tags, Value: 1},
 		{Metric: metrics.HTTPReqDuration, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Duration)},
 		{Metric: metrics.HTTPReqBlocked, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Blocked)},
 		{Metric: metrics.HTTPReqConnecting, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Connecting)},
+		{Metric: metrics.HTTPReqTLSHandshaking, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.TLSHandshaking)},
 		{Metric: metrics.HTTPReqSending, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Sending)},
 		{Metric: metrics.HTTPReqWaiting, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Waiting)},
 		{Metric: metrics.HTTPReqReceiving, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Receiving)},
 		{Metric: metrics.DataReceived, Time: tr.EndTime, Tags: tags, Value: float64(tr.BytesRead)},
 		{Metric: metrics.DataSent, Time: tr.EndTime, Tags: tags, Value: float64(tr.BytesWritten)},
 	}
+	if tr.ConnReused {
+		samples = append(samples, stats.Sample{Metric: metrics.HTTPReqPoolWait, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.PoolWait)})
+	}
+	if tr.ConnRetired {
+		samples = append(samples, stats.Sample{Metric: metrics.HTTPReconnects, Time: tr.EndTime, Tags: tags, Value: 1})
+	}
+	if tr.DNSLookups > 0 {
+		samples = append(samples, stats.Sample{
+			Metric: metrics.DNSLookupDuration, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.DNSLookup),
+		})
+		for i := int64(0); i < tr.DNSLookups; i++ {
+			hit := 0.0
+			if i < tr.DNSCacheHits {
+				hit = 1
+			}
+			samples = append(samples, stats.Sample{Metric: metrics.DNSCacheHits, Time: tr.EndTime, Tags: tags, Value: hit})
+		}
+	}
+	return samples
 }
 
 // A Tracer wraps "net/http/httptrace" to collect granular timings for HTTP requests.
@@ -77,14 +110,20 @@ type Tracer struct {
 	gotFirstResponseByte time.Time
 	connectStart         time.Time
 	connectDone          time.Time
+	tlsHandshakeStart    time.Time
+	tlsHandshakeDone     time.Time
 	wroteRequest         time.Time
 
 	connReused     bool
 	connRemoteAddr net.Addr
+	connRetired    bool
 
 	protoError error
 
 	bytesRead, bytesWritten int64
+
+	// Lookups may be done while dialing for another request, so these are updated atomically.
+	dnsLookup, dnsLookups, dnsCacheHits int64
 }
 
 // Trace() returns a premade ClientTrace that calls all of the Tracer's hooks.
@@ -95,6 +134,8 @@ func (t *Tracer) Trace() *httptrace.ClientTrace {
 		GotFirstResponseByte: t.GotFirstResponseByte,
 		ConnectStart:         t.ConnectStart,
 		ConnectDone:          t.ConnectDone,
+		TLSHandshakeStart:    t.TLSHandshakeStart,
+		TLSHandshakeDone:     t.TLSHandshakeDone,
 		WroteRequest:         t.WroteRequest,
 	}
 }
@@ -114,23 +155,31 @@ func (t *Tracer) Done() Trail {
 	}
 
 	trail := Trail{
-		Blocked:    t.gotConn.Sub(t.getConn),
-		Connecting: t.connectDone.Sub(t.connectStart),
-		Sending:    t.wroteRequest.Sub(t.connectDone),
-		Waiting:    t.gotFirstResponseByte.Sub(t.wroteRequest),
-		Receiving:  done.Sub(t.gotFirstResponseByte),
+		Blocked:        t.gotConn.Sub(t.getConn),
+		Connecting:     t.connectDone.Sub(t.connectStart),
+		TLSHandshaking: t.tlsHandshakeDone.Sub(t.tlsHandshakeStart),
+		Sending:        t.wroteRequest.Sub(t.gotConn),
+		Waiting:        t.gotFirstResponseByte.Sub(t.wroteRequest),
+		Receiving:      done.Sub(t.gotFirstResponseByte),
 
 		ConnReused:     t.connReused,
 		ConnRemoteAddr: t.connRemoteAddr,
+		ConnRetired:    t.connRetired,
 
 		BytesRead:    t.bytesRead,
 		BytesWritten: t.bytesWritten,
+
+		DNSLookup:    time.Duration(atomic.LoadInt64(&t.dnsLookup)),
+		DNSLookups:   atomic.LoadInt64(&t.dnsLookups),
+		DNSCacheHits: atomic.LoadInt64(&t.dnsCacheHits),
 	}
 
-	// If the connection was reused, it never blocked.
+	// Blocked spans GetConn to GotConn either way, so time spent waiting for a free slot in
+	// the connection pool shows up there; a reused connection didn't connect or handshake.
 	if t.connReused {
-		trail.Blocked = 0
 		trail.Connecting = 0
+		trail.TLSHandshaking = 0
+		trail.PoolWait = trail.Blocked
 	}
 
 	// If the connection failed, we'll never get any (meaningful) data for these.
@@ -154,6 +203,15 @@ func (t *Tracer) Done() Trail {
 	return trail
 }
 
+// Records a host lookup made for the request; see Dialer.
+func (t *Tracer) addDNSLookup(d time.Duration, cached bool) {
+	atomic.AddInt64(&t.dnsLookup, int64(d))
+	atomic.AddInt64(&t.dnsLookups, 1)
+	if cached {
+		atomic.AddInt64(&t.dnsCacheHits, 1)
+	}
+}
+
 // GetConn event hook.
 func (t *Tracer) GetConn(hostPort string) {
 	t.getConn = time.Now()
@@ -208,6 +266,19 @@ func (t *Tracer) ConnectDone(network, addr string, err error) {
 	}
 }
 
+// TLSHandshakeStart hook.
+func (t *Tracer) TLSHandshakeStart() {
+	t.tlsHandshakeStart = time.Now()
+}
+
+// TLSHandshakeDone hook.
+func (t *Tracer) TLSHandshakeDone(state tls.ConnectionState, err error) {
+	t.tlsHandshakeDone = time.Now()
+	if err != nil {
+		t.protoError = err
+	}
+}
+
 // WroteRequest hook.
 func (t *Tracer) WroteRequest(info httptrace.WroteRequestInfo) {
 	t.wroteRequest = time.Now()
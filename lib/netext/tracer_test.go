@@ -0,0 +1,89 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracer(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+
+	for _, reused := range []bool{false, true} {
+		tracer := &Tracer{}
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		res, err := client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), tracer.Trace())))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, _ = ioutil.ReadAll(res.Body)
+		assert.NoError(t, res.Body.Close())
+		trail := tracer.Done()
+
+		assert.Equal(t, reused, trail.ConnReused)
+		assert.True(t, trail.Blocked > 0)
+		if reused {
+			assert.Equal(t, 0, int(trail.Connecting))
+			assert.Equal(t, 0, int(trail.TLSHandshaking))
+		} else {
+			assert.True(t, trail.Connecting > 0)
+			assert.True(t, trail.TLSHandshaking > 0)
+		}
+		assert.True(t, trail.Sending > 0)
+		assert.True(t, trail.Waiting > 0)
+
+		samples := trail.Samples(map[string]string{"url": srv.URL})
+		seen := map[string]bool{}
+		for _, s := range samples {
+			assert.Equal(t, srv.URL, s.Tags["url"])
+			seen[s.Metric.Name] = true
+		}
+		for _, m := range []string{
+			metrics.HTTPReqBlocked.Name,
+			metrics.HTTPReqConnecting.Name,
+			metrics.HTTPReqTLSHandshaking.Name,
+			metrics.HTTPReqSending.Name,
+			metrics.HTTPReqWaiting.Name,
+			metrics.HTTPReqReceiving.Name,
+		} {
+			assert.True(t, seen[m], "missing %s", m)
+		}
+		assert.Equal(t, reused, seen[metrics.HTTPReqPoolWait.Name])
+	}
+}
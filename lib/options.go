@@ -22,13 +22,67 @@ package lib
 
 import (
 	"encoding/json"
+	"net"
 	"time"
 
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 
 	"gopkg.in/guregu/null.v3"
 )
 
+// Possible values for Options.CookieMode.
+const (
+	CookieModePersist  = "persist"  // Cookies persist across iterations (default)
+	CookieModeReset    = "reset"    // The cookie jar is cleared before every iteration
+	CookieModeDisabled = "disabled" // No cookie jar is used at all
+)
+
+// Possible values for Options.TrendSink.
+const (
+	TrendSinkExact     = "exact"     // Values are kept, up to stats.MaxTrendValues (default)
+	TrendSinkHistogram = "histogram" // Values are counted into buckets; see stats.HistogramSink
+)
+
+// Possible values for Options.HTTPDebug.
+const (
+	HTTPDebugHeaders = "headers" // Requests and responses are logged without bodies
+	HTTPDebugFull    = "full"    // Requests and responses are logged with (truncated) bodies
+)
+
+// Possible values for TracingOptions.Propagator.
+const (
+	TracingPropagatorW3C = "w3c" // W3C Trace Context's traceparent header
+	TracingPropagatorB3  = "b3"  // Zipkin's X-B3-* headers
+)
+
+// Possible values for DNSOptions.Select and DNSOptions.Policy.
+const (
+	DNSSelectFirst      = "first"      // Always connect to the first address
+	DNSSelectRoundRobin = "roundRobin" // Take turns between addresses, separately for every VU
+	DNSSelectRandom     = "random"     // Connect to a random address
+
+	DNSPolicyAny        = "any"        // Use addresses in the order they were returned
+	DNSPolicyPreferIPv4 = "preferIPv4" // Use IPv4 addresses before IPv6 ones
+	DNSPolicyPreferIPv6 = "preferIPv6" // Use IPv6 addresses before IPv4 ones
+	DNSPolicyOnlyIPv4   = "onlyIPv4"   // Only use IPv4 addresses
+	DNSPolicyOnlyIPv6   = "onlyIPv6"   // Only use IPv6 addresses
+)
+
+// Default for Options.MaxResponseBodySize; generous, but enough to keep a runaway response from
+// taking down the machine.
+const DefaultMaxResponseBodySize = 100 * 1024 * 1024
+
+// Default for Options.MaxRedirects, same as net/http's.
+const DefaultMaxRedirects = 10
+
+// Default for Options.HTTPTimeout; a request that takes longer than this is most likely hung.
+const DefaultHTTPTimeout = 60 * time.Second
+
+// User-Agent sent with HTTP requests unless Options.UserAgent or Options.Headers say otherwise,
+// rather than Go's, which some firewalls block outright.
+const DefaultUserAgent = "k6 (https://github.com/loadimpact/k6)"
+
 type Duration time.Duration
 
 func (d *Duration) UnmarshalJSON(data []byte) error {
@@ -47,6 +101,78 @@ func (d *Duration) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Propagates a trace context with every HTTP request, so that the system under test's traces can
+// be joined against k6's output; see Options.Tracing.
+type TracingOptions struct {
+	Propagator null.String `json:"propagator"`
+
+	// Share of requests marked as sampled, from 0 to 1; all of them if unset.
+	Sampling null.Float `json:"sampling"`
+}
+
+// How hosts are looked up and which of their addresses are connected to; see Options.DNS. Lookups
+// are cached for all VUs.
+type DNSOptions struct {
+	// How long lookups are cached for: a duration, eg. "1m", "0" to look hosts up for every new
+	// connection, or "inf" (the default) to never look them up again.
+	TTL    null.String `json:"ttl"`
+	Select null.String `json:"select"`
+	Policy null.String `json:"policy"`
+
+	// Tags requests' samples with the IP they connected to ("ip"), and with whether the host's
+	// lookup came from the cache ("dns_cache": "hit" or "miss") if the request made a connection.
+	Tags null.Bool `json:"tags"`
+}
+
+// Returns the TTL as a duration; negative for "inf", or if it's unset.
+func (o DNSOptions) ParseTTL() (time.Duration, error) {
+	switch o.TTL.String {
+	case "", "inf":
+		return -1, nil
+	}
+	d, err := time.ParseDuration(o.TTL.String)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("can't be negative")
+	}
+	return d, nil
+}
+
+// Records requests and responses in full, and writes them to a HAR file at the end of the test;
+// see Options.HAR.
+type HAROptions struct {
+	File null.String `json:"file"`
+
+	// Share of requests to record, from 0 to 1; all of them if unset.
+	Sample null.Float `json:"sample"`
+
+	// Only record requests that failed, or got a 4xx or 5xx response.
+	FailedOnly null.Bool `json:"failedOnly"`
+
+	// Bodies are truncated past this many bytes (default 10 KiB); 0 leaves them out.
+	MaxBodySize null.Int `json:"maxBodySize"`
+}
+
+// Scenario executors; see Scenario.Executor.
+const (
+	ExecutorConstantVUs = "constant-vus"
+)
+
+// A named workload, run alongside any others; see Options.Scenarios.
+type Scenario struct {
+	// How the scenario's VUs are scheduled; only "constant-vus" (the default) for now, which runs
+	// a fixed number of VUs for the test's duration or iterations.
+	Executor null.String `json:"executor"`
+
+	// VUs reserved for this scenario; they're never shared with other scenarios.
+	VUs null.Int `json:"vus"`
+
+	// The exported function the scenario's VUs run; "default" if unset.
+	Exec null.String `json:"exec"`
+}
+
 type Options struct {
 	Paused     null.Bool   `json:"paused"`
 	VUs        null.Int    `json:"vus"`
@@ -55,14 +181,159 @@ type Options struct {
 	Iterations null.Int    `json:"iterations"`
 	Stages     []Stage     `json:"stages"`
 
+	// Named scenarios to run concurrently, each with its own VUs and function; samples are tagged
+	// with "scenario". VUs and VUsMax are the sum of the scenarios' VUs, and stages can't be used.
+	Scenarios map[string]Scenario `json:"scenarios"`
+
+	// Runs only a share of the test, eg. "2/4" or "1/4:2/4"; see ExecutionSegment.
+	ExecutionSegment null.String `json:"executionSegment"`
+
+	// Aborts iterations running for longer than this, eg. stuck in an infinite loop; a VU stops
+	// altogether after MaxIterationTimeouts consecutive timeouts, if set.
+	MaxIterationDuration null.String `json:"maxIterationDuration"`
+	MaxIterationTimeouts null.Int    `json:"maxIterationTimeouts"`
+
+	// Aborts running iterations once the heap grows larger than this many bytes, after collecting
+	// garbage. It's a coarse, process-wide limit rather than a per-VU one, as the JS runtime
+	// doesn't keep track of what each VU allocates; whichever iterations are running are aborted.
+	MaxHeapSize null.Int `json:"maxHeapSize"`
+
+	// Leaves time spent in sleep() out of iteration_duration, to measure active time rather than
+	// what a user would experience.
+	IterationDurationExcludesSleep null.Bool `json:"iterationDurationExcludesSleep"`
+
+	// Periodically writes aggregated metrics to this file, so that partial results survive k6
+	// being killed; see Engine.WriteCheckpoint().
+	Checkpoint         null.String `json:"checkpoint"`
+	CheckpointInterval null.String `json:"checkpointInterval"`
+
+	// Seeds VUs' RNGs, making randomness reproducible across runs; random if unset.
+	Seed null.Int `json:"seed"`
+
 	Linger        null.Bool `json:"linger"`
 	NoUsageReport null.Bool `json:"noUsageReport"`
 
+	// How many iterations' worth of samples may be buffered, and whether to drop samples rather
+	// than wait when that buffer is full.
+	SamplesBufferSize null.Int  `json:"samplesBufferSize"`
+	DropSamples       null.Bool `json:"dropSamples"`
+
+	// Caps the rate of HTTP requests, across all VUs and per VU, in requests per second; requests
+	// wait their turn, which is reported as http_req_rate_limited. 0 means no limit.
+	RPS      null.Int `json:"rps"`
+	RPSPerVU null.Int `json:"rpsPerVU"`
+
+	// Headers sent with every HTTP request, unless overridden by the request's own. UserAgent takes
+	// precedence over a User-Agent in Headers; if neither is set (or UserAgent is null),
+	// DefaultUserAgent is sent. An empty UserAgent sends no User-Agent header at all.
+	UserAgent null.String       `json:"userAgent"`
+	Headers   map[string]string `json:"headers"`
+
+	// Redirects an HTTP request follows before failing (see DefaultMaxRedirects); 0 makes any
+	// redirect an error. Requests can override it with their maxRedirects param.
 	MaxRedirects          null.Int  `json:"maxRedirects"`
 	InsecureSkipTLSVerify null.Bool `json:"insecureSkipTLSVerify"`
 
+	// Restricts the TLS versions (eg. "tls1.1", see TLSVersionNames) and cipher suites (see
+	// TLSCipherSuiteNames) connections may negotiate; Go's defaults if unset. Cipher suites only
+	// apply to TLS 1.2 and older.
+	TLSMinVersion   null.String `json:"tlsMinVersion"`
+	TLSMaxVersion   null.String `json:"tlsMaxVersion"`
+	TLSCipherSuites []string    `json:"tlsCipherSuites"`
+
+	// Client certificates, for servers that ask for one. The first one that fits a server's request
+	// is presented, trying the ones scoped to its host before the unscoped ones.
+	TLSAuth []TLSAuth `json:"tlsAuth"`
+
+	// Makes every connection do a full TLS handshake, rather than resuming an earlier session, and
+	// optionally every request open a new connection; for modelling clients without warm caches.
+	NoTLSResumption   null.Bool `json:"noTLSResumption"`
+	NoConnectionReuse null.Bool `json:"noConnectionReuse"`
+
+	// Sticks to HTTP/1.1, rather than negotiating HTTP/2 with servers that support it.
+	NoHTTP2 null.Bool `json:"noHTTP2"`
+
+	// Retires pooled connections once they're this old (eg. "30s") or have served this many
+	// requests, so that clients reconnect periodically; eg. to spread load behind a load balancer
+	// as it scales. The retiring request is sent with "Connection: close". 0 or "" means no limit.
+	ConnectionMaxAge      null.String `json:"connectionMaxAge"`
+	ConnectionMaxRequests null.Int    `json:"connectionMaxRequests"`
+
+	// Caps each VU's idle connection pool, in total and per host, and the connections it can have
+	// open to a host at once; requests past MaxConnsPerHost wait for a connection to free up. 0
+	// means no limit, except for MaxIdleConnsPerHost, where Go's default of 2 applies if unset.
+	MaxIdleConns        null.Int `json:"maxIdleConns"`
+	MaxIdleConnsPerHost null.Int `json:"maxIdleConnsPerHost"`
+	MaxConnsPerHost     null.Int `json:"maxConnsPerHost"`
+
+	CookieMode null.String `json:"cookieMode"`
+
+	// Makes HTTP requests emit no http_* samples, unless their params say recordMetrics: true; eg.
+	// to squeeze more out of a load generator when only custom metrics matter.
+	NoHTTPMetrics null.Bool `json:"noHTTPMetrics"`
+
+	// Response bodies are cut off past this many bytes (see DefaultMaxResponseBodySize); the rest
+	// is read and discarded. 0 means no limit.
+	MaxResponseBodySize null.Int `json:"maxResponseBodySize"`
+
+	// Aborts HTTP requests that take longer than this, eg. "30s", including reading the body (see
+	// DefaultHTTPTimeout); every retry gets a new one. Requests can override it with their timeout
+	// param. "0" means no timeout.
+	HTTPTimeout null.String `json:"httpTimeout"`
+
+	HTTPCache     null.Bool `json:"httpCache"`
+	HTTPCacheSize null.Int  `json:"httpCacheSize"`
+
+	// Logs every request and response, either "headers" or "full"; optionally with credentials
+	// (Authorization, Cookie and Set-Cookie headers) redacted.
+	HTTPDebug       null.String `json:"httpDebug"`
+	HTTPDebugRedact null.Bool   `json:"httpDebugRedact"`
+
+	// Sends a trace context with every request, and records its trace ID on the request's samples.
+	Tracing *TracingOptions `json:"tracing"`
+
+	// DNS caching and address selection; by default, lookups are cached forever, and the first
+	// address is used.
+	DNS *DNSOptions `json:"dns"`
+
+	// Records requests in full, for debugging; see HAROptions.
+	HAR *HAROptions `json:"har"`
+
+	// Resets the global scope to its state after init before every iteration, so iterations can't
+	// leak state into each other; __VU_STATE__ is left alone, for deliberate persistence.
+	IsolateGlobals null.Bool `json:"isolateGlobals"`
+
+	// Maximum size of each VU's key/value store (k6/store), in bytes; 0 means no limit.
+	VUStoreSize null.Int `json:"vuStoreSize"`
+
+	// Hosts ("host" or "host:port") to reach through unix sockets, eg. {"app": "/var/run/app.sock"}.
+	UnixSockets map[string]string `json:"unixSockets"`
+
+	// Local IPs to make connections from, in turns; they must be bindable on this machine.
+	LocalIPs []net.IP `json:"localIPs"`
+
 	Thresholds map[string]stats.Thresholds `json:"thresholds"`
 
+	// Maximum number of distinct values per tag key, past which values are reported as "(other)";
+	// see DefaultMaxTagValues. 0 means no limit. Doesn't apply to the keys in UnlimitedTags.
+	MaxTagValues null.Int `json:"maxTagValues"`
+
+	// Thins out samples passed on to outputs; see OutputFilter.
+	OutputSampleRate null.Float `json:"outputSampleRate"`
+	OutputExclude    []string   `json:"outputExclude"`
+
+	// Percentiles calculated for Trend metrics, eg. [90, 95, 99.9]; see stats.DefaultTrendPercentiles.
+	Percentiles []float64 `json:"percentiles"`
+
+	// How Trend metrics are aggregated for the summary, thresholds and API; "exact" or "histogram".
+	// Outputs are unaffected by this, and always receive every sample.
+	TrendSink null.String `json:"trendSink"`
+
+	// Leaves samples from the start of the test, eg. "30s", out of the summary and thresholds, so
+	// warm-up doesn't skew them; outputs still get them, tagged "warmup". Checks made during this
+	// time are discarded too.
+	DiscardFirst null.String `json:"discardFirst"`
+
 	// These values are for third party collectors' benefit.
 	External map[string]interface{} `json:"ext"`
 }
@@ -86,21 +357,165 @@ func (o Options) Apply(opts Options) Options {
 	if opts.Stages != nil {
 		o.Stages = opts.Stages
 	}
+	if opts.Scenarios != nil {
+		o.Scenarios = opts.Scenarios
+	}
+	if opts.ExecutionSegment.Valid {
+		o.ExecutionSegment = opts.ExecutionSegment
+	}
+	if opts.MaxIterationDuration.Valid {
+		o.MaxIterationDuration = opts.MaxIterationDuration
+	}
+	if opts.MaxIterationTimeouts.Valid {
+		o.MaxIterationTimeouts = opts.MaxIterationTimeouts
+	}
+	if opts.MaxHeapSize.Valid {
+		o.MaxHeapSize = opts.MaxHeapSize
+	}
+	if opts.IterationDurationExcludesSleep.Valid {
+		o.IterationDurationExcludesSleep = opts.IterationDurationExcludesSleep
+	}
+	if opts.Checkpoint.Valid {
+		o.Checkpoint = opts.Checkpoint
+	}
+	if opts.CheckpointInterval.Valid {
+		o.CheckpointInterval = opts.CheckpointInterval
+	}
+	if opts.Seed.Valid {
+		o.Seed = opts.Seed
+	}
 	if opts.Linger.Valid {
 		o.Linger = opts.Linger
 	}
 	if opts.NoUsageReport.Valid {
 		o.NoUsageReport = opts.NoUsageReport
 	}
+	if opts.SamplesBufferSize.Valid {
+		o.SamplesBufferSize = opts.SamplesBufferSize
+	}
+	if opts.DropSamples.Valid {
+		o.DropSamples = opts.DropSamples
+	}
+	if opts.RPS.Valid {
+		o.RPS = opts.RPS
+	}
+	if opts.RPSPerVU.Valid {
+		o.RPSPerVU = opts.RPSPerVU
+	}
+	if opts.UserAgent.Valid {
+		o.UserAgent = opts.UserAgent
+	}
+	if opts.Headers != nil {
+		o.Headers = opts.Headers
+	}
 	if opts.MaxRedirects.Valid {
 		o.MaxRedirects = opts.MaxRedirects
 	}
 	if opts.InsecureSkipTLSVerify.Valid {
 		o.InsecureSkipTLSVerify = opts.InsecureSkipTLSVerify
 	}
+	if opts.TLSMinVersion.Valid {
+		o.TLSMinVersion = opts.TLSMinVersion
+	}
+	if opts.TLSMaxVersion.Valid {
+		o.TLSMaxVersion = opts.TLSMaxVersion
+	}
+	if opts.TLSCipherSuites != nil {
+		o.TLSCipherSuites = opts.TLSCipherSuites
+	}
+	if opts.TLSAuth != nil {
+		o.TLSAuth = opts.TLSAuth
+	}
+	if opts.NoHTTP2.Valid {
+		o.NoHTTP2 = opts.NoHTTP2
+	}
+	if opts.NoTLSResumption.Valid {
+		o.NoTLSResumption = opts.NoTLSResumption
+	}
+	if opts.NoConnectionReuse.Valid {
+		o.NoConnectionReuse = opts.NoConnectionReuse
+	}
+	if opts.ConnectionMaxAge.Valid {
+		o.ConnectionMaxAge = opts.ConnectionMaxAge
+	}
+	if opts.ConnectionMaxRequests.Valid {
+		o.ConnectionMaxRequests = opts.ConnectionMaxRequests
+	}
+	if opts.MaxIdleConns.Valid {
+		o.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost.Valid {
+		o.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.MaxConnsPerHost.Valid {
+		o.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.CookieMode.Valid {
+		o.CookieMode = opts.CookieMode
+	}
+	if opts.NoHTTPMetrics.Valid {
+		o.NoHTTPMetrics = opts.NoHTTPMetrics
+	}
+	if opts.MaxResponseBodySize.Valid {
+		o.MaxResponseBodySize = opts.MaxResponseBodySize
+	}
+	if opts.HTTPTimeout.Valid {
+		o.HTTPTimeout = opts.HTTPTimeout
+	}
+	if opts.HTTPCache.Valid {
+		o.HTTPCache = opts.HTTPCache
+	}
+	if opts.HTTPCacheSize.Valid {
+		o.HTTPCacheSize = opts.HTTPCacheSize
+	}
+	if opts.HTTPDebug.Valid {
+		o.HTTPDebug = opts.HTTPDebug
+	}
+	if opts.HTTPDebugRedact.Valid {
+		o.HTTPDebugRedact = opts.HTTPDebugRedact
+	}
+	if opts.Tracing != nil {
+		o.Tracing = opts.Tracing
+	}
+	if opts.DNS != nil {
+		o.DNS = opts.DNS
+	}
+	if opts.HAR != nil {
+		o.HAR = opts.HAR
+	}
+	if opts.IsolateGlobals.Valid {
+		o.IsolateGlobals = opts.IsolateGlobals
+	}
+	if opts.VUStoreSize.Valid {
+		o.VUStoreSize = opts.VUStoreSize
+	}
+	if opts.UnixSockets != nil {
+		o.UnixSockets = opts.UnixSockets
+	}
+	if opts.LocalIPs != nil {
+		o.LocalIPs = opts.LocalIPs
+	}
 	if opts.Thresholds != nil {
 		o.Thresholds = opts.Thresholds
 	}
+	if opts.MaxTagValues.Valid {
+		o.MaxTagValues = opts.MaxTagValues
+	}
+	if opts.OutputSampleRate.Valid {
+		o.OutputSampleRate = opts.OutputSampleRate
+	}
+	if opts.OutputExclude != nil {
+		o.OutputExclude = opts.OutputExclude
+	}
+	if opts.Percentiles != nil {
+		o.Percentiles = opts.Percentiles
+	}
+	if opts.TrendSink.Valid {
+		o.TrendSink = opts.TrendSink
+	}
+	if opts.DiscardFirst.Valid {
+		o.DiscardFirst = opts.DiscardFirst
+	}
 	if opts.External != nil {
 		o.External = opts.External
 	}
@@ -116,3 +531,30 @@ func (o Options) SetAllValid(valid bool) Options {
 	o.NoUsageReport.Valid = valid
 	return o
 }
+
+// Fills in the defaults for a test about to be run: a single iteration if neither a duration,
+// iterations nor stages are set, and VUsMax defaulting to VUs or the highest stage target. With
+// scenarios, VUs and VUsMax are both their total.
+func (o Options) WithDefaults() Options {
+	if !o.Duration.Valid && !o.Iterations.Valid && len(o.Stages) == 0 {
+		o.Iterations = null.IntFrom(1)
+	}
+	o = o.SetAllValid(true)
+	if len(o.Scenarios) > 0 {
+		var vus int64
+		for _, sc := range o.Scenarios {
+			vus += sc.VUs.Int64
+		}
+		o.VUs = null.IntFrom(vus)
+		o.VUsMax = null.IntFrom(vus)
+	}
+	if o.VUsMax.Int64 == 0 {
+		o.VUsMax.Int64 = o.VUs.Int64
+		for _, stage := range o.Stages {
+			if stage.Target.Valid && stage.Target.Int64 > o.VUsMax.Int64 {
+				o.VUsMax = stage.Target
+			}
+		}
+	}
+	return o
+}
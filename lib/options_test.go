@@ -21,6 +21,7 @@
 package lib
 
 import (
+	"net"
 	"testing"
 	"time"
 
@@ -61,11 +62,52 @@ func TestOptionsApply(t *testing.T) {
 		assert.Len(t, opts.Stages, 1)
 		assert.Equal(t, 1*time.Second, opts.Stages[0].Duration)
 	})
+	t.Run("Scenarios", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Scenarios: map[string]Scenario{
+			"browse": {VUs: null.IntFrom(50)},
+		}})
+		assert.Equal(t, map[string]Scenario{"browse": {VUs: null.IntFrom(50)}}, opts.Scenarios)
+	})
+	t.Run("ExecutionSegment", func(t *testing.T) {
+		opts := Options{}.Apply(Options{ExecutionSegment: null.StringFrom("2/4")})
+		assert.True(t, opts.ExecutionSegment.Valid)
+		assert.Equal(t, "2/4", opts.ExecutionSegment.String)
+	})
+	t.Run("MaxIterationDuration", func(t *testing.T) {
+		opts := Options{}.Apply(Options{MaxIterationDuration: null.StringFrom("30s")})
+		assert.True(t, opts.MaxIterationDuration.Valid)
+		assert.Equal(t, "30s", opts.MaxIterationDuration.String)
+	})
+	t.Run("MaxIterationTimeouts", func(t *testing.T) {
+		opts := Options{}.Apply(Options{MaxIterationTimeouts: null.IntFrom(3)})
+		assert.True(t, opts.MaxIterationTimeouts.Valid)
+		assert.Equal(t, int64(3), opts.MaxIterationTimeouts.Int64)
+	})
+	t.Run("MaxHeapSize", func(t *testing.T) {
+		opts := Options{}.Apply(Options{MaxHeapSize: null.IntFrom(1 << 30)})
+		assert.True(t, opts.MaxHeapSize.Valid)
+		assert.Equal(t, int64(1<<30), opts.MaxHeapSize.Int64)
+	})
+	t.Run("Seed", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Seed: null.IntFrom(12345)})
+		assert.True(t, opts.Seed.Valid)
+		assert.Equal(t, int64(12345), opts.Seed.Int64)
+	})
 	t.Run("Linger", func(t *testing.T) {
 		opts := Options{}.Apply(Options{Linger: null.BoolFrom(true)})
 		assert.True(t, opts.Linger.Valid)
 		assert.True(t, opts.Linger.Bool)
 	})
+	t.Run("SamplesBufferSize", func(t *testing.T) {
+		opts := Options{}.Apply(Options{SamplesBufferSize: null.IntFrom(12345)})
+		assert.True(t, opts.SamplesBufferSize.Valid)
+		assert.Equal(t, int64(12345), opts.SamplesBufferSize.Int64)
+	})
+	t.Run("DropSamples", func(t *testing.T) {
+		opts := Options{}.Apply(Options{DropSamples: null.BoolFrom(true)})
+		assert.True(t, opts.DropSamples.Valid)
+		assert.True(t, opts.DropSamples.Bool)
+	})
 	t.Run("MaxRedirects", func(t *testing.T) {
 		opts := Options{}.Apply(Options{MaxRedirects: null.IntFrom(12345)})
 		assert.True(t, opts.MaxRedirects.Valid)
@@ -76,6 +118,169 @@ func TestOptionsApply(t *testing.T) {
 		assert.True(t, opts.InsecureSkipTLSVerify.Valid)
 		assert.True(t, opts.InsecureSkipTLSVerify.Bool)
 	})
+	t.Run("TLS", func(t *testing.T) {
+		opts := Options{}.Apply(Options{
+			TLSMinVersion:   null.StringFrom("tls1.1"),
+			TLSMaxVersion:   null.StringFrom("tls1.2"),
+			TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		})
+		assert.Equal(t, null.StringFrom("tls1.1"), opts.TLSMinVersion)
+		assert.Equal(t, null.StringFrom("tls1.2"), opts.TLSMaxVersion)
+		assert.Equal(t, []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}, opts.TLSCipherSuites)
+	})
+	t.Run("CookieMode", func(t *testing.T) {
+		opts := Options{}.Apply(Options{CookieMode: null.StringFrom(CookieModeReset)})
+		assert.True(t, opts.CookieMode.Valid)
+		assert.Equal(t, CookieModeReset, opts.CookieMode.String)
+	})
+	t.Run("HTTPCache", func(t *testing.T) {
+		opts := Options{}.Apply(Options{HTTPCache: null.BoolFrom(true)})
+		assert.True(t, opts.HTTPCache.Valid)
+		assert.True(t, opts.HTTPCache.Bool)
+	})
+	t.Run("HTTPCacheSize", func(t *testing.T) {
+		opts := Options{}.Apply(Options{HTTPCacheSize: null.IntFrom(12345)})
+		assert.True(t, opts.HTTPCacheSize.Valid)
+		assert.Equal(t, int64(12345), opts.HTTPCacheSize.Int64)
+	})
+	t.Run("NoHTTP2", func(t *testing.T) {
+		opts := Options{}.Apply(Options{NoHTTP2: null.BoolFrom(true)})
+		assert.True(t, opts.NoHTTP2.Valid)
+		assert.True(t, opts.NoHTTP2.Bool)
+	})
+	t.Run("NoTLSResumption", func(t *testing.T) {
+		opts := Options{}.Apply(Options{NoTLSResumption: null.BoolFrom(true)})
+		assert.True(t, opts.NoTLSResumption.Valid)
+		assert.True(t, opts.NoTLSResumption.Bool)
+	})
+	t.Run("NoConnectionReuse", func(t *testing.T) {
+		opts := Options{}.Apply(Options{NoConnectionReuse: null.BoolFrom(true)})
+		assert.True(t, opts.NoConnectionReuse.Valid)
+		assert.True(t, opts.NoConnectionReuse.Bool)
+	})
+	t.Run("NoHTTPMetrics", func(t *testing.T) {
+		opts := Options{}.Apply(Options{NoHTTPMetrics: null.BoolFrom(true)})
+		assert.Equal(t, null.BoolFrom(true), opts.NoHTTPMetrics)
+	})
+	t.Run("DNS", func(t *testing.T) {
+		dns := &DNSOptions{TTL: null.StringFrom("1m"), Select: null.StringFrom(DNSSelectRandom), Tags: null.BoolFrom(true)}
+		opts := Options{}.Apply(Options{DNS: dns})
+		assert.Equal(t, dns, opts.DNS)
+
+		ttl, err := opts.DNS.ParseTTL()
+		assert.NoError(t, err)
+		assert.Equal(t, 1*time.Minute, ttl)
+	})
+	t.Run("DiscardFirst", func(t *testing.T) {
+		opts := Options{}.Apply(Options{DiscardFirst: null.StringFrom("30s")})
+		assert.Equal(t, null.StringFrom("30s"), opts.DiscardFirst)
+	})
+	t.Run("ConnectionLifetime", func(t *testing.T) {
+		opts := Options{}.Apply(Options{
+			ConnectionMaxAge:      null.StringFrom("30s"),
+			ConnectionMaxRequests: null.IntFrom(100),
+		})
+		assert.Equal(t, null.StringFrom("30s"), opts.ConnectionMaxAge)
+		assert.Equal(t, null.IntFrom(100), opts.ConnectionMaxRequests)
+	})
+	t.Run("ConnectionPool", func(t *testing.T) {
+		opts := Options{}.Apply(Options{
+			MaxIdleConns:        null.IntFrom(100),
+			MaxIdleConnsPerHost: null.IntFrom(10),
+			MaxConnsPerHost:     null.IntFrom(20),
+		})
+		assert.Equal(t, null.IntFrom(100), opts.MaxIdleConns)
+		assert.Equal(t, null.IntFrom(10), opts.MaxIdleConnsPerHost)
+		assert.Equal(t, null.IntFrom(20), opts.MaxConnsPerHost)
+	})
+	t.Run("IterationDurationExcludesSleep", func(t *testing.T) {
+		opts := Options{}.Apply(Options{IterationDurationExcludesSleep: null.BoolFrom(true)})
+		assert.True(t, opts.IterationDurationExcludesSleep.Valid)
+		assert.True(t, opts.IterationDurationExcludesSleep.Bool)
+	})
+	t.Run("Checkpoint", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Checkpoint: null.StringFrom("checkpoint.json")})
+		assert.True(t, opts.Checkpoint.Valid)
+		assert.Equal(t, "checkpoint.json", opts.Checkpoint.String)
+	})
+	t.Run("CheckpointInterval", func(t *testing.T) {
+		opts := Options{}.Apply(Options{CheckpointInterval: null.StringFrom("30s")})
+		assert.True(t, opts.CheckpointInterval.Valid)
+		assert.Equal(t, "30s", opts.CheckpointInterval.String)
+	})
+	t.Run("MaxTagValues", func(t *testing.T) {
+		opts := Options{}.Apply(Options{MaxTagValues: null.IntFrom(10)})
+		assert.True(t, opts.MaxTagValues.Valid)
+		assert.Equal(t, int64(10), opts.MaxTagValues.Int64)
+	})
+	t.Run("TrendSink", func(t *testing.T) {
+		opts := Options{}.Apply(Options{TrendSink: null.StringFrom(TrendSinkHistogram)})
+		assert.True(t, opts.TrendSink.Valid)
+		assert.Equal(t, TrendSinkHistogram, opts.TrendSink.String)
+	})
+	t.Run("MaxResponseBodySize", func(t *testing.T) {
+		opts := Options{}.Apply(Options{MaxResponseBodySize: null.IntFrom(1024)})
+		assert.True(t, opts.MaxResponseBodySize.Valid)
+		assert.Equal(t, int64(1024), opts.MaxResponseBodySize.Int64)
+	})
+	t.Run("HTTPTimeout", func(t *testing.T) {
+		opts := Options{}.Apply(Options{HTTPTimeout: null.StringFrom("30s")})
+		assert.True(t, opts.HTTPTimeout.Valid)
+		assert.Equal(t, "30s", opts.HTTPTimeout.String)
+	})
+	t.Run("HTTPDebug", func(t *testing.T) {
+		opts := Options{}.Apply(Options{HTTPDebug: null.StringFrom(HTTPDebugFull)})
+		assert.True(t, opts.HTTPDebug.Valid)
+		assert.Equal(t, HTTPDebugFull, opts.HTTPDebug.String)
+	})
+	t.Run("HTTPDebugRedact", func(t *testing.T) {
+		opts := Options{}.Apply(Options{HTTPDebugRedact: null.BoolFrom(true)})
+		assert.True(t, opts.HTTPDebugRedact.Valid)
+		assert.True(t, opts.HTTPDebugRedact.Bool)
+	})
+	t.Run("Tracing", func(t *testing.T) {
+		tracing := &TracingOptions{Propagator: null.StringFrom(TracingPropagatorW3C), Sampling: null.FloatFrom(0.1)}
+		opts := Options{}.Apply(Options{Tracing: tracing})
+		assert.Equal(t, tracing, opts.Tracing)
+	})
+	t.Run("HAR", func(t *testing.T) {
+		har := &HAROptions{File: null.StringFrom("out.har"), FailedOnly: null.BoolFrom(true)}
+		opts := Options{}.Apply(Options{HAR: har})
+		assert.Equal(t, har, opts.HAR)
+	})
+	t.Run("RPS", func(t *testing.T) {
+		opts := Options{}.Apply(Options{RPS: null.IntFrom(100), RPSPerVU: null.IntFrom(10)})
+		assert.Equal(t, null.IntFrom(100), opts.RPS)
+		assert.Equal(t, null.IntFrom(10), opts.RPSPerVU)
+	})
+	t.Run("UserAgent", func(t *testing.T) {
+		opts := Options{}.Apply(Options{UserAgent: null.StringFrom("k6-test")})
+		assert.True(t, opts.UserAgent.Valid)
+		assert.Equal(t, "k6-test", opts.UserAgent.String)
+	})
+	t.Run("Headers", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Headers: map[string]string{"X-Test": "1"}})
+		assert.Equal(t, map[string]string{"X-Test": "1"}, opts.Headers)
+	})
+	t.Run("IsolateGlobals", func(t *testing.T) {
+		opts := Options{}.Apply(Options{IsolateGlobals: null.BoolFrom(true)})
+		assert.True(t, opts.IsolateGlobals.Valid)
+		assert.True(t, opts.IsolateGlobals.Bool)
+	})
+	t.Run("VUStoreSize", func(t *testing.T) {
+		opts := Options{}.Apply(Options{VUStoreSize: null.IntFrom(12345)})
+		assert.True(t, opts.VUStoreSize.Valid)
+		assert.Equal(t, int64(12345), opts.VUStoreSize.Int64)
+	})
+	t.Run("LocalIPs", func(t *testing.T) {
+		ips := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}
+		opts := Options{}.Apply(Options{LocalIPs: ips})
+		assert.Equal(t, ips, opts.LocalIPs)
+	})
+	t.Run("UnixSockets", func(t *testing.T) {
+		opts := Options{}.Apply(Options{UnixSockets: map[string]string{"app": "/var/run/app.sock"}})
+		assert.Equal(t, map[string]string{"app": "/var/run/app.sock"}, opts.UnixSockets)
+	})
 	t.Run("Thresholds", func(t *testing.T) {
 		opts := Options{}.Apply(Options{Thresholds: map[string]stats.Thresholds{
 			"metric": {
@@ -85,6 +290,19 @@ func TestOptionsApply(t *testing.T) {
 		assert.NotNil(t, opts.Thresholds)
 		assert.NotEmpty(t, opts.Thresholds)
 	})
+	t.Run("OutputSampleRate", func(t *testing.T) {
+		opts := Options{}.Apply(Options{OutputSampleRate: null.FloatFrom(0.1)})
+		assert.True(t, opts.OutputSampleRate.Valid)
+		assert.Equal(t, 0.1, opts.OutputSampleRate.Float64)
+	})
+	t.Run("OutputExclude", func(t *testing.T) {
+		opts := Options{}.Apply(Options{OutputExclude: []string{"http_reqs{status:200}"}})
+		assert.Equal(t, []string{"http_reqs{status:200}"}, opts.OutputExclude)
+	})
+	t.Run("Percentiles", func(t *testing.T) {
+		opts := Options{}.Apply(Options{Percentiles: []float64{50, 99.9}})
+		assert.Equal(t, []float64{50, 99.9}, opts.Percentiles)
+	})
 	t.Run("External", func(t *testing.T) {
 		opts := Options{}.Apply(Options{External: map[string]interface{}{"a": 1}})
 		assert.Equal(t, map[string]interface{}{"a": 1}, opts.External)
@@ -95,3 +313,36 @@ func TestOptionsApply(t *testing.T) {
 		assert.True(t, opts.NoUsageReport.Bool)
 	})
 }
+
+func TestOptionsWithDefaults(t *testing.T) {
+	t.Run("Iterations", func(t *testing.T) {
+		opts := Options{}.WithDefaults()
+		assert.Equal(t, null.IntFrom(1), opts.Iterations)
+		assert.True(t, opts.VUs.Valid)
+		assert.True(t, opts.Duration.Valid)
+
+		opts = Options{Duration: null.StringFrom("10s")}.WithDefaults()
+		assert.False(t, opts.Iterations.Valid)
+	})
+	t.Run("VUsMax", func(t *testing.T) {
+		opts := Options{VUs: null.IntFrom(5)}.WithDefaults()
+		assert.Equal(t, int64(5), opts.VUsMax.Int64)
+
+		opts = Options{VUs: null.IntFrom(5), Stages: []Stage{
+			{Duration: 10 * time.Second, Target: null.IntFrom(20)},
+			{Duration: 10 * time.Second, Target: null.IntFrom(10)},
+		}}.WithDefaults()
+		assert.Equal(t, int64(20), opts.VUsMax.Int64)
+
+		opts = Options{VUs: null.IntFrom(5), VUsMax: null.IntFrom(50)}.WithDefaults()
+		assert.Equal(t, int64(50), opts.VUsMax.Int64)
+	})
+	t.Run("Scenarios", func(t *testing.T) {
+		opts := Options{VUs: null.IntFrom(1), Scenarios: map[string]Scenario{
+			"browse": {VUs: null.IntFrom(50)},
+			"admin":  {VUs: null.IntFrom(5), Exec: null.StringFrom("admin")},
+		}}.WithDefaults()
+		assert.Equal(t, null.IntFrom(55), opts.VUs)
+		assert.Equal(t, null.IntFrom(55), opts.VUsMax)
+	})
+}
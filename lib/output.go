@@ -0,0 +1,117 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// How often the engine flushes its outputs.
+const OutputFlushInterval = 1 * time.Second
+
+// An Output sends the samples a test produces somewhere, eg. to a storage backend. The engine
+// starts all of its outputs before the test, passes every batch of samples on to each of them,
+// flushes them every OutputFlushInterval, and stops them once the last samples are in.
+type Output interface {
+	// Prepares the output, eg. connecting to its backend; no samples are added before this.
+	Start() error
+
+	// Receives a batch of samples, which mustn't be modified, as all outputs get the same slice.
+	// It's never called concurrently with itself, but it's called from the engine's collection
+	// loop, so anything slow should be left to Flush().
+	AddSamples(samples []stats.Sample)
+
+	// Sends buffered samples on. It's called from a goroutine of its own, so it may run
+	// concurrently with AddSamples(), but never with itself.
+	Flush() error
+
+	// Sends whatever's left and releases any resources; no samples are added after this.
+	Stop() error
+}
+
+// Creates an output from the part of an output argument after "type=", eg. a URL.
+type OutputFactory func(arg string, src *SourceData, opts Options) (Output, error)
+
+var (
+	outputFactories     = make(map[string]OutputFactory)
+	outputFactoriesLock sync.RWMutex
+)
+
+// Registers a type of output, so that "--out name=arg" creates an output with f. This is how the
+// built-in outputs are made available, and how custom ones can be added, eg. by a program that
+// embeds k6. Registering the same name twice panics.
+func RegisterOutput(name string, f OutputFactory) {
+	outputFactoriesLock.Lock()
+	defer outputFactoriesLock.Unlock()
+
+	if _, ok := outputFactories[name]; ok {
+		panic("output already registered: " + name)
+	}
+	outputFactories[name] = f
+}
+
+// Returns the names of all registered types of output, sorted.
+func OutputNames() []string {
+	outputFactoriesLock.RLock()
+	defer outputFactoriesLock.RUnlock()
+
+	names := make([]string, 0, len(outputFactories))
+	for name := range outputFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Creates an output from an output argument, in the form "type=arg".
+func NewOutput(s string, src *SourceData, opts Options) (Output, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("Malformed output; must be in the form 'type=url'")
+	}
+
+	outputFactoriesLock.RLock()
+	f, ok := outputFactories[parts[0]]
+	outputFactoriesLock.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("Unknown output type: %s; must be one of: %s", parts[0], strings.Join(OutputNames(), ", "))
+	}
+	return f(parts[1], src, opts)
+}
+
+// Describes a set of outputs for humans, eg. "json, influxdb (localhost:8086)"; "-" if empty.
+func OutputsString(outputs []Output) string {
+	if len(outputs) == 0 {
+		return "-"
+	}
+	names := make([]string, len(outputs))
+	for i, out := range outputs {
+		names[i] = fmt.Sprint(out)
+	}
+	return strings.Join(names, ", ")
+}
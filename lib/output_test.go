@@ -0,0 +1,61 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/loadimpact/k6/stats/dummy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOutput(t *testing.T) {
+	var gotArg string
+	c := &dummy.Collector{}
+	RegisterOutput("test-output", func(arg string, src *SourceData, opts Options) (Output, error) {
+		gotArg = arg
+		return c, nil
+	})
+	assert.Contains(t, OutputNames(), "test-output")
+	assert.Panics(t, func() { RegisterOutput("test-output", nil) })
+
+	t.Run("Registered", func(t *testing.T) {
+		out, err := NewOutput("test-output=http://example.com/?a=b", nil, Options{})
+		assert.NoError(t, err)
+		assert.Equal(t, c, out)
+		assert.Equal(t, "http://example.com/?a=b", gotArg)
+	})
+	t.Run("Unknown", func(t *testing.T) {
+		_, err := NewOutput("nope=x", nil, Options{})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unknown output type: nope; must be one of: ")
+			assert.Contains(t, err.Error(), "test-output")
+		}
+	})
+	t.Run("Malformed", func(t *testing.T) {
+		_, err := NewOutput("test-output", nil, Options{})
+		assert.EqualError(t, err, "Malformed output; must be in the form 'type=url'")
+	})
+}
+
+func TestOutputsString(t *testing.T) {
+	assert.Equal(t, "-", OutputsString(nil))
+}
@@ -0,0 +1,120 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+type outputSelector struct {
+	metric string
+	tags   map[string]string
+}
+
+func (s outputSelector) matches(sample stats.Sample) bool {
+	if s.metric != "" && s.metric != sample.Metric.Name {
+		return false
+	}
+	for k, v := range s.tags {
+		if sample.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// An OutputFilter thins out the samples passed on to a collector, to keep the volume of data
+// manageable at high request rates. The engine's own metrics are always calculated from every
+// sample; only what's exported is affected.
+type OutputFilter struct {
+	// Fraction of successful HTTP requests to keep samples for; failed requests are always kept.
+	SampleRate float64
+
+	exclude []outputSelector
+}
+
+// Returns an OutputFilter for the given options, or nil if there's nothing to filter.
+func NewOutputFilter(o Options) (*OutputFilter, error) {
+	if !o.OutputSampleRate.Valid && len(o.OutputExclude) == 0 {
+		return nil, nil
+	}
+
+	f := &OutputFilter{SampleRate: 1.0}
+	if o.OutputSampleRate.Valid {
+		if o.OutputSampleRate.Float64 < 0 || o.OutputSampleRate.Float64 > 1 {
+			return nil, errors.Errorf("options.outputSampleRate: must be between 0 and 1: %v", o.OutputSampleRate.Float64)
+		}
+		f.SampleRate = o.OutputSampleRate.Float64
+	}
+
+	// Exclusions use the same syntax as thresholds for submetrics, eg. "http_reqs{status:200}";
+	// leave out the name, eg. "{name:healthcheck}", to match any metric.
+	for _, expr := range o.OutputExclude {
+		name, sm := stats.NewSubmetric(expr)
+		f.exclude = append(f.exclude, outputSelector{metric: name, tags: sm.Tags})
+	}
+	return f, nil
+}
+
+// Returns the samples that should be passed on. A nil filter passes everything.
+func (f *OutputFilter) Filter(samples []stats.Sample) []stats.Sample {
+	if f == nil {
+		return samples
+	}
+
+	filtered := make([]stats.Sample, 0, len(samples))
+	for _, sample := range samples {
+		if f.keep(sample) {
+			filtered = append(filtered, sample)
+		}
+	}
+	return filtered
+}
+
+func (f *OutputFilter) keep(sample stats.Sample) bool {
+	for _, sel := range f.exclude {
+		if sel.matches(sample) {
+			return false
+		}
+	}
+
+	if f.SampleRate >= 1 {
+		return true
+	}
+
+	// Only samples from successful HTTP requests are sampled; anything else is too interesting.
+	status, err := strconv.Atoi(sample.Tags["status"])
+	if err != nil || status <= 0 || status >= 400 {
+		return true
+	}
+
+	// All samples from a single request share a timestamp and URL; hash those, so a request's
+	// samples are either all kept or all dropped together.
+	h := fnv.New64a()
+	_ = binary.Write(h, binary.LittleEndian, sample.Time.UnixNano())
+	_, _ = h.Write([]byte(sample.Tags["url"]))
+	return float64(h.Sum64()%10000) < f.SampleRate*10000
+}
@@ -0,0 +1,109 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestNewOutputFilter(t *testing.T) {
+	t.Run("none", func(t *testing.T) {
+		f, err := NewOutputFilter(Options{})
+		assert.NoError(t, err)
+		assert.Nil(t, f)
+
+		samples := []stats.Sample{{Metric: stats.New("my_metric", stats.Counter)}}
+		assert.Equal(t, samples, f.Filter(samples))
+	})
+	t.Run("invalid rate", func(t *testing.T) {
+		_, err := NewOutputFilter(Options{OutputSampleRate: null.FloatFrom(1.5)})
+		assert.EqualError(t, err, "options.outputSampleRate: must be between 0 and 1: 1.5")
+	})
+}
+
+func TestOutputFilter(t *testing.T) {
+	reqs := stats.New("http_reqs", stats.Counter)
+	duration := stats.New("http_req_duration", stats.Trend)
+	other := stats.New("my_metric", stats.Counter)
+
+	t.Run("Exclude", func(t *testing.T) {
+		f, err := NewOutputFilter(Options{OutputExclude: []string{"http_reqs{status:200}", "{name:health}"}})
+		assert.NoError(t, err)
+		samples := []stats.Sample{
+			{Metric: reqs, Tags: map[string]string{"status": "200"}},
+			{Metric: reqs, Tags: map[string]string{"status": "500"}},
+			{Metric: duration, Tags: map[string]string{"status": "200"}},
+			{Metric: other, Tags: map[string]string{"name": "health"}},
+		}
+		assert.Equal(t, []stats.Sample{samples[1], samples[2]}, f.Filter(samples))
+	})
+
+	t.Run("SampleRate", func(t *testing.T) {
+		for _, rate := range []float64{0, 0.25, 1} {
+			t.Run(strconv.FormatFloat(rate, 'f', -1, 64), func(t *testing.T) {
+				f, err := NewOutputFilter(Options{OutputSampleRate: null.FloatFrom(rate)})
+				assert.NoError(t, err)
+
+				now := time.Now()
+				kept, failed, others := 0, 0, 0
+				for i := 0; i < 1000; i++ {
+					tags := map[string]string{"status": "200", "url": "http://example.com/"}
+					failTags := map[string]string{"status": "503", "url": "http://example.com/"}
+					at := now.Add(time.Duration(i) * time.Millisecond)
+					out := f.Filter([]stats.Sample{
+						{Metric: reqs, Time: at, Tags: tags},
+						{Metric: duration, Time: at, Tags: tags},
+						{Metric: reqs, Time: at, Tags: failTags},
+						{Metric: other, Time: at},
+					})
+					for _, s := range out {
+						switch {
+						case s.Metric == other:
+							others++
+						case s.Tags["status"] == "503":
+							failed++
+						case s.Metric == reqs:
+							kept++
+						}
+					}
+
+					// A request's samples are kept or dropped together.
+					n := 0
+					for _, s := range out {
+						if s.Tags["status"] == "200" {
+							n++
+						}
+					}
+					assert.True(t, n == 0 || n == 2, "request partially kept")
+				}
+				assert.Equal(t, 1000, failed)
+				assert.Equal(t, 1000, others)
+				assert.InDelta(t, rate*1000, float64(kept), 60)
+			})
+		}
+	})
+}
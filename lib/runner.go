@@ -22,8 +22,12 @@ package lib
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 )
 
 // Ensure RunnerFunc conforms to Runner.
@@ -55,6 +59,66 @@ type VU interface {
 	Reconfigure(id int64) error
 }
 
+// Optionally implemented by VUs that can tell how much of their last iteration was spent sleeping,
+// so that it can be left out of iteration_duration; see Options.IterationDurationExcludesSleep.
+type SleepTracker interface {
+	LastIterationSleep() time.Duration
+}
+
+// Optionally implemented by runners with metrics that aren't tied to any one iteration, eg. gauges
+// of shared state; the engine emits them periodically, along with vus and vus_max.
+type MetricsEmitter interface {
+	EmitMetrics(t time.Time) []stats.Sample
+}
+
+// Optionally implemented by VUs that can run a function other than their default one; the engine
+// assigns every VU to a scenario once, right after creating it. See Options.Scenarios.
+type ScenarioVU interface {
+	SetScenario(name, exec string) error
+}
+
+// ErrIterationTimeout is returned by VUs whose iteration was aborted for exceeding
+// Options.MaxIterationDuration; possibly wrapped in an IterationError.
+var ErrIterationTimeout = errors.New("iteration timed out")
+
+// Returns whether an error is (or wraps) ErrIterationTimeout.
+func IsIterationTimeout(err error) bool {
+	if ierr, ok := err.(*IterationError); ok {
+		err = ierr.Err
+	}
+	return err == ErrIterationTimeout
+}
+
+// An IterationError is returned by VUs whose iterations can be replayed; it carries everything
+// needed to do so, which is also attached as tags to the error sample.
+type IterationError struct {
+	VU        int64
+	Iteration int64
+	Seed      int64
+	Err       error
+}
+
+func (e *IterationError) Error() string {
+	return e.Err.Error()
+}
+
+// Passes through the wrapped error's String(), which may include eg. a stack trace.
+func (e *IterationError) String() string {
+	if s, ok := e.Err.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return e.Err.Error()
+}
+
+// Returns the tags identifying the failed iteration.
+func (e *IterationError) Tags() map[string]string {
+	return map[string]string{
+		"vu":   strconv.FormatInt(e.VU, 10),
+		"iter": strconv.FormatInt(e.Iteration, 10),
+		"seed": strconv.FormatInt(e.Seed, 10),
+	}
+}
+
 // RunnerFunc adapts a function to be used as both a runner and a VU.
 // Mainly useful for testing.
 type RunnerFunc func(ctx context.Context) ([]stats.Sample, error)
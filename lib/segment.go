@@ -0,0 +1,132 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// An ExecutionSegment is one of several equal shares of a test's workload, for running it across
+// multiple instances that don't talk to each other. Segment "2/4" is the second of four; it may also
+// be written as a range, "1/4:2/4". The zero value is the whole test.
+type ExecutionSegment struct {
+	Index, Count int64
+}
+
+func ParseExecutionSegment(s string) (ExecutionSegment, error) {
+	if strings.Contains(s, ":") {
+		return parseExecutionSegmentRange(s)
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return ExecutionSegment{}, errors.Errorf("invalid execution segment: %s", s)
+	}
+	index, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return ExecutionSegment{}, errors.Errorf("invalid execution segment: %s", s)
+	}
+	count, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+	if err != nil {
+		return ExecutionSegment{}, errors.Errorf("invalid execution segment: %s", s)
+	}
+	if count < 1 || index < 1 || index > count {
+		return ExecutionSegment{}, errors.Errorf("invalid execution segment: %s", s)
+	}
+	return ExecutionSegment{Index: index, Count: count}, nil
+}
+
+// Parses a range, "from:to", where both ends are fractions of the test (or 0 and 1). The range must
+// be one of several equal shares, eg. "1/3:2/3", or "2/6:4/6", which is the same.
+func parseExecutionSegmentRange(s string) (ExecutionSegment, error) {
+	parts := strings.SplitN(s, ":", 2)
+	fromN, fromD, err1 := parseFraction(parts[0])
+	toN, toD, err2 := parseFraction(parts[1])
+	if err1 != nil || err2 != nil || fromN*toD >= toN*fromD {
+		return ExecutionSegment{}, errors.Errorf("invalid execution segment: %s", s)
+	}
+
+	// The share is 1/count wide, and starts at (index-1)/count.
+	width := toN*fromD - fromN*toD
+	if (fromD*toD)%width != 0 {
+		return ExecutionSegment{}, errors.Errorf("unsupported execution segment: %s; it must be an equal share, eg. 1/4:2/4", s)
+	}
+	count := fromD * toD / width
+	if (fromN*count)%fromD != 0 {
+		return ExecutionSegment{}, errors.Errorf("unsupported execution segment: %s; it must be an equal share, eg. 1/4:2/4", s)
+	}
+	return ExecutionSegment{Index: fromN*count/fromD + 1, Count: count}, nil
+}
+
+// Parses "n/d", or a plain "0" or "1".
+func parseFraction(s string) (n, d int64, err error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+	if n, err = strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64); err != nil {
+		return 0, 0, err
+	}
+	d = 1
+	if len(parts) == 2 {
+		if d, err = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	if n < 0 || d < 1 || n > d {
+		return 0, 0, errors.Errorf("invalid fraction: %s", s)
+	}
+	return n, d, nil
+}
+
+func (s ExecutionSegment) String() string {
+	if s.Count == 0 {
+		return "1/1"
+	}
+	return strconv.FormatInt(s.Index, 10) + "/" + strconv.FormatInt(s.Count, 10)
+}
+
+// Returns this segment's share of v: the number of i in 0..v-1 it Contains(). Shares are spread
+// as evenly as possible, they always add up to exactly v, and the VUIDs of all segments' shares
+// are exactly 1..v.
+func (s ExecutionSegment) Scale(v int64) int64 {
+	if s.Count == 0 {
+		return v
+	}
+	return (v - s.Index + s.Count) / s.Count
+}
+
+// Maps a segment-local VU ID (1, 2, 3...) to one that's unique across all segments, by
+// interleaving them; with 4 segments, segment 2 gets IDs 2, 6, 10...
+func (s ExecutionSegment) VUID(local int64) int64 {
+	if s.Count == 0 {
+		return local
+	}
+	return (local-1)*s.Count + s.Index
+}
+
+// Returns whether the i:th (0-based) item of a data set belongs to this segment, for slicing
+// shared data without overlaps.
+func (s ExecutionSegment) Contains(i int64) bool {
+	if s.Count == 0 {
+		return true
+	}
+	return i%s.Count == s.Index-1
+}
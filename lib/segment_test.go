@@ -0,0 +1,124 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExecutionSegment(t *testing.T) {
+	testdata := map[string]struct {
+		seg   ExecutionSegment
+		valid bool
+	}{
+		"1/1":   {ExecutionSegment{1, 1}, true},
+		"2/4":   {ExecutionSegment{2, 4}, true},
+		" 3/ 4": {ExecutionSegment{3, 4}, true},
+		"0/4":   {ExecutionSegment{}, false},
+		"5/4":   {ExecutionSegment{}, false},
+		"1/0":   {ExecutionSegment{}, false},
+		"1":     {ExecutionSegment{}, false},
+		"a/b":   {ExecutionSegment{}, false},
+
+		"0:1":         {ExecutionSegment{1, 1}, true},
+		"1/4:2/4":     {ExecutionSegment{2, 4}, true},
+		"0:1/3":       {ExecutionSegment{1, 3}, true},
+		"2/6 : 4/6":   {ExecutionSegment{2, 3}, true},
+		"1/2:1":       {ExecutionSegment{2, 2}, true},
+		"1/3:1/2":     {ExecutionSegment{3, 6}, true},
+		"2/4:1/4":     {ExecutionSegment{}, false},
+		"1/4:1/4":     {ExecutionSegment{}, false},
+		"0:5/4":       {ExecutionSegment{}, false},
+		"-1/4:1/4":    {ExecutionSegment{}, false},
+		"1/4:":        {ExecutionSegment{}, false},
+		"1/4:2/4:3/4": {ExecutionSegment{}, false},
+	}
+	for s, data := range testdata {
+		t.Run(s, func(t *testing.T) {
+			seg, err := ParseExecutionSegment(s)
+			if !data.valid {
+				assert.EqualError(t, err, "invalid execution segment: "+s)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, data.seg, seg)
+		})
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		for _, s := range []string{"0:2/3", "1/4:3/4"} {
+			_, err := ParseExecutionSegment(s)
+			assert.EqualError(t, err, "unsupported execution segment: "+s+"; it must be an equal share, eg. 1/4:2/4")
+		}
+	})
+}
+
+func TestExecutionSegment(t *testing.T) {
+	t.Run("Whole", func(t *testing.T) {
+		seg := ExecutionSegment{}
+		assert.Equal(t, "1/1", seg.String())
+		assert.Equal(t, int64(10), seg.Scale(10))
+		assert.Equal(t, int64(3), seg.VUID(3))
+		assert.True(t, seg.Contains(7))
+	})
+
+	t.Run("Uneven", func(t *testing.T) {
+		first, second := ExecutionSegment{1, 2}, ExecutionSegment{2, 2}
+		assert.Equal(t, int64(3), first.Scale(5))
+		assert.Equal(t, int64(2), second.Scale(5))
+		assert.Equal(t, int64(5), first.VUID(3))
+		assert.Equal(t, int64(4), second.VUID(2))
+	})
+
+	t.Run("Partition", func(t *testing.T) {
+		for _, count := range []int64{1, 2, 3, 4, 7} {
+			for _, total := range []int64{0, 1, 5, 10, 99, 100} {
+				sum := int64(0)
+				ids := map[int64]bool{}
+				items := map[int64]int{}
+				for index := int64(1); index <= count; index++ {
+					seg := ExecutionSegment{index, count}
+					share := seg.Scale(total)
+					sum += share
+					for local := int64(1); local <= share; local++ {
+						id := seg.VUID(local)
+						assert.False(t, ids[id], "duplicate VU ID %d", id)
+						ids[id] = true
+					}
+					for i := int64(0); i < total; i++ {
+						if seg.Contains(i) {
+							items[i]++
+						}
+					}
+				}
+				assert.Equal(t, total, sum, "%d/%d", total, count)
+				for id := int64(1); id <= total; id++ {
+					assert.True(t, ids[id], "missing VU ID %d", id)
+				}
+				for i := int64(0); i < total; i++ {
+					assert.Equal(t, 1, items[i], "item %d", i)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,198 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// The end-of-test data handed to a script's handleSummary(). Its JSON form is part of the
+// scripting API, so fields may be added, but never renamed or removed. It looks like:
+//
+//	{
+//	  "state": { "test_run_duration_ms": 30012.5, "interrupted": false, "discarded_samples": 0 },
+//	  "metrics": {
+//	    "http_req_duration": {
+//	      "type": "trend",
+//	      "contains": "time",
+//	      "values": { "avg": 12.3, "max": 80.2, "med": 10.1, "min": 4.5, "p90": 30.2, "p95": 40.1 },
+//	      "thresholds": { "p(95)<500": { "ok": true } }
+//	    }
+//	  },
+//	  "root_group": {
+//	    "name": "",
+//	    "path": "",
+//	    "groups": [ { "name": "login", "path": "::login", "groups": [], "checks": [] } ],
+//	    "checks": [ { "name": "is 200", "path": "::is 200", "passes": 10, "fails": 0 } ]
+//	  }
+//	}
+//
+// Metric values are the same ones printed in the default summary; see stats.Sink.Format(). Metrics
+// with thresholds but no samples are listed with no values, and "no_samples" set on each threshold.
+type Summary struct {
+	State     SummaryState             `json:"state"`
+	Metrics   map[string]SummaryMetric `json:"metrics"`
+	RootGroup SummaryGroup             `json:"root_group"`
+}
+
+type SummaryState struct {
+	TestRunDuration float64 `json:"test_run_duration_ms"`
+
+	// Set if the test was cut short by a signal, so results are partial.
+	Interrupted bool `json:"interrupted"`
+
+	// Samples left out of the results for being part of the warm-up; see Options.DiscardFirst.
+	DiscardedSamples int64 `json:"discarded_samples"`
+}
+
+type SummaryMetric struct {
+	Type       stats.MetricType            `json:"type"`
+	Contains   stats.ValueType             `json:"contains"`
+	Values     map[string]float64          `json:"values"`
+	Thresholds map[string]SummaryThreshold `json:"thresholds,omitempty"`
+}
+
+type SummaryThreshold struct {
+	OK bool `json:"ok"`
+
+	// Set if the threshold was never evaluated, because its metric got no samples, eg. because of
+	// a typo in a tag filter; see Engine.UnmatchedThresholds().
+	NoSamples bool `json:"no_samples,omitempty"`
+}
+
+// Groups and checks are sorted by name, so the output is stable from run to run.
+type SummaryGroup struct {
+	Name   string         `json:"name"`
+	Path   string         `json:"path"`
+	Groups []SummaryGroup `json:"groups"`
+	Checks []SummaryCheck `json:"checks"`
+}
+
+type SummaryCheck struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Passes int64  `json:"passes"`
+	Fails  int64  `json:"fails"`
+}
+
+// Implemented by runners whose scripts can replace the default end-of-test summary.
+type SummaryHandler interface {
+	// Returns a map of output filenames to contents, where "stdout" stands for the terminal, or
+	// nil if the script doesn't define a handler.
+	HandleSummary(ctx context.Context, summary *Summary) (map[string]string, error)
+}
+
+// Snapshots the engine's aggregated metrics, threshold results and checks.
+func (e *Engine) Summary() *Summary {
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+
+	root := &Group{}
+	if e.Runner != nil {
+		if g := e.Runner.GetDefaultGroup(); g != nil {
+			root = g
+		}
+	}
+
+	summary := &Summary{
+		State: SummaryState{
+			TestRunDuration:  float64(e.AtTime()) / float64(time.Millisecond),
+			DiscardedSamples: e.numDiscardedSamples,
+		},
+		Metrics:   make(map[string]SummaryMetric, len(e.Metrics)),
+		RootGroup: summarizeGroup(root),
+	}
+	for name, m := range e.Metrics {
+		sm := SummaryMetric{
+			Type:     m.Type,
+			Contains: m.Contains,
+			Values:   m.Sink.Format(),
+		}
+		if len(m.Thresholds.Thresholds) > 0 {
+			sm.Thresholds = make(map[string]SummaryThreshold, len(m.Thresholds.Thresholds))
+			for _, th := range m.Thresholds.Thresholds {
+				sm.Thresholds[th.Source] = SummaryThreshold{OK: !th.Failed}
+			}
+		}
+		summary.Metrics[name] = sm
+	}
+	for _, name := range e.UnmatchedThresholds() {
+		sm := SummaryMetric{Values: map[string]float64{}, Thresholds: make(map[string]SummaryThreshold)}
+		if parent, ok := e.Metrics[strings.SplitN(name, "{", 2)[0]]; ok {
+			sm.Type = parent.Type
+			sm.Contains = parent.Contains
+		}
+		for _, th := range e.thresholds[name].Thresholds {
+			sm.Thresholds[th.Source] = SummaryThreshold{NoSamples: true}
+		}
+		summary.Metrics[name] = sm
+	}
+	return summary
+}
+
+func summarizeGroup(g *Group) SummaryGroup {
+	sg := SummaryGroup{
+		Name:   g.Name,
+		Path:   g.Path,
+		Groups: []SummaryGroup{},
+		Checks: []SummaryCheck{},
+	}
+
+	g.groupMutex.Lock()
+	groupNames := make([]string, 0, len(g.Groups))
+	for name := range g.Groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	groups := make([]*Group, len(groupNames))
+	for i, name := range groupNames {
+		groups[i] = g.Groups[name]
+	}
+	g.groupMutex.Unlock()
+	for _, group := range groups {
+		sg.Groups = append(sg.Groups, summarizeGroup(group))
+	}
+
+	g.checkMutex.Lock()
+	checkNames := make([]string, 0, len(g.Checks))
+	for name := range g.Checks {
+		checkNames = append(checkNames, name)
+	}
+	sort.Strings(checkNames)
+	for _, name := range checkNames {
+		check := g.Checks[name]
+		sg.Checks = append(sg.Checks, SummaryCheck{
+			Name:   check.Name,
+			Path:   check.Path,
+			Passes: atomic.LoadInt64(&check.Passes),
+			Fails:  atomic.LoadInt64(&check.Fails),
+		})
+	}
+	g.checkMutex.Unlock()
+
+	return sg
+}
@@ -0,0 +1,110 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/stats"
+)
+
+// Default for Options.MaxTagValues.
+const DefaultMaxTagValues = 100
+
+// Tag values past a TagLimiter's cap are replaced with this.
+const OtherTagValue = "(other)"
+
+// Tag keys a TagLimiter never caps: together, they identify a failed iteration, and they're needed
+// to replay one from an output's data.
+var UnlimitedTags = map[string]bool{"vu": true, "iter": true, "seed": true, "error": true}
+
+// A TagLimiter caps the number of distinct values seen for each tag key, eg. "url", so that
+// tagging with unbounded values doesn't blow up the engine's submetrics, or the number of series
+// an output like InfluxDB has to create. Values past the cap collapse into OtherTagValue. Keys in
+// UnlimitedTags are left alone.
+type TagLimiter struct {
+	// Maximum number of distinct values per key; 0 means no limit.
+	Max    int
+	Logger log.FieldLogger
+
+	seen   map[string]map[string]bool
+	warned map[string]bool
+}
+
+func NewTagLimiter(max int, logger log.FieldLogger) *TagLimiter {
+	return &TagLimiter{
+		Max:    max,
+		Logger: logger,
+		seen:   make(map[string]map[string]bool),
+		warned: make(map[string]bool),
+	}
+}
+
+// Returns the samples with tag values past the cap replaced. Tag maps may be shared between
+// samples, so any that need changes are copied rather than modified. Not thread-safe.
+func (l *TagLimiter) Limit(samples []stats.Sample) []stats.Sample {
+	if l == nil || l.Max <= 0 {
+		return samples
+	}
+
+	for i, sample := range samples {
+		var tags map[string]string
+		for k, v := range sample.Tags {
+			if UnlimitedTags[k] || l.allow(k, v) {
+				continue
+			}
+			if tags == nil {
+				tags = make(map[string]string, len(sample.Tags))
+				for k, v := range sample.Tags {
+					tags[k] = v
+				}
+			}
+			tags[k] = OtherTagValue
+		}
+		if tags != nil {
+			samples[i].Tags = tags
+		}
+	}
+	return samples
+}
+
+func (l *TagLimiter) allow(key, value string) bool {
+	values, ok := l.seen[key]
+	if !ok {
+		values = make(map[string]bool)
+		l.seen[key] = values
+	}
+	if values[value] {
+		return true
+	}
+	if len(values) < l.Max {
+		values[value] = true
+		return true
+	}
+
+	if !l.warned[key] {
+		l.warned[key] = true
+		if l.Logger != nil {
+			l.Logger.WithField("tag", key).Warnf(
+				"Tag has more than %d distinct values; further ones are reported as %s", l.Max, OtherTagValue)
+		}
+	}
+	return false
+}
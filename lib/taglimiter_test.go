@@ -0,0 +1,106 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"strconv"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	logtest "github.com/Sirupsen/logrus/hooks/test"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagLimiter(t *testing.T) {
+	metric := stats.New("my_metric", stats.Counter)
+
+	t.Run("Unlimited", func(t *testing.T) {
+		samples := []stats.Sample{{Metric: metric, Tags: map[string]string{"url": "a"}}}
+		assert.Equal(t, samples, NewTagLimiter(0, nil).Limit(samples))
+
+		var l *TagLimiter
+		assert.Equal(t, samples, l.Limit(samples))
+	})
+
+	t.Run("Limited", func(t *testing.T) {
+		logger, hook := logtest.NewNullLogger()
+		l := NewTagLimiter(2, logger)
+
+		shared := map[string]string{"url": "c", "status": "200"}
+		samples := []stats.Sample{
+			{Metric: metric, Tags: map[string]string{"url": "a", "status": "200"}},
+			{Metric: metric, Tags: map[string]string{"url": "b", "status": "200"}},
+			{Metric: metric, Tags: shared},
+			{Metric: metric, Tags: shared},
+			{Metric: metric, Tags: map[string]string{"url": "a", "status": "404"}},
+			{Metric: metric, Tags: map[string]string{"url": "d", "status": "500"}},
+		}
+		var urls, statuses []string
+		for _, s := range l.Limit(samples) {
+			urls = append(urls, s.Tags["url"])
+			statuses = append(statuses, s.Tags["status"])
+		}
+		assert.Equal(t, []string{"a", "b", OtherTagValue, OtherTagValue, "a", OtherTagValue}, urls)
+		assert.Equal(t, []string{"200", "200", "200", "200", "404", OtherTagValue}, statuses)
+		assert.Equal(t, "c", shared["url"], "shared tags were modified")
+
+		// One warning per tag key.
+		entries := hook.AllEntries()
+		if assert.Len(t, entries, 2) {
+			for _, entry := range entries {
+				assert.Equal(t, log.WarnLevel, entry.Level)
+			}
+		}
+	})
+
+	t.Run("Unlimited tags", func(t *testing.T) {
+		l := NewTagLimiter(1, nil)
+		for i := 0; i < 10; i++ {
+			tags := map[string]string{
+				"url":   strconv.Itoa(i),
+				"vu":    strconv.Itoa(i),
+				"iter":  strconv.Itoa(i),
+				"seed":  strconv.Itoa(i),
+				"error": "error " + strconv.Itoa(i),
+			}
+			samples := l.Limit([]stats.Sample{{Metric: metric, Tags: tags}})
+			for k := range UnlimitedTags {
+				assert.NotEqual(t, OtherTagValue, samples[0].Tags[k], k)
+			}
+			if i > 0 {
+				assert.Equal(t, OtherTagValue, samples[0].Tags["url"])
+			}
+		}
+	})
+
+	t.Run("Many", func(t *testing.T) {
+		l := NewTagLimiter(DefaultMaxTagValues, nil)
+		others := 0
+		for i := 0; i < 1000; i++ {
+			samples := l.Limit([]stats.Sample{{Metric: metric, Tags: map[string]string{"url": strconv.Itoa(i)}}})
+			if samples[0].Tags["url"] == OtherTagValue {
+				others++
+			}
+		}
+		assert.Equal(t, 1000-DefaultMaxTagValues, others)
+	})
+}
@@ -0,0 +1,90 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	v, err := ParseTLSVersion("TLS1.1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS11), v)
+
+	_, err = ParseTLSVersion("tls9")
+	assert.EqualError(t, err, "unknown TLS version: tls9")
+}
+
+func TestParseTLSCipherSuite(t *testing.T) {
+	id, err := ParseTLSCipherSuite("tls_ecdhe_rsa_with_aes_128_gcm_sha256")
+	assert.NoError(t, err)
+	assert.Equal(t, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, id)
+
+	_, err = ParseTLSCipherSuite("nope")
+	assert.EqualError(t, err, "unknown TLS cipher suite: nope")
+}
+
+// Generates a self-signed certificate and its key, PEM encoded.
+func newTestCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "k6 test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestTLSAuthCertificate(t *testing.T) {
+	cert, key := newTestCertificate(t)
+	c, err := TLSAuth{Cert: cert, Key: key}.Certificate()
+	if assert.NoError(t, err) {
+		assert.Len(t, c.Certificate, 1)
+	}
+
+	_, err = TLSAuth{Cert: key, Key: cert}.Certificate()
+	assert.Error(t, err)
+}
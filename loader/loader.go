@@ -21,8 +21,11 @@
 package loader
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -45,14 +48,48 @@ var loaders = []struct {
 	{"github", github, regexp.MustCompile(`^github.com/([^/]+)/([^/]+)/(.*)$`)},
 }
 
+// Filesystem remote sources are cached on, so they're only fetched once every CacheTTL; see
+// OpenCache(). If nil, nothing is cached, and every load fetches them anew.
+var Cache afero.Fs
+
+// How long cached remote sources are used for before they're fetched anew, so that changes to them
+// are eventually picked up.
+var CacheTTL = 24 * time.Hour
+
+// Client used to fetch remote sources; has a timeout, so a hanging server fails the load rather
+// than the whole test.
+var client = &http.Client{Timeout: 30 * time.Second}
+
 // Resolves a relative path to an absolute one.
 func Resolve(pwd, name string) string {
-	if name[0] == '.' {
+	if strings.HasPrefix(name, ".") {
 		return filepath.Join(pwd, name)
 	}
 	return name
 }
 
+// Opens a directory to cache remote sources in, creating it if needed. Cached sources are run as
+// they are, so the directory must belong to the current user, and be inaccessible to others.
+func OpenCache(dir string) (afero.Fs, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, errors.Errorf("%s isn't a directory", dir)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return nil, errors.Errorf("%s is accessible to other users; its mode must be 0700", dir)
+	}
+	if err := checkOwner(fi); err != nil {
+		return nil, errors.Wrap(err, dir)
+	}
+	return afero.NewBasePathFs(afero.NewOsFs(), dir), nil
+}
+
 // Returns the directory for the path.
 func Dir(name string) string {
 	return filepath.Dir(name)
@@ -70,7 +107,7 @@ func Load(fs afero.Fs, pwd, name string) (*lib.SourceData, error) {
 	}
 
 	// Do not allow remote-loaded scripts to lift arbitrary files off the user's machine.
-	if name[0] == '/' && pwd[0] != '/' {
+	if name[0] == '/' && !strings.HasPrefix(pwd, "/") {
 		return nil, errors.Errorf("origin (%s) not allowed to load local file: %s", pwd, name)
 	}
 
@@ -86,6 +123,27 @@ func Load(fs afero.Fs, pwd, name string) (*lib.SourceData, error) {
 		return &lib.SourceData{Filename: name, Data: data}, nil
 	}
 
+	// Anything else is remote; use a cached copy if there's a fresh enough one.
+	if Cache != nil {
+		if fi, err := Cache.Stat(cacheKey(name)); err == nil && time.Since(fi.ModTime()) < CacheTTL {
+			if data, err := afero.ReadFile(Cache, cacheKey(name)); err == nil {
+				return &lib.SourceData{Filename: name, Data: data}, nil
+			}
+		}
+	}
+	data, err := loadRemote(name)
+	if err != nil {
+		return nil, err
+	}
+	if Cache != nil {
+		if err := afero.WriteFile(Cache, cacheKey(name), data, 0600); err != nil {
+			log.WithError(err).WithField("name", name).Warn("Couldn't cache remote source")
+		}
+	}
+	return &lib.SourceData{Filename: name, Data: data}, nil
+}
+
+func loadRemote(name string) ([]byte, error) {
 	// If the file is from a known service, try loading from there.
 	loaderName, loader, loaderArgs := pickLoader(name)
 	if loader != nil {
@@ -97,7 +155,7 @@ func Load(fs afero.Fs, pwd, name string) (*lib.SourceData, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, loaderName)
 		}
-		return &lib.SourceData{Filename: name, Data: data}, nil
+		return data, nil
 	}
 
 	// If not, load it and have a look. HTTPS is enforced, because it's 2017, HTTPS is easy,
@@ -125,7 +183,13 @@ func Load(fs afero.Fs, pwd, name string) (*lib.SourceData, error) {
 	// <meta name="k6-import" content="example.com/path/to/real/file.txt" />
 	// <meta name="k6-import" content="github.com/myusername/repo/file.txt" />
 
-	return &lib.SourceData{Filename: name, Data: data}, nil
+	return data, nil
+}
+
+// Returns the name a remote source is cached under.
+func cacheKey(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return hex.EncodeToString(sum[:])
 }
 
 func pickLoader(path string) (string, loaderFunc, []string) {
@@ -141,7 +205,7 @@ func pickLoader(path string) (string, loaderFunc, []string) {
 func fetch(u string) ([]byte, error) {
 	log.WithField("url", u).Debug("Fetching source...")
 	startTime := time.Now()
-	res, err := http.Get(u)
+	res, err := client.Get(u)
 	if err != nil {
 		return nil, err
 	}
@@ -21,7 +21,11 @@
 package loader
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
@@ -93,6 +97,51 @@ func TestLoad(t *testing.T) {
 		})
 	})
 
+	t.Run("Cached", func(t *testing.T) {
+		Cache = afero.NewMemMapFs()
+		defer func() { Cache = nil }()
+
+		assert.NoError(t, afero.WriteFile(Cache, cacheKey("example.com/lib.js"), []byte("hi"), 0644))
+		src, err := Load(nil, "/", "example.com/lib.js")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "example.com/lib.js", src.Filename)
+			assert.Equal(t, "hi", string(src.Data))
+		}
+
+		t.Run("Miss", func(t *testing.T) {
+			src, err := Load(nil, "/", "httpbin.org/robots.txt")
+			if assert.NoError(t, err) {
+				data, err := afero.ReadFile(Cache, cacheKey("httpbin.org/robots.txt"))
+				if assert.NoError(t, err) {
+					assert.Equal(t, string(src.Data), string(data))
+				}
+			}
+		})
+
+		t.Run("Expired", func(t *testing.T) {
+			key := cacheKey("httpbin.org/robots.txt")
+			assert.NoError(t, afero.WriteFile(Cache, key, []byte("stale"), 0600))
+			old := time.Now().Add(-CacheTTL - time.Minute)
+			assert.NoError(t, Cache.Chtimes(key, old, old))
+
+			src, err := Load(nil, "/", "httpbin.org/robots.txt")
+			if assert.NoError(t, err) {
+				assert.NotEqual(t, "stale", string(src.Data))
+				data, err := afero.ReadFile(Cache, key)
+				if assert.NoError(t, err) {
+					assert.Equal(t, string(src.Data), string(data))
+				}
+			}
+		})
+
+		t.Run("Not Found", func(t *testing.T) {
+			_, err := Load(nil, "/", "httpbin.org/status/404")
+			assert.EqualError(t, err, "not found: https://httpbin.org/status/404?_k6=1")
+			exists, _ := afero.Exists(Cache, cacheKey("httpbin.org/status/404"))
+			assert.False(t, exists)
+		})
+	})
+
 	t.Run("No _k6=1 Fallback", func(t *testing.T) {
 		src, err := Load(nil, "/", "pastebin.com/raw/zngdRRDT")
 		if assert.NoError(t, err) {
@@ -101,3 +150,29 @@ func TestLoad(t *testing.T) {
 		}
 	})
 }
+
+func TestOpenCache(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "k6-loader-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = os.RemoveAll(tmpdir) }()
+
+	t.Run("Create", func(t *testing.T) {
+		dir := filepath.Join(tmpdir, "cache")
+		_, err := OpenCache(dir)
+		if assert.NoError(t, err) {
+			fi, err := os.Stat(dir)
+			if assert.NoError(t, err) {
+				assert.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+			}
+		}
+	})
+	t.Run("Shared", func(t *testing.T) {
+		dir := filepath.Join(tmpdir, "shared")
+		assert.NoError(t, os.Mkdir(dir, 0755))
+		assert.NoError(t, os.Chmod(dir, 0755))
+		_, err := OpenCache(dir)
+		assert.EqualError(t, err, dir+" is accessible to other users; its mode must be 0700")
+	})
+}
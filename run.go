@@ -42,14 +42,16 @@ import (
 	"github.com/loadimpact/k6/api"
 	"github.com/loadimpact/k6/js"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
 	"github.com/loadimpact/k6/loader"
 	"github.com/loadimpact/k6/simple"
 	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/stats/influxdb"
 	"github.com/loadimpact/k6/stats/json"
+	"github.com/loadimpact/k6/stats/statsd"
 	"github.com/loadimpact/k6/ui"
 	"github.com/spf13/afero"
-	"gopkg.in/guregu/null.v3"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -59,6 +61,9 @@ const (
 	TypeJS   = "js"
 )
 
+// How long the engine gets to shut down after a signal before partial results are reported.
+const shutdownGracePeriod = 10 * time.Second
+
 var urlRegex = regexp.MustCompile(`(?i)^https?://`)
 
 var commandRun = cli.Command{
@@ -104,6 +109,18 @@ var commandRun = cli.Command{
 			Name:  "linger, l",
 			Usage: "linger after test completion",
 		},
+		cli.Int64Flag{
+			Name:  "rps",
+			Usage: "limit HTTP requests per second, across all VUs",
+		},
+		cli.Int64Flag{
+			Name:  "rps-per-vu",
+			Usage: "limit HTTP requests per second, for each VU",
+		},
+		cli.StringFlag{
+			Name:  "user-agent",
+			Usage: "User-Agent header to send with HTTP requests, rather than k6's; empty to send none",
+		},
 		cli.Int64Flag{
 			Name:  "max-redirects",
 			Usage: "follow at most n redirects",
@@ -114,9 +131,123 @@ var commandRun = cli.Command{
 			Usage: "INSECURE: skip verification of TLS certificates",
 		},
 		cli.StringFlag{
-			Name:   "out, o",
-			Usage:  "output metrics to an external data store (format: type=uri)",
-			EnvVar: "K6_OUT",
+			Name:  "tls-min-version",
+			Usage: "lowest TLS version to negotiate, eg. tls1.1",
+		},
+		cli.StringFlag{
+			Name:  "tls-max-version",
+			Usage: "highest TLS version to negotiate, eg. tls1.2",
+		},
+		cli.StringSliceFlag{
+			Name:  "tls-cipher-suite",
+			Usage: "allow only this TLS cipher suite; may be given several times",
+		},
+		cli.BoolFlag{
+			Name:  "no-tls-resumption",
+			Usage: "do a full TLS handshake for every connection, instead of resuming sessions",
+		},
+		cli.BoolFlag{
+			Name:  "no-http2",
+			Usage: "use HTTP/1.1 only, rather than negotiating HTTP/2",
+		},
+		cli.BoolFlag{
+			Name:  "no-connection-reuse",
+			Usage: "open a new connection for every request",
+		},
+		cli.BoolFlag{
+			Name:  "no-http-metrics",
+			Usage: "don't emit http_* metrics for requests, unless they ask for them",
+		},
+		cli.StringFlag{
+			Name:  "connection-max-age",
+			Usage: "reconnect once a connection is this old, eg. 30s",
+		},
+		cli.Int64Flag{
+			Name:  "connection-max-requests",
+			Usage: "reconnect once a connection has served n requests",
+		},
+		cli.Int64Flag{
+			Name:  "max-idle-conns",
+			Usage: "keep at most n idle connections per VU",
+		},
+		cli.Int64Flag{
+			Name:  "max-idle-conns-per-host",
+			Usage: "keep at most n idle connections per VU and host",
+		},
+		cli.Int64Flag{
+			Name:  "max-conns-per-host",
+			Usage: "open at most n connections per VU and host; requests past that wait",
+		},
+		cli.StringFlag{
+			Name:  "http-timeout",
+			Usage: "abort HTTP requests taking longer than this, eg. 30s; 0 means never",
+		},
+		cli.StringFlag{
+			Name:  "discard-first",
+			Usage: "leave the first part of the test out of the summary and thresholds, eg. 30s",
+		},
+		cli.StringFlag{
+			Name:  "max-iteration-duration",
+			Usage: "abort iterations running for longer than this, eg. 30s",
+		},
+		cli.Int64Flag{
+			Name:  "max-heap-size",
+			Usage: "abort running iterations once the process' heap grows larger than this many bytes",
+		},
+		cli.StringFlag{
+			Name:  "checkpoint",
+			Usage: "periodically write aggregated metrics to a file, so partial results survive a crash",
+		},
+		cli.StringFlag{
+			Name:  "checkpoint-interval",
+			Usage: "how often to write checkpoints, eg. 10s",
+		},
+		cli.StringFlag{
+			Name:  "execution-segment",
+			Usage: "run only a share of the test, eg. 2/4 (or 1/4:2/4) for the second of four instances",
+		},
+		cli.Int64Flag{
+			Name:  "seed",
+			Usage: "seed for random number generation, to make runs reproducible",
+		},
+		cli.StringFlag{
+			Name:  "replay",
+			Usage: "replay a single failed iteration (format: vu:iteration:seed)",
+		},
+		cli.BoolFlag{
+			Name:  "replay-verbose",
+			Usage: "dump all requests and responses made while replaying",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "run a single iteration on one VU, dumping all requests and responses, to debug the script",
+		},
+		cli.StringFlag{
+			Name:   "compatibility-mode",
+			Usage:  "JS dialect scripts are written in, one of: es6 (transformed with Babel, which also runs .ts files), es5 (faster)",
+			Value:  "es6",
+			EnvVar: "K6_COMPATIBILITY_MODE",
+		},
+		cli.StringFlag{
+			Name:   "module-cache",
+			Usage:  "cache remote modules in this directory for a day, rather than fetching them every run; it must be private to the current user",
+			EnvVar: "K6_MODULE_CACHE",
+		},
+		cli.StringSliceFlag{
+			Name:  "local-ip",
+			Usage: "make connections from this local IP; may be given several times to take turns",
+		},
+		cli.StringFlag{
+			Name:  "http-debug",
+			Usage: "log all HTTP requests and responses, one of: headers, full",
+		},
+		cli.StringFlag{
+			Name:  "cookie-mode",
+			Usage: "cookie handling between iterations, one of: persist, reset, disabled",
+		},
+		cli.StringSliceFlag{
+			Name:  "out, o",
+			Usage: "output metrics to an external data store (format: type=uri); may be given more than once, or as whitespace-separated outputs in K6_OUT",
 		},
 		cli.StringSliceFlag{
 			Name:  "config, c",
@@ -158,8 +289,36 @@ var commandInspect = cli.Command{
 			Name:  "config, c",
 			Usage: "read additional config files",
 		},
+		cli.StringFlag{
+			Name:   "compatibility-mode",
+			Usage:  "JS dialect scripts are written in, one of: es6, es5",
+			Value:  "es6",
+			EnvVar: "K6_COMPATIBILITY_MODE",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the options and the script's custom metrics as JSON",
+		},
 	},
 	Action: actionInspect,
+	Description: `Inspect loads a test without running it, and prints its options.
+
+   The script and any modules it imports are compiled and their init code is
+   run, so syntax errors and errors thrown there are reported, with where they
+   occurred; the exit code is non-zero if there are any. This makes it useful
+   as a quick check, eg. in CI, before starting an expensive test.`,
+}
+
+// Output of inspect --json.
+type inspectOutput struct {
+	Options lib.Options     `json:"options"`
+	Metrics []inspectMetric `json:"metrics"`
+}
+
+type inspectMetric struct {
+	Name     string           `json:"name"`
+	Type     stats.MetricType `json:"type"`
+	Contains stats.ValueType  `json:"contains"`
 }
 
 func guessType(data []byte) string {
@@ -193,10 +352,10 @@ func getSrcData(filename string, fs afero.Fs) (*lib.SourceData, error) {
 	return loader.Load(fs, pwd, filename)
 }
 
-func makeRunner(runnerType string, src *lib.SourceData, fs afero.Fs) (lib.Runner, error) {
+func makeRunner(runnerType string, src *lib.SourceData, fs afero.Fs, compatMode string) (lib.Runner, error) {
 	switch runnerType {
 	case TypeAuto:
-		return makeRunner(guessType(src.Data), src, fs)
+		return makeRunner(guessType(src.Data), src, fs, compatMode)
 	case TypeURL:
 		u, err := url.Parse(strings.TrimSpace(string(src.Data)))
 		if err != nil || u.Scheme == "" {
@@ -208,35 +367,25 @@ func makeRunner(runnerType string, src *lib.SourceData, fs afero.Fs) (lib.Runner
 		}
 		return r, err
 	case TypeJS:
-		return js.New(src, fs)
+		return js.NewWithCompatibilityMode(src, fs, compatMode)
 	default:
 		return nil, errors.New("Invalid type specified, see --help")
 	}
 }
 
-func parseCollectorString(s string) (t, p string, err error) {
-	parts := strings.SplitN(s, "=", 2)
-	if len(parts) != 2 {
-		return "", "", errors.New("Malformed output; must be in the form 'type=url'")
-	}
-
-	return parts[0], parts[1], nil
-}
-
-func makeCollector(s string, src *lib.SourceData, opts lib.Options) (lib.Collector, error) {
-	t, p, err := parseCollectorString(s)
-	if err != nil {
-		return nil, err
-	}
-
-	switch t {
-	case "influxdb":
-		return influxdb.New(p, opts)
-	case "json":
-		return json.New(p, afero.NewOsFs(), opts)
-	default:
-		return nil, errors.New("Unknown output type: " + t)
-	}
+func init() {
+	lib.RegisterOutput("influxdb", func(arg string, src *lib.SourceData, opts lib.Options) (lib.Output, error) {
+		return influxdb.New(arg, opts)
+	})
+	lib.RegisterOutput("json", func(arg string, src *lib.SourceData, opts lib.Options) (lib.Output, error) {
+		return json.New(arg, afero.NewOsFs(), opts)
+	})
+	lib.RegisterOutput("statsd", func(arg string, src *lib.SourceData, opts lib.Options) (lib.Output, error) {
+		return statsd.New(arg, statsd.StatsD, opts)
+	})
+	lib.RegisterOutput("datadog", func(arg string, src *lib.SourceData, opts lib.Options) (lib.Output, error) {
+		return statsd.New(arg, statsd.DogStatsD, opts)
+	})
 }
 
 func actionRun(cc *cli.Context) error {
@@ -249,7 +398,11 @@ func actionRun(cc *cli.Context) error {
 
 	// Collect CLI arguments, most (not all) relating to options.
 	addr := cc.GlobalString("address")
-	out := cc.String("out")
+	outs := cc.StringSlice("out")
+	if len(outs) == 0 {
+		// Not an EnvVar on the flag, as that'd split it on commas, which are common in URLs.
+		outs = strings.Fields(os.Getenv("K6_OUT"))
+	}
 	quiet := cc.Bool("quiet")
 	cliOpts := lib.Options{
 		Paused:                cliBool(cc, "paused"),
@@ -258,10 +411,44 @@ func actionRun(cc *cli.Context) error {
 		Duration:              cliDuration(cc, "duration"),
 		Iterations:            cliInt64(cc, "iterations"),
 		Linger:                cliBool(cc, "linger"),
+		RPS:                   cliInt64(cc, "rps"),
+		RPSPerVU:              cliInt64(cc, "rps-per-vu"),
+		UserAgent:             cliString(cc, "user-agent"),
 		MaxRedirects:          cliInt64(cc, "max-redirects"),
 		InsecureSkipTLSVerify: cliBool(cc, "insecure-skip-tls-verify"),
+		TLSMinVersion:         cliString(cc, "tls-min-version"),
+		TLSMaxVersion:         cliString(cc, "tls-max-version"),
+		NoTLSResumption:       cliBool(cc, "no-tls-resumption"),
+		NoConnectionReuse:     cliBool(cc, "no-connection-reuse"),
+		NoHTTP2:               cliBool(cc, "no-http2"),
+		NoHTTPMetrics:         cliBool(cc, "no-http-metrics"),
+		ConnectionMaxAge:      cliString(cc, "connection-max-age"),
+		ConnectionMaxRequests: cliInt64(cc, "connection-max-requests"),
+		MaxIdleConns:          cliInt64(cc, "max-idle-conns"),
+		MaxIdleConnsPerHost:   cliInt64(cc, "max-idle-conns-per-host"),
+		MaxConnsPerHost:       cliInt64(cc, "max-conns-per-host"),
+		CookieMode:            cliString(cc, "cookie-mode"),
+		HTTPDebug:             cliString(cc, "http-debug"),
+		HTTPTimeout:           cliString(cc, "http-timeout"),
+		MaxIterationDuration:  cliString(cc, "max-iteration-duration"),
+		MaxHeapSize:           cliInt64(cc, "max-heap-size"),
+		DiscardFirst:          cliString(cc, "discard-first"),
+		ExecutionSegment:      cliString(cc, "execution-segment"),
+		Checkpoint:            cliString(cc, "checkpoint"),
+		CheckpointInterval:    cliString(cc, "checkpoint-interval"),
+		Seed:                  cliInt64(cc, "seed"),
 		NoUsageReport:         cliBool(cc, "no-usage-report"),
 	}
+	if cc.IsSet("tls-cipher-suite") {
+		cliOpts.TLSCipherSuites = cc.StringSlice("tls-cipher-suite")
+	}
+	for _, s := range cc.StringSlice("local-ip") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return cli.NewExitError("Invalid local IP: "+s, 1)
+		}
+		cliOpts.LocalIPs = append(cliOpts.LocalIPs, ip)
+	}
 	for _, s := range cc.StringSlice("stage") {
 		stage, err := ParseStage(s)
 		if err != nil {
@@ -275,6 +462,14 @@ func actionRun(cc *cli.Context) error {
 	// Make the Runner, extract script-defined options.
 	arg := args[0]
 	fs := afero.NewOsFs()
+	if dir := cc.String("module-cache"); dir != "" {
+		cache, err := loader.OpenCache(dir)
+		if err != nil {
+			log.WithError(err).Warn("Couldn't open the module cache, remote modules won't be cached")
+		} else {
+			loader.Cache = cache
+		}
+	}
 	src, err := getSrcData(arg, fs)
 	if err != nil {
 		log.WithError(err).Error("Failed to parse input data")
@@ -284,7 +479,7 @@ func actionRun(cc *cli.Context) error {
 	if runnerType == TypeAuto {
 		runnerType = guessType(src.Data)
 	}
-	runner, err := makeRunner(runnerType, src, fs)
+	runner, err := makeRunner(runnerType, src, fs, cc.String("compatibility-mode"))
 	if err != nil {
 		if errstr, ok := err.(fmt.Stringer); ok {
 			log.Error(errstr.String())
@@ -312,38 +507,29 @@ func actionRun(cc *cli.Context) error {
 	// CLI options override everything.
 	opts = opts.Apply(cliOpts)
 
-	// Default to 1 iteration if duration and stages are unspecified.
-	if !opts.Duration.Valid && !opts.Iterations.Valid && len(opts.Stages) == 0 {
-		opts.Iterations = null.IntFrom(1)
-	}
-
-	// Apply defaults.
-	opts = opts.SetAllValid(true)
-
-	// Make sure VUsMax defaults to VUs if not specified.
-	if opts.VUsMax.Int64 == 0 {
-		opts.VUsMax.Int64 = opts.VUs.Int64
-		if len(opts.Stages) > 0 {
-			for _, stage := range opts.Stages {
-				if stage.Target.Valid && stage.Target.Int64 > opts.VUsMax.Int64 {
-					opts.VUsMax = stage.Target
-				}
-			}
-		}
-	}
+	// Apply defaults; eg. 1 iteration if duration and stages are unspecified.
+	opts = opts.WithDefaults()
 
 	// Update the runner's options.
 	runner.ApplyOptions(opts)
 
-	// Make the metric collector, if requested.
-	var collector lib.Collector
-	if out != "" {
-		c, err := makeCollector(out, src, opts)
+	// Replaying a failed iteration is a one-off, and doesn't need an engine.
+	if replay := cc.String("replay"); replay != "" {
+		return actionReplay(runner, replay, cc.Bool("replay-verbose"))
+	}
+	if cc.Bool("dry-run") {
+		return actionDryRun(runner)
+	}
+
+	// Make the outputs, if requested; samples are passed on to all of them.
+	var outputs []lib.Output
+	for _, out := range outs {
+		o, err := lib.NewOutput(out, src, opts)
 		if err != nil {
 			log.WithError(err).Error("Couldn't create output")
 			return err
 		}
-		collector = c
+		outputs = append(outputs, o)
 	}
 
 	fmt.Fprintln(color.Output, "")
@@ -354,16 +540,10 @@ func actionRun(cc *cli.Context) error {
 	color.Cyan(`   /          \   |  |‾\  \ | (_) | `)
 	color.Cyan(`  / __________ \  |__|  \__\ \___/  Welcome to k6 v%s!`, cc.App.Version)
 
-	collectorString := "-"
-	if collector != nil {
-		collector.Init()
-		collectorString = fmt.Sprint(collector)
-	}
-
 	fmt.Fprintln(color.Output, "")
 
 	fmt.Fprintf(color.Output, "  execution: %s\n", color.CyanString("local"))
-	fmt.Fprintf(color.Output, "     output: %s\n", color.CyanString(collectorString))
+	fmt.Fprintf(color.Output, "     output: %s\n", color.CyanString(lib.OutputsString(outputs)))
 	fmt.Fprintf(color.Output, "     script: %s (%s)\n", color.CyanString(src.Filename), color.CyanString(runnerType))
 	fmt.Fprintf(color.Output, "\n")
 	fmt.Fprintf(color.Output, "   duration: %s, iterations: %s\n", color.CyanString(opts.Duration.String), color.CyanString("%d", opts.Iterations.Int64))
@@ -379,7 +559,7 @@ func actionRun(cc *cli.Context) error {
 		return err
 	}
 	ctx, cancel := context.WithCancel(context.Background())
-	engine.Collector = collector
+	engine.Outputs = outputs
 
 	// Send usage report, if we're allowed to
 	if opts.NoUsageReport.Valid && !opts.NoUsageReport.Bool {
@@ -424,6 +604,7 @@ func actionRun(cc *cli.Context) error {
 	// Wait for a signal or timeout before shutting down
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	interrupted := false
 
 	// Print status at a set interval; less frequently on non-TTYs.
 	tickInterval := 10 * time.Millisecond
@@ -461,10 +642,15 @@ loop:
 					roundDuration(totalTime, 100*time.Millisecond),
 				)
 			} else {
-				fmt.Fprintf(color.Output, "[%-10s] %s / %s\n",
+				snapshot := engine.Snapshot()
+				fmt.Fprintf(color.Output, "[%-10s] %s / %s vus=%d reqs/s=%.1f p95=%s errors=%.2f%%\n",
 					statusString,
 					roundDuration(atTime, 100*time.Millisecond),
 					roundDuration(totalTime, 100*time.Millisecond),
+					snapshot.VUs,
+					snapshot.RequestsPerSecond,
+					roundDuration(time.Duration(snapshot.RequestDurationP95*float64(time.Millisecond)), time.Microsecond),
+					snapshot.ErrorRate*100,
 				)
 			}
 		case <-ctx.Done():
@@ -472,43 +658,141 @@ loop:
 			break loop
 		case sig := <-signals:
 			log.WithField("signal", sig).Debug("Signal received; shutting down...")
+			interrupted = true
 			break loop
 		}
 	}
 
-	// Shut down the API server and engine.
+	// Shut down the API server and engine. After a signal, the engine only gets so long to flush
+	// what it has; partial results are reported either way, and another signal cuts it short.
 	cancel()
-	wg.Wait()
+	if interrupted {
+		engineDone := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(engineDone)
+		}()
+		select {
+		case <-engineDone:
+		case <-time.After(shutdownGracePeriod):
+			log.Warn("Engine didn't shut down in time; reporting partial results")
+		case sig := <-signals:
+			log.WithField("signal", sig).Warn("Signal received again; reporting partial results")
+		}
+	} else {
+		wg.Wait()
+	}
+
+	if path := engine.Options.Checkpoint.String; path != "" {
+		if err := engine.WriteCheckpoint(path, interrupted); err != nil {
+			log.WithError(err).Error("Couldn't write checkpoint")
+		}
+	}
+
+	if jsRunner, ok := engine.Runner.(*js.Runner); ok && jsRunner.HAR != nil {
+		if err := writeHAR(fs, engine.Options.HAR.File.String, jsRunner.HAR, cc.App.Version); err != nil {
+			log.WithError(err).Error("Couldn't write HAR file")
+		}
+	}
 
 	// Test done, leave that status as the final progress bar!
 	atTime := engine.AtTime()
+	status := "done"
+	if interrupted {
+		status = "interrupted"
+	}
 	if isTTY && !quiet {
 		progressBar.Progress = 1.0
-		fmt.Fprintf(color.Output, "      done %s %10s / %s\n",
+		fmt.Fprintf(color.Output, "%10s %s %10s / %s\n",
+			status,
 			progressBar.String(),
 			roundDuration(atTime, 100*time.Millisecond),
 			roundDuration(atTime, 100*time.Millisecond),
 		)
 	} else {
 		fmt.Fprintf(color.Output, "[%-10s] %s / %s\n",
-			"done",
+			status,
 			roundDuration(atTime, 100*time.Millisecond),
 			roundDuration(atTime, 100*time.Millisecond),
 		)
 	}
 	fmt.Fprintf(color.Output, "\n")
 
+	// Let the script replace the default summary, or write it to files, if it wants to.
+	printDefaultSummary := true
+	if handler, ok := engine.Runner.(lib.SummaryHandler); ok {
+		summary := engine.Summary()
+		summary.State.Interrupted = interrupted
+		outputs, err := handler.HandleSummary(context.Background(), summary)
+		if err != nil {
+			log.WithError(err).Error("handleSummary() failed, falling back to the default summary")
+		}
+		for name, content := range outputs {
+			if name == "stdout" {
+				fmt.Fprint(color.Output, content)
+				printDefaultSummary = false
+				continue
+			}
+			if err := afero.WriteFile(fs, name, []byte(content), 0644); err != nil {
+				log.WithError(err).WithField("file", name).Error("Couldn't write summary")
+			}
+		}
+	}
+	if printDefaultSummary {
+		if interrupted {
+			fmt.Fprint(color.Output, color.RedString("  The test was interrupted; these are partial results.\n\n"))
+		}
+		printSummary(engine, atTime)
+	}
+
+	if opts.Linger.Bool {
+		<-signals
+	}
+
+	if engine.IsTainted() {
+		return cli.NewExitError("", 99)
+	}
+	return nil
+}
+
+// Writes the requests recorded for the har option to a file.
+func writeHAR(fs afero.Fs, path string, rec *netext.HARRecorder, version string) error {
+	f, err := fs.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := rec.Export(f, version); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if dropped := rec.Dropped(); dropped > 0 {
+		log.WithField("dropped", dropped).Warn("Too many requests to record them all in the HAR file")
+	}
+	return f.Close()
+}
+
+// Prints the default end-of-test summary: checks, metrics and a per-host breakdown.
+func printSummary(engine *lib.Engine, atTime time.Duration) {
+	// Checks are summarized before anything else is locked, as VUs may still be adding to them;
+	// this copies them under their group's lock.
+	rootGroup := engine.Summary().RootGroup
+
+	// The engine may still be winding down after an interrupt.
+	engine.MetricsLock.Lock()
+	defer engine.MetricsLock.Unlock()
+
 	// Print groups.
-	var printGroup func(g *lib.Group, level int)
-	printGroup = func(g *lib.Group, level int) {
+	var printGroup func(g lib.SummaryGroup, level int)
+	printGroup = func(g lib.SummaryGroup, level int) {
 		indent := strings.Repeat("  ", level)
+		isRoot := level == 1
 
-		if g.Name != "" && g.Parent != nil {
+		if !isRoot {
 			fmt.Fprintf(color.Output, "%s█ %s\n", indent, g.Name)
 		}
 
 		if len(g.Checks) > 0 {
-			if g.Name != "" && g.Parent != nil {
+			if !isRoot {
 				fmt.Fprintf(color.Output, "\n")
 			}
 			for _, check := range g.Checks {
@@ -528,7 +812,7 @@ loop:
 			fmt.Fprintf(color.Output, "\n")
 		}
 		if len(g.Groups) > 0 {
-			if g.Name != "" && g.Parent != nil && len(g.Checks) > 0 {
+			if !isRoot && len(g.Checks) > 0 {
 				fmt.Fprintf(color.Output, "\n")
 			}
 			for _, g := range g.Groups {
@@ -537,7 +821,14 @@ loop:
 		}
 	}
 
-	printGroup(engine.Runner.GetDefaultGroup(), 1)
+	printGroup(rootGroup, 1)
+
+	if discarded := engine.DiscardedSamples(); discarded > 0 {
+		fmt.Fprint(color.Output, color.New(color.Faint).Sprintf(
+			"  %d samples from the first %s (warm-up) are left out of these results\n\n",
+			discarded, engine.Options.DiscardFirst.String,
+		))
+	}
 
 	// Sort and print metrics.
 	metricNames := make([]string, 0, len(engine.Metrics))
@@ -548,10 +839,27 @@ loop:
 			metricNameWidth = l
 		}
 	}
+	for _, name := range engine.UnmatchedThresholds() {
+		metricNames = append(metricNames, name)
+		if l := len(name); l > metricNameWidth {
+			metricNameWidth = l
+		}
+	}
 	sort.Strings(metricNames)
 
 	for _, name := range metricNames {
-		m := engine.Metrics[name]
+		m, ok := engine.Metrics[name]
+		if !ok {
+			// Thresholds without samples are neither passed nor failed; there may be a typo.
+			namePadding := strings.Repeat(".", metricNameWidth-len(name)+3)
+			fmt.Fprintf(color.Output, "  %s %s%s %s\n",
+				color.YellowString("?"),
+				name,
+				color.New(color.Faint).Sprint(namePadding+":"),
+				color.YellowString("no samples matched"),
+			)
+			continue
+		}
 		sample := m.Sink.Format()
 
 		keys := make([]string, 0, len(sample))
@@ -600,13 +908,72 @@ loop:
 		)
 	}
 
-	if opts.Linger.Bool {
-		<-signals
+	// Break HTTP requests down by host, if more than one was hit.
+	if len(engine.Hosts) > 1 {
+		hosts := make([]string, 0, len(engine.Hosts))
+		hostWidth := len("host")
+		for host := range engine.Hosts {
+			hosts = append(hosts, host)
+			if l := len(host); l > hostWidth {
+				hostWidth = l
+			}
+		}
+		sort.Strings(hosts)
+
+		fmt.Fprintf(color.Output, "\n")
+		fmt.Fprint(color.Output, color.New(color.Faint).Sprintf("    %-*s %10s %8s %10s\n",
+			hostWidth, "host", "requests", "errors", "p95"))
+		for _, host := range hosts {
+			hs := engine.Hosts[host]
+			fmt.Fprintf(color.Output, "    %-*s %s %s %s\n",
+				hostWidth, host,
+				color.CyanString("%10d", hs.Requests),
+				color.CyanString("%7.2f%%", 100*hs.ErrorRate()),
+				color.CyanString("%10s", metrics.HTTPReqDuration.HumanizeValue(hs.Duration.P(0.95))),
+			)
+		}
 	}
+}
 
-	if engine.IsTainted() {
-		return cli.NewExitError("", 99)
+func actionReplay(runner lib.Runner, replay string, verbose bool) error {
+	jsRunner, ok := runner.(*js.Runner)
+	if !ok {
+		return cli.NewExitError("Only JS scripts can be replayed", 1)
+	}
+	id, iteration, seed, err := ParseReplay(replay)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fields := log.Fields{"vu": id, "iter": iteration, "seed": seed}
+	if _, err := jsRunner.Replay(context.Background(), id, iteration, seed, verbose); err != nil {
+		if serr, ok := err.(fmt.Stringer); ok {
+			log.WithFields(fields).Error(serr.String())
+		} else {
+			log.WithFields(fields).WithError(err).Error("Replayed iteration failed")
+		}
+		return cli.NewExitError("", 1)
 	}
+	log.WithFields(fields).Info("Replayed iteration succeeded")
+	return nil
+}
+
+func actionDryRun(runner lib.Runner) error {
+	jsRunner, ok := runner.(*js.Runner)
+	if !ok {
+		return cli.NewExitError("Only JS scripts can be dry-run", 1)
+	}
+	log.SetLevel(log.DebugLevel)
+
+	if _, err := jsRunner.DryRun(context.Background()); err != nil {
+		if serr, ok := err.(fmt.Stringer); ok {
+			log.Error(serr.String())
+		} else {
+			log.WithError(err).Error("Dry run failed")
+		}
+		return cli.NewExitError("", 1)
+	}
+	log.Info("Dry run passed")
 	return nil
 }
 
@@ -628,14 +995,18 @@ func actionInspect(cc *cli.Context) error {
 	}
 
 	var opts lib.Options
+	declared := []inspectMetric{}
 
 	switch runnerType {
 	case TypeJS:
-		r, err := js.NewBundle(src, fs)
+		r, err := js.NewBundleWithCompatibilityMode(src, fs, cc.String("compatibility-mode"))
 		if err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
 		opts = opts.Apply(r.Options)
+		for _, m := range r.Metrics {
+			declared = append(declared, inspectMetric{Name: m.Name, Type: m.Type, Contains: m.Contains})
+		}
 	}
 
 	for _, filename := range cc.StringSlice("config") {
@@ -651,5 +1022,8 @@ func actionInspect(cc *cli.Context) error {
 		opts = opts.Apply(configOpts)
 	}
 
+	if cc.Bool("json") {
+		return dumpJSON(inspectOutput{Options: opts, Metrics: declared})
+	}
 	return dumpYAML(opts)
 }
@@ -0,0 +1,104 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// An example of running a test from a Go program: it load tests a local server with an inline
+// script, then checks the results. Run it with `go run samples/embed/main.go`.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/loadimpact/k6/embed"
+	"github.com/loadimpact/k6/lib"
+	"github.com/spf13/afero"
+	"gopkg.in/guregu/null.v3"
+)
+
+const script = `
+import http from "k6/http";
+import { check } from "k6";
+
+export let options = {
+	thresholds: { "http_req_duration": ["p(95)<500"] },
+};
+
+export default function() {
+	check(http.get("%s"), { "is 200": (r) => r.status === 200 });
+}
+`
+
+func main() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	if err := run(srv.URL); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		srv.Close()
+		os.Exit(1)
+	}
+}
+
+func run(url string) error {
+	runner, err := embed.NewRunner("/script.js", []byte(fmt.Sprintf(script, url)), afero.NewMemMapFs())
+	if err != nil {
+		return err
+	}
+
+	test := embed.NewTest(runner, lib.Options{
+		VUs:      null.IntFrom(5),
+		Duration: null.StringFrom("3s"),
+	})
+	go func() {
+		for p := range test.Progress() {
+			fmt.Printf("%s: %d VUs, %.1f reqs/s\n", p.AtTime, p.VUs, p.RequestsPerSecond)
+		}
+	}()
+
+	result, err := test.Run(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// Trend percentiles are keyed as "p95", rather than in the "p(95)" threshold syntax.
+	reqs := result.Summary.Metrics["http_reqs"].Values["count"]
+	p95, ok := result.Summary.Metrics["http_req_duration"].Values["p95"]
+	fmt.Printf("%.0f requests, p(95) = %.2fms\n", reqs, p95)
+	if reqs == 0 {
+		return fmt.Errorf("no requests were made")
+	}
+	if !ok || p95 <= 0 {
+		return fmt.Errorf("no p95 for http_req_duration in the summary")
+	}
+	for _, check := range result.Summary.RootGroup.Checks {
+		if check.Fails > 0 {
+			return fmt.Errorf("check %q failed %d times", check.Name, check.Fails)
+		}
+	}
+	if result.ThresholdsFailed {
+		return fmt.Errorf("thresholds failed")
+	}
+	return nil
+}
@@ -40,22 +40,25 @@ import (
 type Runner struct {
 	URL       *url.URL
 	Transport *http.Transport
+	Dialer    *netext.Dialer
 	Options   lib.Options
 
 	defaultGroup *lib.Group
 }
 
 func New(u *url.URL) (*Runner, error) {
+	dialer := netext.NewDialer(net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 60 * time.Second,
+		DualStack: true,
+	})
 	return &Runner{
-		URL: u,
+		URL:    u,
+		Dialer: dialer,
 		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: netext.NewDialer(net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 60 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			TLSClientConfig:     &tls.Config{},
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     &tls.Config{ClientSessionCache: tls.NewLRUClientSessionCache(0)},
 			MaxIdleConns:        math.MaxInt32,
 			MaxIdleConnsPerHost: math.MaxInt32,
 		},
@@ -64,6 +67,19 @@ func New(u *url.URL) (*Runner, error) {
 }
 
 func (r *Runner) NewVU() (lib.VU, error) {
+	// Connections per host are limited separately for every VU, like in the JS runner, so every
+	// VU needs a dialer and a transport of its own; the rest is taken from the runner's.
+	dialer := r.Dialer.ForVU()
+	dialer.SetMaxConnsPerHost(int(r.Options.MaxConnsPerHost.Int64))
+	transport := &http.Transport{
+		Proxy:               r.Transport.Proxy,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     r.Transport.TLSClientConfig,
+		DisableKeepAlives:   r.Transport.DisableKeepAlives,
+		MaxIdleConns:        r.Transport.MaxIdleConns,
+		MaxIdleConnsPerHost: r.Transport.MaxIdleConnsPerHost,
+	}
+
 	return &VU{
 		Runner:    r,
 		URLString: r.URL.String(),
@@ -72,7 +88,7 @@ func (r *Runner) NewVU() (lib.VU, error) {
 			URL:    r.URL,
 		},
 		Client: &http.Client{
-			Transport: r.Transport,
+			Transport: transport,
 		},
 		tracer: &netext.Tracer{},
 	}, nil
@@ -82,6 +98,10 @@ func (r *Runner) GetDefaultGroup() *lib.Group {
 	return &lib.Group{}
 }
 
+func (r *Runner) EmitMetrics(t time.Time) []stats.Sample {
+	return r.Dialer.Stats.Samples(t)
+}
+
 func (r Runner) GetOptions() lib.Options {
 	return r.Options
 }
@@ -89,6 +109,17 @@ func (r Runner) GetOptions() lib.Options {
 func (r *Runner) ApplyOptions(opts lib.Options) {
 	r.Options = r.Options.Apply(opts)
 	r.Transport.TLSClientConfig.InsecureSkipVerify = opts.InsecureSkipTLSVerify.Bool
+	if r.Options.NoTLSResumption.Bool {
+		r.Transport.TLSClientConfig.ClientSessionCache = nil
+		r.Transport.TLSClientConfig.SessionTicketsDisabled = true
+	}
+	r.Transport.DisableKeepAlives = r.Options.NoConnectionReuse.Bool
+	if r.Options.MaxIdleConns.Valid {
+		r.Transport.MaxIdleConns = int(r.Options.MaxIdleConns.Int64)
+	}
+	if r.Options.MaxIdleConnsPerHost.Valid {
+		r.Transport.MaxIdleConnsPerHost = int(r.Options.MaxIdleConnsPerHost.Int64)
+	}
 }
 
 type VU struct {
@@ -111,20 +142,38 @@ func (u *VU) RunOnce(ctx context.Context) ([]stats.Sample, error) {
 		"url":    u.URLString,
 	}
 
-	resp, err := u.Client.Do(u.Request.WithContext(netext.WithTracer(ctx, u.tracer)))
+	// An iteration is a single request, so the iteration time limit works like a request timeout;
+	// whatever was measured before it ran out is still reported.
+	iterCtx := ctx
+	if d, _ := time.ParseDuration(u.Runner.Options.MaxIterationDuration.String); d > 0 {
+		var cancel context.CancelFunc
+		iterCtx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	resp, err := u.Client.Do(u.Request.WithContext(netext.WithTracer(iterCtx, u.tracer)))
 	if err != nil {
-		return u.tracer.Done().Samples(tags), err
+		return u.tracer.Done().Samples(tags), iterationError(ctx, iterCtx, err)
 	}
 	tags["status"] = strconv.Itoa(resp.StatusCode)
 
 	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
-		return u.tracer.Done().Samples(tags), err
+		return u.tracer.Done().Samples(tags), iterationError(ctx, iterCtx, err)
 	}
 	_ = resp.Body.Close()
 
 	return u.tracer.Done().Samples(tags), nil
 }
 
+// Reports requests cut short by the iteration time limit as lib.ErrIterationTimeout; ones cut short
+// by the test's context, even if that has a deadline of its own, are reported as they are.
+func iterationError(ctx, iterCtx context.Context, err error) error {
+	if ctx.Err() == nil && iterCtx.Err() == context.DeadlineExceeded {
+		return lib.ErrIterationTimeout
+	}
+	return err
+}
+
 func (u *VU) Reconfigure(id int64) error {
 	u.ID = id
 	u.IDString = strconv.FormatInt(id, 10)
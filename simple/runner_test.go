@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package simple
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestVURunOnceTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(1 * time.Second):
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer srv.Close()
+
+	newVU := func(path, maxIterationDuration string) (lib.VU, error) {
+		u, err := url.Parse(srv.URL + path)
+		if err != nil {
+			return nil, err
+		}
+		r, err := New(u)
+		if err != nil {
+			return nil, err
+		}
+		r.ApplyOptions(lib.Options{MaxIterationDuration: null.NewString(maxIterationDuration, maxIterationDuration != "")})
+		return r.NewVU()
+	}
+
+	t.Run("Fast", func(t *testing.T) {
+		vu, err := newVU("/", "500ms")
+		if !assert.NoError(t, err) {
+			return
+		}
+		samples, err := vu.RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.NotEmpty(t, samples)
+	})
+	t.Run("Slow", func(t *testing.T) {
+		vu, err := newVU("/slow", "50ms")
+		if !assert.NoError(t, err) {
+			return
+		}
+		start := time.Now()
+		samples, err := vu.RunOnce(context.Background())
+		assert.Equal(t, lib.ErrIterationTimeout, err)
+		assert.NotEmpty(t, samples)
+		assert.True(t, time.Since(start) < 500*time.Millisecond, "iteration wasn't cut short")
+	})
+	t.Run("Test deadline", func(t *testing.T) {
+		// The test running out isn't the iteration's fault, whether or not it has a limit.
+		for _, limit := range []string{"", "500ms"} {
+			vu, err := newVU("/slow", limit)
+			if !assert.NoError(t, err) {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			_, err = vu.RunOnce(ctx)
+			cancel()
+			assert.Error(t, err)
+			assert.NotEqual(t, lib.ErrIterationTimeout, err, limit)
+		}
+	})
+}
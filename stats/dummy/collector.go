@@ -21,7 +21,6 @@
 package dummy
 
 import (
-	"context"
 	"sync"
 
 	"github.com/loadimpact/k6/stats"
@@ -34,22 +33,27 @@ type Collector struct {
 	lock sync.Mutex
 }
 
-func (c *Collector) Init() {
-}
-
-func (c *Collector) Run(ctx context.Context) {
+func (c *Collector) Start() error {
 	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.running = true
-	c.lock.Unlock()
+	return nil
+}
 
-	<-ctx.Done()
+func (c *Collector) Flush() error {
+	return nil
+}
 
+func (c *Collector) Stop() error {
 	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.running = false
-	c.lock.Unlock()
+	return nil
 }
 
-func (c *Collector) Collect(samples []stats.Sample) {
+func (c *Collector) AddSamples(samples []stats.Sample) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
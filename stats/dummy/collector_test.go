@@ -21,39 +21,32 @@
 package dummy
 
 import (
-	"context"
 	"testing"
-	"time"
 
 	"github.com/loadimpact/k6/stats"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestCollectorRun(t *testing.T) {
+func TestCollectorStart(t *testing.T) {
 	c := &Collector{}
 	assert.False(t, c.IsRunning())
 
-	ctx, cancel := context.WithCancel(context.Background())
-	go c.Run(ctx)
-	time.Sleep(1 * time.Millisecond)
+	assert.NoError(t, c.Start())
 	assert.True(t, c.IsRunning(), "not marked as running")
 
-	cancel()
-	time.Sleep(1 * time.Millisecond)
+	assert.NoError(t, c.Stop())
 	assert.False(t, c.IsRunning(), "not marked as stopped")
 }
 
-func TestCollectorCollect(t *testing.T) {
+func TestCollectorAddSamples(t *testing.T) {
 	c := &Collector{}
-	t.Run("no context", func(t *testing.T) {
-		assert.Panics(t, func() { c.Collect([]stats.Sample{{}}) })
+	t.Run("not running", func(t *testing.T) {
+		assert.Panics(t, func() { c.AddSamples([]stats.Sample{{}}) })
 	})
-	t.Run("context", func(t *testing.T) {
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		go func() { c.Run(ctx) }()
-		time.Sleep(1 * time.Millisecond)
-		c.Collect([]stats.Sample{{}})
+	t.Run("running", func(t *testing.T) {
+		assert.NoError(t, c.Start())
+		defer func() { _ = c.Stop() }()
+		c.AddSamples([]stats.Sample{{}})
 		assert.Len(t, c.Samples, 1)
 	})
 }
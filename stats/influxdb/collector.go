@@ -21,7 +21,6 @@
 package influxdb
 
 import (
-	"context"
 	"fmt"
 	"net/url"
 	"sync"
@@ -31,10 +30,9 @@ import (
 	"github.com/influxdata/influxdb/client/v2"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 )
 
-const pushInterval = 1 * time.Second
-
 type Collector struct {
 	u          *url.URL
 	client     client.Client
@@ -61,34 +59,31 @@ func New(s string, opts lib.Options) (*Collector, error) {
 	}, nil
 }
 
-func (c *Collector) Init() {
-}
-
 func (c *Collector) String() string {
 	return fmt.Sprintf("influxdb (%s)", c.u.Host)
 }
 
-func (c *Collector) Run(ctx context.Context) {
+func (c *Collector) Start() error {
 	log.Debug("InfluxDB: Running!")
-	ticker := time.NewTicker(pushInterval)
-	for {
-		select {
-		case <-ticker.C:
-			c.commit()
-		case <-ctx.Done():
-			c.commit()
-			return
-		}
-	}
+	return nil
 }
 
-func (c *Collector) Collect(samples []stats.Sample) {
+func (c *Collector) AddSamples(samples []stats.Sample) {
 	c.bufferLock.Lock()
 	c.buffer = append(c.buffer, samples...)
 	c.bufferLock.Unlock()
 }
 
-func (c *Collector) commit() {
+// Writes out everything buffered since the last flush as a single batch.
+func (c *Collector) Flush() error {
+	return c.commit()
+}
+
+func (c *Collector) Stop() error {
+	return c.commit()
+}
+
+func (c *Collector) commit() error {
 	c.bufferLock.Lock()
 	samples := c.buffer
 	c.buffer = nil
@@ -97,8 +92,7 @@ func (c *Collector) commit() {
 	log.Debug("InfluxDB: Committing...")
 	batch, err := client.NewBatchPoints(c.batchConf)
 	if err != nil {
-		log.WithError(err).Error("InfluxDB: Couldn't make a batch")
-		return
+		return errors.Wrap(err, "InfluxDB: Couldn't make a batch")
 	}
 
 	for _, sample := range samples {
@@ -109,8 +103,7 @@ func (c *Collector) commit() {
 			sample.Time,
 		)
 		if err != nil {
-			log.WithError(err).Error("InfluxDB: Couldn't make point from sample!")
-			return
+			return errors.Wrap(err, "InfluxDB: Couldn't make point from sample")
 		}
 		batch.AddPoint(p)
 	}
@@ -118,8 +111,9 @@ func (c *Collector) commit() {
 	log.WithField("points", len(batch.Points())).Debug("InfluxDB: Writing...")
 	startTime := time.Now()
 	if err := c.client.Write(batch); err != nil {
-		log.WithError(err).Error("InfluxDB: Couldn't write stats")
+		return errors.Wrap(err, "InfluxDB: Couldn't write stats")
 	}
 	t := time.Since(startTime)
 	log.WithField("t", t).Debug("InfluxDB: Batch written!")
+	return nil
 }
@@ -21,7 +21,6 @@
 package json
 
 import (
-	"context"
 	"encoding/json"
 	"io"
 
@@ -31,6 +30,8 @@ import (
 	"github.com/spf13/afero"
 )
 
+// Writes samples to a file as they come in, one JSON object per line; see Envelope. It's a
+// lib.Output.
 type Collector struct {
 	outfile     io.WriteCloser
 	fname       string
@@ -60,17 +61,22 @@ func New(fname string, fs afero.Fs, opts lib.Options) (*Collector, error) {
 	}, nil
 }
 
-func (c *Collector) Init() {
-}
-
 func (c *Collector) String() string {
 	return "JSON"
 }
 
-func (c *Collector) Run(ctx context.Context) {
+func (c *Collector) Start() error {
 	log.WithField("filename", c.fname).Debug("JSON: Writing JSON metrics")
-	<-ctx.Done()
-	_ = c.outfile.Close()
+	return nil
+}
+
+// Samples are written as they're added, so there's nothing to flush.
+func (c *Collector) Flush() error {
+	return nil
+}
+
+func (c *Collector) Stop() error {
+	return c.outfile.Close()
 }
 
 func (c *Collector) HandleMetric(m *stats.Metric) {
@@ -95,7 +101,7 @@ func (c *Collector) HandleMetric(m *stats.Metric) {
 	}
 }
 
-func (c *Collector) Collect(samples []stats.Sample) {
+func (c *Collector) AddSamples(samples []stats.Sample) {
 	for _, sample := range samples {
 		c.HandleMetric(sample.Metric)
 
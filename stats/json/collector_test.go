@@ -22,9 +22,11 @@ package json
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 )
@@ -51,3 +53,29 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestCollector(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	c, err := New("/out.json", fs, lib.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var _ lib.Output = c
+
+	metric := stats.New("my_metric", stats.Counter)
+	assert.NoError(t, c.Start())
+	c.AddSamples([]stats.Sample{{Metric: metric, Value: 1}, {Metric: metric, Value: 2}})
+	assert.NoError(t, c.Flush())
+	assert.NoError(t, c.Stop())
+
+	data, err := afero.ReadFile(fs, "/out.json")
+	if assert.NoError(t, err) {
+		// The metric, followed by both of its samples.
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if assert.Len(t, lines, 3) {
+			assert.Contains(t, lines[0], `"type":"Metric"`)
+			assert.Contains(t, lines[1], `"type":"Point"`)
+			assert.Contains(t, lines[2], `"value":2`)
+		}
+	}
+}
@@ -33,16 +33,18 @@ type Envelope struct {
 }
 
 type JSONSample struct {
-	Time  time.Time         `json:"time"`
-	Value float64           `json:"value"`
-	Tags  map[string]string `json:"tags"`
+	Time     time.Time         `json:"time"`
+	Value    float64           `json:"value"`
+	Tags     map[string]string `json:"tags"`
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 func NewJSONSample(sample *stats.Sample) *JSONSample {
 	return &JSONSample{
-		Time:  sample.Time,
-		Value: sample.Value,
-		Tags:  sample.Tags,
+		Time:     sample.Time,
+		Value:    sample.Value,
+		Tags:     sample.Tags,
+		Metadata: sample.Metadata,
 	}
 }
 
@@ -45,3 +45,12 @@ func TestWrapMetricWithMetricPointer(t *testing.T) {
 	out := WrapMetric(&stats.Metric{})
 	assert.NotEqual(t, out, (*Envelope)(nil))
 }
+
+func TestWrapSampleMetadata(t *testing.T) {
+	out := WrapSample(&stats.Sample{
+		Metric:   &stats.Metric{Name: "my_metric"},
+		Tags:     map[string]string{"a": "1"},
+		Metadata: map[string]string{"trace_id": "abc"},
+	})
+	assert.Equal(t, map[string]string{"trace_id": "abc"}, out.Data.(*JSONSample).Metadata)
+}
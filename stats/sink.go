@@ -22,7 +22,10 @@ package stats
 
 import (
 	"errors"
+	"math"
+	"math/rand"
 	"sort"
+	"strconv"
 )
 
 type Sink interface {
@@ -54,9 +57,20 @@ func (g *GaugeSink) Format() map[string]float64 {
 	return map[string]float64{"value": g.Value}
 }
 
+// Percentiles calculated by a TrendSink unless configured otherwise.
+var DefaultTrendPercentiles = []float64{90, 95, 99}
+
+// Maximum number of values a TrendSink holds on to. Past this point, it keeps a uniformly
+// distributed random sample of everything it's seen (reservoir sampling), so memory use stays
+// bounded no matter how long a test runs, while percentiles remain a close estimate.
+const MaxTrendValues = 100000
+
 type TrendSink struct {
 	Values []float64
 
+	// Percentiles to report in Format(), eg. 99.9 for "p99.9"; nil for the defaults.
+	Percentiles []float64
+
 	jumbled  bool
 	count    uint64
 	min, max float64
@@ -65,9 +79,14 @@ type TrendSink struct {
 }
 
 func (t *TrendSink) Add(s Sample) {
-	t.Values = append(t.Values, s.Value)
-	t.jumbled = true
 	t.count += 1
+	if len(t.Values) < MaxTrendValues {
+		t.Values = append(t.Values, s.Value)
+		t.jumbled = true
+	} else if i := rand.Int63n(int64(t.count)); i < MaxTrendValues {
+		t.Values[i] = s.Value
+		t.jumbled = true
+	}
 	t.sum += s.Value
 	t.avg = t.sum / float64(t.count)
 
@@ -79,8 +98,15 @@ func (t *TrendSink) Add(s Sample) {
 	}
 }
 
+// Returns the total number of values added, which may be more than are retained in Values.
+func (t *TrendSink) Count() uint64 {
+	return t.count
+}
+
 func (t *TrendSink) P(pct float64) float64 {
-	switch t.count {
+	t.sort()
+
+	switch len(t.Values) {
 	case 0:
 		return 0
 	case 1:
@@ -92,29 +118,183 @@ func (t *TrendSink) P(pct float64) float64 {
 			return t.Values[1]
 		}
 	default:
-		return t.Values[int(float64(t.count)*pct)]
+		i := int(float64(len(t.Values)) * pct)
+		if i >= len(t.Values) {
+			i = len(t.Values) - 1
+		}
+		return t.Values[i]
+	}
+}
+
+func (t *TrendSink) sort() {
+	if !t.jumbled {
+		return
+	}
+	sort.Float64s(t.Values)
+	t.jumbled = false
+
+	n := len(t.Values)
+	t.med = t.Values[n/2]
+	if (n & 0x01) == 0 {
+		t.med = (t.med + t.Values[(n/2)-1]) / 2
 	}
 }
 
 func (t *TrendSink) Format() map[string]float64 {
-	if t.jumbled {
-		sort.Float64s(t.Values)
-		t.jumbled = false
+	t.sort()
 
-		t.med = t.Values[t.count/2]
-		if (t.count & 0x01) == 0 {
-			t.med = (t.med + t.Values[(t.count/2)-1]) / 2
-		}
+	percentiles := t.Percentiles
+	if percentiles == nil {
+		percentiles = DefaultTrendPercentiles
 	}
 
-	return map[string]float64{
+	res := map[string]float64{
 		"min": t.min,
 		"max": t.max,
 		"avg": t.avg,
 		"med": t.med,
-		"p90": t.P(0.90),
-		"p95": t.P(0.95),
 	}
+	for _, p := range percentiles {
+		res["p"+strconv.FormatFloat(p, 'f', -1, 64)] = t.P(p / 100)
+	}
+	return res
+}
+
+// A Sink that can estimate percentiles; pct is a fraction, eg. 0.95 for the 95th percentile.
+type PercentileSink interface {
+	Sink
+	P(pct float64) float64
+}
+
+// Relative error of the percentiles reported by a HistogramSink.
+const HistogramAccuracy = 0.01
+
+var histogramLogGamma = math.Log((1 + HistogramAccuracy) / (1 - HistogramAccuracy))
+
+// A HistogramSink is an alternative to TrendSink, which counts values into logarithmically sized
+// buckets instead of keeping them around. Memory use depends only on the range of values seen, not
+// their number, at the cost of percentiles being off by up to HistogramAccuracy (relative).
+type HistogramSink struct {
+	// Percentiles to report in Format(), eg. 99.9 for "p99.9"; nil for the defaults.
+	Percentiles []float64
+
+	count    uint64
+	min, max float64
+	sum      float64
+
+	// Bucket i holds values in (gamma^(i-1), gamma^i]; negative values are bucketed by magnitude.
+	positive map[int]uint64
+	negative map[int]uint64
+	zeros    uint64
+}
+
+func histogramIndex(v float64) int {
+	return int(math.Ceil(math.Log(v) / histogramLogGamma))
+}
+
+// Returns the value a bucket stands for; the one with the smallest relative error to its bounds.
+func histogramValue(i int) float64 {
+	gamma := math.Exp(histogramLogGamma)
+	return 2 * math.Exp(float64(i)*histogramLogGamma) / (gamma + 1)
+}
+
+func (h *HistogramSink) Add(s Sample) {
+	if h.count == 0 || s.Value < h.min {
+		h.min = s.Value
+	}
+	if h.count == 0 || s.Value > h.max {
+		h.max = s.Value
+	}
+	h.count++
+	h.sum += s.Value
+
+	switch {
+	case s.Value > 0:
+		if h.positive == nil {
+			h.positive = make(map[int]uint64)
+		}
+		h.positive[histogramIndex(s.Value)]++
+	case s.Value < 0:
+		if h.negative == nil {
+			h.negative = make(map[int]uint64)
+		}
+		h.negative[histogramIndex(-s.Value)]++
+	default:
+		h.zeros++
+	}
+}
+
+// Returns the total number of values added.
+func (h *HistogramSink) Count() uint64 {
+	return h.count
+}
+
+func (h *HistogramSink) P(pct float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	// Same rank as TrendSink.P() would pick from the sorted values.
+	rank := uint64(float64(h.count) * pct)
+	if rank >= h.count {
+		rank = h.count - 1
+	}
+
+	var seen uint64
+	for _, i := range sortedBuckets(h.negative, true) {
+		if seen += h.negative[i]; seen > rank {
+			return h.clamp(-histogramValue(i))
+		}
+	}
+	if seen += h.zeros; seen > rank {
+		return 0
+	}
+	for _, i := range sortedBuckets(h.positive, false) {
+		if seen += h.positive[i]; seen > rank {
+			return h.clamp(histogramValue(i))
+		}
+	}
+	return h.max
+}
+
+// Estimates never fall outside of the values actually seen.
+func (h *HistogramSink) clamp(v float64) float64 {
+	return math.Min(math.Max(v, h.min), h.max)
+}
+
+func sortedBuckets(buckets map[int]uint64, reverse bool) []int {
+	keys := make([]int, 0, len(buckets))
+	for i := range buckets {
+		keys = append(keys, i)
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+	} else {
+		sort.Ints(keys)
+	}
+	return keys
+}
+
+func (h *HistogramSink) Format() map[string]float64 {
+	percentiles := h.Percentiles
+	if percentiles == nil {
+		percentiles = DefaultTrendPercentiles
+	}
+
+	var avg float64
+	if h.count > 0 {
+		avg = h.sum / float64(h.count)
+	}
+	res := map[string]float64{
+		"min": h.min,
+		"max": h.max,
+		"avg": avg,
+		"med": h.P(0.5),
+	}
+	for _, p := range percentiles {
+		res["p"+strconv.FormatFloat(p, 'f', -1, 64)] = h.P(p / 100)
+	}
+	return res
 }
 
 type RateSink struct {
@@ -21,6 +21,9 @@
 package stats
 
 import (
+	"math"
+	"math/rand"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -35,3 +38,133 @@ func TestDummySinkAddPanics(t *testing.T) {
 func TestDummySinkFormatReturnsItself(t *testing.T) {
 	assert.Equal(t, map[string]float64{"a": 1}, DummySink{"a": 1}.Format())
 }
+
+func TestTrendSink(t *testing.T) {
+	t.Run("Format", func(t *testing.T) {
+		sink := &TrendSink{}
+		for i := 1; i <= 100; i++ {
+			sink.Add(Sample{Value: float64(i)})
+		}
+		assert.Equal(t, map[string]float64{
+			"min": 1,
+			"max": 100,
+			"avg": 50.5,
+			"med": 50.5,
+			"p90": 91,
+			"p95": 96,
+			"p99": 100,
+		}, sink.Format())
+
+		t.Run("Percentiles", func(t *testing.T) {
+			sink.Percentiles = []float64{50, 99.9}
+			assert.Equal(t, map[string]float64{
+				"min":   1,
+				"max":   100,
+				"avg":   50.5,
+				"med":   50.5,
+				"p50":   51,
+				"p99.9": 100,
+			}, sink.Format())
+		})
+	})
+	t.Run("Bounded", func(t *testing.T) {
+		sink := &TrendSink{}
+		n := MaxTrendValues * 3
+		for i := 0; i < n; i++ {
+			sink.Add(Sample{Value: float64(i)})
+		}
+		assert.Equal(t, uint64(n), sink.Count())
+		assert.Len(t, sink.Values, MaxTrendValues)
+		assert.Equal(t, float64(n-1), sink.max)
+		assert.InEpsilon(t, float64(n)*0.5, sink.P(0.5), 0.05)
+		assert.InEpsilon(t, float64(n)*0.95, sink.P(0.95), 0.05)
+	})
+}
+
+func TestHistogramSink(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		sink := &HistogramSink{}
+		assert.Equal(t, 0.0, sink.P(0.5))
+		assert.Equal(t, map[string]float64{
+			"min": 0,
+			"max": 0,
+			"avg": 0,
+			"med": 0,
+			"p90": 0,
+			"p95": 0,
+			"p99": 0,
+		}, sink.Format())
+	})
+	t.Run("Format", func(t *testing.T) {
+		sink := &HistogramSink{Percentiles: []float64{50, 99.9}}
+		for i := 1; i <= 100; i++ {
+			sink.Add(Sample{Value: float64(i)})
+		}
+		assert.Equal(t, uint64(100), sink.Count())
+
+		res := sink.Format()
+		assert.Equal(t, 1.0, res["min"])
+		assert.Equal(t, 100.0, res["max"])
+		assert.Equal(t, 50.5, res["avg"])
+		assert.InEpsilon(t, 51, res["med"], HistogramAccuracy)
+		assert.InEpsilon(t, 51, res["p50"], HistogramAccuracy)
+		assert.InEpsilon(t, 100, res["p99.9"], HistogramAccuracy)
+	})
+
+	// Percentiles are compared to the exact ones TrendSink would report, on distributions with
+	// zeroes, negative values and long tails, respectively.
+	distributions := map[string]func(r *rand.Rand) float64{
+		"Uniform":     func(r *rand.Rand) float64 { return math.Floor(r.Float64() * 1000) },
+		"Normal":      func(r *rand.Rand) float64 { return r.NormFloat64()*50 + 10 },
+		"Exponential": func(r *rand.Rand) float64 { return r.ExpFloat64() * 200 },
+		"LogNormal":   func(r *rand.Rand) float64 { return math.Exp(r.NormFloat64()*2 + 3) },
+	}
+	for name, fn := range distributions {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			sink := &HistogramSink{}
+			values := make([]float64, 100000)
+			for i := range values {
+				values[i] = fn(r)
+				sink.Add(Sample{Value: values[i]})
+			}
+			sort.Float64s(values)
+
+			for _, pct := range []float64{0, 0.1, 0.5, 0.9, 0.95, 0.99, 0.999, 1} {
+				i := int(float64(len(values)) * pct)
+				if i >= len(values) {
+					i = len(values) - 1
+				}
+				exact, estimate := values[i], sink.P(pct)
+				assert.InDelta(t, exact, estimate, math.Abs(exact)*HistogramAccuracy+1e-9, "p%v", pct*100)
+			}
+		})
+	}
+}
+
+func benchmarkSink(b *testing.B, newSink func() Sink) {
+	r := rand.New(rand.NewSource(1))
+	values := make([]float64, 1000000)
+	for i := range values {
+		values[i] = r.ExpFloat64() * 200
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sink := newSink()
+		for _, v := range values {
+			sink.Add(Sample{Value: v})
+		}
+		sink.Format()
+	}
+}
+
+// Both fed 1M samples per op; compare allocated bytes.
+func BenchmarkTrendSink(b *testing.B) {
+	benchmarkSink(b, func() Sink { return &TrendSink{} })
+}
+
+func BenchmarkHistogramSink(b *testing.B) {
+	benchmarkSink(b, func() Sink { return &HistogramSink{} })
+}
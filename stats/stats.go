@@ -167,6 +167,10 @@ type Sample struct {
 	Time   time.Time
 	Tags   map[string]string
 	Value  float64
+
+	// Values that identify a single sample rather than a group of them, eg. a trace ID; they're
+	// passed on to outputs, but unlike tags, never used to aggregate or filter.
+	Metadata map[string]string
 }
 
 // A Metric defines the shape of a set of data.
@@ -235,29 +239,60 @@ type Submetric struct {
 	Metric *Metric           `json:"metric"`
 }
 
-// Creates a submetric from a name.
+// Creates a submetric from a name, eg. `http_req_duration{name:login}`, which matches samples with
+// all the given tags. Values containing commas, colons or leading or trailing spaces may be
+// quoted, eg. `{name:"a, b"}`.
 func NewSubmetric(name string) (parentName string, sm Submetric) {
 	parts := strings.SplitN(strings.TrimSuffix(name, "}"), "{", 2)
 	if len(parts) == 1 {
 		return parts[0], Submetric{Name: name}
 	}
 
-	kvs := strings.Split(parts[1], ",")
+	kvs := splitUnquoted(parts[1], ',', -1)
 	tags := make(map[string]string, len(kvs))
 	for _, kv := range kvs {
-		if kv == "" {
+		if strings.TrimSpace(kv) == "" {
 			continue
 		}
-		parts := strings.SplitN(kv, ":", 2)
+		parts := splitUnquoted(kv, ':', 2)
 
-		key := strings.TrimSpace(strings.Trim(parts[0], `"'`))
+		key := unquote(parts[0])
 		if len(parts) != 2 {
 			tags[key] = ""
 			continue
 		}
-
-		value := strings.TrimSpace(strings.Trim(parts[1], `"'`))
-		tags[key] = value
+		tags[key] = unquote(parts[1])
 	}
 	return parts[0], Submetric{Name: name, Tags: tags}
 }
+
+// Splits s around sep, like strings.SplitN, except where sep is inside quotes (" or ').
+func splitUnquoted(s string, sep rune, n int) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, c := range s {
+		switch {
+		case n > 0 && len(parts) == n-1:
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Trims spaces around s, then a pair of quotes, if it's quoted.
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
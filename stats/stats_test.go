@@ -158,6 +158,13 @@ func TestNewSubmetric(t *testing.T) {
 		"my_metric{a,b}":            {"my_metric", map[string]string{"a": "", "b": ""}},
 		"my_metric{a:1,b:2}":        {"my_metric", map[string]string{"a": "1", "b": "2"}},
 		"my_metric{ a : 1, b : 2 }": {"my_metric", map[string]string{"a": "1", "b": "2"}},
+
+		"my_metric{group:::checkout}":         {"my_metric", map[string]string{"group": "::checkout"}},
+		"my_metric{url:http://example.com/}":  {"my_metric", map[string]string{"url": "http://example.com/"}},
+		`my_metric{name:"a, b:c"}`:            {"my_metric", map[string]string{"name": "a, b:c"}},
+		`my_metric{name:' padded ', "x":"y"}`: {"my_metric", map[string]string{"name": " padded ", "x": "y"}},
+		`my_metric{name:login page}`:          {"my_metric", map[string]string{"name": "login page"}},
+		`my_metric{"a:b":"c,d",e:f}`:          {"my_metric", map[string]string{"a:b": "c,d", "e": "f"}},
 	}
 
 	for name, data := range testdata {
@@ -0,0 +1,332 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+// The flavour of StatsD spoken.
+type Dialect int
+
+const (
+	// Plain StatsD has no tags; they're flattened into metric names instead.
+	StatsD Dialect = iota
+
+	// DogStatsD, as understood by the Datadog agent, with native tags.
+	DogStatsD
+)
+
+const (
+	DefaultAddr          = "localhost:8125"
+	DefaultBufferSize    = 10000
+	DefaultFlushInterval = 1 * time.Second
+
+	// Keeps packets within a typical MTU, so they aren't fragmented.
+	MaxPacketSize = 1432
+)
+
+type Config struct {
+	Dialect Dialect
+
+	// Address of the StatsD server or Datadog agent.
+	Addr string
+
+	// Prepended verbatim to all metric names, eg. "k6.".
+	Namespace string
+
+	// Samples waiting to be sent; if this fills up, further samples are dropped rather than
+	// holding up the test.
+	BufferSize int
+
+	// How often buffered samples are sent.
+	FlushInterval time.Duration
+}
+
+// Parses an output string in the form "addr?namespace=k6.&buffer_size=10000&flush_interval=1s";
+// everything is optional.
+func ParseConfig(s string) (Config, error) {
+	conf := Config{
+		Addr:          DefaultAddr,
+		BufferSize:    DefaultBufferSize,
+		FlushInterval: DefaultFlushInterval,
+	}
+
+	addr, query := s, ""
+	if i := strings.IndexByte(s, '?'); i != -1 {
+		addr, query = s[:i], s[i+1:]
+	}
+	if addr != "" {
+		conf.Addr = addr
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return conf, err
+	}
+	for k, vs := range q {
+		v := vs[len(vs)-1]
+		switch k {
+		case "namespace":
+			conf.Namespace = v
+		case "buffer_size":
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return conf, fmt.Errorf("statsd output: invalid buffer_size: %s", v)
+			}
+			conf.BufferSize = n
+		case "flush_interval":
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return conf, fmt.Errorf("statsd output: invalid flush_interval: %s", v)
+			}
+			conf.FlushInterval = d
+		default:
+			return conf, fmt.Errorf("statsd output: unknown option: %s", k)
+		}
+	}
+	return conf, nil
+}
+
+// Streams samples to StatsD over UDP. Trends are sent as timings, counters as counts and gauges
+// as gauges; rates are aggregated over each flush interval and sent as gauges of the ratio.
+type Collector struct {
+	Config Config
+
+	conn    net.Conn
+	samples chan stats.Sample
+	dropped int64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func New(s string, dialect Dialect, opts lib.Options) (*Collector, error) {
+	conf, err := ParseConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	conf.Dialect = dialect
+
+	conn, err := net.Dial("udp", conf.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Collector{
+		Config:  conf,
+		conn:    conn,
+		samples: make(chan stats.Sample, conf.BufferSize),
+	}, nil
+}
+
+func (c *Collector) String() string {
+	if c.Config.Dialect == DogStatsD {
+		return fmt.Sprintf("datadog (%s)", c.Config.Addr)
+	}
+	return fmt.Sprintf("statsd (%s)", c.Config.Addr)
+}
+
+// Returns the number of samples dropped because the buffer was full.
+func (c *Collector) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
+
+func (c *Collector) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		c.run(ctx)
+	}()
+	return nil
+}
+
+// Buffered samples are sent every Config.FlushInterval by the collector's own loop, which
+// also keeps packets together per interval; there's nothing to do here.
+func (c *Collector) Flush() error {
+	return nil
+}
+
+// Sends whatever's still buffered and closes the connection.
+func (c *Collector) Stop() error {
+	c.cancel()
+	<-c.done
+	return nil
+}
+
+func (c *Collector) run(ctx context.Context) {
+	log.WithField("addr", c.Config.Addr).Debug("StatsD: Running!")
+	ticker := time.NewTicker(c.Config.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []stats.Sample
+	for {
+		select {
+		case sample := <-c.samples:
+			batch = append(batch, sample)
+		case <-ticker.C:
+			c.flush(batch)
+			batch = nil
+		case <-ctx.Done():
+			for len(c.samples) > 0 {
+				batch = append(batch, <-c.samples)
+			}
+			c.flush(batch)
+			if n := c.Dropped(); n > 0 {
+				log.WithField("samples", n).Warn("StatsD: Buffer was full, some samples were dropped")
+			}
+			_ = c.conn.Close()
+			return
+		}
+	}
+}
+
+// Never blocks; samples that don't fit in the buffer are dropped and counted.
+func (c *Collector) AddSamples(samples []stats.Sample) {
+	for _, sample := range samples {
+		select {
+		case c.samples <- sample:
+		default:
+			atomic.AddInt64(&c.dropped, 1)
+		}
+	}
+}
+
+// A rate's samples over a flush interval.
+type rateAggregate struct {
+	name, tags  string
+	hits, total int64
+}
+
+func (c *Collector) flush(samples []stats.Sample) {
+	if len(samples) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	var rates []*rateAggregate
+	rateIndex := make(map[string]*rateAggregate)
+	for _, sample := range samples {
+		name, tags := c.name(sample.Metric.Name, sample.Tags)
+		switch sample.Metric.Type {
+		case stats.Rate:
+			key := name + tags
+			agg, ok := rateIndex[key]
+			if !ok {
+				agg = &rateAggregate{name: name, tags: tags}
+				rateIndex[key] = agg
+				rates = append(rates, agg)
+			}
+			agg.total++
+			if sample.Value != 0 {
+				agg.hits++
+			}
+		case stats.Counter:
+			c.write(&buf, name, sample.Value, "c", tags)
+		case stats.Gauge:
+			c.write(&buf, name, sample.Value, "g", tags)
+		case stats.Trend:
+			c.write(&buf, name, sample.Value, "ms", tags)
+		}
+	}
+	for _, agg := range rates {
+		c.write(&buf, agg.name, float64(agg.hits)/float64(agg.total), "g", agg.tags)
+	}
+	c.send(&buf)
+}
+
+// Returns a metric's full name and, for DogStatsD, its tag suffix.
+func (c *Collector) name(name string, tags map[string]string) (string, string) {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	if c.Config.Dialect == DogStatsD {
+		if len(keys) == 0 {
+			return c.Config.Namespace + name, ""
+		}
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = dogTagReplacer.Replace(k) + ":" + dogTagReplacer.Replace(tags[k])
+		}
+		return c.Config.Namespace + name, "|#" + strings.Join(parts, ",")
+	}
+
+	full := c.Config.Namespace + name
+	for _, k := range keys {
+		full += "." + sanitizeName(k) + "." + sanitizeName(tags[k])
+	}
+	return full, ""
+}
+
+// Characters that would break DogStatsD's tag syntax.
+var dogTagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_", " ", "_")
+
+// Flattened tags become parts of a dotted name, so anything but [a-zA-Z0-9_-] goes.
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// Appends a line to the packet, sending it first if the line wouldn't fit.
+func (c *Collector) write(buf *bytes.Buffer, name string, value float64, typ, tags string) {
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + typ + tags
+	if buf.Len() > 0 && buf.Len()+1+len(line) > MaxPacketSize {
+		c.send(buf)
+	}
+	if buf.Len() > 0 {
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(line)
+}
+
+func (c *Collector) send(buf *bytes.Buffer) {
+	if buf.Len() == 0 {
+		return
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		log.WithError(err).Debug("StatsD: Couldn't send packet")
+	}
+	buf.Reset()
+}
@@ -0,0 +1,143 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package statsd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	testdata := map[string]struct {
+		conf Config
+		err  string
+	}{
+		"": {Config{Addr: DefaultAddr, BufferSize: DefaultBufferSize, FlushInterval: DefaultFlushInterval}, ""},
+		"10.0.0.1:9125?namespace=k6.&buffer_size=10&flush_interval=100ms": {
+			Config{Addr: "10.0.0.1:9125", Namespace: "k6.", BufferSize: 10, FlushInterval: 100 * time.Millisecond}, "",
+		},
+		"?buffer_size=0":      {Config{}, "statsd output: invalid buffer_size: 0"},
+		"?flush_interval=1":   {Config{}, "statsd output: invalid flush_interval: 1"},
+		"?nope=1":             {Config{}, "statsd output: unknown option: nope"},
+		"localhost:8125?a=%%": {Config{}, `invalid URL escape "%%"`},
+	}
+	for s, data := range testdata {
+		t.Run(s, func(t *testing.T) {
+			conf, err := ParseConfig(s)
+			if data.err != "" {
+				assert.EqualError(t, err, data.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, data.conf, conf)
+		})
+	}
+}
+
+// Runs a collector against a local UDP listener, and returns every line it received.
+func collect(t *testing.T, dialect Dialect, samples []stats.Sample) []string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer func() { _ = pc.Close() }()
+
+	c, err := New(pc.LocalAddr().String()+"?namespace=k6.&flush_interval=1h", dialect, lib.Options{})
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	var _ lib.Output = c
+	assert.NoError(t, c.Start())
+	c.AddSamples(samples)
+	assert.NoError(t, c.Flush())
+	assert.NoError(t, c.Stop())
+
+	var lines []string
+	buf := make([]byte, MaxPacketSize)
+	for {
+		_ = pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		assert.True(t, n <= MaxPacketSize)
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestCollector(t *testing.T) {
+	tags := map[string]string{"status": "200", "url": "http://example.com/a,b"}
+	samples := []stats.Sample{
+		{Metric: stats.New("reqs", stats.Counter), Tags: tags, Value: 1},
+		{Metric: stats.New("vus", stats.Gauge), Value: 10},
+		{Metric: stats.New("duration", stats.Trend, stats.Time), Tags: tags, Value: 12.5},
+		{Metric: stats.New("checks", stats.Rate), Value: 1},
+		{Metric: stats.New("checks", stats.Rate), Value: 0},
+		{Metric: stats.New("checks", stats.Rate), Value: 1},
+		{Metric: stats.New("checks", stats.Rate), Value: 1},
+	}
+
+	t.Run("StatsD", func(t *testing.T) {
+		assert.Equal(t, []string{
+			"k6.checks:0.75|g",
+			"k6.duration.status.200.url.http___example_com_a_b:12.5|ms",
+			"k6.reqs.status.200.url.http___example_com_a_b:1|c",
+			"k6.vus:10|g",
+		}, collect(t, StatsD, samples))
+	})
+	t.Run("DogStatsD", func(t *testing.T) {
+		assert.Equal(t, []string{
+			"k6.checks:0.75|g",
+			"k6.duration:12.5|ms|#status:200,url:http://example.com/a_b",
+			"k6.reqs:1|c|#status:200,url:http://example.com/a_b",
+			"k6.vus:10|g",
+		}, collect(t, DogStatsD, samples))
+	})
+	t.Run("Packets", func(t *testing.T) {
+		metric := stats.New("a_rather_long_metric_name_to_fill_up_packets", stats.Counter)
+		samples := make([]stats.Sample, 200)
+		for i := range samples {
+			samples[i] = stats.Sample{Metric: metric, Value: 1}
+		}
+		assert.Len(t, collect(t, StatsD, samples), 200)
+	})
+}
+
+func TestCollectorDrops(t *testing.T) {
+	c, err := New("127.0.0.1:8125?buffer_size=2", StatsD, lib.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = c.conn.Close() }()
+
+	metric := stats.New("my_metric", stats.Counter)
+	c.AddSamples([]stats.Sample{{Metric: metric, Value: 1}, {Metric: metric, Value: 2}, {Metric: metric, Value: 3}})
+	assert.Equal(t, int64(1), c.Dropped())
+}
@@ -21,6 +21,7 @@
 package main
 
 import (
+	"encoding/json"
 	"os"
 	"strconv"
 	"strings"
@@ -28,6 +29,7 @@ import (
 
 	"github.com/ghodss/yaml"
 	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
 	"gopkg.in/guregu/null.v3"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -43,6 +45,17 @@ func dumpYAML(v interface{}) error {
 	return nil
 }
 
+func dumpJSON(v interface{}) error {
+	bytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stdout.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
 // cliBool returns a CLI argument as a bool, which is invalid if not given.
 func cliBool(cc *cli.Context, name string) null.Bool {
 	return null.NewBool(cc.Bool(name), cc.IsSet(name))
@@ -53,6 +66,11 @@ func cliInt64(cc *cli.Context, name string) null.Int {
 	return null.NewInt(cc.Int64(name), cc.IsSet(name))
 }
 
+// cliString returns a CLI argument as a string, which is invalid if not given.
+func cliString(cc *cli.Context, name string) null.String {
+	return null.NewString(cc.String(name), cc.IsSet(name))
+}
+
 // cliDuration returns a CLI argument as a duration string, which is invalid if not given.
 func cliDuration(cc *cli.Context, name string) null.String {
 	return null.NewString(cc.Duration(name).String(), cc.IsSet(name))
@@ -82,3 +100,21 @@ func ParseStage(s string) (lib.Stage, error) {
 	}
 	return stage, nil
 }
+
+// Parses a "vu:iteration:seed" triplet, as printed for failed iterations, for --replay.
+func ParseReplay(s string) (id, iteration, seed int64, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, 0, 0, errors.New("replay must be in the form vu:iteration:seed")
+	}
+	if id, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return 0, 0, 0, err
+	}
+	if iteration, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return 0, 0, 0, err
+	}
+	if seed, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return 0, 0, 0, err
+	}
+	return id, iteration, seed, nil
+}
@@ -46,3 +46,18 @@ func TestParseStage(t *testing.T) {
 		})
 	}
 }
+
+func TestParseReplay(t *testing.T) {
+	id, iteration, seed, err := ParseReplay("57:48213:-1234")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(57), id)
+	assert.Equal(t, int64(48213), iteration)
+	assert.Equal(t, int64(-1234), seed)
+
+	for _, s := range []string{"", "57", "57:48213", "a:1:2", "1:2:3:4"} {
+		t.Run(s, func(t *testing.T) {
+			_, _, _, err := ParseReplay(s)
+			assert.Error(t, err)
+		})
+	}
+}